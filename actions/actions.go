@@ -0,0 +1,200 @@
+// Package actions is the registry of the action types the config and the
+// admin API instantiate by name. The action packages register their types
+// when imported, e.g.
+//
+//	import _ "ilya.app/feedtrigger/actions/discord"
+//
+// and applications add their own with Register.
+package actions
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ilya.app/feedtrigger"
+)
+
+// Params are the parameters an action is instantiated with, as decoded
+// from JSON.
+type Params map[string]interface{}
+
+// String returns the string parameter, empty if missing.
+func (p Params) String(name string) string {
+	s, _ := p[name].(string)
+	return s
+}
+
+// Bool returns the bool parameter, false if missing.
+func (p Params) Bool(name string) bool {
+	b, _ := p[name].(bool)
+	return b
+}
+
+// Number returns the number parameter, zero if missing.
+func (p Params) Number(name string) float64 {
+	switch n := p[name].(type) {
+	case float64:
+		return n
+	case int:
+		return float64(n)
+	}
+	return 0
+}
+
+// Duration returns the duration parameter, e.g. "30s", zero if missing.
+func (p Params) Duration(name string) time.Duration {
+	d, _ := time.ParseDuration(p.String(name))
+	return d
+}
+
+// Strings returns the string list parameter, nil if missing.
+func (p Params) Strings(name string) []string {
+	switch v := p[name].(type) {
+	case []string:
+		return v
+	case []interface{}:
+		s := make([]string, 0, len(v))
+		for _, e := range v {
+			if str, ok := e.(string); ok {
+				s = append(s, str)
+			}
+		}
+		return s
+	}
+	return nil
+}
+
+// Factory instantiates an action from the parameters validated against its
+// schema.
+type Factory func(Params) (feedtrigger.NewItemAction, error)
+
+type actionType struct {
+	factory Factory
+	params  []feedtrigger.ActionParam
+}
+
+var (
+	mu    sync.RWMutex
+	types = make(map[string]actionType)
+)
+
+// Registry instantiates the registered action types, see
+// feedtrigger.ActionRegistry.
+var Registry feedtrigger.ActionRegistry = registry{}
+
+// Register makes the action type available by name with the parameter
+// schema. It panics if the name is registered already.
+func Register(name string, factory Factory, params ...feedtrigger.ActionParam) {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, dup := types[name]; dup {
+		panic("actions: Register called twice for " + name)
+	}
+	types[name] = actionType{factory: factory, params: params}
+}
+
+// New instantiates an action of the registered type.
+func New(typ string, params Params) (feedtrigger.NewItemAction, error) {
+	mu.RLock()
+	t, ok := types[typ]
+	mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown action type %q", typ)
+	}
+	if err := validate(t.params, params); err != nil {
+		return nil, fmt.Errorf("%s: %w", typ, err)
+	}
+	action, err := t.factory(params)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", typ, err)
+	}
+	return action, nil
+}
+
+// Types returns the registered action types, sorted by name.
+func Types() []feedtrigger.ActionType {
+	mu.RLock()
+	defer mu.RUnlock()
+	list := make([]feedtrigger.ActionType, 0, len(types))
+	for name, t := range types {
+		list = append(list, feedtrigger.ActionType{Name: name, Params: t.params})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// validate checks the parameters against the schema.
+func validate(schema []feedtrigger.ActionParam, params Params) error {
+	known := make(map[string]bool, len(schema))
+	for _, s := range schema {
+		known[s.Name] = true
+		v, ok := params[s.Name]
+		if !ok {
+			if s.Required {
+				return fmt.Errorf("missing parameter %s", s.Name)
+			}
+			continue
+		}
+		valid := false
+		switch s.Type {
+		case feedtrigger.ParamString:
+			_, valid = v.(string)
+		case feedtrigger.ParamNumber:
+			switch v.(type) {
+			case float64, int:
+				valid = true
+			}
+		case feedtrigger.ParamBool:
+			_, valid = v.(bool)
+		case feedtrigger.ParamDuration:
+			if str, ok := v.(string); ok {
+				_, err := time.ParseDuration(str)
+				valid = err == nil
+			}
+		case feedtrigger.ParamStrings:
+			valid = len(params.Strings(s.Name)) == lenOf(v)
+		}
+		if !valid {
+			return fmt.Errorf("parameter %s: want %s, got %T", s.Name, s.Type, v)
+		}
+	}
+	var unknown []string
+	for name := range params {
+		if !known[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return fmt.Errorf("unknown parameters %s", strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// lenOf returns the length of the list parameter, -1 if it isn't a list.
+func lenOf(v interface{}) int {
+	switch l := v.(type) {
+	case []string:
+		return len(l)
+	case []interface{}:
+		return len(l)
+	}
+	return -1
+}
+
+type registry struct{}
+
+func (registry) Types() []feedtrigger.ActionType { return Types() }
+
+func (registry) New(typ string, params map[string]interface{}) (feedtrigger.NewItemAction, error) {
+	return New(typ, params)
+}
+
+func init() {
+	Register("log", func(Params) (feedtrigger.NewItemAction, error) {
+		return feedtrigger.LogAuthorAndLink, nil
+	})
+}
@@ -0,0 +1,230 @@
+// Package discord posts feed items to a Discord channel webhook.
+package discord
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+	"ilya.app/feedtrigger/actions"
+	"ilya.app/feedtrigger/render"
+)
+
+// Discord limits.
+const (
+	maxTitle       = 256
+	maxDescription = 4096
+	maxEmbedsChars = 6000
+	maxEmbeds      = 10
+	maxRetries     = 5
+)
+
+// Embed is a Discord rich embed.
+type Embed struct {
+	Title       string     `json:"title,omitempty"`
+	Description string     `json:"description,omitempty"`
+	URL         string     `json:"url,omitempty"`
+	Timestamp   string     `json:"timestamp,omitempty"`
+	Author      *Author    `json:"author,omitempty"`
+	Thumbnail   *Thumbnail `json:"thumbnail,omitempty"`
+}
+
+// Author is the embed author.
+type Author struct {
+	Name string `json:"name"`
+}
+
+// Thumbnail is the embed thumbnail.
+type Thumbnail struct {
+	URL string `json:"url"`
+}
+
+// Webhook posts to a Discord webhook, waiting out its rate limits.
+type Webhook struct {
+	URL string
+	// Username overrides the webhook name.
+	Username string
+	// Template renders the embed description instead of the item one.
+	Template *render.Template
+
+	mu sync.Mutex
+	// wait is when the rate limit bucket resets after being emptied.
+	wait time.Time
+}
+
+// Action posts every new item as an embed to the webhook.
+func Action(webhookURL string) feedtrigger.NewItemAction {
+	w := &Webhook{URL: webhookURL}
+	return w.Post
+}
+
+func init() {
+	actions.Register("discord", func(p actions.Params) (feedtrigger.NewItemAction, error) {
+		return Action(p.String("webhook")), nil
+	}, feedtrigger.ActionParam{Name: "webhook", Type: feedtrigger.ParamString, Required: true, Doc: "channel webhook URL"})
+}
+
+// Post sends the item as one or more embeds: descriptions over the Discord
+// limit are continued in following embeds and messages.
+func (w *Webhook) Post(i *gofeed.Item) error {
+	if w.Template != nil {
+		description, err := w.Template.Render(i)
+		if err != nil {
+			return fmt.Errorf("rendering message: %w", err)
+		}
+		c := *i
+		c.Description = description
+		i = &c
+	}
+	for _, embeds := range messages(Embeds(i)) {
+		if err := w.send(embeds); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Embeds returns the embeds of the item, more than one if the description
+// doesn't fit.
+func Embeds(i *gofeed.Item) []Embed {
+	first := Embed{
+		Title: truncate(i.Title, maxTitle),
+		URL:   i.Link,
+	}
+	if i.Author != nil && i.Author.Name != "" {
+		first.Author = &Author{Name: truncate(i.Author.Name, maxTitle)}
+	}
+	if icon := i.Custom[feedtrigger.IconKey]; icon != "" {
+		first.Thumbnail = &Thumbnail{URL: icon}
+	}
+	switch {
+	case i.PublishedParsed != nil:
+		first.Timestamp = i.PublishedParsed.UTC().Format(time.RFC3339)
+	case i.UpdatedParsed != nil:
+		first.Timestamp = i.UpdatedParsed.UTC().Format(time.RFC3339)
+	}
+
+	chunks := split(i.Description, maxDescription)
+	if len(chunks) == 0 {
+		return []Embed{first}
+	}
+	first.Description = chunks[0]
+	embeds := []Embed{first}
+	for _, c := range chunks[1:] {
+		embeds = append(embeds, Embed{Description: c})
+	}
+	return embeds
+}
+
+// messages groups embeds into messages within the Discord limits.
+func messages(embeds []Embed) [][]Embed {
+	var (
+		out   [][]Embed
+		cur   []Embed
+		chars int
+	)
+	for _, e := range embeds {
+		n := utf8.RuneCountInString(e.Title) + utf8.RuneCountInString(e.Description)
+		if e.Author != nil {
+			n += utf8.RuneCountInString(e.Author.Name)
+		}
+		if len(cur) > 0 && (len(cur) == maxEmbeds || chars+n > maxEmbedsChars) {
+			out = append(out, cur)
+			cur, chars = nil, 0
+		}
+		cur = append(cur, e)
+		chars += n
+	}
+	if len(cur) > 0 {
+		out = append(out, cur)
+	}
+	return out
+}
+
+// send posts a message, retrying when rate limited.
+func (w *Webhook) send(embeds []Embed) error {
+	body, err := json.Marshal(map[string]interface{}{
+		"username": w.Username,
+		"embeds":   embeds,
+	})
+	if err != nil {
+		return fmt.Errorf("encoding message: %w", err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for attempt := 0; ; attempt++ {
+		if d := time.Until(w.wait); d > 0 {
+			time.Sleep(d)
+		}
+
+		resp, err := http.Post(w.URL, "application/json", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.Header.Get("X-RateLimit-Remaining") == "0" {
+			w.wait = time.Now().Add(seconds(resp.Header.Get("X-RateLimit-Reset-After")))
+		}
+		switch {
+		case resp.StatusCode >= 200 && resp.StatusCode < 300:
+			return nil
+		case resp.StatusCode == http.StatusTooManyRequests && attempt < maxRetries:
+			var limited struct {
+				RetryAfter float64 `json:"retry_after"`
+			}
+			retry := seconds(resp.Header.Get("Retry-After"))
+			if json.Unmarshal(b, &limited) == nil && limited.RetryAfter > 0 {
+				retry = time.Duration(limited.RetryAfter * float64(time.Second))
+			}
+			if retry <= 0 {
+				retry = time.Second << uint(attempt)
+			}
+			w.wait = time.Now().Add(retry)
+		default:
+			return fmt.Errorf("posting to Discord: %s: %s", resp.Status, bytes.TrimSpace(b))
+		}
+	}
+}
+
+func seconds(s string) time.Duration {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(f * float64(time.Second))
+}
+
+func truncate(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:max-1]) + "…"
+}
+
+// split cuts s into chunks of at most max runes.
+func split(s string, max int) []string {
+	var chunks []string
+	r := []rune(s)
+	for len(r) > 0 {
+		n := max
+		if n > len(r) {
+			n = len(r)
+		}
+		chunks = append(chunks, string(r[:n]))
+		r = r[n:]
+	}
+	return chunks
+}
@@ -0,0 +1,206 @@
+// Package elastic indexes feed items into Elasticsearch or OpenSearch with
+// the bulk API, e.g. to search them in existing SIEM dashboards.
+package elastic
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+)
+
+// Index is the template of the indices the items are written to.
+type Index struct {
+	// Name is the index name. Time layouts in braces are replaced with the
+	// publication time of the item, the current time if it has none, e.g.
+	// "feeds-{2006.01.02}" writes daily indices.
+	Name string
+	// Mappings are the mappings of the indices created by the action, the
+	// cluster defaults if nil. Existing indices are left alone.
+	Mappings map[string]interface{}
+	// Document maps an item to the indexed document, DefaultDocument if
+	// nil.
+	Document func(*gofeed.Item) map[string]interface{}
+	// APIKey or Username and Password authenticate the requests.
+	APIKey   string
+	Username string
+	Password string
+}
+
+var layoutRe = regexp.MustCompile(`\{([^{}]+)\}`)
+
+// name returns the index name of the item.
+func (x *Index) name(i *gofeed.Item) string {
+	t := time.Now()
+	if i.PublishedParsed != nil {
+		t = *i.PublishedParsed
+	}
+	return layoutRe.ReplaceAllStringFunc(x.Name, func(m string) string {
+		return t.UTC().Format(m[1 : len(m)-1])
+	})
+}
+
+// DefaultDocument maps the item fields and the feed it came from.
+func DefaultDocument(i *gofeed.Item) map[string]interface{} {
+	f := feedtrigger.ItemFeed(i)
+	doc := map[string]interface{}{
+		"id":          feedtrigger.ItemID(i),
+		"title":       i.Title,
+		"link":        i.Link,
+		"description": i.Description,
+		"content":     i.Content,
+		"categories":  i.Categories,
+		"feed":        f.URL,
+		"labels":      f.Labels,
+		"@timestamp":  time.Now().UTC(),
+	}
+	if i.PublishedParsed != nil {
+		doc["published"] = i.PublishedParsed.UTC()
+		doc["@timestamp"] = i.PublishedParsed.UTC()
+	}
+	if i.Author != nil {
+		doc["author"] = i.Author.Name
+	}
+	return doc
+}
+
+// DocumentID returns the ID of the item document, so an item indexed again
+// replaces its document.
+func DocumentID(i *gofeed.Item) string {
+	sum := sha1.Sum([]byte(feedtrigger.ItemFeed(i).URL + "#" + feedtrigger.ItemID(i)))
+	return hex.EncodeToString(sum[:])
+}
+
+// client indexes the documents into the cluster at baseURL.
+type client struct {
+	endpoint string
+	index    Index
+	// created are the indices known to exist.
+	created sync.Map
+}
+
+// Action indexes every new item into the cluster at baseURL.
+func Action(baseURL string, x Index) feedtrigger.NewItemAction {
+	c := &client{endpoint: strings.TrimSuffix(baseURL, "/"), index: x}
+	return func(i *gofeed.Item) error {
+		return c.bulk([]*gofeed.Item{i})
+	}
+}
+
+// BatchAction indexes the new items of a poll with a single bulk request,
+// see Feed.OnNewBatch.
+func BatchAction(baseURL string, x Index) feedtrigger.NewBatchAction {
+	c := &client{endpoint: strings.TrimSuffix(baseURL, "/"), index: x}
+	return c.bulk
+}
+
+func (c *client) bulk(items []*gofeed.Item) error {
+	if len(items) == 0 {
+		return nil
+	}
+	document := c.index.Document
+	if document == nil {
+		document = DefaultDocument
+	}
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+	for _, i := range items {
+		name := c.index.name(i)
+		if err := c.create(name); err != nil {
+			return err
+		}
+		meta := map[string]interface{}{"index": map[string]string{"_index": name, "_id": DocumentID(i)}}
+		if err := enc.Encode(meta); err != nil {
+			return fmt.Errorf("encoding document: %w", err)
+		}
+		if err := enc.Encode(document(i)); err != nil {
+			return fmt.Errorf("encoding document: %w", err)
+		}
+	}
+
+	b, err := c.do(http.MethodPost, "/_bulk", "application/x-ndjson", &body)
+	if err != nil {
+		return fmt.Errorf("indexing: %w", err)
+	}
+	var result struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Status int             `json:"status"`
+			Error  json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(b, &result); err != nil {
+		return fmt.Errorf("decoding bulk response: %w", err)
+	}
+	if !result.Errors {
+		return nil
+	}
+	for _, r := range result.Items {
+		for _, op := range r {
+			if op.Status >= 300 {
+				return fmt.Errorf("indexing: %d: %s", op.Status, op.Error)
+			}
+		}
+	}
+	return nil
+}
+
+// create creates the index with the mappings unless it exists.
+func (c *client) create(name string) error {
+	if c.index.Mappings == nil {
+		return nil
+	}
+	if _, ok := c.created.Load(name); ok {
+		return nil
+	}
+	data, err := json.Marshal(map[string]interface{}{"mappings": c.index.Mappings})
+	if err != nil {
+		return fmt.Errorf("encoding mappings: %w", err)
+	}
+	_, err = c.do(http.MethodPut, "/"+name, "application/json", bytes.NewReader(data))
+	if err != nil && !strings.Contains(err.Error(), "resource_already_exists_exception") {
+		return fmt.Errorf("creating index %s: %w", name, err)
+	}
+	c.created.Store(name, true)
+	return nil
+}
+
+func (c *client) do(method, path, contentType string, body io.Reader) ([]byte, error) {
+	req, err := http.NewRequest(method, c.endpoint+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("User-Agent", feedtrigger.UserAgent)
+	switch {
+	case c.index.APIKey != "":
+		req.Header.Set("Authorization", "ApiKey "+c.index.APIKey)
+	case c.index.Username != "":
+		req.SetBasicAuth(c.index.Username, c.index.Password)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(b))
+	}
+	return b, nil
+}
@@ -0,0 +1,320 @@
+// Package enclosure downloads the enclosures of feed items, e.g. podcast
+// episodes, mirroring them into a directory.
+package enclosure
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+	"ilya.app/feedtrigger/actions"
+)
+
+// DefaultMaxConcurrent is the default number of downloads at once.
+const DefaultMaxConcurrent = 2
+
+// DefaultName names the files after the enclosure URL.
+var DefaultName = template.Must(template.New("name").Parse("{{.Base}}"))
+
+// Downloader saves the enclosures of the items into a directory.
+// Interrupted downloads are resumed from the partial file on the next
+// attempt, and the files are checked against the enclosure length and
+// the Media RSS hashes of the item if there are any.
+type Downloader struct {
+	Dir string
+	// Name renders the path of the file within Dir from a Name value,
+	// DefaultName if nil, e.g.
+	//
+	//	{{.Feed.Metadata.show}}/{{.Date.Format "2006-01-02"}} {{.Title}}{{.Ext}}
+	Name *template.Template
+	// Types are the MIME type prefixes of the enclosures to download, e.g.
+	// "audio/", all enclosures if empty.
+	Types []string
+	// MaxConcurrent bounds the downloads at once across the items,
+	// DefaultMaxConcurrent if zero.
+	MaxConcurrent int
+	// Client is http.DefaultClient if nil.
+	Client *http.Client
+
+	once sync.Once
+	sem  chan struct{}
+}
+
+// Name is the data the file name template is rendered with. Title and
+// Base are safe to use as file names.
+type Name struct {
+	Feed  feedtrigger.FeedInfo
+	Item  *gofeed.Item
+	Title string
+	Date  time.Time
+	// Base is the file name of the enclosure URL and Ext its extension.
+	Base string
+	Ext  string
+	// Index is the position of the enclosure in the item.
+	Index int
+}
+
+// Action downloads the enclosures of the items into the directory.
+func Action(dir string) feedtrigger.NewItemAction {
+	d := &Downloader{Dir: dir}
+	return d.Download
+}
+
+func init() {
+	actions.Register("enclosure", func(p actions.Params) (feedtrigger.NewItemAction, error) {
+		return Action(p.String("dir")), nil
+	}, feedtrigger.ActionParam{Name: "dir", Type: feedtrigger.ParamString, Required: true, Doc: "download directory"})
+}
+
+// Download saves the enclosures of the item.
+func (d *Downloader) Download(i *gofeed.Item) error {
+	d.once.Do(func() {
+		n := d.MaxConcurrent
+		if n <= 0 {
+			n = DefaultMaxConcurrent
+		}
+		d.sem = make(chan struct{}, n)
+	})
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		errs []string
+	)
+	for n, e := range i.Enclosures {
+		if e == nil || e.URL == "" || !d.wanted(e.Type) {
+			continue
+		}
+		file, err := d.path(i, e, n)
+		if err != nil {
+			return err
+		}
+		wg.Add(1)
+		go func(e *gofeed.Enclosure) {
+			defer wg.Done()
+			d.sem <- struct{}{}
+			defer func() { <-d.sem }()
+			if err := d.fetch(e, file, hashes(i, e.URL)); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Sprintf("%s: %v", e.URL, err))
+				mu.Unlock()
+			}
+		}(e)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		return fmt.Errorf("downloading enclosures: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func (d *Downloader) wanted(typ string) bool {
+	if len(d.Types) == 0 {
+		return true
+	}
+	for _, t := range d.Types {
+		if strings.HasPrefix(typ, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// path renders the file path of the enclosure, refusing paths out of Dir.
+func (d *Downloader) path(i *gofeed.Item, e *gofeed.Enclosure, index int) (string, error) {
+	base := "enclosure"
+	if u, err := url.Parse(e.URL); err == nil && path.Base(u.Path) != "/" && path.Base(u.Path) != "." {
+		base = path.Base(u.Path)
+	}
+	date := time.Now()
+	if i.PublishedParsed != nil {
+		date = *i.PublishedParsed
+	}
+	name := Name{
+		Feed:  feedtrigger.ItemFeed(i),
+		Item:  i,
+		Title: sanitize(i.Title),
+		Date:  date,
+		Base:  sanitize(base),
+		Ext:   path.Ext(base),
+		Index: index,
+	}
+	tmpl := d.Name
+	if tmpl == nil {
+		tmpl = DefaultName
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, name); err != nil {
+		return "", fmt.Errorf("file name: %w", err)
+	}
+	file := filepath.Join(d.Dir, filepath.FromSlash(b.String()))
+	if rel, err := filepath.Rel(d.Dir, file); err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("file name %q out of %s", b.String(), d.Dir)
+	}
+	return file, nil
+}
+
+// sanitize makes the text usable as a file name.
+func sanitize(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < ' ' || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(s))
+	if len(s) > 200 {
+		s = s[:200]
+	}
+	return s
+}
+
+// fetch downloads the enclosure into the file, resuming the partial
+// download if there's one.
+func (d *Downloader) fetch(e *gofeed.Enclosure, file string, sums map[string]string) error {
+	if _, err := os.Stat(file); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	part := file + ".part"
+	f, err := os.OpenFile(part, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, e.URL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", feedtrigger.UserAgent)
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && offset > 0:
+		// the partial file is complete already
+	case resp.StatusCode == http.StatusPartialContent && offset > 0:
+		if _, err := io.Copy(f, resp.Body); err != nil {
+			return err
+		}
+	case resp.StatusCode == http.StatusOK:
+		// the server doesn't support ranges, start over
+		if err := f.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.Copy(f, resp.Body); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := verify(part, e.Length, sums); err != nil {
+		os.Remove(part)
+		return err
+	}
+	return os.Rename(part, file)
+}
+
+// verify checks the size and the checksums of the file.
+func verify(file, length string, sums map[string]string) error {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return err
+	}
+	var size int64
+	if _, err := fmt.Sscan(length, &size); err == nil && size > 0 && fi.Size() != size {
+		return fmt.Errorf("got %d bytes, the feed says %d", fi.Size(), size)
+	}
+	for algo, want := range sums {
+		var h hash.Hash
+		switch algo {
+		case "md5":
+			h = md5.New()
+		case "sha-1", "sha1":
+			h = sha1.New()
+		case "sha-256", "sha256":
+			h = sha256.New()
+		default:
+			continue
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(h, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, want) {
+			return errors.New(algo + " checksum mismatch")
+		}
+	}
+	return nil
+}
+
+// hashes returns the Media RSS hashes of the enclosure by algorithm.
+func hashes(i *gofeed.Item, enclosureURL string) map[string]string {
+	sums := make(map[string]string)
+	media := i.Extensions["media"]
+	if media == nil {
+		return sums
+	}
+	contents := media["content"]
+	for _, g := range media["group"] {
+		contents = append(contents, g.Children["content"]...)
+	}
+	for _, c := range contents {
+		if c.Attrs["url"] != enclosureURL {
+			continue
+		}
+		for _, h := range c.Children["hash"] {
+			algo := strings.ToLower(h.Attrs["algo"])
+			if algo == "" {
+				algo = "md5"
+			}
+			sums[algo] = strings.TrimSpace(h.Value)
+		}
+	}
+	return sums
+}
@@ -0,0 +1,138 @@
+// Package gotify sends feed items to a Gotify server.
+package gotify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+	"ilya.app/feedtrigger/actions"
+	"ilya.app/feedtrigger/render"
+)
+
+// DefaultPriority is the priority of the messages, shown as a notification
+// by the Android client from 4 up and with a sound from 8.
+const DefaultPriority = 5
+
+// DefaultPriorityLabel is the feed label holding the message priority.
+const DefaultPriorityLabel = "priority"
+
+// App is a Gotify application messages are sent as.
+type App struct {
+	// Server is the base URL, e.g. https://gotify.example.org.
+	Server string
+	// Token is the application token.
+	Token string
+	// Priority is the priority of the messages, DefaultPriority if zero.
+	// The feed label PriorityLabel, DefaultPriorityLabel if empty,
+	// overrides it with a priority number or a key of Priorities, e.g.
+	// {"low": 2, "high": 8}.
+	Priority      int
+	PriorityLabel string
+	Priorities    map[string]int
+	// Markdown renders the messages as Markdown in the clients.
+	Markdown bool
+	// Template renders the message instead of the item description.
+	Template *render.Template
+}
+
+// Action sends every new item as a message of the application.
+func Action(server, token string) feedtrigger.NewItemAction {
+	a := &App{Server: server, Token: token}
+	return a.Send
+}
+
+func init() {
+	actions.Register("gotify", func(p actions.Params) (feedtrigger.NewItemAction, error) {
+		a := &App{
+			Server:        p.String("server"),
+			Token:         p.String("token"),
+			Priority:      int(p.Number("priority")),
+			PriorityLabel: p.String("priority_label"),
+			Markdown:      p.Bool("markdown"),
+		}
+		return a.Send, nil
+	},
+		feedtrigger.ActionParam{Name: "server", Type: feedtrigger.ParamString, Required: true, Doc: "server URL"},
+		feedtrigger.ActionParam{Name: "token", Type: feedtrigger.ParamString, Required: true, Doc: "application token"},
+		feedtrigger.ActionParam{Name: "priority", Type: feedtrigger.ParamNumber, Doc: "0 to 10"},
+		feedtrigger.ActionParam{Name: "priority_label", Type: feedtrigger.ParamString, Doc: "feed label overriding the priority"},
+		feedtrigger.ActionParam{Name: "markdown", Type: feedtrigger.ParamBool})
+}
+
+// PriorityOf returns the priority of the message of the item.
+func (a *App) PriorityOf(i *gofeed.Item) int {
+	label := a.PriorityLabel
+	if label == "" {
+		label = DefaultPriorityLabel
+	}
+	if v := strings.TrimSpace(feedtrigger.ItemLabels(i)[label]); v != "" {
+		if p, ok := a.Priorities[v]; ok {
+			return p
+		}
+		if p, err := strconv.Atoi(v); err == nil && p >= 0 {
+			return p
+		}
+	}
+	if a.Priority == 0 {
+		return DefaultPriority
+	}
+	return a.Priority
+}
+
+// Send posts the item as a message opening its link when clicked.
+func (a *App) Send(i *gofeed.Item) error {
+	message := i.Description
+	if a.Template != nil {
+		var err error
+		if message, err = a.Template.Render(i); err != nil {
+			return fmt.Errorf("rendering message: %w", err)
+		}
+	}
+	if message == "" {
+		message = i.Link
+	}
+	extras := map[string]interface{}{}
+	if i.Link != "" {
+		extras["client::notification"] = map[string]interface{}{
+			"click": map[string]string{"url": i.Link},
+		}
+	}
+	if a.Markdown {
+		extras["client::display"] = map[string]string{"contentType": "text/markdown"}
+	}
+	body, err := json.Marshal(struct {
+		Title    string                 `json:"title,omitempty"`
+		Message  string                 `json:"message"`
+		Priority int                    `json:"priority"`
+		Extras   map[string]interface{} `json:"extras,omitempty"`
+	}{i.Title, message, a.PriorityOf(i), extras})
+	if err != nil {
+		return fmt.Errorf("encoding message: %w", err)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(a.Server, "/")+"/message", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", feedtrigger.UserAgent)
+	req.Header.Set("X-Gotify-Key", a.Token)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("sending to Gotify: %s: %s", resp.Status, bytes.TrimSpace(b))
+	}
+	return nil
+}
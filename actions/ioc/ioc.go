@@ -0,0 +1,131 @@
+// Package ioc extracts indicators of compromise from feed items: IP
+// addresses, domains, URLs, file hashes and CVE IDs.
+package ioc
+
+import (
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+)
+
+// Set is the indicators found in an item, deduplicated and sorted.
+type Set struct {
+	IPs     []string `json:"ips,omitempty"`
+	Domains []string `json:"domains,omitempty"`
+	URLs    []string `json:"urls,omitempty"`
+	MD5     []string `json:"md5,omitempty"`
+	SHA1    []string `json:"sha1,omitempty"`
+	SHA256  []string `json:"sha256,omitempty"`
+	CVEs    []string `json:"cves,omitempty"`
+}
+
+// Empty reports whether nothing was found.
+func (s Set) Empty() bool {
+	return len(s.IPs)+len(s.Domains)+len(s.URLs)+len(s.MD5)+len(s.SHA1)+len(s.SHA256)+len(s.CVEs) == 0
+}
+
+var (
+	tagRe    = regexp.MustCompile(`<[^>]*>`)
+	urlRe    = regexp.MustCompile(`(?i)\bhttps?://[^\s"'<>()\[\]]+`)
+	ipv4Re   = regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`)
+	ipv6Re   = regexp.MustCompile(`(?i)\b(?:[0-9a-f]{1,4}:){2,7}[0-9a-f]{0,4}\b`)
+	domainRe = regexp.MustCompile(`(?i)\b(?:[a-z0-9](?:[a-z0-9-]{0,61}[a-z0-9])?\.)+[a-z]{2,24}\b`)
+	hashRe   = regexp.MustCompile(`(?i)\b[0-9a-f]{32}(?:[0-9a-f]{8}(?:[0-9a-f]{24})?)?\b`)
+	cveRe    = regexp.MustCompile(`(?i)\bCVE-\d{4}-\d{4,7}\b`)
+
+	// refang undoes the usual ways of defanging indicators in reports.
+	refang = strings.NewReplacer(
+		"hxxps://", "https://", "hxxp://", "http://",
+		"hXXps://", "https://", "hXXp://", "http://",
+		"[.]", ".", "(.)", ".", "{.}", ".", "[dot]", ".", "(dot)", ".",
+		"[:]", ":", "[://]", "://",
+	)
+)
+
+// notTLDs are file extensions matching the domain pattern.
+var notTLDs = map[string]bool{
+	"exe": true, "dll": true, "sys": true, "bin": true, "dat": true,
+	"txt": true, "log": true, "json": true, "xml": true, "yml": true, "yaml": true,
+	"html": true, "htm": true, "php": true, "asp": true, "aspx": true, "jsp": true,
+	"png": true, "jpg": true, "jpeg": true, "gif": true, "svg": true,
+	"doc": true, "docx": true, "xls": true, "xlsx": true, "pdf": true, "zip": true,
+	"rar": true, "ps1": true, "bat": true, "vbs": true, "lnk": true, "tmp": true,
+}
+
+// Extract returns the indicators found in the text. Defanged indicators,
+// e.g. hxxp://evil[.]com, are refanged.
+func Extract(text string) Set {
+	text = refang.Replace(tagRe.ReplaceAllString(text, " "))
+
+	var s Set
+	s.URLs = unique(urlRe.FindAllString(text, -1), func(u string) string {
+		return strings.TrimRight(u, ".,;:")
+	})
+	// domains and addresses inside URLs are reported as URLs only
+	rest := urlRe.ReplaceAllString(text, " ")
+
+	s.IPs = unique(append(ipv4Re.FindAllString(rest, -1), ipv6Re.FindAllString(rest, -1)...), func(ip string) string {
+		if net.ParseIP(ip) == nil {
+			return ""
+		}
+		return ip
+	})
+	s.Domains = unique(domainRe.FindAllString(rest, -1), func(d string) string {
+		d = strings.ToLower(d)
+		if notTLDs[d[strings.LastIndex(d, ".")+1:]] {
+			return ""
+		}
+		return d
+	})
+	for _, h := range unique(hashRe.FindAllString(rest, -1), strings.ToLower) {
+		switch len(h) {
+		case 32:
+			s.MD5 = append(s.MD5, h)
+		case 40:
+			s.SHA1 = append(s.SHA1, h)
+		case 64:
+			s.SHA256 = append(s.SHA256, h)
+		}
+	}
+	s.CVEs = unique(cveRe.FindAllString(rest, -1), strings.ToUpper)
+	return s
+}
+
+// FromItem returns the indicators in the item title, description and
+// content.
+func FromItem(i *gofeed.Item) Set {
+	return Extract(strings.Join([]string{i.Title, i.Description, i.Content}, "\n"))
+}
+
+// Action calls fn with the indicators of every new item having any.
+func Action(fn func(*gofeed.Item, Set) error) feedtrigger.NewItemAction {
+	return func(i *gofeed.Item) error {
+		s := FromItem(i)
+		if s.Empty() {
+			return nil
+		}
+		return fn(i, s)
+	}
+}
+
+// unique normalizes the values with norm, dropping the ones it returns
+// empty for, and returns them deduplicated and sorted.
+func unique(values []string, norm func(string) string) []string {
+	seen := make(map[string]bool, len(values))
+	var out []string
+	for _, v := range values {
+		v = norm(v)
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		out = append(out, v)
+	}
+	sort.Strings(out)
+	return out
+}
@@ -0,0 +1,123 @@
+// Package matrix sends feed items to a Matrix room.
+package matrix
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+	"ilya.app/feedtrigger/actions"
+	"ilya.app/feedtrigger/render"
+)
+
+// Room is a Matrix room messages are sent to with the client-server API.
+type Room struct {
+	// Homeserver is the base URL, e.g. https://matrix.example.org.
+	Homeserver  string
+	AccessToken string
+	// ID is the room ID, e.g. !abc:example.org.
+	ID string
+	// Notice sends m.notice messages, which bots are expected to use.
+	Notice bool
+	// Text and HTML render the message bodies instead of Format.
+	Text *render.Template
+	HTML *render.Template
+}
+
+// Action sends every new item to the room.
+func Action(homeserver, accessToken, roomID string) feedtrigger.NewItemAction {
+	r := &Room{Homeserver: homeserver, AccessToken: accessToken, ID: roomID, Notice: true}
+	return r.Send
+}
+
+func init() {
+	actions.Register("matrix", func(p actions.Params) (feedtrigger.NewItemAction, error) {
+		return Action(p.String("homeserver"), p.String("access_token"), p.String("room")), nil
+	},
+		feedtrigger.ActionParam{Name: "homeserver", Type: feedtrigger.ParamString, Required: true, Doc: "homeserver URL"},
+		feedtrigger.ActionParam{Name: "access_token", Type: feedtrigger.ParamString, Required: true},
+		feedtrigger.ActionParam{Name: "room", Type: feedtrigger.ParamString, Required: true, Doc: "room ID"})
+}
+
+// Send posts the item with an HTML body linking its title. The transaction
+// ID is derived from the item, so a retried item isn't posted twice.
+func (r *Room) Send(i *gofeed.Item) error {
+	msgtype := "m.text"
+	if r.Notice {
+		msgtype = "m.notice"
+	}
+	plain, formatted := Format(i)
+	var err error
+	if r.Text != nil {
+		if plain, err = r.Text.Render(i); err != nil {
+			return fmt.Errorf("rendering message: %w", err)
+		}
+	}
+	if r.HTML != nil {
+		if formatted, err = r.HTML.Render(i); err != nil {
+			return fmt.Errorf("rendering message: %w", err)
+		}
+	}
+	body, err := json.Marshal(map[string]string{
+		"msgtype":        msgtype,
+		"body":           plain,
+		"format":         "org.matrix.custom.html",
+		"formatted_body": formatted,
+	})
+	if err != nil {
+		return fmt.Errorf("encoding message: %w", err)
+	}
+
+	sum := sha1.Sum([]byte(r.ID + "\x00" + feedtrigger.ItemID(i)))
+	endpoint := fmt.Sprintf("%s/_matrix/client/v3/rooms/%s/send/m.room.message/%s",
+		strings.TrimSuffix(r.Homeserver, "/"), url.PathEscape(r.ID), hex.EncodeToString(sum[:]))
+	req, err := http.NewRequest(http.MethodPut, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+r.AccessToken)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", feedtrigger.UserAgent)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("sending to Matrix room: %s: %s", resp.Status, bytes.TrimSpace(b))
+	}
+	return nil
+}
+
+// Format returns the plain text and HTML bodies of the item message.
+func Format(i *gofeed.Item) (plain, formatted string) {
+	var p, h strings.Builder
+	p.WriteString(i.Title)
+	if i.Link != "" {
+		p.WriteString("\n" + i.Link)
+		fmt.Fprintf(&h, `<strong><a href="%s">%s</a></strong>`, html.EscapeString(i.Link), html.EscapeString(i.Title))
+	} else {
+		fmt.Fprintf(&h, "<strong>%s</strong>", html.EscapeString(i.Title))
+	}
+	if i.Author != nil && i.Author.Name != "" {
+		p.WriteString("\nby " + i.Author.Name)
+		fmt.Fprintf(&h, "<br>by %s", html.EscapeString(i.Author.Name))
+	}
+	if i.Description != "" {
+		p.WriteString("\n\n" + i.Description)
+		fmt.Fprintf(&h, "<br><br>%s", html.EscapeString(i.Description))
+	}
+	return p.String(), h.String()
+}
@@ -0,0 +1,104 @@
+// Package mattermost posts feed items to a Mattermost incoming webhook.
+package mattermost
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+	"ilya.app/feedtrigger/actions"
+	"ilya.app/feedtrigger/render"
+)
+
+// Attachment is a Mattermost message attachment.
+type Attachment struct {
+	Fallback   string `json:"fallback"`
+	Color      string `json:"color,omitempty"`
+	AuthorName string `json:"author_name,omitempty"`
+	Title      string `json:"title,omitempty"`
+	TitleLink  string `json:"title_link,omitempty"`
+	Text       string `json:"text,omitempty"`
+	Footer     string `json:"footer,omitempty"`
+	FooterIcon string `json:"footer_icon,omitempty"`
+}
+
+// Webhook is a Mattermost incoming webhook.
+type Webhook struct {
+	URL string
+	// Channel overrides the webhook channel, if the webhook allows it.
+	Channel string
+	// Username and IconURL override the webhook name and picture. The feed
+	// icon is used if IconURL is empty and branding is enabled.
+	Username string
+	IconURL  string
+	// Color is the attachment side bar color, e.g. #2f80ed.
+	Color string
+	// Template renders the attachment text instead of the item description.
+	Template *render.Template
+}
+
+// Action posts every new item to the webhook.
+func Action(webhookURL string) feedtrigger.NewItemAction {
+	w := &Webhook{URL: webhookURL}
+	return w.Post
+}
+
+func init() {
+	actions.Register("mattermost", func(p actions.Params) (feedtrigger.NewItemAction, error) {
+		return Action(p.String("webhook")), nil
+	}, feedtrigger.ActionParam{Name: "webhook", Type: feedtrigger.ParamString, Required: true, Doc: "incoming webhook URL"})
+}
+
+// Post sends the item as a message attachment.
+func (w *Webhook) Post(i *gofeed.Item) error {
+	icon := w.IconURL
+	if icon == "" {
+		icon = i.Custom[feedtrigger.IconKey]
+	}
+	a := Attachment{
+		Fallback:  i.Title + " " + i.Link,
+		Color:     w.Color,
+		Title:     i.Title,
+		TitleLink: i.Link,
+		Text:      i.Description,
+	}
+	if w.Template != nil {
+		text, err := w.Template.Render(i)
+		if err != nil {
+			return fmt.Errorf("rendering message: %w", err)
+		}
+		a.Text = text
+	}
+	if i.Author != nil {
+		a.AuthorName = i.Author.Name
+	}
+	if i.PublishedParsed != nil {
+		a.Footer = i.PublishedParsed.UTC().Format("2006-01-02 15:04 MST")
+		a.FooterIcon = i.Custom[feedtrigger.IconKey]
+	}
+
+	body, err := json.Marshal(struct {
+		Channel     string       `json:"channel,omitempty"`
+		Username    string       `json:"username,omitempty"`
+		IconURL     string       `json:"icon_url,omitempty"`
+		Attachments []Attachment `json:"attachments"`
+	}{w.Channel, w.Username, icon, []Attachment{a}})
+	if err != nil {
+		return fmt.Errorf("encoding message: %w", err)
+	}
+	resp, err := http.Post(w.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("posting to Mattermost: %s: %s", resp.Status, bytes.TrimSpace(b))
+	}
+	return nil
+}
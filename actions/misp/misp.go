@@ -0,0 +1,175 @@
+// Package misp creates MISP events from feed items.
+package misp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+	"ilya.app/feedtrigger/actions/ioc"
+)
+
+// Distribution levels of MISP events.
+const (
+	DistributionOrganisation = 0
+	DistributionCommunity    = 1
+	DistributionConnected    = 2
+	DistributionAll          = 3
+)
+
+// Attribute is a MISP event attribute.
+type Attribute struct {
+	Type     string `json:"type"`
+	Category string `json:"category"`
+	Value    string `json:"value"`
+	ToIDS    bool   `json:"to_ids"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// Event is the template of the created events.
+type Event struct {
+	// EventID appends attributes of every item to this existing event
+	// instead of creating one per item.
+	EventID      string
+	Distribution int
+	// ThreatLevel is 1 (high) to 4 (undefined), 4 if zero.
+	ThreatLevel int
+	// Analysis is 0 (initial), 1 (ongoing) or 2 (completed).
+	Analysis int
+	Tags     []string
+	// Attributes maps an item to event attributes, DefaultAttributes if
+	// nil.
+	Attributes func(*gofeed.Item) []Attribute
+}
+
+// DefaultAttributes maps the item link and the indicators extracted from it
+// to attributes.
+func DefaultAttributes(i *gofeed.Item) []Attribute {
+	var attrs []Attribute
+	if i.Link != "" {
+		attrs = append(attrs, Attribute{Type: "link", Category: "External analysis", Value: i.Link, Comment: i.Title})
+	}
+	set := ioc.FromItem(i)
+	add := func(typ, category string, values []string, ids bool) {
+		for _, v := range values {
+			attrs = append(attrs, Attribute{Type: typ, Category: category, Value: v, ToIDS: ids})
+		}
+	}
+	add("ip-dst", "Network activity", set.IPs, true)
+	add("domain", "Network activity", set.Domains, true)
+	add("url", "Network activity", set.URLs, true)
+	add("md5", "Payload delivery", set.MD5, true)
+	add("sha1", "Payload delivery", set.SHA1, true)
+	add("sha256", "Payload delivery", set.SHA256, true)
+	add("vulnerability", "External analysis", set.CVEs, false)
+	return attrs
+}
+
+// Action returns a step creating a MISP event for every new item, or
+// appending to tmpl.EventID. The result holds the event ID under
+// "misp_event", and an item already delivered isn't sent again.
+func Action(baseURL, apiKey string, tmpl Event) feedtrigger.ResultAction {
+	c := &client{base: strings.TrimSuffix(baseURL, "/"), key: apiKey}
+	return func(i *gofeed.Item, prev feedtrigger.Results) (feedtrigger.Result, error) {
+		for _, r := range prev {
+			if id := r["misp_event"]; id != "" {
+				return feedtrigger.Result{"misp_event": id}, nil
+			}
+		}
+
+		mapping := tmpl.Attributes
+		if mapping == nil {
+			mapping = DefaultAttributes
+		}
+		attrs := mapping(i)
+
+		if tmpl.EventID != "" {
+			for _, a := range attrs {
+				if err := c.post("/attributes/add/"+tmpl.EventID, map[string]interface{}{"Attribute": a}, nil); err != nil {
+					return nil, err
+				}
+			}
+			return feedtrigger.Result{"misp_event": tmpl.EventID}, nil
+		}
+
+		threat := tmpl.ThreatLevel
+		if threat == 0 {
+			threat = 4
+		}
+		var tags []map[string]string
+		for _, t := range tmpl.Tags {
+			tags = append(tags, map[string]string{"name": t})
+		}
+		date := ""
+		if i.PublishedParsed != nil {
+			date = i.PublishedParsed.Format("2006-01-02")
+		}
+		event := map[string]interface{}{
+			"info":            i.Title,
+			"distribution":    tmpl.Distribution,
+			"threat_level_id": threat,
+			"analysis":        tmpl.Analysis,
+			"Attribute":       attrs,
+			"Tag":             tags,
+		}
+		if date != "" {
+			event["date"] = date
+		}
+
+		var created struct {
+			Event struct {
+				ID string `json:"id"`
+			} `json:"Event"`
+		}
+		if err := c.post("/events/add", map[string]interface{}{"Event": event}, &created); err != nil {
+			return nil, err
+		}
+		return feedtrigger.Result{"misp_event": created.Event.ID}, nil
+	}
+}
+
+type client struct {
+	base string
+	key  string
+}
+
+func (c *client) post(path string, body, out interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("encoding MISP request: %w", err)
+	}
+	req, err := http.NewRequest(http.MethodPost, c.base+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", c.key)
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", feedtrigger.UserAgent)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("MISP %s: %s: %s", path, resp.Status, bytes.TrimSpace(b))
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(b, out); err != nil {
+		return fmt.Errorf("decoding MISP response: %w", err)
+	}
+	return nil
+}
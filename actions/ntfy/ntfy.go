@@ -0,0 +1,162 @@
+// Package ntfy publishes feed items to an ntfy topic.
+package ntfy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+	"ilya.app/feedtrigger/actions"
+	"ilya.app/feedtrigger/render"
+)
+
+// DefaultServer is the public ntfy instance.
+const DefaultServer = "https://ntfy.sh"
+
+// DefaultPriorityLabel is the feed label holding the message priority.
+const DefaultPriorityLabel = "priority"
+
+// Priorities of the messages.
+const (
+	Min     = 1
+	Low     = 2
+	Default = 3
+	High    = 4
+	Max     = 5
+)
+
+// names are the ntfy names of the priorities.
+var names = map[string]int{
+	"min":     Min,
+	"low":     Low,
+	"default": Default,
+	"high":    High,
+	"max":     Max,
+	"urgent":  Max,
+}
+
+// Topic is an ntfy topic messages are published to.
+type Topic struct {
+	// Server is DefaultServer if empty.
+	Server string
+	Topic  string
+	// Token is the access token of a protected topic.
+	Token string
+	// Priority is the priority of the messages, Default if zero. The feed
+	// label PriorityLabel, DefaultPriorityLabel if empty, overrides it
+	// with a priority number, an ntfy priority name, e.g. high, or a key of
+	// Priorities.
+	Priority      int
+	PriorityLabel string
+	Priorities    map[string]int
+	// Tags are set on every message, e.g. emoji short codes.
+	Tags []string
+	// Template renders the message instead of the item description.
+	Template *render.Template
+}
+
+// Action publishes every new item to the topic.
+func Action(server, topic, token string) feedtrigger.NewItemAction {
+	t := &Topic{Server: server, Topic: topic, Token: token}
+	return t.Publish
+}
+
+func init() {
+	actions.Register("ntfy", func(p actions.Params) (feedtrigger.NewItemAction, error) {
+		t := &Topic{
+			Server:        p.String("server"),
+			Topic:         p.String("topic"),
+			Token:         p.String("token"),
+			Priority:      int(p.Number("priority")),
+			PriorityLabel: p.String("priority_label"),
+			Tags:          p.Strings("tags"),
+		}
+		return t.Publish, nil
+	},
+		feedtrigger.ActionParam{Name: "topic", Type: feedtrigger.ParamString, Required: true},
+		feedtrigger.ActionParam{Name: "server", Type: feedtrigger.ParamString, Doc: "server URL, " + DefaultServer + " if empty"},
+		feedtrigger.ActionParam{Name: "token", Type: feedtrigger.ParamString, Doc: "access token"},
+		feedtrigger.ActionParam{Name: "priority", Type: feedtrigger.ParamNumber, Doc: "1 to 5"},
+		feedtrigger.ActionParam{Name: "priority_label", Type: feedtrigger.ParamString, Doc: "feed label overriding the priority"},
+		feedtrigger.ActionParam{Name: "tags", Type: feedtrigger.ParamStrings})
+}
+
+// PriorityOf returns the priority of the message of the item.
+func (t *Topic) PriorityOf(i *gofeed.Item) int {
+	label := t.PriorityLabel
+	if label == "" {
+		label = DefaultPriorityLabel
+	}
+	if v := strings.TrimSpace(feedtrigger.ItemLabels(i)[label]); v != "" {
+		if p, ok := t.Priorities[v]; ok {
+			return p
+		}
+		if p, ok := names[strings.ToLower(v)]; ok {
+			return p
+		}
+		if p, err := strconv.Atoi(v); err == nil && p >= Min && p <= Max {
+			return p
+		}
+	}
+	if t.Priority == 0 {
+		return Default
+	}
+	return t.Priority
+}
+
+// Publish sends the item as a message clicking through to its link.
+func (t *Topic) Publish(i *gofeed.Item) error {
+	message := i.Description
+	if t.Template != nil {
+		var err error
+		if message, err = t.Template.Render(i); err != nil {
+			return fmt.Errorf("rendering message: %w", err)
+		}
+	}
+	if message == "" {
+		message = i.Link
+	}
+	body, err := json.Marshal(struct {
+		Topic    string   `json:"topic"`
+		Title    string   `json:"title,omitempty"`
+		Message  string   `json:"message"`
+		Priority int      `json:"priority"`
+		Tags     []string `json:"tags,omitempty"`
+		Click    string   `json:"click,omitempty"`
+		Icon     string   `json:"icon,omitempty"`
+	}{t.Topic, i.Title, message, t.PriorityOf(i), t.Tags, i.Link, i.Custom[feedtrigger.IconKey]})
+	if err != nil {
+		return fmt.Errorf("encoding message: %w", err)
+	}
+
+	server := t.Server
+	if server == "" {
+		server = DefaultServer
+	}
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(server, "/"), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", feedtrigger.UserAgent)
+	if t.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+t.Token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("publishing to ntfy: %s: %s", resp.Status, bytes.TrimSpace(b))
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+// Package opsgenie creates Opsgenie alerts for feed items.
+package opsgenie
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+)
+
+// API roots of the Opsgenie instances.
+const (
+	DefaultBaseURL = "https://api.opsgenie.com"
+	EUBaseURL      = "https://api.eu.opsgenie.com"
+)
+
+// Priorities of the alerts.
+const (
+	P1 = "P1"
+	P2 = "P2"
+	P3 = "P3"
+	P4 = "P4"
+	P5 = "P5"
+)
+
+// Alert is the template of the created alerts.
+type Alert struct {
+	// Source names the feed, it's part of the alert alias with the item
+	// ID, so it should be unique per feed, e.g. its URL.
+	Source string
+	// Priority is the priority of the alerts, P3 if empty. PriorityOf
+	// overrides it per item when it returns a non-empty priority.
+	Priority   string
+	PriorityOf func(*gofeed.Item) string
+	// Filter limits alerts to the matching items, e.g. the advisories of a
+	// critical severity.
+	Filter feedtrigger.ItemFilter
+	Tags   []string
+	Entity string
+	// Responders are the teams notified, by name.
+	Responders []string
+	// BaseURL is DefaultBaseURL if empty.
+	BaseURL string
+}
+
+// Action creates an alert for every new item passing the template filter.
+// The alerts are deduplicated by Alias, so an item polled again doesn't
+// page twice while its alert is open.
+func Action(apiKey string, tmpl Alert) feedtrigger.NewItemAction {
+	base := tmpl.BaseURL
+	if base == "" {
+		base = DefaultBaseURL
+	}
+	endpoint := strings.TrimSuffix(base, "/") + "/v2/alerts"
+	return func(i *gofeed.Item) error {
+		if tmpl.Filter != nil && !tmpl.Filter(i) {
+			return nil
+		}
+		priority := tmpl.Priority
+		if tmpl.PriorityOf != nil {
+			if p := tmpl.PriorityOf(i); p != "" {
+				priority = p
+			}
+		}
+		if priority == "" {
+			priority = P3
+		}
+		message := []rune(i.Title)
+		if len(message) > 130 {
+			message = message[:130]
+		}
+		description := i.Description
+		if i.Link != "" {
+			description += "\n\n" + i.Link
+		}
+		source := tmpl.Source
+		if source == "" {
+			source = feedtrigger.ItemFeed(i).URL
+		}
+		alert := map[string]interface{}{
+			"message":     string(message),
+			"alias":       Alias(tmpl.Source, i),
+			"description": description,
+			"priority":    priority,
+			"source":      source,
+			"tags":        tmpl.Tags,
+			"details": map[string]string{
+				"link": i.Link,
+				"feed": feedtrigger.ItemFeed(i).URL,
+			},
+		}
+		if tmpl.Entity != "" {
+			alert["entity"] = tmpl.Entity
+		}
+		var responders []map[string]string
+		for _, team := range tmpl.Responders {
+			responders = append(responders, map[string]string{"name": team, "type": "team"})
+		}
+		if len(responders) > 0 {
+			alert["responders"] = responders
+		}
+		data, err := json.Marshal(alert)
+		if err != nil {
+			return fmt.Errorf("encoding alert: %w", err)
+		}
+
+		req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "GenieKey "+apiKey)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", feedtrigger.UserAgent)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("creating alert: %s: %s", resp.Status, bytes.TrimSpace(b))
+	}
+}
+
+// Alias returns the alert deduplication alias of the item from the source.
+func Alias(source string, i *gofeed.Item) string {
+	sum := sha1.Sum([]byte(source + "#" + feedtrigger.ItemID(i)))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,137 @@
+// Package pagerduty opens PagerDuty incidents for feed items with the Events
+// API v2.
+package pagerduty
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+)
+
+// DefaultEndpoint is the Events API v2 endpoint.
+const DefaultEndpoint = "https://events.pagerduty.com/v2/enqueue"
+
+// Severities of the events.
+const (
+	Critical = "critical"
+	Error    = "error"
+	Warning  = "warning"
+	Info     = "info"
+)
+
+// Event is the template of the triggered events.
+type Event struct {
+	// RoutingKey is the integration key of the service.
+	RoutingKey string
+	// Source names the feed, it's part of the event deduplication key with
+	// the item ID, so it should be unique per feed, e.g. its URL.
+	Source string
+	// Severity is the severity of the events, Warning if empty. SeverityOf
+	// overrides it per item when it returns a non-empty severity.
+	Severity   string
+	SeverityOf func(*gofeed.Item) string
+	// Filter limits incidents to the matching items, e.g. the advisories
+	// of a critical severity.
+	Filter    feedtrigger.ItemFilter
+	Component string
+	Group     string
+	Class     string
+	// Endpoint is DefaultEndpoint if empty.
+	Endpoint string
+}
+
+// Action triggers an event for every new item passing the template filter.
+// The events are deduplicated by DedupKey, so an item polled again doesn't
+// page twice while its incident is open.
+func Action(tmpl Event) feedtrigger.NewItemAction {
+	endpoint := tmpl.Endpoint
+	if endpoint == "" {
+		endpoint = DefaultEndpoint
+	}
+	return func(i *gofeed.Item) error {
+		if tmpl.Filter != nil && !tmpl.Filter(i) {
+			return nil
+		}
+		severity := tmpl.Severity
+		if tmpl.SeverityOf != nil {
+			if s := tmpl.SeverityOf(i); s != "" {
+				severity = s
+			}
+		}
+		if severity == "" {
+			severity = Warning
+		}
+		summary := []rune(i.Title)
+		if len(summary) > 1024 {
+			summary = summary[:1024]
+		}
+		source := tmpl.Source
+		if source == "" {
+			source = feedtrigger.ItemFeed(i).URL
+		}
+		payload := map[string]interface{}{
+			"summary":  string(summary),
+			"source":   source,
+			"severity": severity,
+			"custom_details": map[string]interface{}{
+				"description": i.Description,
+				"link":        i.Link,
+				"feed":        feedtrigger.ItemFeed(i).URL,
+				"categories":  i.Categories,
+			},
+		}
+		if i.PublishedParsed != nil {
+			payload["timestamp"] = i.PublishedParsed.UTC().Format(time.RFC3339)
+		}
+		for k, v := range map[string]string{"component": tmpl.Component, "group": tmpl.Group, "class": tmpl.Class} {
+			if v != "" {
+				payload[k] = v
+			}
+		}
+		event := map[string]interface{}{
+			"routing_key":  tmpl.RoutingKey,
+			"event_action": "trigger",
+			"dedup_key":    DedupKey(tmpl.Source, i),
+			"payload":      payload,
+		}
+		if i.Link != "" {
+			event["links"] = []map[string]string{{"href": i.Link, "text": i.Title}}
+		}
+		data, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("encoding event: %w", err)
+		}
+
+		req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", feedtrigger.UserAgent)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("triggering event: %s: %s", resp.Status, bytes.TrimSpace(b))
+	}
+}
+
+// DedupKey returns the event deduplication key of the item from the source.
+func DedupKey(source string, i *gofeed.Item) string {
+	sum := sha1.Sum([]byte(source + "#" + feedtrigger.ItemID(i)))
+	return hex.EncodeToString(sum[:])
+}
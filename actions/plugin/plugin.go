@@ -0,0 +1,197 @@
+// Package plugin runs actions shipped as separate executables, so
+// notifiers can be added without rebuilding feedtrigger. A plugin is a
+// program feedtrigger starts once and talks to over its standard input and
+// output with JSON-RPC 1.0. Go plugins call Serve:
+//
+//	func main() {
+//		plugin.Serve(func(i *gofeed.Item) error {
+//			return notify(i.Title, i.Link)
+//		})
+//	}
+//
+// Plugins in other languages implement the protocol themselves, it only
+// takes reading and writing JSON objects. The FEEDTRIGGER_PLUGIN variable
+// is set in their environment. For every item feedtrigger writes a request
+// with the item in the JSON form of gofeed.Item:
+//
+//	{"method": "Plugin.Trigger", "params": [{"title": "...", "link": "..."}], "id": 0}
+//
+// and waits for the response with the same id, error being null or the
+// message of the failed action:
+//
+//	{"id": 0, "result": {}, "error": null}
+//
+// The plugin's standard error is passed through to feedtrigger's log.
+//
+// Plugins aren't sandboxed: they run with the privileges of feedtrigger,
+// so only trusted programs belong in the plugins directory. WebAssembly
+// modules, which could run untrusted handlers, aren't supported.
+//
+// The protocol is not gRPC on purpose: feedtrigger has no dependencies
+// beyond the feed parsing and storage libraries, and JSON-RPC is served by
+// the standard library while being as easy to speak from other languages.
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+)
+
+// cookie is set in the environment of plugins, so running one by hand
+// fails with a hint instead of waiting for requests.
+const cookie = "FEEDTRIGGER_PLUGIN"
+
+// Serve serves the action to feedtrigger until it closes the connection.
+func Serve(action feedtrigger.NewItemAction) {
+	if os.Getenv(cookie) == "" {
+		fmt.Fprintln(os.Stderr, "this is a feedtrigger plugin, put it in the plugins directory")
+		os.Exit(1)
+	}
+	srv := rpc.NewServer()
+	if err := srv.RegisterName("Plugin", &service{action}); err != nil {
+		log.Fatal(err)
+	}
+	srv.ServeCodec(jsonrpc.NewServerCodec(stdio{}))
+}
+
+type service struct {
+	action feedtrigger.NewItemAction
+}
+
+// Trigger is the RPC method running the action.
+func (s *service) Trigger(i *gofeed.Item, _ *struct{}) error {
+	return s.action(i)
+}
+
+// stdio is the connection of a plugin to feedtrigger.
+type stdio struct{}
+
+func (stdio) Read(p []byte) (int, error)  { return os.Stdin.Read(p) }
+func (stdio) Write(p []byte) (int, error) { return os.Stdout.Write(p) }
+func (stdio) Close() error                { return os.Stdout.Close() }
+
+// Plugin is an action executable. It's started on the first item and
+// restarted if it exits.
+type Plugin struct {
+	Name string
+	Path string
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	client *rpc.Client
+}
+
+// Discover returns the plugins in the directory, every executable file is
+// one named after the file without the extension.
+func Discover(dir string) ([]*Plugin, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading plugins: %w", err)
+	}
+	var plugins []*Plugin
+	for _, fi := range files {
+		if fi.IsDir() || fi.Mode()&0111 == 0 {
+			continue
+		}
+		name := strings.TrimSuffix(fi.Name(), filepath.Ext(fi.Name()))
+		plugins = append(plugins, &Plugin{Name: name, Path: filepath.Join(dir, fi.Name())})
+	}
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].Name < plugins[j].Name })
+	return plugins, nil
+}
+
+// Action sends the items to the plugin.
+func (p *Plugin) Action(i *gofeed.Item) error {
+	client, err := p.start()
+	if err != nil {
+		return err
+	}
+	err = client.Call("Plugin.Trigger", i, &struct{}{})
+	if errors.Is(err, rpc.ErrShutdown) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		p.stop(client)
+	}
+	if err != nil {
+		return fmt.Errorf("plugin %s: %w", p.Name, err)
+	}
+	return nil
+}
+
+// start runs the plugin unless it's running.
+func (p *Plugin) start() (*rpc.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.client != nil {
+		return p.client, nil
+	}
+
+	cmd := exec.Command(p.Path)
+	cmd.Env = append(os.Environ(), cookie+"=1")
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting plugin %s: %w", p.Name, err)
+	}
+	p.cmd = cmd
+	p.client = jsonrpc.NewClient(pipe{stdout, stdin})
+	return p.client, nil
+}
+
+// stop kills the plugin if client is still its connection.
+func (p *Plugin) stop(client *rpc.Client) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.client != client {
+		return
+	}
+	p.client.Close()
+	p.cmd.Process.Kill()
+	p.cmd.Wait()
+	p.client, p.cmd = nil, nil
+}
+
+// Close stops the plugin.
+func (p *Plugin) Close() error {
+	p.mu.Lock()
+	client := p.client
+	p.mu.Unlock()
+	if client == nil {
+		return nil
+	}
+	p.stop(client)
+	return nil
+}
+
+// pipe joins the plugin standard output and input.
+type pipe struct {
+	io.ReadCloser
+	w io.WriteCloser
+}
+
+func (p pipe) Write(b []byte) (int, error) { return p.w.Write(b) }
+
+func (p pipe) Close() error {
+	p.w.Close()
+	return p.ReadCloser.Close()
+}
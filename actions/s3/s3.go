@@ -0,0 +1,327 @@
+// Package s3 archives feed items into S3 compatible object storage, e.g.
+// AWS S3 or MinIO, for cheap long-term retention.
+package s3
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+)
+
+// DefaultKey stores the items by feed host and publication day.
+var DefaultKey = template.Must(template.New("key").Parse(`{{.Host}}/{{.Date.Format "2006/01/02"}}/{{.ID}}`))
+
+// DefaultMaxDownload is the size limit of the downloaded pages and
+// enclosures without a MaxDownload.
+const DefaultMaxDownload = 100 << 20
+
+// Server-side encryption modes.
+const (
+	SSES3  = "AES256"
+	SSEKMS = "aws:kms"
+)
+
+// Bucket is where and how the items are archived.
+type Bucket struct {
+	// Endpoint is the storage root, e.g. https://s3.eu-west-1.amazonaws.com
+	// or http://minio:9000. The bucket is addressed in the path.
+	Endpoint string
+	Bucket   string
+	// Region is "us-east-1" if empty.
+	Region       string
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	// Key renders the object key prefix of an item from a Key value,
+	// DefaultKey if nil. The item is stored as <prefix>.json.
+	Key *template.Template
+	// Gzip compresses the objects, adding .gz to their keys.
+	Gzip bool
+	// Encryption is the server-side encryption, SSES3 or SSEKMS with the
+	// KMSKeyID key, none if empty.
+	Encryption string
+	KMSKeyID   string
+	// Page stores the page the item links to as <prefix>.html and
+	// Enclosures the item enclosures under <prefix>/.
+	Page       bool
+	Enclosures bool
+	// MaxDownload bounds the size of the page and every enclosure,
+	// DefaultMaxDownload if zero.
+	MaxDownload int64
+	// Client is http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// Key is the data the object key template is rendered with.
+type Key struct {
+	Feed feedtrigger.FeedInfo
+	Item *gofeed.Item
+	// Host is the host of the feed URL.
+	Host string
+	// Date is the publication time of the item, the current time if it
+	// has none, in UTC.
+	Date time.Time
+	// ID is a hash of the item ID, safe to use in keys.
+	ID string
+}
+
+// Action archives every new item into the bucket.
+func Action(b *Bucket) feedtrigger.NewItemAction {
+	return b.Put
+}
+
+// Put stores the item, and its page and enclosures if enabled.
+func (b *Bucket) Put(i *gofeed.Item) error {
+	prefix, err := b.prefix(i)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(i)
+	if err != nil {
+		return fmt.Errorf("encoding item: %w", err)
+	}
+	if err := b.put(prefix+".json", "application/json", data); err != nil {
+		return err
+	}
+	if b.Page && i.Link != "" {
+		page, typ, err := b.download(i.Link)
+		if err != nil {
+			return fmt.Errorf("downloading page: %w", err)
+		}
+		if err := b.put(prefix+".html", typ, page); err != nil {
+			return err
+		}
+	}
+	if b.Enclosures {
+		for n, e := range i.Enclosures {
+			if e == nil || e.URL == "" {
+				continue
+			}
+			data, typ, err := b.download(e.URL)
+			if err != nil {
+				return fmt.Errorf("downloading enclosure: %w", err)
+			}
+			if err := b.put(fmt.Sprintf("%s/%d-%s", prefix, n, base(e.URL)), typ, data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// prefix renders the object key prefix of the item.
+func (b *Bucket) prefix(i *gofeed.Item) (string, error) {
+	f := feedtrigger.ItemFeed(i)
+	date := time.Now()
+	if i.PublishedParsed != nil {
+		date = *i.PublishedParsed
+	}
+	sum := sha1.Sum([]byte(feedtrigger.ItemID(i)))
+	k := Key{Feed: f, Item: i, Date: date.UTC(), ID: hex.EncodeToString(sum[:])}
+	if u, err := url.Parse(f.URL); err == nil && u.Host != "" {
+		k.Host = u.Host
+	} else {
+		k.Host = "feed"
+	}
+	tmpl := b.Key
+	if tmpl == nil {
+		tmpl = DefaultKey
+	}
+	var key bytes.Buffer
+	if err := tmpl.Execute(&key, k); err != nil {
+		return "", fmt.Errorf("object key: %w", err)
+	}
+	return strings.TrimPrefix(key.String(), "/"), nil
+}
+
+func base(link string) string {
+	if u, err := url.Parse(link); err == nil {
+		if b := path.Base(u.Path); b != "/" && b != "." {
+			return b
+		}
+	}
+	return "enclosure"
+}
+
+func (b *Bucket) client() *http.Client {
+	if b.Client == nil {
+		return http.DefaultClient
+	}
+	return b.Client
+}
+
+// download fetches the URL up to MaxDownload bytes.
+func (b *Bucket) download(link string) ([]byte, string, error) {
+	req, err := http.NewRequest(http.MethodGet, link, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("User-Agent", feedtrigger.UserAgent)
+	resp, err := b.client().Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("%s: %s", link, resp.Status)
+	}
+	max := b.MaxDownload
+	if max <= 0 {
+		max = DefaultMaxDownload
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, max+1))
+	if err != nil {
+		return nil, "", err
+	}
+	if int64(len(data)) > max {
+		return nil, "", fmt.Errorf("%s: larger than %d bytes", link, max)
+	}
+	return data, resp.Header.Get("Content-Type"), nil
+}
+
+// put uploads the object.
+func (b *Bucket) put(key, contentType string, data []byte) error {
+	header := http.Header{}
+	if b.Gzip {
+		var gz bytes.Buffer
+		w := gzip.NewWriter(&gz)
+		if _, err := w.Write(data); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		data = gz.Bytes()
+		key += ".gz"
+		header.Set("Content-Encoding", "gzip")
+	}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	switch b.Encryption {
+	case "":
+	case SSEKMS:
+		header.Set("X-Amz-Server-Side-Encryption", SSEKMS)
+		if b.KMSKeyID != "" {
+			header.Set("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", b.KMSKeyID)
+		}
+	default:
+		header.Set("X-Amz-Server-Side-Encryption", b.Encryption)
+	}
+
+	u := strings.TrimSuffix(b.Endpoint, "/") + "/" + escape(b.Bucket) + "/" + escape(key)
+	req, err := http.NewRequest(http.MethodPut, u, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("User-Agent", feedtrigger.UserAgent)
+	b.sign(req, data, time.Now().UTC())
+
+	resp, err := b.client().Do(req)
+	if err != nil {
+		return fmt.Errorf("storing %s: %w", key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("storing %s: %s: %s", key, resp.Status, bytes.TrimSpace(msg))
+	}
+	return nil
+}
+
+// escape encodes the object key as AWS Signature Version 4 expects.
+func escape(key string) string {
+	var e strings.Builder
+	for _, c := range []byte(key) {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/':
+			e.WriteByte(c)
+		default:
+			fmt.Fprintf(&e, "%%%02X", c)
+		}
+	}
+	return e.String()
+}
+
+// sign signs the request with AWS Signature Version 4.
+func (b *Bucket) sign(req *http.Request, payload []byte, now time.Time) {
+	region := b.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	sum := sha256.Sum256(payload)
+	payloadHash := hex.EncodeToString(sum[:])
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if b.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", b.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		lk := strings.ToLower(k)
+		if strings.HasPrefix(lk, "x-amz-") || lk == "content-type" || lk == "content-encoding" {
+			headers[lk] = strings.TrimSpace(strings.Join(v, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonical strings.Builder
+	for _, k := range names {
+		canonical.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signed := strings.Join(names, ";")
+
+	request := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonical.String(),
+		signed,
+		payloadHash,
+	}, "\n")
+	scope := day + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(request))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := mac([]byte("AWS4"+b.SecretKey), day)
+	key = mac(key, region)
+	key = mac(key, "s3")
+	key = mac(key, "aws4_request")
+	signature := hex.EncodeToString(mac(key, toSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		b.AccessKey, scope, signed, signature))
+}
+
+func mac(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
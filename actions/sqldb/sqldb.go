@@ -0,0 +1,198 @@
+// Package sqldb inserts feed items into a SQL table, e.g. in Postgres or
+// ClickHouse, for analytics over the monitored feeds. The database driver is
+// registered by the application importing it.
+package sqldb
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+)
+
+// DefaultBatchSize is the number of rows inserted per statement by
+// BatchAction without a BatchSize.
+const DefaultBatchSize = 100
+
+// Placeholder styles of the statement parameters.
+const (
+	// Dollar numbers the parameters, e.g. $1, as Postgres does.
+	Dollar = "$"
+	// Question uses ? for every parameter, as ClickHouse and MySQL do.
+	Question = "?"
+)
+
+// Column maps an item field to a table column.
+type Column struct {
+	Name string
+	// Field is the item field, see Value.
+	Field string
+}
+
+// DefaultColumns are the columns of Table without any.
+var DefaultColumns = []Column{
+	{"id", "id"},
+	{"feed", "feed"},
+	{"title", "title"},
+	{"link", "link"},
+	{"description", "description"},
+	{"published", "published"},
+}
+
+// Table is the table the items are inserted into.
+type Table struct {
+	Name    string
+	Columns []Column
+	// Placeholder is the parameter style of the driver, Dollar if empty.
+	Placeholder string
+	// BatchSize bounds the rows per statement of BatchAction,
+	// DefaultBatchSize if zero.
+	BatchSize int
+}
+
+// Open opens the database of the DSN with the registered driver, e.g.
+// "postgres" or "clickhouse".
+func Open(driver, dsn string) (*sql.DB, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s database: %w", driver, err)
+	}
+	return db, nil
+}
+
+// Action inserts every new item as a row of the table.
+func Action(db *sql.DB, t Table) feedtrigger.NewItemAction {
+	return func(i *gofeed.Item) error {
+		return t.insert(db, []*gofeed.Item{i})
+	}
+}
+
+// BatchAction inserts the new items of a poll with multi-row statements of
+// up to BatchSize rows in a transaction, see Feed.OnNewBatch.
+func BatchAction(db *sql.DB, t Table) feedtrigger.NewBatchAction {
+	size := t.BatchSize
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+	return func(items []*gofeed.Item) error {
+		if len(items) <= size {
+			return t.insert(db, items)
+		}
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("inserting into %s: %w", t.Name, err)
+		}
+		for len(items) > 0 {
+			n := size
+			if n > len(items) {
+				n = len(items)
+			}
+			query, args := t.statement(items[:n])
+			if _, err := tx.Exec(query, args...); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("inserting into %s: %w", t.Name, err)
+			}
+			items = items[n:]
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("inserting into %s: %w", t.Name, err)
+		}
+		return nil
+	}
+}
+
+func (t Table) insert(db *sql.DB, items []*gofeed.Item) error {
+	if len(items) == 0 {
+		return nil
+	}
+	query, args := t.statement(items)
+	if _, err := db.Exec(query, args...); err != nil {
+		return fmt.Errorf("inserting into %s: %w", t.Name, err)
+	}
+	return nil
+}
+
+// statement returns the multi-row INSERT of the items.
+func (t Table) statement(items []*gofeed.Item) (string, []interface{}) {
+	cols := t.Columns
+	if len(cols) == 0 {
+		cols = DefaultColumns
+	}
+	names := make([]string, len(cols))
+	for n, c := range cols {
+		names[n] = c.Name
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "INSERT INTO %s (%s) VALUES ", t.Name, strings.Join(names, ", "))
+	args := make([]interface{}, 0, len(items)*len(cols))
+	for r, i := range items {
+		if r > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteByte('(')
+		for n, c := range cols {
+			if n > 0 {
+				b.WriteString(", ")
+			}
+			args = append(args, Value(i, c.Field))
+			if t.Placeholder == Question {
+				b.WriteByte('?')
+			} else {
+				fmt.Fprintf(&b, "$%d", len(args))
+			}
+		}
+		b.WriteByte(')')
+	}
+	return b.String(), args
+}
+
+// Value returns the item field: "id", "guid", "title", "link",
+// "description", "content", "author", "categories" (comma separated),
+// "published" and "updated" (times, nil if missing), "feed" (the feed URL),
+// "label.<key>" and "metadata.<key>". Unknown fields are nil.
+func Value(i *gofeed.Item, field string) interface{} {
+	switch {
+	case strings.HasPrefix(field, "label."):
+		return feedtrigger.ItemFeed(i).Labels[strings.TrimPrefix(field, "label.")]
+	case strings.HasPrefix(field, "metadata."):
+		return feedtrigger.ItemFeed(i).Metadata[strings.TrimPrefix(field, "metadata.")]
+	}
+	switch field {
+	case "id":
+		return feedtrigger.ItemID(i)
+	case "guid":
+		return i.GUID
+	case "title":
+		return i.Title
+	case "link":
+		return i.Link
+	case "description":
+		return i.Description
+	case "content":
+		return i.Content
+	case "author":
+		if i.Author == nil {
+			return ""
+		}
+		return i.Author.Name
+	case "categories":
+		return strings.Join(i.Categories, ",")
+	case "published":
+		if i.PublishedParsed == nil {
+			return nil
+		}
+		return i.PublishedParsed.UTC()
+	case "updated":
+		if i.UpdatedParsed == nil {
+			return nil
+		}
+		return i.UpdatedParsed.UTC()
+	case "feed":
+		return feedtrigger.ItemFeed(i).URL
+	}
+	return nil
+}
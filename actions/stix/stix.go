@@ -0,0 +1,214 @@
+// Package stix converts feed items and their indicators into STIX 2.1
+// bundles, written to disk or posted to a TAXII 2.1 collection.
+package stix
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+	"ilya.app/feedtrigger/actions/ioc"
+)
+
+// namespace is the UUIDv5 namespace of the generated object IDs, so the
+// same item always produces the same objects.
+var namespace = [16]byte{0x8a, 0x4d, 0x2c, 0x1e, 0x5b, 0x3f, 0x4a, 0x91, 0xb2, 0x6e, 0x0d, 0x7c, 0x55, 0x13, 0xf0, 0x42}
+
+// Object is a STIX domain object, only the properties used here.
+type Object struct {
+	Type               string              `json:"type"`
+	SpecVersion        string              `json:"spec_version"`
+	ID                 string              `json:"id"`
+	Created            string              `json:"created"`
+	Modified           string              `json:"modified"`
+	Name               string              `json:"name,omitempty"`
+	Description        string              `json:"description,omitempty"`
+	Published          string              `json:"published,omitempty"`
+	ReportTypes        []string            `json:"report_types,omitempty"`
+	ObjectRefs         []string            `json:"object_refs,omitempty"`
+	Pattern            string              `json:"pattern,omitempty"`
+	PatternType        string              `json:"pattern_type,omitempty"`
+	ValidFrom          string              `json:"valid_from,omitempty"`
+	IndicatorTypes     []string            `json:"indicator_types,omitempty"`
+	ExternalReferences []ExternalReference `json:"external_references,omitempty"`
+	Labels             []string            `json:"labels,omitempty"`
+}
+
+// ExternalReference points to a source outside of STIX.
+type ExternalReference struct {
+	SourceName string `json:"source_name"`
+	URL        string `json:"url,omitempty"`
+	ExternalID string `json:"external_id,omitempty"`
+}
+
+// Bundle is a STIX bundle.
+type Bundle struct {
+	Type    string    `json:"type"`
+	ID      string    `json:"id"`
+	Objects []*Object `json:"objects"`
+}
+
+// Convert returns a bundle with a report of the item referencing an
+// indicator for every IP address, domain, URL and hash, and a
+// vulnerability for every CVE found in it.
+func Convert(i *gofeed.Item) *Bundle {
+	itemID := feedtrigger.ItemID(i)
+	ts := time.Now().UTC()
+	if i.PublishedParsed != nil {
+		ts = i.PublishedParsed.UTC()
+	}
+	stamp := ts.Format("2006-01-02T15:04:05.000Z")
+
+	newObject := func(typ, key string) *Object {
+		return &Object{
+			Type:        typ,
+			SpecVersion: "2.1",
+			ID:          typ + "--" + uuid5(itemID+"\x00"+typ+"\x00"+key),
+			Created:     stamp,
+			Modified:    stamp,
+		}
+	}
+
+	report := newObject("report", "")
+	report.Name = i.Title
+	report.Description = i.Description
+	report.Published = stamp
+	report.ReportTypes = []string{"threat-report"}
+	report.Labels = i.Categories
+	if i.Link != "" {
+		report.ExternalReferences = []ExternalReference{{SourceName: "feed", URL: i.Link}}
+	}
+
+	b := &Bundle{Type: "bundle", ID: "bundle--" + uuid5(itemID)}
+	indicate := func(pattern, name string) {
+		o := newObject("indicator", pattern)
+		o.Name = name
+		o.Pattern = pattern
+		o.PatternType = "stix"
+		o.ValidFrom = stamp
+		o.IndicatorTypes = []string{"malicious-activity"}
+		b.Objects = append(b.Objects, o)
+	}
+
+	set := ioc.FromItem(i)
+	for _, v := range set.IPs {
+		typ := "ipv4-addr"
+		if strings.Contains(v, ":") {
+			typ = "ipv6-addr"
+		}
+		indicate(fmt.Sprintf("[%s:value = '%s']", typ, quote(v)), v)
+	}
+	for _, v := range set.Domains {
+		indicate(fmt.Sprintf("[domain-name:value = '%s']", quote(v)), v)
+	}
+	for _, v := range set.URLs {
+		indicate(fmt.Sprintf("[url:value = '%s']", quote(v)), v)
+	}
+	hashes := []struct {
+		algo   string
+		values []string
+	}{{"MD5", set.MD5}, {"SHA-1", set.SHA1}, {"SHA-256", set.SHA256}}
+	for _, h := range hashes {
+		for _, v := range h.values {
+			indicate(fmt.Sprintf("[file:hashes.'%s' = '%s']", h.algo, v), v)
+		}
+	}
+	for _, v := range set.CVEs {
+		o := newObject("vulnerability", v)
+		o.Name = v
+		o.ExternalReferences = []ExternalReference{{SourceName: "cve", ExternalID: v}}
+		b.Objects = append(b.Objects, o)
+	}
+
+	for _, o := range b.Objects {
+		report.ObjectRefs = append(report.ObjectRefs, o.ID)
+	}
+	if len(report.ObjectRefs) == 0 {
+		// object_refs can't be empty, the report references itself
+		report.ObjectRefs = []string{report.ID}
+	}
+	b.Objects = append([]*Object{report}, b.Objects...)
+	return b
+}
+
+// Writer delivers a bundle.
+type Writer func(*Bundle) error
+
+// Action converts every new item and passes the bundle to w.
+func Action(w Writer) feedtrigger.NewItemAction {
+	return func(i *gofeed.Item) error {
+		return w(Convert(i))
+	}
+}
+
+// ToDir writes every bundle as a JSON file named by its ID into dir.
+func ToDir(dir string) Writer {
+	return func(b *Bundle) error {
+		data, err := json.MarshalIndent(b, "", "  ")
+		if err != nil {
+			return fmt.Errorf("encoding bundle: %w", err)
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		return ioutil.WriteFile(filepath.Join(dir, b.ID+".json"), data, 0644)
+	}
+}
+
+// ToTAXII posts the objects of every bundle to the TAXII 2.1 collection,
+// e.g. https://taxii.example.com/api1/collections/<id>/. Basic auth is used
+// if user is set.
+func ToTAXII(collectionURL, user, password string) Writer {
+	endpoint := strings.TrimSuffix(collectionURL, "/") + "/objects/"
+	return func(b *Bundle) error {
+		data, err := json.Marshal(map[string]interface{}{"objects": b.Objects})
+		if err != nil {
+			return fmt.Errorf("encoding envelope: %w", err)
+		}
+		req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/taxii+json;version=2.1")
+		req.Header.Set("Accept", "application/taxii+json;version=2.1")
+		req.Header.Set("User-Agent", feedtrigger.UserAgent)
+		if user != "" {
+			req.SetBasicAuth(user, password)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("posting to TAXII collection: %s", resp.Status)
+		}
+		return nil
+	}
+}
+
+// uuid5 returns a name-based UUID of the name in the package namespace.
+func uuid5(name string) string {
+	h := sha1.New()
+	h.Write(namespace[:])
+	h.Write([]byte(name))
+	u := h.Sum(nil)[:16]
+	u[6] = u[6]&0x0f | 0x50
+	u[8] = u[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", u[0:4], u[4:6], u[6:8], u[8:10], u[10:16])
+}
+
+// quote escapes the value for a STIX pattern string literal.
+func quote(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v)
+}
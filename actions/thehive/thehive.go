@@ -0,0 +1,156 @@
+// Package thehive raises TheHive 5 alerts for feed items.
+package thehive
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+	"ilya.app/feedtrigger/actions/ioc"
+)
+
+// TLP and PAP levels.
+const (
+	White = 0
+	Green = 1
+	Amber = 2
+	Red   = 3
+)
+
+// Observable is an alert observable.
+type Observable struct {
+	DataType string   `json:"dataType"`
+	Data     string   `json:"data"`
+	IOC      bool     `json:"ioc,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+}
+
+// Alert is the template of the raised alerts.
+type Alert struct {
+	// Source names the feed, it's part of the alert deduplication key
+	// with the item ID, so it should be unique per feed, e.g. its URL.
+	Source string
+	// Type is the alert type, "feed" if empty.
+	Type string
+	// Severity is 1 (low) to 4 (critical), 2 if zero.
+	Severity int
+	TLP      int
+	PAP      int
+	Tags     []string
+	// Filter limits alerts to the matching items.
+	Filter feedtrigger.ItemFilter
+	// Observables maps an item to alert observables, DefaultObservables if
+	// nil.
+	Observables func(*gofeed.Item) []Observable
+}
+
+// DefaultObservables maps the indicators extracted from the item to
+// observables.
+func DefaultObservables(i *gofeed.Item) []Observable {
+	set := ioc.FromItem(i)
+	var obs []Observable
+	add := func(typ string, values []string) {
+		for _, v := range values {
+			obs = append(obs, Observable{DataType: typ, Data: v, IOC: true})
+		}
+	}
+	add("ip", set.IPs)
+	add("domain", set.Domains)
+	add("url", set.URLs)
+	add("hash", set.MD5)
+	add("hash", set.SHA1)
+	add("hash", set.SHA256)
+	for _, v := range set.CVEs {
+		obs = append(obs, Observable{DataType: "other", Data: v, Tags: []string{"cve"}})
+	}
+	return obs
+}
+
+// Action raises an alert in TheHive at baseURL for every new item passing
+// the template filter. The alert sourceRef is derived from the template
+// source and the item ID, so an alert already raised for the item is
+// treated as delivered.
+func Action(baseURL, apiKey string, tmpl Alert) feedtrigger.NewItemAction {
+	endpoint := strings.TrimSuffix(baseURL, "/") + "/api/v1/alert"
+	return func(i *gofeed.Item) error {
+		if tmpl.Filter != nil && !tmpl.Filter(i) {
+			return nil
+		}
+
+		typ := tmpl.Type
+		if typ == "" {
+			typ = "feed"
+		}
+		severity := tmpl.Severity
+		if severity == 0 {
+			severity = 2
+		}
+		mapping := tmpl.Observables
+		if mapping == nil {
+			mapping = DefaultObservables
+		}
+		description := i.Description
+		if description == "" {
+			description = i.Title
+		}
+		if i.Link != "" {
+			description += "\n\n" + i.Link
+		}
+
+		alert := map[string]interface{}{
+			"type":        typ,
+			"source":      tmpl.Source,
+			"sourceRef":   SourceRef(tmpl.Source, i),
+			"title":       i.Title,
+			"description": description,
+			"severity":    severity,
+			"tlp":         tmpl.TLP,
+			"pap":         tmpl.PAP,
+			"tags":        tmpl.Tags,
+			"observables": mapping(i),
+		}
+		if i.PublishedParsed != nil {
+			alert["date"] = i.PublishedParsed.UnixNano() / 1e6
+		}
+		data, err := json.Marshal(alert)
+		if err != nil {
+			return fmt.Errorf("encoding alert: %w", err)
+		}
+
+		req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", feedtrigger.UserAgent)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return nil
+		}
+		b, _ := ioutil.ReadAll(resp.Body)
+		if resp.StatusCode == http.StatusBadRequest && bytes.Contains(bytes.ToLower(b), []byte("already exist")) {
+			return nil
+		}
+		return fmt.Errorf("raising alert: %s: %s", resp.Status, bytes.TrimSpace(b))
+	}
+}
+
+// SourceRef returns the alert deduplication reference of the item from the
+// source.
+func SourceRef(source string, i *gofeed.Item) string {
+	sum := sha1.Sum([]byte(source + "#" + feedtrigger.ItemID(i)))
+	return hex.EncodeToString(sum[:])
+}
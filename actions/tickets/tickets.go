@@ -0,0 +1,223 @@
+// Package tickets files a GitHub issue or a Jira ticket per feed item, e.g.
+// to turn security advisories into tracked work. The tickets filed are
+// remembered in a store, so an entry never gets a duplicate ticket.
+package tickets
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/philippgille/gokv"
+
+	"ilya.app/feedtrigger"
+	"ilya.app/feedtrigger/render"
+)
+
+// keyPrefix prefixes the store keys of the filed tickets.
+const keyPrefix = "tickets/"
+
+// Tracker files tickets.
+type Tracker interface {
+	// Create files the ticket and returns its reference, e.g. its URL.
+	Create(t Ticket) (string, error)
+}
+
+// Ticket is a rendered ticket.
+type Ticket struct {
+	Title     string
+	Body      string
+	Labels    []string
+	Assignees []string
+}
+
+// Template is the template of the filed tickets.
+type Template struct {
+	// Title and Body render the ticket, the item title and its description
+	// followed by the link if nil.
+	Title *render.Template
+	Body  *render.Template
+	// Labels and Assignees are set on every ticket.
+	Labels    []string
+	Assignees []string
+	// Filter limits tickets to the matching items.
+	Filter feedtrigger.ItemFilter
+}
+
+// Action files a ticket with the tracker for every new item passing the
+// template filter, unless one was filed for the item before according to
+// the store.
+func Action(tr Tracker, tmpl Template, store gokv.Store) feedtrigger.NewItemAction {
+	var mu sync.Mutex
+	return func(i *gofeed.Item) error {
+		if tmpl.Filter != nil && !tmpl.Filter(i) {
+			return nil
+		}
+		mu.Lock()
+		defer mu.Unlock()
+
+		key := keyPrefix + Key(i)
+		var ref string
+		found, err := store.Get(key, &ref)
+		if err != nil {
+			return fmt.Errorf("get ticket: %w", err)
+		}
+		if found {
+			return nil
+		}
+
+		t, err := tmpl.render(i)
+		if err != nil {
+			return err
+		}
+		ref, err = tr.Create(t)
+		if err != nil {
+			return err
+		}
+		if err := store.Set(key, ref); err != nil {
+			return fmt.Errorf("store ticket %s: %w", ref, err)
+		}
+		return nil
+	}
+}
+
+// Key returns the deduplication key of the item: a hash of its feed and ID.
+func Key(i *gofeed.Item) string {
+	sum := sha1.Sum([]byte(feedtrigger.ItemFeed(i).URL + "#" + feedtrigger.ItemID(i)))
+	return hex.EncodeToString(sum[:])
+}
+
+func (tmpl Template) render(i *gofeed.Item) (Ticket, error) {
+	t := Ticket{Title: i.Title, Body: i.Description, Labels: tmpl.Labels, Assignees: tmpl.Assignees}
+	if i.Link != "" {
+		t.Body = strings.TrimSpace(t.Body + "\n\n" + i.Link)
+	}
+	var err error
+	if tmpl.Title != nil {
+		if t.Title, err = tmpl.Title.Render(i); err != nil {
+			return t, fmt.Errorf("rendering title: %w", err)
+		}
+	}
+	if tmpl.Body != nil {
+		if t.Body, err = tmpl.Body.Render(i); err != nil {
+			return t, fmt.Errorf("rendering body: %w", err)
+		}
+	}
+	t.Title = strings.TrimSpace(t.Title)
+	if t.Title == "" {
+		t.Title = "Untitled feed entry"
+	}
+	return t, nil
+}
+
+// GitHub files issues in a GitHub repository.
+type GitHub struct {
+	Owner string
+	Repo  string
+	Token string
+	// BaseURL is the API root, https://api.github.com if empty.
+	BaseURL string
+}
+
+// Create implements Tracker, returning the issue URL.
+func (g *GitHub) Create(t Ticket) (string, error) {
+	base := g.BaseURL
+	if base == "" {
+		base = "https://api.github.com"
+	}
+	issue := map[string]interface{}{"title": t.Title, "body": t.Body}
+	if len(t.Labels) > 0 {
+		issue["labels"] = t.Labels
+	}
+	if len(t.Assignees) > 0 {
+		issue["assignees"] = t.Assignees
+	}
+	var created struct {
+		HTMLURL string `json:"html_url"`
+	}
+	endpoint := fmt.Sprintf("%s/repos/%s/%s/issues", strings.TrimSuffix(base, "/"), g.Owner, g.Repo)
+	err := post(endpoint, "Bearer "+g.Token, issue, &created)
+	if err != nil {
+		return "", fmt.Errorf("creating issue: %w", err)
+	}
+	return created.HTMLURL, nil
+}
+
+// Jira files tickets in a Jira project.
+type Jira struct {
+	// BaseURL is the instance root, e.g. https://example.atlassian.net.
+	BaseURL string
+	Project string
+	// IssueType is "Task" if empty.
+	IssueType string
+	// User and Token authenticate with basic auth on Jira Cloud, Token
+	// alone is a personal access token of Jira Data Center.
+	User  string
+	Token string
+}
+
+// Create implements Tracker, returning the issue key. The first assignee
+// is assigned by account ID.
+func (j *Jira) Create(t Ticket) (string, error) {
+	typ := j.IssueType
+	if typ == "" {
+		typ = "Task"
+	}
+	fields := map[string]interface{}{
+		"project":     map[string]string{"key": j.Project},
+		"summary":     t.Title,
+		"description": t.Body,
+		"issuetype":   map[string]string{"name": typ},
+	}
+	if len(t.Labels) > 0 {
+		fields["labels"] = t.Labels
+	}
+	if len(t.Assignees) > 0 {
+		fields["assignee"] = map[string]string{"accountId": t.Assignees[0]}
+	}
+	auth := "Bearer " + j.Token
+	if j.User != "" {
+		auth = "Basic " + base64.StdEncoding.EncodeToString([]byte(j.User+":"+j.Token))
+	}
+	var created struct {
+		Key string `json:"key"`
+	}
+	endpoint := strings.TrimSuffix(j.BaseURL, "/") + "/rest/api/2/issue"
+	if err := post(endpoint, auth, map[string]interface{}{"fields": fields}, &created); err != nil {
+		return "", fmt.Errorf("creating ticket: %w", err)
+	}
+	return created.Key, nil
+}
+
+func post(endpoint, auth string, v, out interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", auth)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", feedtrigger.UserAgent)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	b, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(b))
+	}
+	return json.Unmarshal(b, out)
+}
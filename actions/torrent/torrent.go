@@ -0,0 +1,307 @@
+// Package torrent hands the items of torrent feeds over to BitTorrent
+// clients: Transmission and qBittorrent.
+package torrent
+
+import (
+	"bytes"
+	"encoding/base32"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+	"ilya.app/feedtrigger/actions"
+)
+
+// MIMEType is the type of .torrent enclosures.
+const MIMEType = "application/x-bittorrent"
+
+// ErrNoTorrent is returned for items without a magnet link or a torrent.
+var ErrNoTorrent = errors.New("no magnet link or torrent in the item")
+
+// Link returns the magnet link of the item if it has one, the URL of its
+// .torrent file otherwise. Magnet links are looked up in the link, the
+// GUID, the enclosures and the torrent:magnetURI extension; torrents in
+// the enclosures of MIMEType and links ending with .torrent.
+func Link(i *gofeed.Item) string {
+	if m := Magnet(i); m != "" {
+		return m
+	}
+	for _, e := range i.Enclosures {
+		if e != nil && e.Type == MIMEType {
+			return e.URL
+		}
+	}
+	if u, err := url.Parse(i.Link); err == nil && strings.HasSuffix(u.Path, ".torrent") {
+		return i.Link
+	}
+	return ""
+}
+
+// Magnet returns the magnet link of the item, if any.
+func Magnet(i *gofeed.Item) string {
+	candidates := []string{i.Link, i.GUID}
+	for _, e := range i.Enclosures {
+		if e != nil {
+			candidates = append(candidates, e.URL)
+		}
+	}
+	if t := i.Extensions["torrent"]; t != nil {
+		for _, e := range t["magnetURI"] {
+			candidates = append(candidates, strings.TrimSpace(e.Value))
+		}
+	}
+	for _, c := range candidates {
+		if strings.HasPrefix(c, "magnet:?") {
+			return c
+		}
+	}
+	return ""
+}
+
+// InfoHash returns the lowercase hex info hash of the item from its magnet
+// link or the torrent:infoHash and nyaa:infoHash extensions. It can be
+// used as the Dedup key of torrent feeds, which often republish the same
+// torrent under different links.
+func InfoHash(i *gofeed.Item) string {
+	if m := Magnet(i); m != "" {
+		if u, err := url.Parse(m); err == nil {
+			for _, xt := range u.Query()["xt"] {
+				if h := strings.TrimPrefix(xt, "urn:btih:"); h != xt {
+					return normalizeHash(h)
+				}
+			}
+		}
+	}
+	for _, ns := range []string{"torrent", "nyaa"} {
+		if els := i.Extensions[ns]; els != nil && len(els["infoHash"]) > 0 {
+			return normalizeHash(els["infoHash"][0].Value)
+		}
+	}
+	return ""
+}
+
+// normalizeHash converts a base32 info hash into hex.
+func normalizeHash(h string) string {
+	h = strings.TrimSpace(h)
+	if len(h) == 32 {
+		if b, err := base32.StdEncoding.DecodeString(strings.ToUpper(h)); err == nil {
+			return hex.EncodeToString(b)
+		}
+	}
+	return strings.ToLower(h)
+}
+
+// Transmission adds torrents through the Transmission RPC API.
+type Transmission struct {
+	// URL of the RPC endpoint, e.g. http://localhost:9091/transmission/rpc.
+	URL      string
+	Username string
+	Password string
+	// DownloadDir overrides the default download directory.
+	DownloadDir string
+	// Paused adds the torrents without starting them.
+	Paused bool
+	// Client is http.DefaultClient if nil.
+	Client *http.Client
+
+	mu sync.Mutex
+	// session is the CSRF token of the RPC API.
+	session string
+}
+
+// TransmissionAction adds the torrents of the items to Transmission.
+func TransmissionAction(rpcURL string) feedtrigger.NewItemAction {
+	t := &Transmission{URL: rpcURL}
+	return t.Add
+}
+
+func init() {
+	actions.Register("transmission", func(p actions.Params) (feedtrigger.NewItemAction, error) {
+		return TransmissionAction(p.String("rpc_url")), nil
+	}, feedtrigger.ActionParam{Name: "rpc_url", Type: feedtrigger.ParamString, Required: true, Doc: "Transmission RPC URL"})
+	actions.Register("qbittorrent", func(p actions.Params) (feedtrigger.NewItemAction, error) {
+		return QBittorrentAction(p.String("url"), p.String("username"), p.String("password")), nil
+	},
+		feedtrigger.ActionParam{Name: "url", Type: feedtrigger.ParamString, Required: true, Doc: "web UI URL"},
+		feedtrigger.ActionParam{Name: "username", Type: feedtrigger.ParamString},
+		feedtrigger.ActionParam{Name: "password", Type: feedtrigger.ParamString})
+}
+
+// Add adds the torrent of the item.
+func (t *Transmission) Add(i *gofeed.Item) error {
+	link := Link(i)
+	if link == "" {
+		return ErrNoTorrent
+	}
+	args := map[string]interface{}{"filename": link}
+	if t.DownloadDir != "" {
+		args["download-dir"] = t.DownloadDir
+	}
+	if t.Paused {
+		args["paused"] = true
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"method":    "torrent-add",
+		"arguments": args,
+	})
+	if err != nil {
+		return err
+	}
+
+	// the first request of a session is rejected with the token to use
+	for attempt := 0; attempt < 2; attempt++ {
+		req, err := http.NewRequest(http.MethodPost, t.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if t.Username != "" {
+			req.SetBasicAuth(t.Username, t.Password)
+		}
+		t.mu.Lock()
+		req.Header.Set("X-Transmission-Session-Id", t.session)
+		t.mu.Unlock()
+
+		resp, err := client(t.Client).Do(req)
+		if err != nil {
+			return fmt.Errorf("transmission: %w", err)
+		}
+		data, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("transmission: %w", err)
+		}
+		if resp.StatusCode == http.StatusConflict {
+			t.mu.Lock()
+			t.session = resp.Header.Get("X-Transmission-Session-Id")
+			t.mu.Unlock()
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("transmission: unexpected status %s", resp.Status)
+		}
+		var r struct {
+			Result string `json:"result"`
+		}
+		if err := json.Unmarshal(data, &r); err != nil {
+			return fmt.Errorf("transmission: decoding response: %w", err)
+		}
+		if r.Result != "success" {
+			return fmt.Errorf("transmission: %s", r.Result)
+		}
+		return nil
+	}
+	return errors.New("transmission: session token rejected")
+}
+
+// QBittorrent adds torrents through the qBittorrent Web API.
+type QBittorrent struct {
+	// URL of the Web UI, e.g. http://localhost:8080.
+	URL      string
+	Username string
+	Password string
+	// SavePath overrides the default download directory.
+	SavePath string
+	Category string
+	// Paused adds the torrents without starting them.
+	Paused bool
+	// Client is a client with its own cookie jar if nil.
+	Client *http.Client
+
+	once   sync.Once
+	client *http.Client
+}
+
+// QBittorrentAction adds the torrents of the items to qBittorrent.
+func QBittorrentAction(webURL, username, password string) feedtrigger.NewItemAction {
+	q := &QBittorrent{URL: webURL, Username: username, Password: password}
+	return q.Add
+}
+
+// Add adds the torrent of the item, logging in if the session expired.
+func (q *QBittorrent) Add(i *gofeed.Item) error {
+	link := Link(i)
+	if link == "" {
+		return ErrNoTorrent
+	}
+	q.once.Do(func() {
+		q.client = q.Client
+		if q.client == nil {
+			jar, _ := cookiejar.New(nil)
+			q.client = &http.Client{Jar: jar}
+		}
+	})
+
+	form := url.Values{"urls": {link}}
+	if q.SavePath != "" {
+		form.Set("savepath", q.SavePath)
+	}
+	if q.Category != "" {
+		form.Set("category", q.Category)
+	}
+	if q.Paused {
+		form.Set("paused", "true")
+	}
+	status, body, err := q.post("/api/v2/torrents/add", form)
+	if err == nil && status == http.StatusForbidden {
+		if err := q.login(); err != nil {
+			return err
+		}
+		status, body, err = q.post("/api/v2/torrents/add", form)
+	}
+	if err != nil {
+		return fmt.Errorf("qbittorrent: %w", err)
+	}
+	if status != http.StatusOK || strings.TrimSpace(body) != "Ok." {
+		return fmt.Errorf("qbittorrent: adding torrent: %d %s", status, body)
+	}
+	return nil
+}
+
+func (q *QBittorrent) login() error {
+	status, body, err := q.post("/api/v2/auth/login", url.Values{
+		"username": {q.Username},
+		"password": {q.Password},
+	})
+	if err != nil {
+		return fmt.Errorf("qbittorrent: logging in: %w", err)
+	}
+	if status != http.StatusOK || strings.TrimSpace(body) != "Ok." {
+		return fmt.Errorf("qbittorrent: logging in: %d %s", status, body)
+	}
+	return nil
+}
+
+func (q *QBittorrent) post(path string, form url.Values) (int, string, error) {
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(q.URL, "/")+path, strings.NewReader(form.Encode()))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	// the API rejects requests with a foreign origin
+	req.Header.Set("Referer", q.URL)
+	resp, err := q.client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	return resp.StatusCode, string(data), err
+}
+
+func client(c *http.Client) *http.Client {
+	if c == nil {
+		return http.DefaultClient
+	}
+	return c
+}
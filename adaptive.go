@@ -0,0 +1,109 @@
+package feedtrigger
+
+import (
+	"sort"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// DefaultAdaptiveWeight is the weight of the newest interval between items
+// in the average by default.
+const DefaultAdaptiveWeight = 0.3
+
+// AdaptiveInterval polls a feed more often while it publishes often and
+// less while it's quiet. The poll interval is half of the moving average of
+// the intervals between items, or of the time since the last item if it's
+// longer, within [Min, Max].
+type AdaptiveInterval struct {
+	// Min and Max bound the interval, Min defaults to the refresh period.
+	Min time.Duration
+	Max time.Duration
+	// Weight of the newest interval in the exponentially weighted moving
+	// average, DefaultAdaptiveWeight if zero.
+	Weight float64
+}
+
+// observe updates the average interval between items with the new ones.
+func (h *FeedHead) observe(f Feed, items []*gofeed.Item, now time.Time) {
+	if f.Adaptive == nil {
+		return
+	}
+	w := f.Adaptive.Weight
+	if w <= 0 || w > 1 {
+		w = DefaultAdaptiveWeight
+	}
+	times := make([]time.Time, 0, len(items))
+	for _, i := range items {
+		t := now
+		if i.PublishedParsed != nil && i.PublishedParsed.Before(now) {
+			t = *i.PublishedParsed
+		}
+		times = append(times, t)
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	for _, t := range times {
+		if !t.After(h.LastItem) {
+			continue
+		}
+		if !h.LastItem.IsZero() {
+			gap := t.Sub(h.LastItem)
+			if h.Interval == 0 {
+				h.Interval = gap
+			} else {
+				h.Interval = time.Duration(w*float64(gap) + (1-w)*float64(h.Interval))
+			}
+		}
+		h.LastItem = t
+	}
+}
+
+// adapt remembers the average interval for scheduling.
+func (a *FeedAction) adapt(f Feed, h *FeedHead) {
+	if f.Adaptive == nil {
+		return
+	}
+	s := a.state(f.URL)
+	s.mu.Lock()
+	s.interval, s.lastItem = h.Interval, h.LastItem
+	s.mu.Unlock()
+}
+
+// adaptiveDelay returns the learned poll interval of the feed, zero if it
+// isn't adaptive or nothing was learned yet.
+func (a *FeedAction) adaptiveDelay(f Feed) time.Duration {
+	ad := f.Adaptive
+	if ad == nil {
+		return 0
+	}
+	s := a.state(f.URL)
+	s.mu.Lock()
+	interval, last := s.interval, s.lastItem
+	s.mu.Unlock()
+	if interval == 0 {
+		return 0
+	}
+	if quiet := a.now().Sub(last); quiet > interval {
+		interval = quiet
+	}
+	d := interval / 2
+	min := ad.Min
+	if min <= 0 {
+		min = f.RefreshPeriod
+	}
+	if d < min {
+		d = min
+	}
+	if ad.Max > 0 && d > ad.Max {
+		d = ad.Max
+	}
+	return d
+}
+
+// period is the longest expected time between polls of the feed.
+func (f Feed) period() time.Duration {
+	if f.Adaptive != nil && f.Adaptive.Max > f.RefreshPeriod {
+		return f.Adaptive.Max
+	}
+	return f.RefreshPeriod
+}
@@ -0,0 +1,304 @@
+package feedtrigger
+
+import (
+	"encoding/json"
+	"expvar"
+	"net/http"
+	"strconv"
+)
+
+// AdminHandler returns the admin HTTP API of the running application:
+//
+//	GET  /                   the dashboard, see Dashboard
+//	POST /op                 dashboard buttons
+//	GET  /branding?feed=     cached icon of the feed
+//	GET  /feeds              status of the feeds, see Status
+//	GET  /feeds/head?url=    stored state of the feed
+//	GET  /feeds/cost?n=&by=  the most expensive feeds, see TopCosts
+//	POST /feeds/actions?url= wire the feed to the named actions of the body,
+//	                         e.g. ["alerts","archive"]
+//	GET  /actions            the named actions and the registry types
+//	POST /actions?name=      define the named action of the body, e.g.
+//	                         {"type":"discord","params":{...}}
+//	POST /feeds/poll?url=    poll the feed right away
+//	POST /feeds/pause?url=   stop fetching the feed
+//	POST /feeds/resume?url=  resume fetching the feed
+//	POST /feeds/remove?url=  stop polling the feed, see RemoveFeed
+//	GET  /state              stored state of the feeds, see ExportState
+//	POST /state              replace the stored state, see ImportState
+//	GET  /items/watch        stream of the delivered items as JSON lines
+//	GET  /watchlist          hits per watchlist keyword
+//	GET  /tenants            status of the tenants
+//	POST /tenants/start?name= start polling the feeds of the tenant
+//	POST /tenants/stop?name=  stop polling the feeds of the tenant
+//	GET  /groups             status of the feed groups
+//	GET  /groups/feeds?name= status of the feeds of the group
+//	POST /groups/poll?name=  poll the feeds of the group right away
+//	POST /groups/pause?name= stop fetching the feeds of the group
+//	POST /groups/resume?name= resume fetching the feeds of the group
+//	GET  /healthz, /readyz   probes, see Healthz and Readyz
+//	GET  /debug/vars         expvar counters
+//
+// It's the management API for other services too: there is no gRPC one,
+// the items are followed with /items/watch and the feeds are added in
+// process with AddFeed. It has no authentication, so it should only be
+// exposed to operators.
+func (a *FeedAction) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/", a.Dashboard())
+	mux.Handle("/branding", a.BrandingHandler())
+	mux.HandleFunc("/feeds", a.adminFeeds)
+	mux.HandleFunc("/feeds/head", a.adminHead)
+	mux.HandleFunc("/feeds/cost", a.adminCost)
+	mux.HandleFunc("/feeds/actions", a.adminFeedActions)
+	mux.HandleFunc("/actions", a.adminActions)
+	mux.HandleFunc("/feeds/poll", a.adminFeedOp(func(url string) bool { return a.PollNow(url) }))
+	mux.HandleFunc("/feeds/pause", a.adminFeedOp(func(url string) bool {
+		a.PauseFeed(url)
+		return true
+	}))
+	mux.HandleFunc("/feeds/resume", a.adminFeedOp(func(url string) bool {
+		a.ResumeFeed(url)
+		return true
+	}))
+	mux.HandleFunc("/feeds/remove", a.adminFeedOp(a.RemoveFeed))
+	mux.HandleFunc("/state", a.adminState)
+	mux.HandleFunc("/items/watch", a.adminWatch)
+	mux.HandleFunc("/watchlist", a.adminWatchlist)
+	mux.HandleFunc("/tenants", a.adminTenants)
+	mux.HandleFunc("/tenants/start", a.adminTenantOp(a.StartTenant))
+	mux.HandleFunc("/tenants/stop", a.adminTenantOp(a.StopTenant))
+	mux.HandleFunc("/groups", a.adminGroups)
+	mux.HandleFunc("/groups/feeds", a.adminGroupFeeds)
+	mux.HandleFunc("/groups/poll", a.adminGroupOp(a.PollGroup))
+	mux.HandleFunc("/groups/pause", a.adminGroupOp(a.PauseGroup))
+	mux.HandleFunc("/groups/resume", a.adminGroupOp(a.ResumeGroup))
+	mux.Handle("/healthz", a.Healthz())
+	mux.Handle("/readyz", a.Readyz())
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
+
+func (a *FeedAction) adminFeeds(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, a.Status())
+}
+
+func (a *FeedAction) adminState(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		if err := a.ExportState(w); err != nil {
+			a.logf("exporting state: %v", err)
+		}
+	case http.MethodPost:
+		if err := a.ImportState(r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *FeedAction) adminWatchlist(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.Watchlist == nil {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, a.Watchlist.Hits())
+}
+
+func (a *FeedAction) adminCost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	n := 0
+	if s := r.URL.Query().Get("n"); s != "" {
+		var err error
+		if n, err = strconv.Atoi(s); err != nil {
+			http.Error(w, "bad n", http.StatusBadRequest)
+			return
+		}
+	}
+	by := CostMetric(r.URL.Query().Get("by"))
+	if _, err := by.of(PollCost{}); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	costs, err := a.TopCosts(n, by)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, costs)
+}
+
+func (a *FeedAction) adminTenants(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, a.TenantsStatus())
+}
+
+// adminTenantOp handles a POST applying op to the tenant given by the name
+// query parameter.
+func (a *FeedAction) adminTenantOp(op func(name string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		name := r.URL.Query().Get("name")
+		if a.tenant(name) == nil {
+			http.NotFound(w, r)
+			return
+		}
+		if err := op(name); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (a *FeedAction) adminGroups(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	writeJSON(w, a.GroupsStatus())
+}
+
+func (a *FeedAction) adminGroupFeeds(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	status, err := a.GroupFeedsStatus(r.URL.Query().Get("name"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, status)
+}
+
+// adminGroupOp handles a POST applying op to the group given by the name
+// query parameter.
+func (a *FeedAction) adminGroupOp(op func(name string) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := op(r.URL.Query().Get("name")); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (a *FeedAction) adminHead(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	head, found, err := a.Head(r.URL.Query().Get("url"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, head)
+}
+
+// adminFeedOp handles a POST applying op to the feed given by the url
+// query parameter.
+func (a *FeedAction) adminFeedOp(op func(url string) bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		url := r.URL.Query().Get("url")
+		known := false
+		for _, f := range a.ListFeeds() {
+			known = known || f.URL == url
+		}
+		if !known || !op(url) {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (a *FeedAction) adminActions(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		var types []ActionType
+		if a.ActionRegistry != nil {
+			types = a.ActionRegistry.Types()
+		}
+		writeJSON(w, struct {
+			Actions []string     `json:"actions"`
+			Types   []ActionType `json:"types"`
+		}{a.ListActions(), types})
+	case http.MethodPost:
+		var ac ActionConfig
+		if err := json.NewDecoder(r.Body).Decode(&ac); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		name := r.URL.Query().Get("name")
+		if name == "" {
+			http.Error(w, "missing name", http.StatusBadRequest)
+			return
+		}
+		if err := a.DefineAction(name, ac.Type, ac.Params); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (a *FeedAction) adminFeedActions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var names []string
+	if err := json.NewDecoder(r.Body).Decode(&names); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := a.SetFeedActions(r.URL.Query().Get("url"), names...); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
@@ -0,0 +1,40 @@
+package feedtrigger
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// SkipTooOld is the reason of items published longer than the feed
+// MaxItemAge ago.
+const SkipTooOld SkipReason = "too old"
+
+// published returns the publication date of the item, the update date if
+// it has none.
+func published(i *gofeed.Item) *time.Time {
+	if i.PublishedParsed != nil {
+		return i.PublishedParsed
+	}
+	return i.UpdatedParsed
+}
+
+// dropOld returns the items published within the feed MaxItemAge, the ones
+// without a publication or update date are kept.
+func (a *FeedAction) dropOld(f Feed, items []*gofeed.Item, now time.Time) []*gofeed.Item {
+	if f.MaxItemAge <= 0 {
+		return items
+	}
+	cutoff := now.Add(-f.MaxItemAge)
+	var kept []*gofeed.Item
+	for _, i := range items {
+		published := published(i)
+		if published != nil && published.Before(cutoff) && !IsCanary(i) {
+			a.skip(f, i, SkipTooOld, fmt.Sprintf("published %s", published.UTC().Format(time.RFC3339)))
+			continue
+		}
+		kept = append(kept, i)
+	}
+	return kept
+}
@@ -0,0 +1,207 @@
+package feedtrigger
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// Defaults of AnomalyDetector.
+const (
+	DefaultAnomalyWindow  = time.Hour
+	DefaultBurstFactor    = 5
+	DefaultMinBurst       = 5
+	DefaultSilenceFactor  = 3
+	DefaultAnomalySamples = 24
+)
+
+// anomalyWeight is the weight of the newest sample in the moving averages
+// of the activity.
+const anomalyWeight = 0.1
+
+// AnomalyKind is a kind of unusual feed activity.
+type AnomalyKind string
+
+// Anomaly kinds.
+const (
+	// AnomalyBurst is a feed publishing much more than usual, e.g. a burst
+	// of commits to a report repository.
+	AnomalyBurst AnomalyKind = "burst"
+	// AnomalySilence is a feed quiet for much longer than usual.
+	AnomalySilence AnomalyKind = "silence"
+)
+
+// Anomaly is unusual activity of a feed.
+type Anomaly struct {
+	Feed string      `json:"feed"`
+	Kind AnomalyKind `json:"kind"`
+	// Items are the new items of the current window and Expected the
+	// usual number of items per window, for AnomalyBurst.
+	Items    int     `json:"items,omitempty"`
+	Expected float64 `json:"expected,omitempty"`
+	// Silent is the time since the last new item and Usual the usual
+	// interval between new items, for AnomalySilence.
+	Silent time.Duration `json:"silent,omitempty"`
+	Usual  time.Duration `json:"usual,omitempty"`
+}
+
+// AnomalyAction is called with the unusual activity of a feed.
+type AnomalyAction func(Anomaly) error
+
+// AnomalyDetector tracks the posting rate of a feed and reports bursts and
+// silences measured against its history. Nothing is reported until
+// MinSamples windows and intervals between items were seen.
+type AnomalyDetector struct {
+	// Window is the period the new items are counted over,
+	// DefaultAnomalyWindow if zero.
+	Window time.Duration
+	// BurstFactor is how many times the usual number of items per window
+	// makes a burst, DefaultBurstFactor if zero. A burst has at least
+	// MinBurst items, DefaultMinBurst if zero.
+	BurstFactor float64
+	MinBurst    int
+	// SilenceFactor is how many times the usual interval between new items
+	// without any makes a silence, DefaultSilenceFactor if zero.
+	SilenceFactor float64
+	// MinSamples is DefaultAnomalySamples if zero.
+	MinSamples int
+}
+
+// Activity is the posting rate of a feed, kept for feeds with an
+// AnomalyDetector.
+type Activity struct {
+	// WindowStart is the start of the current window and Count the new
+	// items in it.
+	WindowStart time.Time `json:"window_start"`
+	Count       int       `json:"count"`
+	// Rate is the moving average of the items per window over Windows
+	// windows.
+	Rate    float64 `json:"rate"`
+	Windows int     `json:"windows"`
+	// Gap is the moving average of the intervals between new items over
+	// Gaps intervals and LastItem the time the newest one was seen.
+	Gap      time.Duration `json:"gap"`
+	Gaps     int           `json:"gaps"`
+	LastItem time.Time     `json:"last_item,omitempty"`
+	// Burst and Silent are set once the anomaly is reported.
+	Burst  bool `json:"burst,omitempty"`
+	Silent bool `json:"silent,omitempty"`
+}
+
+func (d *AnomalyDetector) window() time.Duration {
+	if d.Window <= 0 {
+		return DefaultAnomalyWindow
+	}
+	return d.Window
+}
+
+func (d *AnomalyDetector) samples() int {
+	if d.MinSamples <= 0 {
+		return DefaultAnomalySamples
+	}
+	return d.MinSamples
+}
+
+// track adds the new items of a poll at now to the activity of the feed and
+// returns the anomalies to report.
+func (h *FeedHead) track(f Feed, items []*gofeed.Item, now time.Time) []Anomaly {
+	d := f.Anomalies
+	if d == nil {
+		return nil
+	}
+	if h.Activity == nil {
+		h.Activity = &Activity{WindowStart: now}
+	}
+	act := h.Activity
+
+	window := d.window()
+	if elapsed := now.Sub(act.WindowStart); elapsed >= window {
+		// close the current window and the empty ones after it
+		n := int(elapsed / window)
+		if act.Windows == 0 {
+			act.Rate = float64(act.Count)
+		} else {
+			act.Rate = anomalyWeight*float64(act.Count) + (1-anomalyWeight)*act.Rate
+		}
+		act.Rate *= math.Pow(1-anomalyWeight, float64(n-1))
+		act.Windows += n
+		act.WindowStart = act.WindowStart.Add(time.Duration(n) * window)
+		act.Count = 0
+		act.Burst = false
+	}
+
+	if len(items) > 0 {
+		act.Count += len(items)
+		if !act.LastItem.IsZero() {
+			gap := now.Sub(act.LastItem)
+			if act.Gaps == 0 {
+				act.Gap = gap
+			} else {
+				act.Gap = time.Duration(anomalyWeight*float64(gap) + (1-anomalyWeight)*float64(act.Gap))
+			}
+			act.Gaps++
+		}
+		act.LastItem = now
+		act.Silent = false
+	}
+
+	var found []Anomaly
+	burst := d.BurstFactor
+	if burst <= 0 {
+		burst = DefaultBurstFactor
+	}
+	min := d.MinBurst
+	if min <= 0 {
+		min = DefaultMinBurst
+	}
+	if !act.Burst && act.Windows >= d.samples() && act.Count >= min && float64(act.Count) > burst*act.Rate {
+		act.Burst = true
+		found = append(found, Anomaly{Feed: f.URL, Kind: AnomalyBurst, Items: act.Count, Expected: act.Rate})
+	}
+	silence := d.SilenceFactor
+	if silence <= 0 {
+		silence = DefaultSilenceFactor
+	}
+	quiet := now.Sub(act.LastItem)
+	if !act.Silent && act.Gaps >= d.samples() && float64(quiet) > silence*float64(act.Gap) {
+		act.Silent = true
+		found = append(found, Anomaly{Feed: f.URL, Kind: AnomalySilence, Silent: quiet, Usual: act.Gap})
+	}
+	return found
+}
+
+// AnomalyItemAction adapts the item action to receive the anomalies as
+// items describing them.
+func AnomalyItemAction(action NewItemAction) AnomalyAction {
+	return func(an Anomaly) error {
+		i := &gofeed.Item{Link: an.Feed}
+		switch an.Kind {
+		case AnomalyBurst:
+			i.Title = fmt.Sprintf("Burst of %d new items in %s", an.Items, an.Feed)
+			i.Description = fmt.Sprintf("%d new items, %.1f expected.", an.Items, an.Expected)
+		case AnomalySilence:
+			i.Title = fmt.Sprintf("%s is silent for %s", an.Feed, an.Silent.Round(time.Minute))
+			i.Description = fmt.Sprintf("No new items for %s, usually one every %s.",
+				an.Silent.Round(time.Minute), an.Usual.Round(time.Minute))
+		}
+		i.Content = i.Description
+		return action(i)
+	}
+}
+
+// reportAnomalies calls the feed OnAnomaly and publishes EventAnomaly for
+// the anomalies.
+func (a *FeedAction) reportAnomalies(f Feed, found []Anomaly) {
+	for n := range found {
+		an := found[n]
+		a.logf("%s: %s anomaly", f.URL, an.Kind)
+		if f.OnAnomaly != nil {
+			if err := f.OnAnomaly(an); err != nil {
+				a.logf("%s: %s anomaly action: %v", f.URL, an.Kind, err)
+			}
+		}
+		a.publish(Event{Type: EventAnomaly, Feed: f.URL, Anomaly: &an})
+	}
+}
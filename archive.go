@@ -0,0 +1,242 @@
+package feedtrigger
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/philippgille/gokv"
+)
+
+const (
+	archiveFeedsKey   = "archive/feeds"
+	archiveIndexKey   = "archive/index/"
+	archiveItemPrefix = "archive/item/"
+)
+
+// ArchivedItem is a triggered item kept in the archive.
+type ArchivedItem struct {
+	Feed       string       `json:"feed"`
+	Item       *gofeed.Item `json:"item"`
+	ArchivedAt time.Time    `json:"archived_at"`
+}
+
+// archiveRef is an index entry of an archived item.
+type archiveRef struct {
+	ID         string    `json:"id"`
+	ArchivedAt time.Time `json:"archived_at"`
+}
+
+// Archive persists every triggered item for later reprocessing and audit.
+// Items are keyed by feed URL and item ID.
+type Archive struct {
+	// Store keeps the archive, the FeedAction store is used if nil.
+	Store gokv.Store
+	// MaxAge drops items archived earlier, zero keeps them forever.
+	MaxAge time.Duration
+	// MaxItems bounds the number of items kept per feed, zero means no
+	// limit.
+	MaxItems int
+	// FullText indexes the words of the archived items for Search, see
+	// its limits there.
+	FullText bool
+
+	mu sync.Mutex
+}
+
+// Put archives the item of the feed.
+func (ar *Archive) Put(feed string, i *gofeed.Item) error {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	now := time.Now().UTC()
+	id := ItemID(i)
+	if ar.FullText {
+		// the words of the previous version may be gone
+		if err := ar.unindex(feed, id); err != nil {
+			return err
+		}
+	}
+	err := ar.Store.Set(archiveItemKey(feed, id), &ArchivedItem{
+		Feed:       feed,
+		Item:       i,
+		ArchivedAt: now,
+	})
+	if err != nil {
+		return fmt.Errorf("archiving item: %w", err)
+	}
+
+	if ar.FullText {
+		if err := ar.indexTerms(feed, i); err != nil {
+			return err
+		}
+	}
+
+	refs, err := ar.index(feed)
+	if err != nil {
+		return err
+	}
+	if len(refs) == 0 {
+		if err := ar.addFeed(feed); err != nil {
+			return err
+		}
+	}
+	for n, ref := range refs {
+		if ref.ID == id {
+			refs = append(refs[:n], refs[n+1:]...)
+			break
+		}
+	}
+	refs = append(refs, archiveRef{ID: id, ArchivedAt: now})
+
+	keep := refs[:0]
+	for n, ref := range refs {
+		expired := ar.MaxAge > 0 && now.Sub(ref.ArchivedAt) > ar.MaxAge
+		overflow := ar.MaxItems > 0 && len(refs)-n > ar.MaxItems
+		if expired || overflow {
+			if err := ar.delete(feed, ref.ID); err != nil {
+				return fmt.Errorf("pruning archive: %w", err)
+			}
+			continue
+		}
+		keep = append(keep, ref)
+	}
+
+	if err := ar.Store.Set(archiveIndexKey+feed, keep); err != nil {
+		return fmt.Errorf("storing archive index: %w", err)
+	}
+	return nil
+}
+
+// Get returns the archived item of the feed by its ID.
+func (ar *Archive) Get(feed, id string) (*ArchivedItem, bool, error) {
+	var item ArchivedItem
+	found, err := ar.Store.Get(archiveItemKey(feed, id), &item)
+	if err != nil || !found {
+		return nil, found, err
+	}
+	return &item, true, nil
+}
+
+// Items returns items of the feed archived since the time, oldest first.
+func (ar *Archive) Items(feed string, since time.Time) ([]ArchivedItem, error) {
+	ar.mu.Lock()
+	refs, err := ar.index(feed)
+	ar.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	var items []ArchivedItem
+	for _, ref := range refs {
+		if ref.ArchivedAt.Before(since) {
+			continue
+		}
+		item, found, err := ar.Get(feed, ref.ID)
+		if err != nil {
+			return nil, fmt.Errorf("get archived item: %w", err)
+		}
+		if found {
+			items = append(items, *item)
+		}
+	}
+	return items, nil
+}
+
+// Feeds returns URLs of the feeds with archived items.
+func (ar *Archive) Feeds() ([]string, error) {
+	var feeds []string
+	if _, err := ar.Store.Get(archiveFeedsKey, &feeds); err != nil {
+		return nil, fmt.Errorf("get archived feeds: %w", err)
+	}
+	sort.Strings(feeds)
+	return feeds, nil
+}
+
+// Purge deletes every archived item of the feed.
+func (ar *Archive) Purge(feed string) error {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	refs, err := ar.index(feed)
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		if err := ar.delete(feed, ref.ID); err != nil {
+			return fmt.Errorf("purging archive: %w", err)
+		}
+	}
+	if err := ar.Store.Delete(archiveIndexKey + feed); err != nil {
+		return fmt.Errorf("purging archive index: %w", err)
+	}
+
+	var feeds []string
+	if _, err := ar.Store.Get(archiveFeedsKey, &feeds); err != nil {
+		return fmt.Errorf("get archived feeds: %w", err)
+	}
+	kept := feeds[:0]
+	for _, f := range feeds {
+		if f != feed {
+			kept = append(kept, f)
+		}
+	}
+	if err := ar.Store.Set(archiveFeedsKey, kept); err != nil {
+		return fmt.Errorf("storing archived feeds: %w", err)
+	}
+	return nil
+}
+
+// delete removes the archived item and its full-text index entries, ar.mu
+// must be held.
+func (ar *Archive) delete(feed, id string) error {
+	if ar.FullText {
+		if err := ar.unindex(feed, id); err != nil {
+			return err
+		}
+	}
+	return ar.Store.Delete(archiveItemKey(feed, id))
+}
+
+// unindex removes the archived item from the full-text index, ar.mu must
+// be held.
+func (ar *Archive) unindex(feed, id string) error {
+	old, found, err := ar.Get(feed, id)
+	if err != nil {
+		return fmt.Errorf("get archived item: %w", err)
+	}
+	if !found || old.Item == nil {
+		return nil
+	}
+	return ar.unindexTerms(feed, old.Item)
+}
+
+func (ar *Archive) index(feed string) ([]archiveRef, error) {
+	var refs []archiveRef
+	if _, err := ar.Store.Get(archiveIndexKey+feed, &refs); err != nil {
+		return nil, fmt.Errorf("get archive index: %w", err)
+	}
+	return refs, nil
+}
+
+func (ar *Archive) addFeed(feed string) error {
+	var feeds []string
+	if _, err := ar.Store.Get(archiveFeedsKey, &feeds); err != nil {
+		return fmt.Errorf("get archived feeds: %w", err)
+	}
+	for _, f := range feeds {
+		if f == feed {
+			return nil
+		}
+	}
+	if err := ar.Store.Set(archiveFeedsKey, append(feeds, feed)); err != nil {
+		return fmt.Errorf("storing archived feeds: %w", err)
+	}
+	return nil
+}
+
+func archiveItemKey(feed, id string) string {
+	return archiveItemPrefix + feed + "#" + id
+}
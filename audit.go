@@ -0,0 +1,131 @@
+package feedtrigger
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+const auditPrefix = "audit/"
+
+// AuditStatus is what happened to an item at an audit entry.
+type AuditStatus string
+
+// Audit statuses.
+const (
+	// AuditSkipped is an item not acted on, see the entry Reason.
+	AuditSkipped AuditStatus = "skipped"
+	// AuditDeferred is an item buffered for a digest, held outside the
+	// delivery window or queued for the actions, see the entry Detail.
+	AuditDeferred AuditStatus = "deferred"
+	// AuditDelivered is an item the actions succeeded for.
+	AuditDelivered AuditStatus = "delivered"
+	// AuditFailed is an item the actions failed for.
+	AuditFailed AuditStatus = "failed"
+	// AuditDeadLetter is a failed item put to the dead-letter queue.
+	AuditDeadLetter AuditStatus = "dead-letter"
+)
+
+// AuditEntry records what happened to an item of a feed. An item gets an
+// entry for every step of its way, e.g. a failed delivery, its dead letter
+// and the successful retry, the last one being its final status.
+type AuditEntry struct {
+	Item  string `json:"item"`
+	Title string `json:"title,omitempty"`
+	Link  string `json:"link,omitempty"`
+	// DetectedAt is when the item was first audited and At when the entry
+	// was recorded.
+	DetectedAt time.Time   `json:"detected_at"`
+	At         time.Time   `json:"at"`
+	Status     AuditStatus `json:"status"`
+	// Reason and Detail tell why the item was skipped or deferred, e.g.
+	// SkipFiltered and the filter number.
+	Reason SkipReason `json:"reason,omitempty"`
+	Detail string     `json:"detail,omitempty"`
+	// Actions are the actions the item was delivered to and Attempts the
+	// deliveries tried.
+	Actions  []string `json:"actions,omitempty"`
+	Attempts int      `json:"attempts,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// actionNames returns the names of the feed actions as Explain reports them.
+func actionNames(f Feed) []string {
+	var names []string
+	switch {
+	case len(f.ActionNames) > 0 && f.OnNewRecord != nil:
+		names = append(names, f.ActionNames...)
+	case f.OnNewRecord != nil:
+		names = append(names, "OnNewRecord")
+	}
+	if f.OnNewRecordCtx != nil {
+		names = append(names, "OnNewRecordCtx")
+	}
+	for _, s := range f.Actions {
+		names = append(names, s.Name)
+	}
+	return names
+}
+
+// audit records the entry of the item of the feed when AuditRetention is
+// set, dropping the entries older than that.
+func (a *FeedAction) audit(f Feed, i *gofeed.Item, e AuditEntry) {
+	if a.AuditRetention <= 0 || a.DryRun || IsCanary(i) {
+		return
+	}
+	a.auditMu.Lock()
+	defer a.auditMu.Unlock()
+
+	now := a.now().UTC()
+	e.Item = ItemID(i)
+	e.Title = i.Title
+	e.Link = i.Link
+	e.At = now
+	e.DetectedAt = now
+
+	entries, err := a.auditEntries(f.URL)
+	if err == nil {
+		kept := entries[:0]
+		for _, old := range entries {
+			if now.Sub(old.At) > a.AuditRetention {
+				continue
+			}
+			if old.Item == e.Item && old.DetectedAt.Before(e.DetectedAt) {
+				e.DetectedAt = old.DetectedAt
+			}
+			kept = append(kept, old)
+		}
+		err = a.feedKV(f.URL).Set(auditPrefix+f.URL, append(kept, e))
+	}
+	if err != nil {
+		a.logf("%s: audit %s: %v", f.URL, e.Item, err)
+	}
+}
+
+func (a *FeedAction) auditEntries(feedURL string) ([]AuditEntry, error) {
+	var entries []AuditEntry
+	if _, err := a.feedKV(feedURL).Get(auditPrefix+feedURL, &entries); err != nil {
+		return nil, fmt.Errorf("get audit entries: %w", err)
+	}
+	return entries, nil
+}
+
+// Audit returns the audit entries of the feed recorded since the time, the
+// oldest first.
+func (a *FeedAction) Audit(feedURL string, since time.Time) ([]AuditEntry, error) {
+	feedURL = NormalizeURL(feedURL)
+	a.auditMu.Lock()
+	defer a.auditMu.Unlock()
+	entries, err := a.auditEntries(feedURL)
+	if err != nil {
+		return nil, err
+	}
+	var found []AuditEntry
+	for _, e := range entries {
+		if !e.At.Before(since) {
+			found = append(found, e)
+		}
+	}
+	return found, nil
+}
@@ -0,0 +1,161 @@
+package feedtrigger
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// Backfill bounds the walk through the archive pages of an RFC 5005 feed.
+type Backfill struct {
+	// MaxPages is the number of archive pages fetched, all of them if zero.
+	MaxPages int
+	// MaxAge stops the walk at items published longer ago, zero means no
+	// limit.
+	MaxAge time.Duration
+	// Trigger delivers the past items to the feed actions. Otherwise they
+	// are only archived.
+	Trigger bool
+}
+
+// Backfill walks the archived pages of the feed, linked with
+// rel="prev-archive" or rel="next" (RFC 5005), and triggers or archives
+// their items. The items of the current document are left to polling. It
+// returns the number of items handled.
+func (a *FeedAction) Backfill(ctx context.Context, f Feed, b Backfill) (int, error) {
+	if err := a.applyProfile(&f); err != nil {
+		return 0, err
+	}
+	if !b.Trigger && a.Archive == nil {
+		return 0, errors.New("archiving past items requires the archive")
+	}
+	if a.Archive != nil && a.Archive.Store == nil {
+		a.Archive.Store = a.kv()
+	}
+
+	body, err := Download(ctx, f)
+	if err != nil {
+		return 0, fmt.Errorf("fetching feed: %w", err)
+	}
+	next := archiveLink(f.URL, body)
+
+	var cutoff time.Time
+	if b.MaxAge > 0 {
+		cutoff = time.Now().Add(-b.MaxAge)
+	}
+	visited := map[string]bool{f.URL: true}
+	handled := 0
+	for pages := 0; next != "" && !visited[next] && (b.MaxPages <= 0 || pages < b.MaxPages); pages++ {
+		if ctx.Err() != nil {
+			return handled, ctx.Err()
+		}
+		visited[next] = true
+		page := f
+		page.URL = next
+		if err := a.waitHost(ctx, page.URL, f.Priority); err != nil {
+			return handled, err
+		}
+		body, err := Download(ctx, page)
+		if err != nil {
+			return handled, fmt.Errorf("fetching %s: %w", page.URL, err)
+		}
+		feed, err := f.parse(body)
+		if err != nil {
+			return handled, fmt.Errorf("parsing %s: %w", page.URL, err)
+		}
+		f.normalize(feed)
+		f.annotate(feed.Items)
+
+		expired := false
+		for _, i := range a.filter(f, feed.Items) {
+			if p := i.PublishedParsed; !cutoff.IsZero() && p != nil && p.Before(cutoff) {
+				expired = true
+				continue
+			}
+			ok, err := a.backfill(ctx, f, i, b.Trigger)
+			if err != nil {
+				return handled, err
+			}
+			if ok {
+				handled++
+			}
+		}
+		if expired {
+			break
+		}
+		next = archiveLink(page.URL, body)
+	}
+	return handled, nil
+}
+
+// backfill triggers or archives the past item, reporting whether it was
+// handled.
+func (a *FeedAction) backfill(ctx context.Context, f Feed, i *gofeed.Item, trigger bool) (bool, error) {
+	if !trigger {
+		return true, a.Archive.Put(f.URL, a.redact(i))
+	}
+	delivered, err := a.handle(ctx, f, i)
+	return delivered != nil, err
+}
+
+// archiveLink returns the resolved link of the feed document to the
+// previous archive page, empty if there is none.
+func archiveLink(base string, body []byte) string {
+	d := xml.NewDecoder(bytes.NewReader(body))
+	d.Strict = false
+	var prev, next string
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			break
+		}
+		el, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		if el.Name.Local == "entry" || el.Name.Local == "item" {
+			break
+		}
+		if el.Name.Local != "link" {
+			continue
+		}
+		var rel, href string
+		for _, attr := range el.Attr {
+			switch attr.Name.Local {
+			case "rel":
+				rel = strings.ToLower(attr.Value)
+			case "href":
+				href = attr.Value
+			}
+		}
+		switch rel {
+		case "prev-archive":
+			prev = href
+		case "next":
+			next = href
+		}
+	}
+	link := prev
+	if link == "" {
+		link = next
+	}
+	if link == "" {
+		return ""
+	}
+	b, err := url.Parse(base)
+	if err != nil {
+		return ""
+	}
+	u, err := b.Parse(strings.TrimSpace(link))
+	if err != nil {
+		return ""
+	}
+	return u.String()
+}
@@ -0,0 +1,194 @@
+package feedtrigger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"golang.org/x/net/html"
+)
+
+const brandingPrefix = "branding/"
+
+// IconKey is the custom item field holding the icon URL of its feed.
+const IconKey = "feedtrigger_icon"
+
+const (
+	maxBrandingPage = 1 << 20
+	maxIconSize     = 256 << 10
+)
+
+// Branding is the visual identity of a feed's site, fetched once and cached
+// in the store.
+type Branding struct {
+	Feed string `json:"feed"`
+	// IconURL is the favicon of the site.
+	IconURL string `json:"icon_url,omitempty"`
+	// ImageURL is the feed image or the og:image of the site.
+	ImageURL string `json:"image_url,omitempty"`
+	// Icon is the favicon itself, empty if it couldn't be fetched.
+	Icon      []byte    `json:"icon,omitempty"`
+	IconType  string    `json:"icon_type,omitempty"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// FeedBranding returns the cached branding of the feed.
+func (a *FeedAction) FeedBranding(feedURL string) (*Branding, bool, error) {
+	feedURL = NormalizeURL(feedURL)
+	var b Branding
+	found, err := a.feedKV(feedURL).Get(brandingPrefix+feedURL, &b)
+	if err != nil || !found {
+		return nil, false, err
+	}
+	return &b, true, nil
+}
+
+// BrandingHandler serves the cached icon of the feed given by the feed
+// query parameter.
+func (a *FeedAction) BrandingHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, found, err := a.FeedBranding(r.URL.Query().Get("feed"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !found || len(b.Icon) == 0 {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", b.IconType)
+		w.Header().Set("Cache-Control", "max-age=86400")
+		w.Write(b.Icon)
+	})
+}
+
+// brand annotates the items with the feed icon, fetching the branding on
+// the first poll. Branding is best effort and never fails a poll.
+func (a *FeedAction) brand(ctx context.Context, f Feed, feed *gofeed.Feed) {
+	b, found, err := a.FeedBranding(f.URL)
+	if err != nil {
+		return
+	}
+	if !found {
+		b = fetchBranding(ctx, f.URL, feed)
+		if err := a.feedKV(f.URL).Set(brandingPrefix+f.URL, b); err != nil {
+			return
+		}
+	}
+
+	icon := b.IconURL
+	if icon == "" {
+		icon = b.ImageURL
+	}
+	if icon == "" {
+		return
+	}
+	for _, i := range feed.Items {
+		setCustom(i, IconKey, icon)
+	}
+}
+
+func fetchBranding(ctx context.Context, feedURL string, feed *gofeed.Feed) *Branding {
+	b := &Branding{Feed: feedURL, FetchedAt: time.Now().UTC()}
+	if feed.Image != nil {
+		b.ImageURL = feed.Image.URL
+	}
+
+	site := feed.Link
+	if site == "" {
+		site = feedURL
+	}
+	base, err := url.Parse(site)
+	if err != nil {
+		return b
+	}
+
+	if body, _, err := get(ctx, site, maxBrandingPage); err == nil {
+		icon, image := pageBranding(base, body)
+		b.IconURL = icon
+		if b.ImageURL == "" {
+			b.ImageURL = image
+		}
+	}
+	if b.IconURL == "" {
+		b.IconURL = base.ResolveReference(&url.URL{Path: "/favicon.ico"}).String()
+	}
+
+	if icon, typ, err := get(ctx, b.IconURL, maxIconSize); err == nil {
+		b.Icon, b.IconType = icon, typ
+	} else {
+		b.IconURL = ""
+	}
+	return b
+}
+
+// pageBranding returns the icon and og:image URLs of the HTML page.
+func pageBranding(base *url.URL, body []byte) (icon, image string) {
+	resolve := func(ref string) string {
+		u, err := base.Parse(strings.TrimSpace(ref))
+		if err != nil {
+			return ""
+		}
+		return u.String()
+	}
+
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return icon, image
+		case html.StartTagToken, html.SelfClosingTagToken:
+			t := z.Token()
+			attrs := make(map[string]string, len(t.Attr))
+			for _, a := range t.Attr {
+				attrs[a.Key] = a.Val
+			}
+			switch {
+			case t.Data == "link" && icon == "" && attrs["href"] != "":
+				for _, rel := range strings.Fields(strings.ToLower(attrs["rel"])) {
+					if rel == "icon" {
+						icon = resolve(attrs["href"])
+					}
+				}
+			case t.Data == "meta" && image == "" && attrs["property"] == "og:image":
+				image = resolve(attrs["content"])
+			case t.Data == "body":
+				return icon, image
+			}
+		}
+	}
+}
+
+// get fetches the URL reading at most limit bytes, and returns the body
+// with its content type.
+func get(ctx context.Context, rawurl string, limit int64) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawurl, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	resp, err := defaultClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, "", fmt.Errorf("fetching %s: %s", rawurl, resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, limit))
+	if err != nil {
+		return nil, "", err
+	}
+	typ := resp.Header.Get("Content-Type")
+	if typ == "" {
+		typ = http.DetectContentType(body)
+	}
+	return body, typ, nil
+}
@@ -0,0 +1,71 @@
+package feedtrigger
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// ErrBridge is an RSS-Bridge failing to produce the feed of a bridge.
+var ErrBridge = errors.New("rss-bridge error")
+
+// RSSBridge is a bridge of an RSS-Bridge instance, e.g. one mirroring a
+// social network account. Its feed is fetched like a native Atom feed.
+type RSSBridge struct {
+	// BaseURL is the instance root, e.g. https://rss-bridge.org/bridge01.
+	BaseURL string
+	// Bridge is the bridge name, e.g. "Telegram".
+	Bridge string
+	// Params are the bridge parameters, e.g. {"username": "durov"}.
+	Params map[string]string
+}
+
+// URL returns the Atom feed endpoint of the bridge.
+func (b RSSBridge) URL() (string, error) {
+	if b.BaseURL == "" || b.Bridge == "" {
+		return "", errors.New("rss-bridge: base URL and bridge are required")
+	}
+	u, err := url.Parse(strings.TrimSuffix(b.BaseURL, "/") + "/")
+	if err != nil {
+		return "", fmt.Errorf("rss-bridge: %w", err)
+	}
+	q := url.Values{}
+	for k, v := range b.Params {
+		q.Set(k, v)
+	}
+	q.Set("action", "display")
+	q.Set("bridge", b.Bridge)
+	q.Set("format", "Atom")
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
+
+// NewBridgeFeed returns a feed of the bridge. Failing bridges fail the polls
+// with ErrBridge.
+func NewBridgeFeed(b RSSBridge, action NewItemAction, opts ...FeedOption) (*Feed, error) {
+	u, err := b.URL()
+	if err != nil {
+		return nil, err
+	}
+	f := NewFeed(u, action, opts...)
+	f.Parse = ParseBridge
+	return f, nil
+}
+
+// ParseBridge parses the feed of an RSS-Bridge, turning the error items the
+// recent versions report the bridge failures with into ErrBridge.
+func ParseBridge(f Feed, body []byte) (*gofeed.Feed, error) {
+	feed, err := ParseFeed(f, body)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range feed.Items {
+		if i != nil && strings.HasPrefix(i.Title, "Bridge returned error") {
+			return nil, fmt.Errorf("%w: %s", ErrBridge, i.Title)
+		}
+	}
+	return feed, nil
+}
@@ -0,0 +1,111 @@
+package feedtrigger
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrThrottled is returned when a feed URL answers with 429 Too Many
+// Requests or 503 Service Unavailable.
+var ErrThrottled = errors.New("throttled by the server")
+
+// MaxServerDelay bounds the delay of the next poll requested by the
+// response headers.
+const MaxServerDelay = 24 * time.Hour
+
+// serverDelay returns how long the response asks to wait before the next
+// request: Retry-After, else the Cache-Control max-age or the Expires date.
+func serverDelay(resp *http.Response, now time.Time) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	if d := retryAfter(resp, now); d > 0 {
+		return d
+	}
+
+	h := resp.Header
+
+	for _, directive := range strings.Split(h.Get("Cache-Control"), ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		switch {
+		case directive == "no-cache" || directive == "no-store":
+			return 0
+		case strings.HasPrefix(directive, "max-age="):
+			secs, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age="))
+			if err != nil {
+				return 0
+			}
+			age, _ := strconv.Atoi(h.Get("Age"))
+			return bound(time.Duration(secs-age) * time.Second)
+		}
+	}
+
+	if v := h.Get("Expires"); v != "" {
+		expires, err := http.ParseTime(v)
+		if err != nil {
+			return 0
+		}
+		if date, err := http.ParseTime(h.Get("Date")); err == nil {
+			now = date
+		}
+		return bound(expires.Sub(now))
+	}
+	return 0
+}
+
+// retryAfter returns the delay of the Retry-After header of the response,
+// zero without one.
+func retryAfter(resp *http.Response, now time.Time) time.Duration {
+	if resp == nil {
+		return 0
+	}
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(strings.TrimSpace(v)); err == nil {
+		return bound(time.Duration(secs) * time.Second)
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return bound(t.Sub(now))
+	}
+	return 0
+}
+
+func bound(d time.Duration) time.Duration {
+	switch {
+	case d < 0:
+		return 0
+	case d > MaxServerDelay:
+		return MaxServerDelay
+	}
+	return d
+}
+
+// requested records the delay requested by the response of the feed.
+func (a *FeedAction) requested(f Feed, resp *http.Response) {
+	if f.IgnoreCacheHeaders {
+		return
+	}
+	s := a.state(f.URL)
+	s.mu.Lock()
+	s.requested = serverDelay(resp, a.now())
+	s.mu.Unlock()
+}
+
+// nextDelay returns the delay of the next poll of the feed if the server
+// asked for more than the refresh period, zero otherwise.
+func (a *FeedAction) nextDelay(f Feed) time.Duration {
+	s := a.state(f.URL)
+	s.mu.Lock()
+	d := s.requested
+	s.requested = 0
+	s.mu.Unlock()
+	if d <= f.RefreshPeriod {
+		return 0
+	}
+	return d
+}
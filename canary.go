@@ -0,0 +1,121 @@
+package feedtrigger
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+const (
+	canaryKey = "feedtrigger_canary"
+	canaryURL = "urn:feedtrigger:canary"
+)
+
+// Canary periodically sends a synthetic item through the trigger pipeline and
+// reports when it isn't acknowledged downstream within the deadline.
+type Canary struct {
+	Interval time.Duration
+	Deadline time.Duration
+	// Action delivers canary items instead of feed actions, so it can point
+	// to a test target.
+	Action NewItemAction
+	// OnMissing is called for every canary that wasn't acknowledged in time,
+	// err is set if the action itself failed. Logs by default.
+	OnMissing func(id string, sent time.Time, err error)
+
+	mu      sync.Mutex
+	pending map[string]time.Time
+}
+
+// IsCanary reports whether the item was injected by a Canary.
+func IsCanary(i *gofeed.Item) bool {
+	return i.Custom[canaryKey] != ""
+}
+
+// Ack marks the canary with the id (the item GUID) as arrived. It returns
+// false for unknown or already expired canaries.
+func (c *Canary) Ack(id string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.pending[id]
+	delete(c.pending, id)
+	return ok
+}
+
+// ServeHTTP acknowledges the canary passed in the id query parameter, so
+// downstream systems can confirm arrival with a webhook.
+func (c *Canary) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if !c.Ack(r.URL.Query().Get("id")) {
+		http.NotFound(w, r)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *Canary) run(ctx context.Context, a *FeedAction) {
+	t := a.clock().NewTicker(c.Interval)
+	defer t.Stop()
+	for {
+		c.inject(ctx, a)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C():
+		}
+	}
+}
+
+func (c *Canary) inject(ctx context.Context, a *FeedAction) {
+	now := a.now().UTC()
+	id := fmt.Sprintf("%s:%d", canaryURL, now.UnixNano())
+	item := &gofeed.Item{
+		Title:           "feedtrigger canary " + now.Format(time.RFC3339),
+		GUID:            id,
+		Link:            id,
+		Published:       now.Format(time.RFC3339),
+		PublishedParsed: &now,
+		Custom:          map[string]string{canaryKey: "1"},
+	}
+
+	c.mu.Lock()
+	if c.pending == nil {
+		c.pending = make(map[string]time.Time)
+	}
+	c.pending[id] = now
+	c.mu.Unlock()
+
+	if err := a.trigger(ctx, Feed{URL: canaryURL, OnNewRecord: c.Action}, item); err != nil {
+		c.Ack(id)
+		a.canaryMissing(c, id, now, err)
+		return
+	}
+
+	a.clock().AfterFunc(c.Deadline, func() {
+		if c.Ack(id) {
+			a.canaryMissing(c, id, now, nil)
+		}
+	})
+}
+
+// canaryMissing reports the canary that failed or didn't arrive in time to
+// OnMissing, or logs it.
+func (a *FeedAction) canaryMissing(c *Canary, id string, sent time.Time, err error) {
+	if c.OnMissing != nil {
+		c.OnMissing(id, sent, err)
+		return
+	}
+	if err != nil {
+		a.logf("canary %s failed: %v", id, err)
+		return
+	}
+	a.logf("canary %s sent at %s didn't arrive in %s", id, sent.Format(time.RFC3339), c.Deadline)
+}
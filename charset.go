@@ -0,0 +1,86 @@
+package feedtrigger
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+)
+
+// CharsetAuto detects the encoding of the feed documents that aren't valid
+// UTF-8, see Feed.Charset.
+const CharsetAuto = "auto"
+
+// xmlEncodingRe matches the encoding of the XML declaration.
+var xmlEncodingRe = regexp.MustCompile(`^(\s*<\?xml[^>]*?encoding=["'])([A-Za-z0-9._:-]+)(["'])`)
+
+func isUTF8(label string) bool {
+	label = strings.ToLower(strings.TrimSpace(label))
+	return label == "utf-8" || label == "utf8"
+}
+
+// decode transcodes the downloaded document of the feed to UTF-8 according
+// to its Charset, declaring the new encoding in the XML declaration.
+func (f Feed) decode(contentType string, body []byte) ([]byte, error) {
+	label := f.Charset
+	if label == CharsetAuto {
+		if utf8.Valid(body) {
+			return body, nil
+		}
+		label = detectCharset(contentType, body)
+	}
+	if label == "" || isUTF8(label) {
+		return body, nil
+	}
+	r, err := charset.NewReaderLabel(label, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("%s: charset %q: %w", f.URL, label, err)
+	}
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: decoding %s: %w", f.URL, label, err)
+	}
+	return xmlEncodingRe.ReplaceAll(out, []byte("${1}UTF-8${3}")), nil
+}
+
+// detectCharset returns the encoding of the document that isn't valid
+// UTF-8: the one of the Content-Type or the XML declaration unless they
+// claim UTF-8, else windows-1251 for the documents mostly written in
+// Cyrillic and windows-1252 for the rest.
+func detectCharset(contentType string, body []byte) string {
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		if cs := params["charset"]; cs != "" && !isUTF8(cs) {
+			return cs
+		}
+	}
+	if m := xmlEncodingRe.FindSubmatch(body); m != nil && !isUTF8(string(m[2])) {
+		return string(m[2])
+	}
+
+	// the letters of both are in 0xc0-0xff, but Cyrillic words are made
+	// of them entirely while the Latin ones only have a few
+	var high, words, run int
+	for _, c := range body {
+		if c >= 0xc0 {
+			high++
+			run++
+			continue
+		}
+		if run >= 3 {
+			words += run
+		}
+		run = 0
+	}
+	if run >= 3 {
+		words += run
+	}
+	if high > 0 && words*2 >= high {
+		return "windows-1251"
+	}
+	return "windows-1252"
+}
@@ -0,0 +1,134 @@
+package feedtrigger
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TLSConfig customizes TLS of the feed requests, e.g. for internal feeds
+// served with a private PKI.
+type TLSConfig struct {
+	// CertFile and KeyFile are the PEM client certificate and key.
+	CertFile string `json:"cert_file,omitempty"`
+	KeyFile  string `json:"key_file,omitempty"`
+	// CAFile is a PEM bundle trusted in addition to the system roots.
+	CAFile string `json:"ca_file,omitempty"`
+	// Pins are base64 SHA-256 hashes of the subject public key info of
+	// certificates, one of which must be in the verified chain.
+	Pins []string `json:"pins,omitempty"`
+}
+
+func (c *TLSConfig) config() (*tls.Config, error) {
+	cfg := &tls.Config{}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if c.CAFile != "" {
+		pem, err := ioutil.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", c.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+	if len(c.Pins) > 0 {
+		pins := make(map[string]bool, len(c.Pins))
+		for _, p := range c.Pins {
+			pins[p] = true
+		}
+		cfg.VerifyPeerCertificate = func(_ [][]byte, chains [][]*x509.Certificate) error {
+			for _, chain := range chains {
+				for _, cert := range chain {
+					sum := sha256.Sum256(cert.RawSubjectPublicKeyInfo)
+					if pins[base64.StdEncoding.EncodeToString(sum[:])] {
+						return nil
+					}
+				}
+			}
+			return errors.New("no pinned certificate in the chain")
+		}
+	}
+	return cfg, nil
+}
+
+// transport is the base transport of the feed requests. It keeps more idle
+// connections per host than the default one, since many feeds are often
+// served by the same hosts and polled again and again.
+var transport = func() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConns = 256
+	t.MaxIdleConnsPerHost = 8
+	t.MaxConnsPerHost = 32
+	t.IdleConnTimeout = 5 * time.Minute
+	return t
+}()
+
+// defaultClient fetches the feeds without custom transport settings.
+var defaultClient = &http.Client{Transport: transport}
+
+// clients caches the HTTP clients of the feeds with custom transport
+// settings, so their connections are reused between polls.
+var clients = struct {
+	sync.Mutex
+	m map[string]*http.Client
+}{m: make(map[string]*http.Client)}
+
+// client returns the HTTP client fetching the feed.
+func (f Feed) client() (*http.Client, error) {
+	if f.Proxy == "" && f.TLS == nil {
+		return defaultClient, nil
+	}
+	key := f.Proxy
+	if f.TLS != nil {
+		key += "|" + strings.Join(append([]string{f.TLS.CertFile, f.TLS.KeyFile, f.TLS.CAFile}, f.TLS.Pins...), "|")
+	}
+
+	clients.Lock()
+	defer clients.Unlock()
+	if c, ok := clients.m[key]; ok {
+		return c, nil
+	}
+	t := transport.Clone()
+	if f.Proxy != "" {
+		proxy, err := url.Parse(f.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("proxy: %w", err)
+		}
+		switch proxy.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("proxy: unsupported scheme %q", proxy.Scheme)
+		}
+		t.Proxy = http.ProxyURL(proxy)
+	}
+	if f.TLS != nil {
+		cfg, err := f.TLS.config()
+		if err != nil {
+			return nil, err
+		}
+		t.TLSClientConfig = cfg
+	}
+	c := &http.Client{Transport: t}
+	clients.m[key] = c
+	return c, nil
+}
@@ -0,0 +1,41 @@
+package feedtrigger
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// benchmarkClient fetches a small document from one host in parallel, the
+// way many feeds of the same host are polled.
+func benchmarkClient(b *testing.B, c *http.Client) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "<rss></rss>")
+	}))
+	defer srv.Close()
+	b.ReportAllocs()
+	b.SetParallelism(16)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			resp, err := c.Get(srv.URL)
+			if err != nil {
+				b.Fatal(err)
+			}
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+	})
+}
+
+func BenchmarkSharedTransport(b *testing.B) {
+	benchmarkClient(b, defaultClient)
+}
+
+// BenchmarkDefaultTransport uses the transport the feeds used before the
+// shared one, for comparison.
+func BenchmarkDefaultTransport(b *testing.B) {
+	benchmarkClient(b, &http.Client{Transport: http.DefaultTransport.(*http.Transport).Clone()})
+}
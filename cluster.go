@@ -0,0 +1,182 @@
+package feedtrigger
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const clusterMembersKey = "cluster/members"
+
+// DefaultHeartbeat is the default interval of cluster member heartbeats.
+const DefaultHeartbeat = 15 * time.Second
+
+// DefaultVirtualNodes is the default number of points of a member on the
+// hash ring.
+const DefaultVirtualNodes = 64
+
+// Cluster partitions the feeds between the instances sharing the store.
+// Every instance registers itself in the store and polls only the feeds
+// assigned to it by consistent hashing of their URLs, so a member joining
+// or leaving moves only a share of the feeds. Members missing three
+// heartbeats are dropped and their feeds are taken over by the others.
+type Cluster struct {
+	// Member identifies the instance, the host name and process ID if
+	// empty.
+	Member string
+	// Heartbeat is DefaultHeartbeat if zero.
+	Heartbeat time.Duration
+	// VirtualNodes is DefaultVirtualNodes if zero.
+	VirtualNodes int
+
+	mu      sync.Mutex
+	self    string
+	members []string
+	ring    []ringPoint
+}
+
+type ringPoint struct {
+	hash   uint32
+	member string
+}
+
+func (c *Cluster) heartbeat() time.Duration {
+	if c.Heartbeat > 0 {
+		return c.Heartbeat
+	}
+	return DefaultHeartbeat
+}
+
+// Members returns the live members of the cluster as of the last
+// heartbeat.
+func (c *Cluster) Members() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.members...)
+}
+
+// owner returns the member assigned the feed, empty before the first
+// heartbeat.
+func (c *Cluster) owner(url string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.ring) == 0 {
+		return ""
+	}
+	h := hash(url)
+	n := sort.Search(len(c.ring), func(i int) bool { return c.ring[i].hash >= h })
+	if n == len(c.ring) {
+		n = 0
+	}
+	return c.ring[n].member
+}
+
+// assigned reports whether the feed is polled by this instance, otherwise
+// it returns the member polling it.
+func (c *Cluster) assigned(url string) (string, bool) {
+	owner := c.owner(url)
+	return owner, owner == "" || owner == c.self
+}
+
+func hash(s string) uint32 {
+	sum := sha1.Sum([]byte(s))
+	return binary.BigEndian.Uint32(sum[:4])
+}
+
+// register stores the heartbeat of the instance and rebuilds the ring
+// from the live members.
+func (a *FeedAction) register() error {
+	c := a.Cluster
+	c.mu.Lock()
+	if c.self == "" {
+		c.self = c.Member
+		if c.self == "" {
+			c.self = instanceID()
+		}
+	}
+	self := c.self
+	c.mu.Unlock()
+
+	// the members share a key, so a heartbeat overwritten by another
+	// member is restored by the next one
+	now := a.now()
+	members := make(map[string]time.Time)
+	if _, err := a.kv().Get(clusterMembersKey, &members); err != nil {
+		return fmt.Errorf("get cluster members: %w", err)
+	}
+	expired := now.Add(-3 * c.heartbeat())
+	for m, seen := range members {
+		if seen.Before(expired) {
+			delete(members, m)
+		}
+	}
+	members[self] = now
+	if err := a.kv().Set(clusterMembersKey, members); err != nil {
+		return fmt.Errorf("storing cluster members: %w", err)
+	}
+
+	nodes := c.VirtualNodes
+	if nodes <= 0 {
+		nodes = DefaultVirtualNodes
+	}
+	names := make([]string, 0, len(members))
+	ring := make([]ringPoint, 0, len(members)*nodes)
+	for m := range members {
+		names = append(names, m)
+		for i := 0; i < nodes; i++ {
+			ring = append(ring, ringPoint{hash: hash(m + "#" + strconv.Itoa(i)), member: m})
+		}
+	}
+	sort.Strings(names)
+	sort.Slice(ring, func(i, j int) bool { return ring[i].hash < ring[j].hash })
+
+	c.mu.Lock()
+	changed := fmt.Sprint(c.members) != fmt.Sprint(names)
+	c.members, c.ring = names, ring
+	c.mu.Unlock()
+	if changed {
+		a.logf("cluster members: %v", names)
+	}
+	return nil
+}
+
+// heartbeats registers the instance every heartbeat until ctx is done.
+func (a *FeedAction) heartbeats(ctx context.Context) {
+	t := a.clock().NewTicker(a.Cluster.heartbeat())
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C():
+			if err := a.register(); err != nil {
+				a.logf("cluster heartbeat: %v", err)
+			}
+		}
+	}
+}
+
+// deregister removes the instance from the cluster, so the others take
+// over its feeds without waiting for it to expire.
+func (a *FeedAction) deregister() {
+	c := a.Cluster
+	c.mu.Lock()
+	self := c.self
+	c.members, c.ring = nil, nil
+	c.mu.Unlock()
+
+	members := make(map[string]time.Time)
+	if _, err := a.kv().Get(clusterMembersKey, &members); err != nil {
+		a.logf("leaving cluster: %v", err)
+		return
+	}
+	delete(members, self)
+	if err := a.kv().Set(clusterMembersKey, members); err != nil {
+		a.logf("leaving cluster: %v", err)
+	}
+}
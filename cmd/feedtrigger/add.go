@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+)
+
+const maxPreviewItems = 5
+
+func cmdAdd(args []string) error {
+	fs := flag.NewFlagSet("add", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfig, "config file path")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: feedtrigger add [-config path] <url>")
+	}
+
+	cfg, err := feedtrigger.LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	feedURL, feed, err := resolveFeed(context.Background(), fs.Arg(0), in)
+	if err != nil {
+		return err
+	}
+	if _, ok := cfg.Feed(feedURL); ok {
+		return fmt.Errorf("%s is already in %s", feedURL, *configPath)
+	}
+
+	preview(feed)
+
+	entry := feedtrigger.FeedConfig{URL: feedURL}
+	var profile feedtrigger.ProfileConfig
+	if len(cfg.Profiles) > 0 {
+		names := []string{"none"}
+		for name := range cfg.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names[1:])
+		name, err := askChoice(in, "Profile", names)
+		if err != nil {
+			return err
+		}
+		if name != "none" {
+			entry.Profile = name
+			profile = cfg.Profiles[name]
+		}
+	}
+
+	suggested := suggestPeriod(feed)
+	if profile.RefreshPeriod > 0 {
+		suggested = time.Duration(profile.RefreshPeriod)
+	}
+	period, err := askDuration(in, "Refresh period", suggested)
+	if err != nil {
+		return err
+	}
+	if period != time.Duration(profile.RefreshPeriod) {
+		entry.RefreshPeriod = feedtrigger.Duration(period)
+	}
+
+	if len(profile.Actions) == 0 {
+		var names []string
+		for name := range actions {
+			names = append(names, name)
+		}
+		for name := range cfg.Actions {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		action, err := askChoice(in, "Action", names)
+		if err != nil {
+			return err
+		}
+		entry.Actions = []string{action}
+	}
+
+	cfg.Feeds = append(cfg.Feeds, entry)
+	if err := cfg.Save(*configPath); err != nil {
+		return err
+	}
+	fmt.Printf("Added %s to %s\n", feedURL, *configPath)
+	return nil
+}
+
+// resolveFeed fetches rawurl and parses it as a feed, falling back to the
+// feeds advertised by the page when rawurl is an HTML page.
+func resolveFeed(ctx context.Context, rawurl string, in *bufio.Reader) (string, *gofeed.Feed, error) {
+	candidates, err := feedtrigger.Discover(ctx, rawurl)
+	if err != nil {
+		return "", nil, fmt.Errorf("%s is neither a feed nor a page advertising one: %w", rawurl, err)
+	}
+
+	feedURL := candidates[0]
+	if len(candidates) > 1 {
+		feedURL, err = askChoice(in, "Feed", candidates)
+		if err != nil {
+			return "", nil, err
+		}
+	} else if feedURL != rawurl {
+		fmt.Printf("Discovered feed %s\n", feedURL)
+	}
+
+	feed, err := gofeed.NewParser().ParseURLWithContext(feedURL, ctx)
+	if err != nil {
+		return "", nil, fmt.Errorf("parsing %s: %w", feedURL, err)
+	}
+	return feedURL, feed, nil
+}
+
+func preview(feed *gofeed.Feed) {
+	fmt.Printf("%s (%s, %d items)\n", feed.Title, feed.FeedType, len(feed.Items))
+	for i, item := range feed.Items {
+		if i == maxPreviewItems {
+			break
+		}
+		date := item.Published
+		if date == "" {
+			date = item.Updated
+		}
+		fmt.Printf("  %s  %s\n", date, item.Title)
+	}
+}
+
+// suggestPeriod picks a refresh period of a quarter of the median interval
+// between items, bounded to [1m, 1h].
+func suggestPeriod(feed *gofeed.Feed) time.Duration {
+	var times []time.Time
+	for _, item := range feed.Items {
+		switch {
+		case item.PublishedParsed != nil:
+			times = append(times, *item.PublishedParsed)
+		case item.UpdatedParsed != nil:
+			times = append(times, *item.UpdatedParsed)
+		}
+	}
+	if len(times) < 2 {
+		return time.Minute
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].After(times[j]) })
+
+	var gaps []time.Duration
+	for i := 1; i < len(times); i++ {
+		gaps = append(gaps, times[i-1].Sub(times[i]))
+	}
+	sort.Slice(gaps, func(i, j int) bool { return gaps[i] < gaps[j] })
+
+	period := (gaps[len(gaps)/2] / 4).Round(time.Minute)
+	switch {
+	case period < time.Minute:
+		return time.Minute
+	case period > time.Hour:
+		return time.Hour
+	}
+	return period
+}
+
+func ask(in *bufio.Reader, prompt, def string) (string, error) {
+	fmt.Printf("%s [%s]: ", prompt, def)
+	line, err := in.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return def, nil
+	}
+	return line, nil
+}
+
+func askDuration(in *bufio.Reader, prompt string, def time.Duration) (time.Duration, error) {
+	for {
+		s, err := ask(in, prompt, def.String())
+		if err != nil {
+			return 0, err
+		}
+		d, err := time.ParseDuration(s)
+		if err == nil && d > 0 {
+			return d, nil
+		}
+		fmt.Printf("invalid duration %q\n", s)
+	}
+}
+
+func askChoice(in *bufio.Reader, prompt string, choices []string) (string, error) {
+	for i, c := range choices {
+		fmt.Printf("  %d) %s\n", i+1, c)
+	}
+	for {
+		s, err := ask(in, prompt, choices[0])
+		if err != nil {
+			return "", err
+		}
+		if n, err := strconv.Atoi(s); err == nil && n >= 1 && n <= len(choices) {
+			return choices[n-1], nil
+		}
+		for _, c := range choices {
+			if c == s {
+				return c, nil
+			}
+		}
+		fmt.Printf("unknown choice %q\n", s)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"ilya.app/feedtrigger"
+)
+
+func cmdAudit(args []string) error {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfig, "config file path")
+	since := fs.Duration("since", 24*time.Hour, "show the entries recorded within the duration")
+	item := fs.String("item", "", "show only the entries of the item ID")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: feedtrigger audit [-config path] [-since duration] [-item id] <feed url>")
+	}
+
+	cfg, err := feedtrigger.LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	store, err := cfg.OpenStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	app, err := feedtrigger.New(feedtrigger.WithStore(store))
+	if err != nil {
+		return err
+	}
+	entries, err := app.Audit(fs.Arg(0), time.Now().Add(-*since))
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "AT\tSTATUS\tITEM\tDETECTED\tDETAIL")
+	for _, e := range entries {
+		if *item != "" && e.Item != *item {
+			continue
+		}
+		var detail []string
+		if e.Reason != "" {
+			detail = append(detail, string(e.Reason))
+		}
+		if e.Detail != "" {
+			detail = append(detail, e.Detail)
+		}
+		if len(e.Actions) > 0 {
+			detail = append(detail, "actions "+strings.Join(e.Actions, ","))
+		}
+		if e.Attempts > 1 {
+			detail = append(detail, fmt.Sprintf("%d attempts", e.Attempts))
+		}
+		if e.Error != "" {
+			detail = append(detail, e.Error)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", e.At.Format(time.RFC3339), e.Status, e.Item,
+			e.DetectedAt.Format(time.RFC3339), strings.Join(detail, "; "))
+	}
+	return tw.Flush()
+}
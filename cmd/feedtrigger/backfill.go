@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"ilya.app/feedtrigger"
+)
+
+func cmdBackfill(args []string) error {
+	fs := flag.NewFlagSet("backfill", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfig, "config file path")
+	pages := fs.Int("pages", 0, "number of archive pages to walk, all if zero")
+	maxAge := fs.Duration("max-age", 0, "skip items older than this, e.g. 720h")
+	trigger := fs.Bool("trigger", false, "trigger the past items instead of only archiving them")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: feedtrigger backfill [-config path] [-pages n] [-max-age d] [-trigger] <feed url>")
+	}
+
+	cfg, err := feedtrigger.LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	app, err := openApp(cfg)
+	if err != nil {
+		return err
+	}
+	defer app.Store.Close()
+	if !*trigger && app.Archive == nil {
+		app.Archive = &feedtrigger.Archive{}
+	}
+	var feed *feedtrigger.Feed
+	for i := range app.Feeds {
+		if app.Feeds[i].URL == fs.Arg(0) {
+			feed = &app.Feeds[i]
+		}
+	}
+	if feed == nil {
+		return fmt.Errorf("%s is not in %s", fs.Arg(0), *configPath)
+	}
+
+	n, err := app.Backfill(context.Background(), *feed, feedtrigger.Backfill{
+		MaxPages: *pages,
+		MaxAge:   *maxAge,
+		Trigger:  *trigger,
+	})
+	fmt.Printf("%d past items handled\n", n)
+	return err
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+)
+
+// dedupKeys are the item identities check evaluates.
+var dedupKeys = []struct {
+	name string
+	key  func(*gofeed.Item) string
+}{
+	{"guid", func(i *gofeed.Item) string { return i.GUID }},
+	{"link", func(i *gofeed.Item) string { return i.Link }},
+	{"normalized link", feedtrigger.DedupByLink},
+	{"content", feedtrigger.DedupByContent},
+	{"title", func(i *gofeed.Item) string { return i.Title }},
+}
+
+// cmdCheck reports how a feed would behave once subscribed, failing if it
+// found anything to warn about.
+func cmdCheck(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: feedtrigger check <url>")
+	}
+	url := args[0]
+	body, err := feedtrigger.Download(context.Background(), feedtrigger.Feed{URL: url})
+	if err != nil {
+		return err
+	}
+	feed, err := gofeed.NewParser().Parse(bytes.NewReader(body))
+	if err != nil {
+		if candidates, derr := feedtrigger.Discover(context.Background(), url); derr == nil && len(candidates) > 0 {
+			return fmt.Errorf("%s is not a feed, the page advertises %v", url, candidates)
+		}
+		return fmt.Errorf("parsing %s: %w", url, err)
+	}
+
+	var warnings []string
+	warn := func(format string, a ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, a...))
+	}
+
+	fmt.Printf("Format:  %s %s\n", feed.FeedType, feed.FeedVersion)
+	fmt.Printf("Title:   %s\n", feed.Title)
+	fmt.Printf("Items:   %d\n", len(feed.Items))
+	if len(feed.Items) == 0 {
+		warn("the feed has no items")
+	}
+
+	var guids, dated int
+	var dates []time.Time
+	for _, i := range feed.Items {
+		if i.GUID != "" {
+			guids++
+		}
+		d := i.PublishedParsed
+		if d == nil {
+			d = i.UpdatedParsed
+		}
+		if d != nil {
+			dated++
+			dates = append(dates, *d)
+		}
+	}
+	fmt.Printf("GUIDs:   %d/%d\n", guids, len(feed.Items))
+	fmt.Printf("Dates:   %d/%d\n", dated, len(feed.Items))
+	if guids < len(feed.Items) {
+		warn("%d items have no GUID, they are identified by the link or the title", len(feed.Items)-guids)
+	}
+	if dated < len(feed.Items) {
+		warn("%d items have no parsable date", len(feed.Items)-dated)
+	}
+
+	fmt.Println("\nDedup key candidates:")
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "  KEY\tPRESENT\tUNIQUE\t")
+	for _, k := range dedupKeys {
+		present, unique := keyStats(feed.Items, k.key)
+		verdict := ""
+		if len(feed.Items) > 0 && present == len(feed.Items) && unique == present {
+			verdict = "ok"
+		}
+		fmt.Fprintf(tw, "  %s\t%d\t%d\t%s\n", k.name, present, unique, verdict)
+	}
+	tw.Flush()
+	if _, unique := keyStats(feed.Items, feedtrigger.ItemID); unique < len(feed.Items) {
+		warn("%d items share their ID with another item and would be skipped", len(feed.Items)-unique)
+	}
+
+	now := time.Now()
+	future, unordered := 0, 0
+	for n, d := range dates {
+		if d.After(now.Add(time.Hour)) {
+			future++
+		}
+		if n > 0 && d.After(dates[n-1]) {
+			unordered++
+		}
+	}
+	if future > 0 {
+		warn("%d items are dated in the future", future)
+	}
+	if unordered > 0 {
+		warn("the items are not ordered newest first: %d are newer than the preceding item", unordered)
+	}
+	if len(dates) > 1 && dates[0].Equal(dates[len(dates)-1]) {
+		warn("all items have the same date, it's probably the fetch time")
+	}
+
+	if len(warnings) == 0 {
+		fmt.Println("\nNo problems found.")
+		return nil
+	}
+	fmt.Println("\nWarnings:")
+	for _, w := range warnings {
+		fmt.Printf("  - %s\n", w)
+	}
+	return fmt.Errorf("%d warnings", len(warnings))
+}
+
+// keyStats counts the items with a non-empty key and the distinct keys.
+func keyStats(items []*gofeed.Item, key func(*gofeed.Item) string) (present, unique int) {
+	seen := make(map[string]bool, len(items))
+	for _, i := range items {
+		k := key(i)
+		if k == "" {
+			continue
+		}
+		present++
+		if !seen[k] {
+			seen[k] = true
+			unique++
+		}
+	}
+	return present, unique
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"ilya.app/feedtrigger"
+)
+
+func cmdCost(args []string) error {
+	fs := flag.NewFlagSet("cost", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfig, "config file path")
+	n := fs.Int("n", 10, "show the n most expensive feeds, all if 0")
+	by := fs.String("by", string(feedtrigger.CostTotal), "order by total, fetch, parse, actions or bytes")
+	fs.Parse(args)
+
+	cfg, err := feedtrigger.LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	urls := fs.Args()
+	if len(urls) == 0 {
+		for _, fc := range cfg.Feeds {
+			urls = append(urls, fc.URL)
+		}
+	}
+	store, err := cfg.OpenStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	app, err := feedtrigger.New(feedtrigger.WithStore(store))
+	if err != nil {
+		return err
+	}
+	costs, err := app.TopCosts(*n, feedtrigger.CostMetric(*by), urls...)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "URL\tPOLLS\tTOTAL\tFETCH\tPARSE\tACTIONS\tBYTES\tPER POLL")
+	for _, c := range costs {
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t%d\t%s\n", c.URL, c.Polls, round(c.Cost.Total()),
+			round(c.Cost.Fetch), round(c.Cost.Parse), round(c.Cost.Actions), c.Cost.Bytes, round(c.PerPoll.Total()))
+	}
+	return tw.Flush()
+}
+
+// round rounds the duration for display.
+func round(d time.Duration) time.Duration {
+	if d > time.Second {
+		return d.Round(time.Millisecond)
+	}
+	return d.Round(time.Microsecond)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+)
+
+func cmdExplain(args []string) error {
+	fs := flag.NewFlagSet("explain", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfig, "config file path")
+	itemID := fs.String("item", "", "ID of the item to explain, the newest one if empty")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: feedtrigger explain [-config path] [-item id] <feed url>")
+	}
+
+	cfg, err := feedtrigger.LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	app, err := openApp(cfg)
+	if err != nil {
+		return err
+	}
+	defer app.Store.Close()
+	var feed *feedtrigger.Feed
+	for i := range app.Feeds {
+		if app.Feeds[i].URL == fs.Arg(0) {
+			feed = &app.Feeds[i]
+		}
+	}
+	if feed == nil {
+		return fmt.Errorf("%s is not in %s", fs.Arg(0), *configPath)
+	}
+
+	ctx := context.Background()
+	var item *gofeed.Item
+	if *itemID != "" {
+		body, err := feedtrigger.Download(ctx, *feed)
+		if err != nil {
+			return err
+		}
+		parsed, err := gofeed.NewParser().Parse(bytes.NewReader(body))
+		if err != nil {
+			return fmt.Errorf("parsing %s: %w", feed.URL, err)
+		}
+		for _, i := range parsed.Items {
+			if feedtrigger.ItemID(i) == *itemID {
+				item = i
+			}
+		}
+		if item == nil {
+			return fmt.Errorf("no item %s in %s", *itemID, feed.URL)
+		}
+	}
+
+	e, err := app.Explain(ctx, *feed, item)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s\n%s\n\n", e.Item.Title, feedtrigger.ItemID(e.Item))
+	for _, s := range e.Stages {
+		verdict := "pass"
+		if !s.Pass {
+			verdict = "STOP"
+		}
+		fmt.Printf("  %-4s  %-10s  %s\n", verdict, s.Name, s.Detail)
+	}
+	if e.Delivered {
+		fmt.Println("\nThe item would be delivered.")
+	} else {
+		fmt.Println("\nThe item would not be delivered.")
+	}
+	return nil
+}
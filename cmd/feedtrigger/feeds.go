@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"ilya.app/feedtrigger"
+)
+
+func cmdList(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfig, "config file path")
+	fs.Parse(args)
+
+	cfg, err := feedtrigger.LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "URL\tPROFILE\tPERIOD\tACTIONS")
+	for _, fc := range cfg.Feeds {
+		period := "-"
+		if fc.RefreshPeriod > 0 {
+			period = time.Duration(fc.RefreshPeriod).String()
+		}
+		profile := fc.Profile
+		if profile == "" {
+			profile = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", fc.URL, profile, period, strings.Join(fc.Actions, ","))
+	}
+	return tw.Flush()
+}
+
+func cmdRm(args []string) error {
+	fs := flag.NewFlagSet("rm", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfig, "config file path")
+	purge := fs.Bool("purge", false, "delete the stored state of the feed as well")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: feedtrigger rm [-config path] [-purge] <url>")
+	}
+
+	cfg, err := feedtrigger.LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	url := fs.Arg(0)
+	kept := cfg.Feeds[:0]
+	for _, fc := range cfg.Feeds {
+		if fc.URL != url {
+			kept = append(kept, fc)
+		}
+	}
+	if len(kept) == len(cfg.Feeds) {
+		return fmt.Errorf("%s is not in %s", url, *configPath)
+	}
+	cfg.Feeds = kept
+	if err := cfg.Save(*configPath); err != nil {
+		return err
+	}
+	if *purge {
+		if err := clearState(cfg, url); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("Removed %s from %s\n", url, *configPath)
+	return nil
+}
+
+func cmdTest(args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: feedtrigger test <url>")
+	}
+	feedURL, feed, err := resolveFeed(context.Background(), args[0], bufio.NewReader(os.Stdin))
+	if err != nil {
+		return err
+	}
+	fmt.Println(feedURL)
+	fmt.Printf("%s (%s, %d items)\n", feed.Title, feed.FeedType, len(feed.Items))
+	for _, item := range feed.Items {
+		fmt.Printf("  %s\n    %s\n", item.Title, feedtrigger.ItemID(item))
+	}
+	fmt.Printf("Suggested refresh period: %s\n", suggestPeriod(feed))
+	return nil
+}
+
+func cmdState(args []string) error {
+	fs := flag.NewFlagSet("state", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfig, "config file path")
+	prune := fs.Duration("prune", 0, "with reconcile, purge the orphaned state unused for longer")
+	fs.Parse(args)
+	migrate := fs.NArg() >= 1 && fs.Arg(0) == "migrate"
+	export := fs.NArg() <= 2 && fs.Arg(0) == "export"
+	reconcile := fs.NArg() == 1 && fs.Arg(0) == "reconcile"
+	if !migrate && !export && !reconcile && (fs.NArg() != 2 || (fs.Arg(0) != "show" && fs.Arg(0) != "clear" && fs.Arg(0) != "import")) {
+		return errors.New("usage: feedtrigger state [-config path] show|clear <url> | migrate [url...] | export [file] | import <file> | [-prune age] reconcile")
+	}
+
+	cfg, err := feedtrigger.LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	switch {
+	case fs.Arg(0) == "clear":
+		return clearState(cfg, fs.Arg(1))
+	case migrate:
+		return migrateState(cfg, fs.Args()[1:])
+	case export:
+		return exportState(cfg, fs.Arg(1))
+	case fs.Arg(0) == "import":
+		return importState(cfg, fs.Arg(1))
+	case reconcile:
+		return reconcileState(cfg, *prune)
+	}
+
+	store, err := cfg.OpenStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	app, err := feedtrigger.New(feedtrigger.WithStore(store))
+	if err != nil {
+		return err
+	}
+	head, found, err := app.Head(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("no state stored for %s", fs.Arg(1))
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(head)
+}
+
+// migrateState upgrades the stored state of the feeds, all configured ones
+// if urls is empty.
+func migrateState(cfg *feedtrigger.Config, urls []string) error {
+	if len(urls) == 0 {
+		for _, fc := range cfg.Feeds {
+			urls = append(urls, fc.URL)
+		}
+	}
+	store, err := cfg.OpenStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	app, err := feedtrigger.New(feedtrigger.WithStore(store))
+	if err != nil {
+		return err
+	}
+	migrated, err := app.MigrateState(urls...)
+	for _, url := range migrated {
+		fmt.Printf("migrated %s\n", url)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%d of %d feeds migrated to schema version %d\n", len(migrated), len(urls), feedtrigger.HeadVersion)
+	return nil
+}
+
+func cmdStats(args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfig, "config file path")
+	fs.Parse(args)
+
+	cfg, err := feedtrigger.LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	urls := fs.Args()
+	if len(urls) == 0 {
+		for _, fc := range cfg.Feeds {
+			urls = append(urls, fc.URL)
+		}
+	}
+
+	store, err := cfg.OpenStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	app, err := feedtrigger.New(feedtrigger.WithStore(store))
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "URL\tPOLLS\tERRORS\tTRIGGERED\tLAST PUBLISHED\tLAST ERROR")
+	for _, url := range urls {
+		st, found, err := app.Stats(url)
+		if err != nil {
+			return err
+		}
+		if !found {
+			fmt.Fprintf(tw, "%s\t-\t-\t-\t-\t-\n", url)
+			continue
+		}
+		published := "-"
+		if !st.LastPublished.IsZero() {
+			published = st.LastPublished.Format(time.RFC3339)
+		}
+		lastErr := "-"
+		if st.LastError != "" {
+			lastErr = st.LastErrorAt.Format(time.RFC3339) + " " + st.LastError
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%s\t%s\n", url, st.Polls, st.Errors, st.Triggered, published, lastErr)
+	}
+	return tw.Flush()
+}
+
+// clearState deletes the stored state of the feed, so it starts over as a
+// new one.
+// exportState writes the stored state of the configured feeds to the file,
+// stdout if path is empty.
+func exportState(cfg *feedtrigger.Config, path string) error {
+	store, err := cfg.OpenStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	var feeds []feedtrigger.Feed
+	for _, fc := range cfg.Feeds {
+		feeds = append(feeds, feedtrigger.Feed{URL: fc.URL})
+	}
+	app, err := feedtrigger.New(feedtrigger.WithStore(store), feedtrigger.WithFeeds(feeds...))
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		return app.ExportState(os.Stdout)
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := app.ExportState(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// reconcileState lists the configured feeds without stored state and the
+// state of the feeds not configured, purging the orphans unused for longer
+// than prune unless it's zero.
+func reconcileState(cfg *feedtrigger.Config, prune time.Duration) error {
+	store, err := cfg.OpenStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	var feeds []feedtrigger.Feed
+	for _, fc := range cfg.Feeds {
+		feeds = append(feeds, feedtrigger.Feed{URL: fc.URL})
+	}
+	app, err := feedtrigger.New(feedtrigger.WithStore(store), feedtrigger.WithFeeds(feeds...))
+	if err != nil {
+		return err
+	}
+	app.OrphanRetention = prune
+	r, err := app.Reconcile()
+	if err != nil {
+		return err
+	}
+	for _, url := range r.New {
+		fmt.Printf("new\t%s\n", url)
+	}
+	for _, o := range r.Orphaned {
+		used := "unknown"
+		if !o.LastUsed.IsZero() {
+			used = o.LastUsed.Format(time.RFC3339)
+		}
+		fmt.Printf("orphaned\t%s\tlast used %s\n", o.URL, used)
+	}
+	for _, url := range r.Pruned {
+		fmt.Printf("pruned\t%s\n", url)
+	}
+	return nil
+}
+
+// importState stores the state exported to the file.
+func importState(cfg *feedtrigger.Config, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	store, err := cfg.OpenStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	app, err := feedtrigger.New(feedtrigger.WithStore(store))
+	if err != nil {
+		return err
+	}
+	return app.ImportState(f)
+}
+
+func clearState(cfg *feedtrigger.Config, url string) error {
+	store, err := cfg.OpenStore()
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	app, err := feedtrigger.New(feedtrigger.WithStore(store))
+	if err != nil {
+		return err
+	}
+	return app.PurgeFeed(url)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+)
+
+func cmdImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfig, "config file path")
+	dryRun := fs.Bool("n", false, "only validate and report, don't change the config")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("usage: feedtrigger import [-config path] [-n] <feeds.csv|feeds.json>")
+	}
+
+	cfg, err := feedtrigger.LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	entries, err := readInventory(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	seen := make(map[string]int)
+	imported := 0
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ROW\tURL\tRESULT")
+	for n, fc := range entries {
+		row := n + 1
+		result := validateEntry(ctx, cfg, fc, seen)
+		seen[fc.URL] = row
+		if result == "" {
+			result = "ok"
+			imported++
+			cfg.Feeds = append(cfg.Feeds, fc)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", row, fc.URL, result)
+	}
+	tw.Flush()
+
+	if *dryRun || imported == 0 {
+		fmt.Printf("%d of %d feeds valid, config unchanged\n", imported, len(entries))
+		return nil
+	}
+	if err := cfg.Save(*configPath); err != nil {
+		return err
+	}
+	fmt.Printf("Imported %d of %d feeds into %s\n", imported, len(entries), *configPath)
+	return nil
+}
+
+// validateEntry returns the problem with the inventory entry or an empty
+// string if it can be imported.
+func validateEntry(ctx context.Context, cfg *feedtrigger.Config, fc feedtrigger.FeedConfig, seen map[string]int) string {
+	u, err := url.Parse(fc.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return "invalid URL"
+	}
+	if _, ok := cfg.Feed(fc.URL); ok {
+		return "already in the config"
+	}
+	if row, ok := seen[fc.URL]; ok {
+		return fmt.Sprintf("duplicate of row %d", row)
+	}
+	if fc.Profile != "" {
+		if _, ok := cfg.Profiles[fc.Profile]; !ok {
+			return fmt.Sprintf("unknown profile %q", fc.Profile)
+		}
+	}
+	for _, name := range fc.Actions {
+		_, defined := cfg.Actions[name]
+		if _, ok := actions[name]; !ok && !defined {
+			return fmt.Sprintf("unknown action %q", name)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	body, err := feedtrigger.Download(ctx, feedtrigger.Feed{URL: fc.URL})
+	if err != nil {
+		return fmt.Sprintf("unreachable: %v", err)
+	}
+	feed, err := gofeed.NewParser().Parse(bytes.NewReader(body))
+	if err != nil {
+		return fmt.Sprintf("not a feed: %v", err)
+	}
+	if len(feed.Items) == 0 {
+		return "feed has no items"
+	}
+	return ""
+}
+
+// readInventory reads feed entries from a JSON array of config entries or
+// a CSV file with a header. The url, profile, refresh_period and actions
+// (separated by ";") columns map to the entry fields, the others become
+// feed metadata.
+func readInventory(path string) ([]feedtrigger.FeedConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		var entries []feedtrigger.FeedConfig
+		if err := json.NewDecoder(f).Decode(&entries); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+		return entries, nil
+	}
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("reading %s header: %w", path, err)
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+
+	var entries []feedtrigger.FeedConfig
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", path, err)
+		}
+
+		var fc feedtrigger.FeedConfig
+		for i, v := range record {
+			v = strings.TrimSpace(v)
+			if i >= len(header) || v == "" {
+				continue
+			}
+			switch header[i] {
+			case "url":
+				fc.URL = v
+			case "profile":
+				fc.Profile = v
+			case "refresh_period":
+				d, err := time.ParseDuration(v)
+				if err != nil {
+					return nil, fmt.Errorf("%s row %d: %w", path, len(entries)+1, err)
+				}
+				fc.RefreshPeriod = feedtrigger.Duration(d)
+			case "actions":
+				for _, a := range strings.Split(v, ";") {
+					if a = strings.TrimSpace(a); a != "" {
+						fc.Actions = append(fc.Actions, a)
+					}
+				}
+			default:
+				if fc.Metadata == nil {
+					fc.Metadata = make(map[string]string)
+				}
+				fc.Metadata[header[i]] = v
+			}
+		}
+		entries = append(entries, fc)
+	}
+}
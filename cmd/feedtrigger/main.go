@@ -0,0 +1,148 @@
+// Command feedtrigger operates feedtrigger applications described by a config
+// file.
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"ilya.app/feedtrigger"
+	registry "ilya.app/feedtrigger/actions"
+	_ "ilya.app/feedtrigger/actions/discord"
+	_ "ilya.app/feedtrigger/actions/enclosure"
+	_ "ilya.app/feedtrigger/actions/gotify"
+	_ "ilya.app/feedtrigger/actions/matrix"
+	_ "ilya.app/feedtrigger/actions/mattermost"
+	_ "ilya.app/feedtrigger/actions/ntfy"
+	"ilya.app/feedtrigger/actions/plugin"
+	_ "ilya.app/feedtrigger/actions/torrent"
+)
+
+const defaultConfig = "feedtrigger.json"
+
+// actions available to config entries by name.
+var actions = map[string]feedtrigger.NewItemAction{
+	"log": feedtrigger.LogAuthorAndLink,
+}
+
+// configActions returns the actions available to the entries of the config:
+// the built-in ones, the plugins and the ones the config defines.
+func configActions(cfg *feedtrigger.Config) (map[string]feedtrigger.NewItemAction, error) {
+	defined, err := cfg.BuildActions(registry.Registry)
+	if err != nil {
+		return nil, err
+	}
+	all := make(map[string]feedtrigger.NewItemAction, len(actions)+len(defined))
+	for name, action := range actions {
+		all[name] = action
+	}
+	for name, action := range defined {
+		if _, ok := actions[name]; ok {
+			return nil, fmt.Errorf("action %s: there's a built-in action of the name", name)
+		}
+		all[name] = action
+	}
+	return all, nil
+}
+
+// plugins are the loaded action plugins, stopped on exit.
+var plugins []*plugin.Plugin
+
+// loadPlugins makes the plugins in the directory available as actions.
+func loadPlugins(dir string) error {
+	found, err := plugin.Discover(dir)
+	if err != nil {
+		return err
+	}
+	for _, p := range found {
+		if _, ok := actions[p.Name]; ok {
+			return fmt.Errorf("plugin %s: there's a built-in action of the name", p.Path)
+		}
+		actions[p.Name] = p.Action
+		plugins = append(plugins, p)
+	}
+	return nil
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, `Usage: feedtrigger <command> [arguments]
+
+Commands:
+  run                        poll the configured feeds, SIGHUP reloads the config
+  add <url>                  interactively add a feed to the config
+  list                       list the configured feeds
+  rm <url>                   remove a feed from the config
+  test <url>                 fetch a feed and show its items
+  check <url>                validate a feed before subscribing to it
+  state show|clear <url>     show or clear the stored state of a feed
+  state migrate [url...]     upgrade the stored state to the current schema
+  state export [file]        dump the stored state of the feeds as JSON
+  state import <file>        load the state dumped by state export
+  state reconcile            list the new feeds and the orphaned state, -prune purges it
+  stats [url...]             show the stored statistics of feeds
+  cost [url...]              show the most expensive feeds to poll
+  audit <url>                show what happened to the recent items of a feed
+  explain <url>              show how the pipeline would handle an item of a feed
+  replay <url> [file...]     run archived items or feed snapshots through the filters
+  import <file>              add feeds from a CSV or JSON inventory
+  backfill <url>             walk the archive pages of an RFC 5005 feed
+  search <words...>          search the archived items
+
+Run "feedtrigger <command> -h" for the command flags.
+`)
+}
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "run":
+		err = cmdRun(os.Args[2:])
+	case "add":
+		err = cmdAdd(os.Args[2:])
+	case "list":
+		err = cmdList(os.Args[2:])
+	case "rm":
+		err = cmdRm(os.Args[2:])
+	case "test":
+		err = cmdTest(os.Args[2:])
+	case "check":
+		err = cmdCheck(os.Args[2:])
+	case "state":
+		err = cmdState(os.Args[2:])
+	case "stats":
+		err = cmdStats(os.Args[2:])
+	case "cost":
+		err = cmdCost(os.Args[2:])
+	case "audit":
+		err = cmdAudit(os.Args[2:])
+	case "explain":
+		err = cmdExplain(os.Args[2:])
+	case "replay":
+		err = cmdReplay(os.Args[2:])
+	case "import":
+		err = cmdImport(os.Args[2:])
+	case "backfill":
+		err = cmdBackfill(os.Args[2:])
+	case "search":
+		err = cmdSearch(os.Args[2:])
+	case "help", "-h", "-help", "--help":
+		usage()
+		return
+	default:
+		usage()
+		os.Exit(2)
+	}
+	for _, p := range plugins {
+		p.Close()
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+}
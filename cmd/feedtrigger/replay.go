@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"ilya.app/feedtrigger"
+)
+
+func cmdReplay(args []string) error {
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfig, "config file path")
+	since := fs.Duration("since", 7*24*time.Hour, "replay the items archived within the duration")
+	run := fs.Bool("run", false, "run the actions of the items passing the filters")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return errors.New("usage: feedtrigger replay [-config path] [-since duration] [-run] <feed url> [snapshot file...]")
+	}
+
+	cfg, err := feedtrigger.LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	app, err := openApp(cfg)
+	if err != nil {
+		return err
+	}
+	defer app.Store.Close()
+	var feed *feedtrigger.Feed
+	for i := range app.Feeds {
+		if app.Feeds[i].URL == fs.Arg(0) {
+			feed = &app.Feeds[i]
+		}
+	}
+	if feed == nil {
+		return fmt.Errorf("%s is not in %s", fs.Arg(0), *configPath)
+	}
+
+	ctx := context.Background()
+	var replayed []feedtrigger.Replayed
+	if fs.NArg() == 1 {
+		if app.Archive == nil {
+			return fmt.Errorf("the archive isn't enabled in %s, replay snapshot files instead", *configPath)
+		}
+		replayed, err = app.ReplayArchive(ctx, *feed, time.Now().Add(-*since), *run)
+		if err != nil {
+			return err
+		}
+	}
+	for _, path := range fs.Args()[1:] {
+		body, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		items, err := app.ParseSnapshot(*feed, body)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		r, err := app.Replay(ctx, *feed, items, *run)
+		if err != nil {
+			return err
+		}
+		replayed = append(replayed, r...)
+	}
+
+	passed := 0
+	for _, r := range replayed {
+		verdict := "pass"
+		if !r.Delivered {
+			verdict = "STOP"
+		} else {
+			passed++
+		}
+		fmt.Printf("%-4s  %s  %s\n", verdict, feedtrigger.ItemID(r.Item), r.Item.Title)
+		switch {
+		case r.Stage != "":
+			fmt.Printf("      %s: %s\n", r.Stage, r.Detail)
+		case r.Detail != "":
+			fmt.Printf("      %s\n", r.Detail)
+		}
+	}
+	verb := "would be delivered"
+	if *run {
+		verb = "delivered"
+	}
+	fmt.Printf("\n%d of %d items %s.\n", passed, len(replayed), verb)
+	return nil
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+	registry "ilya.app/feedtrigger/actions"
+	"ilya.app/feedtrigger/runner/k8s"
+)
+
+func cmdRun(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfig, "config file path")
+	adminAddr := fs.String("admin", "", "address to serve the admin API on, e.g. localhost:8080")
+	pushAddr := fs.String("push", "", "address to receive pushed feeds and items on, e.g. :8081")
+	leaderLease := fs.String("leader-lease", "", "name of the Kubernetes Lease electing the only replica polling the feeds")
+	dryRun := fs.Bool("dry-run", false, "log the items that would be triggered without acting on them")
+	fs.Parse(args)
+
+	cfg, err := feedtrigger.LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	app, err := openApp(cfg)
+	if err != nil {
+		return err
+	}
+	app.DryRun = *dryRun
+	app.OnFeedMoved = func(from, to string) {
+		moveConfigFeed(*configPath, from, to)
+	}
+	if len(app.Feeds) == 0 && len(app.Tenants) == 0 {
+		return errors.New("no feeds configured, add some with feedtrigger add")
+	}
+
+	if *adminAddr != "" {
+		handler := app.AdminHandler()
+		if cfg.Pprof {
+			handler = withPprof(handler)
+		}
+		go func() {
+			log.Printf("admin API on %s", *adminAddr)
+			if err := http.ListenAndServe(*adminAddr, handler); err != nil {
+				log.Printf("admin API: %v", err)
+			}
+		}()
+	}
+
+	if *pushAddr != "" {
+		go func() {
+			log.Printf("push endpoint on %s", *pushAddr)
+			if err := http.ListenAndServe(*pushAddr, app.PushHandler(cfg.PushToken)); err != nil {
+				log.Printf("push endpoint: %v", err)
+			}
+		}()
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	go func() {
+		for s := range sig {
+			if s == syscall.SIGHUP {
+				reload(app, *configPath)
+				continue
+			}
+			cancel()
+			return
+		}
+	}()
+
+	go systemd(ctx, app)
+
+	if *leaderLease != "" {
+		err = (&k8s.Runner{Name: *leaderLease, Logger: app.Logger}).Run(ctx, app)
+	} else {
+		err = app.Run(ctx)
+	}
+	if errors.Is(err, context.Canceled) {
+		return nil
+	}
+	return err
+}
+
+// withPprof serves the runtime profiles along with h.
+func withPprof(h http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/", h)
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// reload applies the feed set of the config file to the running
+// application. The state of the feeds is kept.
+func reload(app *feedtrigger.FeedAction, path string) {
+	cfg, err := feedtrigger.LoadConfig(path)
+	if err != nil {
+		log.Printf("reloading config: %v", err)
+		return
+	}
+	named, err := configActions(cfg)
+	if err != nil {
+		log.Printf("reloading config: %v", err)
+		return
+	}
+	feeds, err := cfg.BuildFeeds(named)
+	if err != nil {
+		log.Printf("reloading config: %v", err)
+		return
+	}
+	added, removed, updated, err := app.SyncFeeds(feeds)
+	if err != nil {
+		log.Printf("reloading config: %v", err)
+	}
+	pauseGroups(app, cfg)
+	log.Printf("reloaded %s: %d feeds added, %d removed, %d updated",
+		path, len(added), len(removed), len(updated))
+}
+
+// moveConfigFeed updates the URL of the feed that moved permanently in the
+// config file.
+func moveConfigFeed(path, from, to string) {
+	cfg, err := feedtrigger.LoadConfig(path)
+	if err != nil {
+		log.Printf("updating moved feed %s: %v", from, err)
+		return
+	}
+	fc, ok := cfg.Feed(from)
+	if !ok || fc.Bridge != nil {
+		return
+	}
+	fc.URL = to
+	if err := cfg.Save(path); err != nil {
+		log.Printf("updating moved feed %s: %v", from, err)
+	}
+}
+
+// pauseGroups pauses the feeds of the groups paused in the config.
+func pauseGroups(app *feedtrigger.FeedAction, cfg *feedtrigger.Config) {
+	for name, gc := range cfg.Groups {
+		if gc.Paused {
+			app.PauseGroup(name)
+		}
+	}
+}
+
+// openApp builds the application described by the config.
+func openApp(cfg *feedtrigger.Config) (*feedtrigger.FeedAction, error) {
+	if cfg.Plugins != "" && len(plugins) == 0 {
+		if err := loadPlugins(cfg.Plugins); err != nil {
+			return nil, err
+		}
+	}
+	named, err := configActions(cfg)
+	if err != nil {
+		return nil, err
+	}
+	feeds, err := cfg.BuildFeeds(named)
+	if err != nil {
+		return nil, err
+	}
+	tenants, err := cfg.BuildTenants(named)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := cfg.RedactionRules()
+	if err != nil {
+		return nil, err
+	}
+	dedup, err := cfg.Deduplication()
+	if err != nil {
+		return nil, err
+	}
+	digests, err := cfg.BuildDigests(named)
+	if err != nil {
+		return nil, err
+	}
+	groups, err := cfg.BuildGroups(named)
+	if err != nil {
+		return nil, err
+	}
+	var watchlist *feedtrigger.Watchlist
+	if cfg.Watchlist != "" {
+		if watchlist, err = feedtrigger.LoadWatchlist(cfg.Watchlist); err != nil {
+			return nil, err
+		}
+	}
+	store, err := cfg.OpenStore()
+	if err != nil {
+		return nil, err
+	}
+	app, err := feedtrigger.New(feedtrigger.WithStore(store), feedtrigger.WithFeeds(feeds...))
+	if err != nil {
+		store.Close()
+		return nil, err
+	}
+	app.Tenants = tenants
+	app.Redactions = rules
+	app.NamedActions = named
+	app.ActionRegistry = registry.Registry
+	app.Dedup = dedup
+	app.Digests = digests
+	app.Groups = groups
+	app.Proxy = cfg.Proxy
+	app.Stagger = cfg.Stagger
+	app.FollowMoves = cfg.FollowMoves
+	app.ThrottleCooldown = time.Duration(cfg.ThrottleCooldown)
+	app.OrphanRetention = time.Duration(cfg.OrphanRetention)
+	app.AuditRetention = time.Duration(cfg.AuditRetention)
+	app.ExactlyOnce = cfg.ExactlyOnce
+	app.SlowStoreThreshold = time.Duration(cfg.SlowStoreThreshold)
+	app.MaxConcurrentFetches = cfg.MaxConcurrentFetches
+	app.QueueSize = cfg.QueueSize
+	app.Dispatchers = cfg.Dispatchers
+	if ac := cfg.Archive; ac != nil {
+		app.Archive = &feedtrigger.Archive{
+			MaxAge:   time.Duration(ac.MaxAge),
+			MaxItems: ac.MaxItems,
+			FullText: ac.FullText,
+		}
+	}
+	if cc := cfg.Cluster; cc != nil {
+		app.Cluster = &feedtrigger.Cluster{
+			Member:       cc.Member,
+			Heartbeat:    time.Duration(cc.Heartbeat),
+			VirtualNodes: cc.VirtualNodes,
+		}
+	}
+	if dq := cfg.DeliveryQueue; dq != nil {
+		app.DeliveryQueue = &feedtrigger.DeliveryQueue{
+			Path:          dq.Path,
+			MaxItems:      dq.MaxItems,
+			MaxAge:        time.Duration(dq.MaxAge),
+			RetryInterval: time.Duration(dq.RetryInterval),
+		}
+	}
+	if lc := cfg.Leases; lc != nil {
+		app.Leases = &feedtrigger.Leases{Owner: lc.Owner, TTL: time.Duration(lc.TTL)}
+	}
+	pauseGroups(app, cfg)
+	if watchlist != nil {
+		app.Watchlist = watchlist
+		app.OnWatchlistHit = func(keyword string, i *gofeed.Item) {
+			log.Printf("watchlist hit %q: %s %s", keyword, i.Title, i.Link)
+		}
+	}
+	return app, nil
+}
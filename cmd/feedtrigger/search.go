@@ -0,0 +1,47 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"ilya.app/feedtrigger"
+)
+
+func cmdSearch(args []string) error {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	configPath := fs.String("config", defaultConfig, "config file path")
+	limit := fs.Int("n", 20, "maximum number of items shown, 0 for all")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		return errors.New("usage: feedtrigger search [-config path] [-n limit] <words...>")
+	}
+
+	cfg, err := feedtrigger.LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	if cfg.Archive == nil {
+		return fmt.Errorf("the archive isn't enabled in %s", *configPath)
+	}
+	app, err := openApp(cfg)
+	if err != nil {
+		return err
+	}
+	defer app.Store.Close()
+
+	items, err := app.Search(strings.Join(fs.Args(), " "))
+	if err != nil {
+		return err
+	}
+	for n, ai := range items {
+		if *limit > 0 && n == *limit {
+			fmt.Printf("... %d more\n", len(items)-n)
+			break
+		}
+		fmt.Printf("%s  %s\n  %s\n  %s\n", ai.ArchivedAt.Format(time.RFC3339), ai.Item.Title, ai.Item.Link, ai.Feed)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"ilya.app/feedtrigger"
+)
+
+// sdNotify sends the state to the systemd notification socket, it does
+// nothing when not run by systemd.
+func sdNotify(state string) error {
+	addr := os.Getenv("NOTIFY_SOCKET")
+	if addr == "" {
+		return nil
+	}
+	if addr[0] == '@' {
+		addr = "\x00" + addr[1:]
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: addr, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("sd_notify: %w", err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(state)); err != nil {
+		return fmt.Errorf("sd_notify: %w", err)
+	}
+	return nil
+}
+
+// watchdogInterval returns the systemd watchdog timeout, zero if it's off.
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0
+	}
+	return time.Duration(usec) * time.Microsecond
+}
+
+// systemd reports readiness once the application polls, then keeps the
+// status line up to date and pings the watchdog as long as polls happen.
+func systemd(ctx context.Context, app *feedtrigger.FeedAction) {
+	if os.Getenv("NOTIFY_SOCKET") == "" {
+		return
+	}
+	for !app.Running() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	ready := time.Now()
+	if err := sdNotify("READY=1"); err != nil {
+		log.Print(err)
+		return
+	}
+
+	interval := watchdogInterval() / 2
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		status, alive := summary(app.Status(), ready)
+		state := "STATUS=" + status
+		if alive && watchdogInterval() > 0 {
+			state += "\nWATCHDOG=1"
+		}
+		if err := sdNotify(state); err != nil {
+			log.Print(err)
+		}
+		select {
+		case <-ctx.Done():
+			sdNotify("STOPPING=1")
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// summary describes the last polls. The polling loop is considered alive
+// while some feed was polled within three longest poll intervals, or all
+// feeds are paused.
+func summary(status []feedtrigger.FeedStatus, ready time.Time) (string, bool) {
+	var last time.Time
+	var longest time.Duration
+	failing := 0
+	for _, s := range status {
+		if s.Paused {
+			continue
+		}
+		if s.LastPoll.After(last) {
+			last = s.LastPoll
+		}
+		period := s.RefreshPeriod
+		if d := s.NextPoll.Sub(s.LastPoll); d > period {
+			period = d
+		}
+		if period > longest {
+			longest = period
+		}
+		if s.ConsecutiveFailures > 0 {
+			failing++
+		}
+	}
+	since := last
+	if since.IsZero() {
+		since = ready
+	}
+	alive := longest == 0 || time.Since(since) <= 3*longest
+	if last.IsZero() {
+		return fmt.Sprintf("%d feeds, no polls yet", len(status)), alive
+	}
+	return fmt.Sprintf("%d feeds, %d failing, last poll %s ago",
+		len(status), failing, time.Since(last).Round(time.Second)), alive
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+)
+
+// commitFilter passes the commits by one of the authors and mentioning one
+// of the keywords in the message, e.g. a path like "rules/" or "CVE". An
+// empty list passes everything.
+func commitFilter(authors, keywords []string) feedtrigger.ItemFilter {
+	return func(i *gofeed.Item) bool {
+		return matchAuthor(i, authors) && matchKeyword(i, keywords)
+	}
+}
+
+func matchAuthor(i *gofeed.Item, authors []string) bool {
+	if len(authors) == 0 {
+		return true
+	}
+	if i.Author == nil {
+		return false
+	}
+	for _, a := range authors {
+		if strings.EqualFold(i.Author.Name, a) || (i.Author.Email != "" && strings.EqualFold(i.Author.Email, a)) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchKeyword(i *gofeed.Item, keywords []string) bool {
+	if len(keywords) == 0 {
+		return true
+	}
+	// the content has the whole commit message, the title its first line
+	text := strings.ToLower(i.Title + "\n" + i.Content)
+	for _, k := range keywords {
+		if strings.Contains(text, strings.ToLower(k)) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,23 +1,115 @@
+// Command gh-repos-mon logs new commits, releases and tags of GitHub
+// repositories.
+//
+// Usage:
+//
+//	gh-repos-mon [-repo owner/name[@branch][:mode,...]]... [-repos file]
+//		[-period 5m] [-branch name] [-watch commits,releases,tags]
+//		[-author login]... [-keyword text]...
+//
+// The -author and -keyword filters apply to the commits only.
 package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/mmcdole/gofeed"
 
 	"ilya.app/feedtrigger"
 )
 
+// defaultRepos are monitored when none are given.
+var defaultRepos = []repo{
+	{Owner: "Neo23x0", Name: "sigma", Branch: "master"},
+	{Owner: "StrangerealIntel", Name: "DailyIOC"},
+	{Owner: "blackorbird", Name: "APT_REPORT"},
+}
+
+// actions log the new items of each watch mode.
+var actions = map[string]feedtrigger.NewItemAction{
+	watchCommits: feedtrigger.LogAuthorAndLink,
+	watchReleases: func(i *gofeed.Item) error {
+		log.Printf("release %s: %s", i.Title, i.Link)
+		return nil
+	},
+	watchTags: func(i *gofeed.Item) error {
+		log.Printf("tag %s: %s", i.Title, i.Link)
+		return nil
+	},
+}
+
 func main() {
-	feeds := []feedtrigger.Feed{
-		*feedtrigger.NewFeed("https://github.com/Neo23x0/sigma/commits/master.atom", feedtrigger.LogAuthorAndLink),
-		*feedtrigger.NewFeed("https://github.com/StrangerealIntel/DailyIOC/commits.atom", feedtrigger.LogAuthorAndLink),
-		*feedtrigger.NewFeed("https://github.com/blackorbird/APT_REPORT/commits.atom", feedtrigger.LogAuthorAndLink),
+	var repos repoFlags
+	flag.Var(&repos, "repo", "repository to monitor as owner/name[@branch][:mode,...], repeatable")
+	reposFile := flag.String("repos", "", "file listing the repositories to monitor, one per line")
+	period := flag.Duration("period", time.Minute, "refresh period of the feeds")
+	branch := flag.String("branch", "", "branch of the repositories without one, the default branch if empty")
+	watch := flag.String("watch", watchCommits, "watch modes of the repositories without their own: commits, releases, tags")
+	var authors, keywords listFlag
+	flag.Var(&authors, "author", "only log the commits by the author login or email, repeatable")
+	flag.Var(&keywords, "keyword", "only log the commits mentioning the keyword or path, repeatable")
+	flag.Parse()
+
+	defaultWatch, err := parseWatch(*watch)
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	app, err := feedtrigger.New(nil, feeds...)
+	if *reposFile != "" {
+		listed, err := readRepos(*reposFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		repos = append(repos, listed...)
+	}
+	if len(repos) == 0 {
+		repos = defaultRepos
+	}
+
+	var feeds []feedtrigger.Feed
+	for _, r := range repos {
+		if r.Branch == "" {
+			r.Branch = *branch
+		}
+		if len(r.Watch) == 0 {
+			r.Watch = defaultWatch
+		}
+		for _, mode := range r.Watch {
+			opts := []feedtrigger.FeedOption{feedtrigger.WithRefreshPeriod(*period)}
+			if mode == watchCommits && (len(authors) > 0 || len(keywords) > 0) {
+				opts = append(opts, feedtrigger.WithFilter(commitFilter(authors, keywords)))
+			}
+			feeds = append(feeds, *feedtrigger.NewFeed(r.feedURL(mode), actions[mode], opts...))
+		}
+	}
+
+	app, err := feedtrigger.New(feedtrigger.WithFeeds(feeds...))
 	if err != nil {
 		log.Fatal(err)
 	}
+	app.HostRateLimit = 1
+
+	// let the running polls finish and store their state on the first
+	// signal, the second one kills the process
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sig
+		log.Print("shutting down")
+		cancel()
+		signal.Stop(sig)
+	}()
 
-	log.Fatal(app.Run(context.Background()))
+	if err := app.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		log.Fatal(err)
+	}
 }
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Watch modes, the feeds of a repository to monitor.
+const (
+	watchCommits  = "commits"
+	watchReleases = "releases"
+	watchTags     = "tags"
+)
+
+// repo is a monitored GitHub repository.
+type repo struct {
+	Owner, Name string
+	// Branch is the branch of the commits, the default branch if empty.
+	Branch string
+	// Watch are the watch modes, the -watch ones if empty.
+	Watch []string
+}
+
+// parseRepo parses "owner/name" with an optional "@branch" suffix and an
+// optional ":mode,..." list of watch modes, e.g. "owner/name:releases,tags".
+func parseRepo(s string) (repo, error) {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "https://github.com/")
+	var r repo
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		modes, err := parseWatch(s[i+1:])
+		if err != nil {
+			return repo{}, err
+		}
+		s, r.Watch = s[:i], modes
+	}
+	if i := strings.LastIndex(s, "@"); i >= 0 {
+		s, r.Branch = s[:i], s[i+1:]
+	}
+	parts := strings.Split(strings.Trim(s, "/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return repo{}, fmt.Errorf("invalid repository %q, want owner/name[@branch][:mode,...]", s)
+	}
+	r.Owner, r.Name = parts[0], parts[1]
+	return r, nil
+}
+
+// parseWatch parses a comma separated list of watch modes.
+func parseWatch(s string) ([]string, error) {
+	var modes []string
+	for _, m := range strings.Split(s, ",") {
+		switch m = strings.TrimSpace(m); m {
+		case watchCommits, watchReleases, watchTags:
+			modes = append(modes, m)
+		default:
+			return nil, fmt.Errorf("unknown watch mode %q, want commits, releases or tags", m)
+		}
+	}
+	return modes, nil
+}
+
+// feedURL returns the URL of the feed of the watch mode.
+func (r repo) feedURL(mode string) string {
+	u := "https://github.com/" + r.Owner + "/" + r.Name + "/" + mode
+	if mode == watchCommits && r.Branch != "" {
+		u += "/" + r.Branch
+	}
+	return u + ".atom"
+}
+
+// readRepos reads repositories from a file, one per line. Empty lines and
+// lines starting with # are skipped.
+func readRepos(path string) ([]repo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var repos []repo
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		r, err := parseRepo(line)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		repos = append(repos, r)
+	}
+	return repos, sc.Err()
+}
+
+// repoFlags collects the repeated -repo flags.
+type repoFlags []repo
+
+func (f *repoFlags) String() string {
+	var s []string
+	for _, r := range *f {
+		s = append(s, r.Owner+"/"+r.Name)
+	}
+	return strings.Join(s, ",")
+}
+
+func (f *repoFlags) Set(v string) error {
+	r, err := parseRepo(v)
+	if err != nil {
+		return err
+	}
+	*f = append(*f, r)
+	return nil
+}
+
+// listFlag collects repeated string flags.
+type listFlag []string
+
+func (f *listFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *listFlag) Set(v string) error {
+	*f = append(*f, v)
+	return nil
+}
@@ -0,0 +1,97 @@
+package feedtrigger
+
+import (
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// Burst is a group of items of a feed that arrived within the coalescing
+// window.
+type Burst struct {
+	Feed  string
+	Items []*gofeed.Item
+	// Start and End are the arrival times of the first and the last item.
+	Start time.Time
+	End   time.Time
+}
+
+// BurstAction receives coalesced items.
+type BurstAction func(Burst) error
+
+// burstBuffer collects items of a feed until the window closes.
+type burstBuffer struct {
+	burst Burst
+	timer Timer
+}
+
+// coalesce adds the item to the open burst of the feed, opening one that
+// closes after the feed CoalesceWindow if needed.
+func (a *FeedAction) coalesce(f Feed, i *gofeed.Item) {
+	if f.OnBurst == nil || IsCanary(i) {
+		return
+	}
+	window := f.CoalesceWindow
+	if window <= 0 {
+		window = f.RefreshPeriod
+	}
+
+	a.burstsMu.Lock()
+	defer a.burstsMu.Unlock()
+	if a.bursts == nil {
+		a.bursts = make(map[string]*burstBuffer)
+	}
+
+	now := a.now()
+	b, ok := a.bursts[f.URL]
+	if !ok {
+		b = &burstBuffer{burst: Burst{Feed: f.URL, Start: now}}
+		a.bursts[f.URL] = b
+		action := f.OnBurst
+		b.timer = a.clock().AfterFunc(window, func() {
+			a.flushBurst(f.URL, action)
+		})
+	}
+	b.burst.Items = append(b.burst.Items, i)
+	b.burst.End = now
+}
+
+// flushBurst closes the burst of the feed and passes it to the action.
+func (a *FeedAction) flushBurst(url string, action BurstAction) {
+	a.burstsMu.Lock()
+	b, ok := a.bursts[url]
+	delete(a.bursts, url)
+	a.burstsMu.Unlock()
+	if !ok {
+		return
+	}
+
+	if err := action(b.burst); err != nil {
+		a.logf("burst action for %s: %v", url, err)
+	}
+}
+
+// flushBursts closes all open bursts right away.
+func (a *FeedAction) flushBursts() {
+	actions := make(map[string]BurstAction)
+	for _, f := range a.ListFeeds() {
+		if f.OnBurst != nil {
+			actions[f.URL] = f.OnBurst
+		}
+	}
+
+	a.burstsMu.Lock()
+	var urls []string
+	for url, b := range a.bursts {
+		if b.timer.Stop() {
+			urls = append(urls, url)
+		}
+	}
+	a.burstsMu.Unlock()
+
+	for _, url := range urls {
+		if action, ok := actions[url]; ok {
+			a.flushBurst(url, action)
+		}
+	}
+}
@@ -0,0 +1,905 @@
+package feedtrigger
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/philippgille/gokv"
+	"github.com/philippgille/gokv/bbolt"
+
+	"ilya.app/feedtrigger/stores"
+)
+
+// Config is the file representation of the application.
+type Config struct {
+	// Store is a path to the bbolt database or a DSN understood by
+	// stores.Open, e.g. "file:///var/lib/feedtrigger".
+	Store    string                   `json:"store,omitempty"`
+	Profiles map[string]ProfileConfig `json:"profiles,omitempty"`
+	Feeds    []FeedConfig             `json:"feeds"`
+	// Redactions are masking rules applied to items before actions.
+	Redactions []RedactionConfig `json:"redactions,omitempty"`
+	// Dedup suppresses items already triggered from another feed.
+	Dedup *DedupConfig `json:"dedup,omitempty"`
+	// Watchlist is a path to the watchlist file, see Watchlist.
+	Watchlist string `json:"watchlist,omitempty"`
+	// Proxy is used by the feeds without their own.
+	Proxy string `json:"proxy,omitempty"`
+	// Archive keeps the triggered items when set.
+	Archive *ArchiveConfig `json:"archive,omitempty"`
+	// Tenants are isolated feed groups, see Tenant.
+	Tenants []TenantConfig `json:"tenants,omitempty"`
+	// Cluster partitions the feeds between the instances sharing the store
+	// when set.
+	Cluster *ClusterConfig `json:"cluster,omitempty"`
+	// Leases coordinate the instances sharing the store when set.
+	Leases *LeasesConfig `json:"leases,omitempty"`
+	// Plugins is a directory of action executables, see package
+	// actions/plugin. They are referenced by the file name without the
+	// extension.
+	Plugins string `json:"plugins,omitempty"`
+	// PushToken is the bearer token required by the push endpoint.
+	PushToken string `json:"push_token,omitempty"`
+	// Pprof serves the net/http/pprof profiles under /debug/pprof/ of the
+	// admin API.
+	Pprof bool `json:"pprof,omitempty"`
+	// MaxConcurrentFetches bounds the feeds fetched at once.
+	MaxConcurrentFetches int `json:"max_concurrent_fetches,omitempty"`
+	// QueueSize and Dispatchers decouple the delivery from the polls, see
+	// FeedAction.QueueSize.
+	QueueSize   int `json:"queue_size,omitempty"`
+	Dispatchers int `json:"dispatchers,omitempty"`
+	// DeliveryQueue keeps the failed deliveries on disk until the actions
+	// recover when set.
+	DeliveryQueue *DeliveryQueueConfig `json:"delivery_queue,omitempty"`
+	// SlowStoreThreshold is the duration of the store operations logged as
+	// slow, e.g. "100ms".
+	SlowStoreThreshold Duration `json:"slow_store_threshold,omitempty"`
+	// Stagger spreads the first polls over the refresh periods, see
+	// FeedAction.Stagger.
+	Stagger bool `json:"stagger,omitempty"`
+	// Digests are the digests feeds can reference by name.
+	Digests map[string]DigestConfig `json:"digests,omitempty"`
+	// Groups are the feed groups feeds can reference by name.
+	Groups map[string]GroupConfig `json:"groups,omitempty"`
+	// Actions are the actions instantiated from a registry type the feeds
+	// can reference by name, see BuildActions.
+	Actions map[string]ActionConfig `json:"actions,omitempty"`
+	// ThrottleCooldown defers the feeds of a host throttling the requests
+	// without a Retry-After, e.g. "30m".
+	ThrottleCooldown Duration `json:"throttle_cooldown,omitempty"`
+	// OrphanRetention purges the stored state of the feeds removed from
+	// the config and unused for longer, e.g. "720h".
+	OrphanRetention Duration `json:"orphan_retention,omitempty"`
+	// AuditRetention records an audit trail of the items kept that long,
+	// e.g. "168h".
+	AuditRetention Duration `json:"audit_retention,omitempty"`
+	// ExactlyOnce claims the delivery of every item in the store, see
+	// FeedAction.ExactlyOnce.
+	ExactlyOnce bool `json:"exactly_once,omitempty"`
+	// FollowMoves polls the URLs the feeds permanently redirect to instead,
+	// updating the config file, see FeedAction.FollowMoves.
+	FollowMoves bool `json:"follow_moves,omitempty"`
+	// RSSBridge is the root of the RSS-Bridge instance of the feeds with a
+	// bridge, e.g. "https://rss-bridge.org/bridge01".
+	RSSBridge string `json:"rss_bridge,omitempty"`
+}
+
+// BridgeConfig is the file representation of RSSBridge. The URL of the
+// feeds with a bridge is derived from it.
+type BridgeConfig struct {
+	Name   string            `json:"name"`
+	Params map[string]string `json:"params,omitempty"`
+	// BaseURL overrides the Config RSSBridge instance.
+	BaseURL string `json:"base_url,omitempty"`
+}
+
+// GroupConfig is the file representation of FeedGroup.
+type GroupConfig struct {
+	RefreshPeriod Duration          `json:"refresh_period,omitempty"`
+	Filter        string            `json:"filter,omitempty"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	Actions       []string          `json:"actions,omitempty"`
+	// Paused groups don't fetch their feeds until resumed with the admin
+	// API.
+	Paused bool `json:"paused,omitempty"`
+}
+
+// ActionConfig is a named action of a registry type, e.g. "slack", and its
+// parameters, see ActionRegistry.
+type ActionConfig struct {
+	Type   string                 `json:"type"`
+	Params map[string]interface{} `json:"params,omitempty"`
+}
+
+// DigestConfig is the file representation of Digest. The Action is called
+// with a single item summarizing the digest, see SummaryAction.
+type DigestConfig struct {
+	Interval Duration `json:"interval,omitempty"`
+	GroupBy  string   `json:"group_by,omitempty"`
+	Action   string   `json:"action"`
+	// Timezone is the IANA name of the timezone the digests are aligned
+	// in, e.g. daily ones sent at its midnight.
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// TenantConfig is the file representation of Tenant.
+type TenantConfig struct {
+	Name  string       `json:"name"`
+	Feeds []FeedConfig `json:"feeds"`
+	// Actions are used by the feeds without their own.
+	Actions            []string `json:"actions,omitempty"`
+	MaxConcurrentPolls int      `json:"max_concurrent_polls,omitempty"`
+	HostRateLimit      float64  `json:"host_rate_limit,omitempty"`
+	HostBurst          int      `json:"host_burst,omitempty"`
+	Stopped            bool     `json:"stopped,omitempty"`
+}
+
+// ArchiveConfig is the file representation of Archive.
+type ArchiveConfig struct {
+	MaxAge   Duration `json:"max_age,omitempty"`
+	MaxItems int      `json:"max_items,omitempty"`
+	// FullText indexes the items for the search command.
+	FullText bool `json:"full_text,omitempty"`
+}
+
+// ClusterConfig is the file representation of Cluster.
+type ClusterConfig struct {
+	Member       string   `json:"member,omitempty"`
+	Heartbeat    Duration `json:"heartbeat,omitempty"`
+	VirtualNodes int      `json:"virtual_nodes,omitempty"`
+}
+
+// DeliveryQueueConfig is the file representation of DeliveryQueue.
+type DeliveryQueueConfig struct {
+	Path          string   `json:"path"`
+	MaxItems      int      `json:"max_items,omitempty"`
+	MaxAge        Duration `json:"max_age,omitempty"`
+	RetryInterval Duration `json:"retry_interval,omitempty"`
+}
+
+// LeasesConfig is the file representation of Leases.
+type LeasesConfig struct {
+	Owner string   `json:"owner,omitempty"`
+	TTL   Duration `json:"ttl,omitempty"`
+}
+
+// DedupConfig is the file representation of Dedup.
+type DedupConfig struct {
+	// By is "link" (the default) or "content".
+	By     string   `json:"by,omitempty"`
+	Window Duration `json:"window,omitempty"`
+}
+
+// ProfileConfig is a named bundle of settings feeds can reference.
+type ProfileConfig struct {
+	RefreshPeriod Duration          `json:"refresh_period,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	Proxy         string            `json:"proxy,omitempty"`
+	TLS           *TLSConfig        `json:"tls,omitempty"`
+	MaxBodySize   int64             `json:"max_body_size,omitempty"`
+	FetchTimeout  Duration          `json:"fetch_timeout,omitempty"`
+	Adaptive      *AdaptiveConfig   `json:"adaptive,omitempty"`
+	Charset       string            `json:"charset,omitempty"`
+	Timezone      string            `json:"timezone,omitempty"`
+	DateLayouts   []string          `json:"date_layouts,omitempty"`
+	Actions       []string          `json:"actions,omitempty"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+	Labels        map[string]string `json:"labels,omitempty"`
+	ActionTimeout Duration          `json:"action_timeout,omitempty"`
+	Retry         *RetryConfig      `json:"retry,omitempty"`
+	FirstRun      FirstRun          `json:"first_run,omitempty"`
+	MaxItems      int               `json:"max_items_per_poll,omitempty"`
+	Overflow      Overflow          `json:"overflow,omitempty"`
+	Normalize     bool              `json:"normalize,omitempty"`
+	Languages     []string          `json:"languages,omitempty"`
+	Filter        string            `json:"filter,omitempty"`
+	Script        string            `json:"script,omitempty"`
+	NotifyWindow  Duration          `json:"notify_window,omitempty"`
+	Windows       []WindowConfig    `json:"delivery_windows,omitempty"`
+	Digest        string            `json:"digest,omitempty"`
+	Priority      int               `json:"priority,omitempty"`
+	MaxItemAge    Duration          `json:"max_item_age,omitempty"`
+	Detector      string            `json:"detector,omitempty"`
+	SortPublished bool              `json:"sort_by_published,omitempty"`
+	EmptyPolicy   EmptyPolicy       `json:"empty_policy,omitempty"`
+	MaxEmptyPolls int               `json:"max_empty_polls,omitempty"`
+	Anomalies     *AnomalyConfig    `json:"anomalies,omitempty"`
+}
+
+// AnomalyConfig is the file representation of AnomalyDetector. The Action
+// is called with an item describing the anomaly, see AnomalyItemAction.
+type AnomalyConfig struct {
+	Window        Duration `json:"window,omitempty"`
+	BurstFactor   float64  `json:"burst_factor,omitempty"`
+	MinBurst      int      `json:"min_burst,omitempty"`
+	SilenceFactor float64  `json:"silence_factor,omitempty"`
+	MinSamples    int      `json:"min_samples,omitempty"`
+	Action        string   `json:"action"`
+}
+
+// FeedConfig is a feed entry of the Config.
+type FeedConfig struct {
+	URL string `json:"url"`
+	// Bridge polls an RSS-Bridge bridge, the URL is filled in from it.
+	Bridge *BridgeConfig `json:"bridge,omitempty"`
+	// Profile is a name of the profile used for the settings not set here.
+	Profile       string            `json:"profile,omitempty"`
+	RefreshPeriod Duration          `json:"refresh_period,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	// InitialDelay postpones the first poll after the start, e.g. "5m".
+	InitialDelay Duration `json:"initial_delay,omitempty"`
+	// Proxy is an HTTP or SOCKS5 proxy URL, e.g. socks5://127.0.0.1:9050.
+	Proxy string     `json:"proxy,omitempty"`
+	TLS   *TLSConfig `json:"tls,omitempty"`
+	// Charset is the encoding of the feed documents, e.g. "windows-1251",
+	// or "auto" to detect it, see Feed.Charset.
+	Charset string `json:"charset,omitempty"`
+	// Timezone is the IANA name of the timezone of the feed, e.g.
+	// "Europe/Berlin", and DateLayouts the Go layouts of its nonstandard
+	// item dates, see Feed.Location and Feed.DateLayouts.
+	Timezone    string   `json:"timezone,omitempty"`
+	DateLayouts []string `json:"date_layouts,omitempty"`
+	// MaxBodySize is the size limit of the feed document in bytes.
+	MaxBodySize int64 `json:"max_body_size,omitempty"`
+	// FetchTimeout bounds the fetch of the feed, e.g. "1m".
+	FetchTimeout Duration `json:"fetch_timeout,omitempty"`
+	// Adaptive learns the poll interval within the bounds.
+	Adaptive *AdaptiveConfig `json:"adaptive,omitempty"`
+	// Actions are names of the actions run in order for every new item.
+	Actions []string `json:"actions,omitempty"`
+	// Metadata is arbitrary data about the feed passed along with its items.
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Labels are tags of the feed actions can route its items by.
+	Labels map[string]string `json:"labels,omitempty"`
+	// ActionTimeout bounds every action call, e.g. "30s".
+	ActionTimeout Duration `json:"action_timeout,omitempty"`
+	// Retry retries failed deliveries.
+	Retry *RetryConfig `json:"retry,omitempty"`
+	// FirstRun is the number of the newest items to trigger on the first
+	// poll, -1 for all of them.
+	FirstRun FirstRun `json:"first_run,omitempty"`
+	// MaxItems caps the number of items triggered per poll, the rest is
+	// dropped or put to the dead-letter queue according to Overflow.
+	MaxItems int      `json:"max_items_per_poll,omitempty"`
+	Overflow Overflow `json:"overflow,omitempty"`
+	// Normalize cleans the HTML out of the item texts.
+	Normalize bool `json:"normalize,omitempty"`
+	// StripTracking removes the utm_ and the StripParams query parameters
+	// from the item links.
+	StripTracking bool     `json:"strip_tracking,omitempty"`
+	StripParams   []string `json:"strip_params,omitempty"`
+	// Unshorten resolves the shortened item links, see Unshortener.
+	Unshorten bool `json:"unshorten,omitempty"`
+	// Truncate cuts the item description and content to the number of
+	// characters.
+	Truncate int `json:"truncate,omitempty"`
+	// Languages are ISO 639-1 codes of the languages of the items to
+	// trigger, all languages if empty.
+	Languages []string `json:"languages,omitempty"`
+	// Script is an executable run for every new item after the actions,
+	// see Script.
+	Script string `json:"script,omitempty"`
+	// Filter is an expression the new items must match, see
+	// CompileFilter. A profile filter must match too.
+	Filter string `json:"filter,omitempty"`
+	// Push feeds receive their items from the push endpoint instead of
+	// being polled.
+	Push bool `json:"push,omitempty"`
+	// NotifyWindow suppresses the items whose title or link the feed
+	// triggered within the window, e.g. "12h".
+	NotifyWindow Duration `json:"notify_window,omitempty"`
+	// Windows are the periods the actions fire in, the items detected
+	// outside of them are held until one opens.
+	Windows []WindowConfig `json:"delivery_windows,omitempty"`
+	// Digest is the name of the digest the new items are sent with instead
+	// of triggering the actions one by one.
+	Digest string `json:"digest,omitempty"`
+	// Group is the name of the group providing the defaults after the
+	// profile, see FeedGroup.
+	Group string `json:"group,omitempty"`
+	// MaxItemAge drops the new items published longer ago, e.g. "720h".
+	MaxItemAge Duration `json:"max_item_age,omitempty"`
+	// Detector is the name of the built-in ChangeDetector deciding which
+	// items are new: "id" (the default), "title", "timestamp" or "hash".
+	Detector string `json:"detector,omitempty"`
+	// SortByPublished tolerates the feeds ordering their items by activity,
+	// e.g. forums, by sorting the items by the publication time.
+	SortByPublished bool `json:"sort_by_published,omitempty"`
+	// EmptyPolicy is how the polls returning no items are handled: ""
+	// ignores them, "warn" reports them and "fail" fails the feed after
+	// MaxEmptyPolls of them in a row.
+	EmptyPolicy   EmptyPolicy `json:"empty_policy,omitempty"`
+	MaxEmptyPolls int         `json:"max_empty_polls,omitempty"`
+	// Anomalies reports the bursts and the silences of the feed.
+	Anomalies *AnomalyConfig `json:"anomalies,omitempty"`
+	// Priority orders the feeds under load, the higher first. Negative
+	// priority feeds skip the polls missed under load.
+	Priority int `json:"priority,omitempty"`
+}
+
+// WindowConfig is the file representation of DeliveryWindow.
+type WindowConfig struct {
+	// Days are the days the window opens on, e.g. "mon-fri", every day if
+	// empty.
+	Days string `json:"days,omitempty"`
+	// Start and End are the clock times, e.g. "08:00" and "20:00".
+	Start string `json:"start"`
+	End   string `json:"end"`
+	// Timezone is the IANA name of the timezone of the window, e.g.
+	// "Europe/Berlin", UTC if empty.
+	Timezone string `json:"timezone,omitempty"`
+}
+
+// AdaptiveConfig is the file representation of AdaptiveInterval.
+type AdaptiveConfig struct {
+	Min Duration `json:"min,omitempty"`
+	Max Duration `json:"max,omitempty"`
+}
+
+// RetryConfig is the file representation of RetryPolicy.
+type RetryConfig struct {
+	Attempts   int      `json:"attempts"`
+	Backoff    Duration `json:"backoff,omitempty"`
+	MaxBackoff Duration `json:"max_backoff,omitempty"`
+}
+
+// Duration is a time.Duration encoded as a string like "5m" in JSON.
+type Duration time.Duration
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration should be a string: %w", err)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// LoadConfig reads the config file. A missing file results in an empty config.
+func LoadConfig(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Config{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading config: %w", err)
+	}
+
+	var c Config
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, fmt.Errorf("parsing config %s: %w", path, err)
+	}
+	for n, fc := range c.Feeds {
+		if fc.Bridge != nil {
+			if c.Feeds[n].URL, err = c.bridge(fc.Bridge).URL(); err != nil {
+				return nil, fmt.Errorf("parsing config %s: %w", path, err)
+			}
+		}
+	}
+	return &c, nil
+}
+
+// bridge returns the RSS-Bridge bridge of the config entry.
+func (c *Config) bridge(bc *BridgeConfig) RSSBridge {
+	b := RSSBridge{BaseURL: bc.BaseURL, Bridge: bc.Name, Params: bc.Params}
+	if b.BaseURL == "" {
+		b.BaseURL = c.RSSBridge
+	}
+	return b
+}
+
+// Save writes the config file atomically.
+func (c *Config) Save(path string) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding config: %w", err)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".feedtrigger-*.json")
+	if err != nil {
+		return fmt.Errorf("saving config: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(append(b, '\n')); err != nil {
+		tmp.Close()
+		return fmt.Errorf("saving config: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("saving config: %w", err)
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// OpenStore opens the configured store, the default bbolt database if
+// Store is empty.
+func (c *Config) OpenStore() (gokv.Store, error) {
+	if strings.Contains(c.Store, "://") {
+		return stores.Open(c.Store)
+	}
+	opts := bbolt.DefaultOptions
+	if c.Store != "" {
+		opts.Path = c.Store
+	}
+	s, err := bbolt.NewStore(opts)
+	if err != nil {
+		return nil, fmt.Errorf("bbolt.NewStore: %w", err)
+	}
+	return s, nil
+}
+
+// Feed returns the config entry for url.
+func (c *Config) Feed(url string) (*FeedConfig, bool) {
+	for i := range c.Feeds {
+		if c.Feeds[i].URL == url {
+			return &c.Feeds[i], true
+		}
+	}
+	return nil, false
+}
+
+// BuildTenants turns the tenant entries into tenants, see BuildFeeds.
+func (c *Config) BuildTenants(actions map[string]NewItemAction) ([]*Tenant, error) {
+	var tenants []*Tenant
+	for _, tc := range c.Tenants {
+		cc := *c
+		cc.Feeds = make([]FeedConfig, len(tc.Feeds))
+		for n, fc := range tc.Feeds {
+			if len(fc.Actions) == 0 && fc.Script == "" && fc.Profile == "" {
+				fc.Actions = tc.Actions
+			}
+			cc.Feeds[n] = fc
+		}
+		feeds, err := cc.BuildFeeds(actions)
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", tc.Name, err)
+		}
+		tenants = append(tenants, &Tenant{
+			Name:               tc.Name,
+			Feeds:              feeds,
+			MaxConcurrentPolls: tc.MaxConcurrentPolls,
+			HostRateLimit:      tc.HostRateLimit,
+			HostBurst:          tc.HostBurst,
+			Stopped:            tc.Stopped,
+		})
+	}
+	return tenants, nil
+}
+
+// fingerprint returns the hash of the resolved feed entry and the
+// definitions of the actions it references. It tells the reloaded feeds
+// whose filters, transforms or actions changed, see SyncFeeds.
+func (c *Config) fingerprint(fc FeedConfig) (string, error) {
+	defined := make(map[string]ActionConfig)
+	names := fc.Actions
+	if fc.Anomalies != nil {
+		names = append(names[:len(names):len(names)], fc.Anomalies.Action)
+	}
+	for _, name := range names {
+		if ac, ok := c.Actions[name]; ok {
+			defined[name] = ac
+		}
+	}
+	b, err := json.Marshal(struct {
+		Feed    FeedConfig
+		Actions map[string]ActionConfig
+	}{fc, defined})
+	if err != nil {
+		return "", err
+	}
+	sum := sha1.Sum(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// BuildFeeds turns config entries into feeds resolving action names with the
+// actions map.
+func (c *Config) BuildFeeds(actions map[string]NewItemAction) ([]Feed, error) {
+	var feeds []Feed
+	for _, fc := range c.Feeds {
+		fc, err := c.resolve(fc)
+		if err != nil {
+			return nil, err
+		}
+		if fc.Bridge != nil {
+			if fc.URL, err = c.bridge(fc.Bridge).URL(); err != nil {
+				return nil, fmt.Errorf("feed %s: %w", fc.Bridge.Name, err)
+			}
+		}
+
+		var chain []NewItemAction
+		for _, name := range fc.Actions {
+			action, ok := actions[name]
+			if !ok {
+				return nil, fmt.Errorf("feed %s: unknown action %q", fc.URL, name)
+			}
+			chain = append(chain, action)
+		}
+		grouped := fc.Group != "" && len(c.Groups[fc.Group].Actions) > 0
+		if len(chain) == 0 && fc.Script == "" && !grouped {
+			return nil, fmt.Errorf("feed %s: no actions", fc.URL)
+		}
+
+		// the feeds without actions use the ones of their group
+		f := NewFeed(fc.URL, nil)
+		if f.config, err = c.fingerprint(fc); err != nil {
+			return nil, fmt.Errorf("feed %s: %w", fc.URL, err)
+		}
+		if len(chain) > 0 {
+			f.OnNewRecord = Chain(chain...)
+			f.ActionNames = fc.Actions
+		}
+		if fc.Script != "" {
+			f.OnNewRecordCtx = Script(fc.Script)
+		}
+		if fc.RefreshPeriod > 0 {
+			f.RefreshPeriod = time.Duration(fc.RefreshPeriod)
+		}
+		f.InitialDelay = time.Duration(fc.InitialDelay)
+		f.NotifyWindow = time.Duration(fc.NotifyWindow)
+		f.Digest = fc.Digest
+		f.Priority = fc.Priority
+		f.Group = fc.Group
+		f.MaxItemAge = time.Duration(fc.MaxItemAge)
+		f.SortByPublished = fc.SortByPublished
+		f.EmptyPolicy = fc.EmptyPolicy
+		f.MaxEmptyPolls = fc.MaxEmptyPolls
+		if fc.Bridge != nil {
+			f.Parse = ParseBridge
+		}
+		if ac := fc.Anomalies; ac != nil {
+			action, ok := actions[ac.Action]
+			if !ok {
+				return nil, fmt.Errorf("feed %s: unknown anomaly action %q", fc.URL, ac.Action)
+			}
+			f.Anomalies = &AnomalyDetector{
+				Window:        time.Duration(ac.Window),
+				BurstFactor:   ac.BurstFactor,
+				MinBurst:      ac.MinBurst,
+				SilenceFactor: ac.SilenceFactor,
+				MinSamples:    ac.MinSamples,
+			}
+			f.OnAnomaly = AnomalyItemAction(action)
+		}
+		if fc.Detector != "" {
+			d, ok := DetectorByName(fc.Detector)
+			if !ok {
+				return nil, fmt.Errorf("feed %s: unknown detector %q", fc.URL, fc.Detector)
+			}
+			f.Detector = d
+		}
+		for _, wc := range fc.Windows {
+			w, err := ParseDeliveryWindow(wc.Days, wc.Start, wc.End, wc.Timezone)
+			if err != nil {
+				return nil, fmt.Errorf("feed %s: %w", fc.URL, err)
+			}
+			f.DeliveryWindows = append(f.DeliveryWindows, w)
+		}
+		if len(fc.Headers) > 0 {
+			f.Headers = make(http.Header, len(fc.Headers))
+			for k, v := range fc.Headers {
+				f.Headers.Set(k, v)
+			}
+		}
+		f.Metadata = fc.Metadata
+		f.Labels = fc.Labels
+		f.Proxy = fc.Proxy
+		f.TLS = fc.TLS
+		f.MaxBodySize = fc.MaxBodySize
+		f.Push = fc.Push
+		f.FetchTimeout = time.Duration(fc.FetchTimeout)
+		if ad := fc.Adaptive; ad != nil {
+			f.Adaptive = &AdaptiveInterval{Min: time.Duration(ad.Min), Max: time.Duration(ad.Max)}
+		}
+		f.ActionTimeout = time.Duration(fc.ActionTimeout)
+		if r := fc.Retry; r != nil {
+			f.Retry = &RetryPolicy{
+				Attempts:   r.Attempts,
+				Backoff:    time.Duration(r.Backoff),
+				MaxBackoff: time.Duration(r.MaxBackoff),
+			}
+		}
+		f.FirstRun = fc.FirstRun
+		f.MaxItemsPerPoll = fc.MaxItems
+		f.Overflow = fc.Overflow
+		f.Normalize = fc.Normalize
+		f.Charset = fc.Charset
+		if fc.Timezone != "" {
+			if f.Location, err = time.LoadLocation(fc.Timezone); err != nil {
+				return nil, fmt.Errorf("feed %s: %w", fc.URL, err)
+			}
+		}
+		f.DateLayouts = fc.DateLayouts
+		if fc.Unshorten {
+			f.Unshorten = &Unshortener{}
+		}
+		var transforms []Transform
+		if fc.StripTracking {
+			transforms = append(transforms, StripTrackingParams(fc.StripParams...))
+		}
+		if fc.Truncate > 0 {
+			transforms = append(transforms, TruncateContent(fc.Truncate))
+		}
+		if len(transforms) > 0 {
+			f.Transform = ChainTransforms(transforms...)
+		}
+		if len(fc.Languages) > 0 {
+			f.Filters = append(f.Filters, LanguageFilter(fc.Languages...))
+		}
+		if fc.Filter != "" {
+			filter, err := CompileFilter(fc.Filter)
+			if err != nil {
+				return nil, fmt.Errorf("feed %s: %w", fc.URL, err)
+			}
+			f.Filters = append(f.Filters, filter)
+		}
+		feeds = append(feeds, *f)
+	}
+	return feeds, nil
+}
+
+// BuildActions instantiates the configured named actions with the registry.
+func (c *Config) BuildActions(r ActionRegistry) (map[string]NewItemAction, error) {
+	actions := make(map[string]NewItemAction, len(c.Actions))
+	for name, ac := range c.Actions {
+		action, err := r.New(ac.Type, ac.Params)
+		if err != nil {
+			return nil, fmt.Errorf("action %s: %w", name, err)
+		}
+		actions[name] = action
+	}
+	return actions, nil
+}
+
+// BuildGroups returns the configured feed groups.
+func (c *Config) BuildGroups(actions map[string]NewItemAction) (map[string]*FeedGroup, error) {
+	groups := make(map[string]*FeedGroup, len(c.Groups))
+	for name, gc := range c.Groups {
+		g := &FeedGroup{
+			Name:          name,
+			RefreshPeriod: time.Duration(gc.RefreshPeriod),
+			Labels:        gc.Labels,
+		}
+		var chain []NewItemAction
+		for _, an := range gc.Actions {
+			action, ok := actions[an]
+			if !ok {
+				return nil, fmt.Errorf("group %s: unknown action %q", name, an)
+			}
+			chain = append(chain, action)
+		}
+		if len(chain) > 0 {
+			g.OnNewRecord = Chain(chain...)
+		}
+		if gc.Filter != "" {
+			filter, err := CompileFilter(gc.Filter)
+			if err != nil {
+				return nil, fmt.Errorf("group %s: %w", name, err)
+			}
+			g.Filters = []ItemFilter{filter}
+		}
+		groups[name] = g
+	}
+	return groups, nil
+}
+
+// BuildDigests returns the configured digests.
+func (c *Config) BuildDigests(actions map[string]NewItemAction) ([]*Digest, error) {
+	names := make([]string, 0, len(c.Digests))
+	for name := range c.Digests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var digests []*Digest
+	for _, name := range names {
+		dc := c.Digests[name]
+		action, ok := actions[dc.Action]
+		if !ok {
+			return nil, fmt.Errorf("digest %s: unknown action %q", name, dc.Action)
+		}
+		d := &Digest{
+			Name:     name,
+			Interval: time.Duration(dc.Interval),
+			GroupBy:  dc.GroupBy,
+			OnDigest: SummaryAction(action),
+		}
+		if dc.Timezone != "" {
+			var err error
+			if d.Location, err = time.LoadLocation(dc.Timezone); err != nil {
+				return nil, fmt.Errorf("digest %s: %w", name, err)
+			}
+		}
+		digests = append(digests, d)
+	}
+	return digests, nil
+}
+
+// Deduplication returns the configured Dedup, nil if it's disabled.
+func (c *Config) Deduplication() (*Dedup, error) {
+	if c.Dedup == nil {
+		return nil, nil
+	}
+	d := &Dedup{Window: time.Duration(c.Dedup.Window)}
+	switch c.Dedup.By {
+	case "", "link":
+		d.Key = DedupByLink
+	case "content":
+		d.Key = DedupByContent
+	default:
+		return nil, fmt.Errorf("unknown dedup key %q", c.Dedup.By)
+	}
+	return d, nil
+}
+
+// RedactionRules compiles the configured redaction rules.
+func (c *Config) RedactionRules() ([]RedactionRule, error) {
+	var rules []RedactionRule
+	for _, rc := range c.Redactions {
+		r, err := rc.Rule()
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// resolve returns the feed entry with settings inherited from its profile.
+func (c *Config) resolve(fc FeedConfig) (FeedConfig, error) {
+	if fc.Profile == "" {
+		return fc, nil
+	}
+	p, ok := c.Profiles[fc.Profile]
+	if !ok {
+		return fc, fmt.Errorf("feed %s: unknown profile %q", fc.URL, fc.Profile)
+	}
+
+	if fc.RefreshPeriod == 0 {
+		fc.RefreshPeriod = p.RefreshPeriod
+	}
+	if len(fc.Actions) == 0 {
+		fc.Actions = p.Actions
+	}
+	if fc.Proxy == "" {
+		fc.Proxy = p.Proxy
+	}
+	if fc.TLS == nil {
+		fc.TLS = p.TLS
+	}
+	if fc.MaxBodySize == 0 {
+		fc.MaxBodySize = p.MaxBodySize
+	}
+	if fc.FetchTimeout == 0 {
+		fc.FetchTimeout = p.FetchTimeout
+	}
+	if fc.Charset == "" {
+		fc.Charset = p.Charset
+	}
+	if fc.Timezone == "" {
+		fc.Timezone = p.Timezone
+	}
+	if len(fc.DateLayouts) == 0 {
+		fc.DateLayouts = p.DateLayouts
+	}
+	if fc.Adaptive == nil {
+		fc.Adaptive = p.Adaptive
+	}
+	if fc.ActionTimeout == 0 {
+		fc.ActionTimeout = p.ActionTimeout
+	}
+	if fc.Retry == nil {
+		fc.Retry = p.Retry
+	}
+	if fc.FirstRun == FirstRunSkip {
+		fc.FirstRun = p.FirstRun
+	}
+	if fc.MaxItems == 0 {
+		fc.MaxItems = p.MaxItems
+		fc.Overflow = p.Overflow
+	}
+	if fc.NotifyWindow == 0 {
+		fc.NotifyWindow = p.NotifyWindow
+	}
+	if len(fc.Windows) == 0 {
+		fc.Windows = p.Windows
+	}
+	if fc.Digest == "" {
+		fc.Digest = p.Digest
+	}
+	if fc.Priority == 0 {
+		fc.Priority = p.Priority
+	}
+	if fc.MaxItemAge == 0 {
+		fc.MaxItemAge = p.MaxItemAge
+	}
+	if fc.Detector == "" {
+		fc.Detector = p.Detector
+	}
+	if !fc.SortByPublished {
+		fc.SortByPublished = p.SortPublished
+	}
+	if fc.EmptyPolicy == EmptySkip {
+		fc.EmptyPolicy = p.EmptyPolicy
+	}
+	if fc.MaxEmptyPolls == 0 {
+		fc.MaxEmptyPolls = p.MaxEmptyPolls
+	}
+	if fc.Anomalies == nil {
+		fc.Anomalies = p.Anomalies
+	}
+	if !fc.Normalize {
+		fc.Normalize = p.Normalize
+	}
+	if len(fc.Languages) == 0 {
+		fc.Languages = p.Languages
+	}
+	if fc.Script == "" {
+		fc.Script = p.Script
+	}
+	switch {
+	case fc.Filter == "":
+		fc.Filter = p.Filter
+	case p.Filter != "":
+		fc.Filter = "(" + p.Filter + ") && (" + fc.Filter + ")"
+	}
+	headers := make(map[string]string, len(p.Headers)+len(fc.Headers))
+	for k, v := range p.Headers {
+		headers[k] = v
+	}
+	for k, v := range fc.Headers {
+		headers[k] = v
+	}
+	fc.Headers = headers
+	metadata := make(map[string]string, len(p.Metadata)+len(fc.Metadata))
+	for k, v := range p.Metadata {
+		metadata[k] = v
+	}
+	for k, v := range fc.Metadata {
+		metadata[k] = v
+	}
+	fc.Metadata = metadata
+	labels := make(map[string]string, len(p.Labels)+len(fc.Labels))
+	for k, v := range p.Labels {
+		labels[k] = v
+	}
+	for k, v := range fc.Labels {
+		labels[k] = v
+	}
+	fc.Labels = labels
+	return fc, nil
+}
+
+// Chain runs actions in order, stopping at the first error.
+func Chain(actions ...NewItemAction) NewItemAction {
+	if len(actions) == 1 {
+		return actions[0]
+	}
+	return func(i *gofeed.Item) error {
+		for _, action := range actions {
+			if err := action(i); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,85 @@
+package feedtrigger
+
+import (
+	"io/ioutil"
+	"log"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger/stores"
+)
+
+// TestReloadUnchanged builds the feeds of the same config twice, as a hot
+// reload does, and syncs them.
+func TestReloadUnchanged(t *testing.T) {
+	config := func() *Config {
+		return &Config{
+			Profiles: map[string]ProfileConfig{
+				"news": {RefreshPeriod: Duration(time.Hour), Languages: []string{"en"}},
+			},
+			Actions: map[string]ActionConfig{
+				"hook": {Type: "webhook", Params: map[string]interface{}{"url": "http://example.com/hook"}},
+			},
+			Feeds: []FeedConfig{
+				{
+					URL:           "http://example.com/feed.xml",
+					Profile:       "news",
+					Actions:       []string{"log", "hook"},
+					Filter:        "item.title.contains('CVE')",
+					StripTracking: true,
+					Unshorten:     true,
+					Timezone:      "Europe/Berlin",
+					Detector:      "hash",
+					Anomalies:     &AnomalyConfig{MinBurst: 5, Action: "log"},
+				},
+				{URL: "http://example.com/other.xml", Actions: []string{"log"}},
+			},
+		}
+	}
+	build := func(c *Config) []Feed {
+		actions := map[string]NewItemAction{
+			"log":  func(*gofeed.Item) error { return nil },
+			"hook": func(*gofeed.Item) error { return nil },
+		}
+		feeds, err := c.BuildFeeds(actions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return feeds
+	}
+
+	app, err := New(WithStore(&stores.MemoryStore{}), WithFeeds(build(config())...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.Logger = log.New(ioutil.Discard, "", 0)
+	added, removed, updated, err := app.SyncFeeds(build(config()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added)+len(removed)+len(updated) > 0 {
+		t.Errorf("unchanged config: added %v, removed %v, updated %v", added, removed, updated)
+	}
+
+	for _, change := range []func(*Config){
+		func(c *Config) { c.Feeds[0].Filter = "item.title.contains('RCE')" },
+		func(c *Config) { c.Actions["hook"].Params["url"] = "http://example.com/other" },
+		func(c *Config) { c.Profiles["news"] = ProfileConfig{Languages: []string{"de"}} },
+	} {
+		c := config()
+		change(c)
+		_, _, updated, err := app.SyncFeeds(build(c))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"http://example.com/feed.xml"}; !reflect.DeepEqual(updated, want) {
+			t.Errorf("updated %v, want %v", updated, want)
+		}
+		if _, _, _, err := app.SyncFeeds(build(config())); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package feedtrigger
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// cooldownsKey is the key of the stored host cooldowns.
+const cooldownsKey = "cooldowns"
+
+// DefaultThrottleCooldown is how long the feeds of a host throttling the
+// requests without a Retry-After are deferred.
+const DefaultThrottleCooldown = 10 * time.Minute
+
+// cooldowns are the hosts throttling the requests and the time they can be
+// polled again, kept in the store to survive restarts.
+type cooldowns struct {
+	mu     sync.Mutex
+	loaded bool
+	until  map[string]time.Time
+}
+
+func hostOf(rawurl string) string {
+	if u, err := url.Parse(rawurl); err == nil && u.Hostname() != "" {
+		return u.Hostname()
+	}
+	return rawurl
+}
+
+// loadCooldowns reads the stored cooldowns once, cooldowns.mu must be held.
+func (a *FeedAction) loadCooldowns() error {
+	c := &a.cooldowns
+	if c.loaded {
+		return nil
+	}
+	until := make(map[string]time.Time)
+	if _, err := a.kv().Get(cooldownsKey, &until); err != nil {
+		return fmt.Errorf("loading cooldowns: %w", err)
+	}
+	c.until, c.loaded = until, true
+	return nil
+}
+
+// cooldown returns the time the host of the feed URL is throttling the
+// requests until, zero if it isn't.
+func (a *FeedAction) cooldown(feedURL string) time.Time {
+	c := &a.cooldowns
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := a.loadCooldowns(); err != nil {
+		a.logf("%s: %v", feedURL, err)
+		return time.Time{}
+	}
+	until := c.until[hostOf(feedURL)]
+	if !until.After(a.now()) {
+		return time.Time{}
+	}
+	return until
+}
+
+// throttled defers the feeds of the host answering the feed request with
+// 429 or 503 for its Retry-After, ThrottleCooldown without one.
+func (a *FeedAction) throttled(f Feed, resp *http.Response) {
+	now := a.now()
+	d := a.ThrottleCooldown
+	if d <= 0 {
+		d = DefaultThrottleCooldown
+	}
+	if !f.IgnoreCacheHeaders {
+		if ra := retryAfter(resp, now); ra > 0 {
+			d = ra
+		}
+	}
+	host := hostOf(f.URL)
+	until := now.Add(d).UTC()
+
+	c := &a.cooldowns
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := a.loadCooldowns(); err != nil {
+		a.logf("%s: %v", f.URL, err)
+		c.until, c.loaded = make(map[string]time.Time), true
+	}
+	if c.until[host].After(until) {
+		return
+	}
+	for h, t := range c.until {
+		if !t.After(now) {
+			delete(c.until, h)
+		}
+	}
+	c.until[host] = until
+	a.logf("%s: %s throttles the requests, deferring its feeds until %s", f.URL, host, until.Format(time.RFC3339))
+	vars.Add("throttled", 1)
+	if a.DryRun {
+		return
+	}
+	if err := a.kv().Set(cooldownsKey, c.until); err != nil {
+		a.logf("%s: storing cooldowns: %v", f.URL, err)
+	}
+}
+
+// Cooldowns returns the hosts throttling the requests and the time their
+// feeds are polled again.
+func (a *FeedAction) Cooldowns() map[string]time.Time {
+	c := &a.cooldowns
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[string]time.Time)
+	if err := a.loadCooldowns(); err != nil {
+		a.logf("%v", err)
+		return out
+	}
+	now := a.now()
+	for h, t := range c.until {
+		if t.After(now) {
+			out[h] = t
+		}
+	}
+	return out
+}
@@ -0,0 +1,129 @@
+package feedtrigger
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// PollCost is the resource usage of a feed.
+type PollCost struct {
+	// Fetch is the time spent downloading the feed, the whole fetch of
+	// the feeds with a Source or the application Fetcher.
+	Fetch   time.Duration `json:"fetch"`
+	Parse   time.Duration `json:"parse"`
+	Actions time.Duration `json:"actions"`
+	// Bytes is the size of the downloaded documents.
+	Bytes int64 `json:"bytes"`
+}
+
+// Total is the time spent on the feed.
+func (c PollCost) Total() time.Duration {
+	return c.Fetch + c.Parse + c.Actions
+}
+
+func (c *PollCost) add(o PollCost) {
+	c.Fetch += o.Fetch
+	c.Parse += o.Parse
+	c.Actions += o.Actions
+	c.Bytes += o.Bytes
+}
+
+// CostMetric orders the TopCosts report.
+type CostMetric string
+
+// Cost metrics.
+const (
+	CostTotal   CostMetric = "total"
+	CostFetch   CostMetric = "fetch"
+	CostParse   CostMetric = "parse"
+	CostActions CostMetric = "actions"
+	CostBytes   CostMetric = "bytes"
+)
+
+// of returns the metric of the cost.
+func (m CostMetric) of(c PollCost) (int64, error) {
+	switch m {
+	case CostTotal, "":
+		return int64(c.Total()), nil
+	case CostFetch:
+		return int64(c.Fetch), nil
+	case CostParse:
+		return int64(c.Parse), nil
+	case CostActions:
+		return int64(c.Actions), nil
+	case CostBytes:
+		return c.Bytes, nil
+	}
+	return 0, fmt.Errorf("unknown cost metric %q", m)
+}
+
+// FeedCost is the resource usage of a feed since its stats were started.
+type FeedCost struct {
+	URL   string    `json:"url"`
+	Polls int64     `json:"polls"`
+	Since time.Time `json:"since"`
+	Cost  PollCost  `json:"cost"`
+	// PerPoll is the average cost of a poll.
+	PerPoll PollCost `json:"per_poll"`
+}
+
+// charge adds the cost to the feed, for the next poll to report.
+func (a *FeedAction) charge(url string, c PollCost) {
+	s := a.state(url)
+	s.mu.Lock()
+	s.cost.add(c)
+	s.mu.Unlock()
+}
+
+// takeCost returns the cost charged to the feed since the last call.
+func (s *feedState) takeCost() PollCost {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.cost
+	s.cost = PollCost{}
+	return c
+}
+
+// TopCosts returns the n most expensive feeds by the metric from their
+// stored stats, all of them if n is zero. The feeds are the urls, the
+// configured ones if there are none.
+func (a *FeedAction) TopCosts(n int, by CostMetric, urls ...string) ([]FeedCost, error) {
+	if _, err := by.of(PollCost{}); err != nil {
+		return nil, err
+	}
+	if len(urls) == 0 {
+		for _, f := range a.ListFeeds() {
+			urls = append(urls, f.URL)
+		}
+	}
+	costs := make([]FeedCost, 0, len(urls))
+	for _, url := range urls {
+		st, found, err := a.Stats(url)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			continue
+		}
+		fc := FeedCost{URL: url, Polls: st.Polls, Since: st.Since, Cost: st.Cost}
+		if st.Polls > 0 {
+			fc.PerPoll = PollCost{
+				Fetch:   st.Cost.Fetch / time.Duration(st.Polls),
+				Parse:   st.Cost.Parse / time.Duration(st.Polls),
+				Actions: st.Cost.Actions / time.Duration(st.Polls),
+				Bytes:   st.Cost.Bytes / st.Polls,
+			}
+		}
+		costs = append(costs, fc)
+	}
+	sort.SliceStable(costs, func(i, j int) bool {
+		ci, _ := by.of(costs[i].Cost)
+		cj, _ := by.of(costs[j].Cost)
+		return ci > cj
+	})
+	if n > 0 && len(costs) > n {
+		costs = costs[:n]
+	}
+	return costs, nil
+}
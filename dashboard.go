@@ -0,0 +1,171 @@
+package feedtrigger
+
+import (
+	"html/template"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// maxRecent is the number of delivered items shown by the dashboard.
+const maxRecent = 50
+
+// Delivery is an item delivered to the actions.
+type Delivery struct {
+	Feed  string    `json:"feed"`
+	Title string    `json:"title"`
+	Link  string    `json:"link"`
+	At    time.Time `json:"at"`
+	// Item is set for the watchers only, see WatchItems.
+	Item *gofeed.Item `json:"item,omitempty"`
+}
+
+// recentItems keeps the latest deliveries in memory.
+type recentItems struct {
+	mu    sync.Mutex
+	items []Delivery
+}
+
+func (r *recentItems) add(d Delivery) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.items = append(r.items, d)
+	if len(r.items) > maxRecent {
+		r.items = r.items[len(r.items)-maxRecent:]
+	}
+}
+
+// Recent returns the latest items delivered since the start, the newest
+// first.
+func (a *FeedAction) Recent() []Delivery {
+	a.recent.mu.Lock()
+	defer a.recent.mu.Unlock()
+	out := make([]Delivery, len(a.recent.items))
+	for n, d := range a.recent.items {
+		out[len(out)-1-n] = d
+	}
+	return out
+}
+
+type dashboardFeed struct {
+	FeedStatus
+	Stalled bool
+	Errors  []PollError
+}
+
+var dashboardPage = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"ago": func(t time.Time) string {
+		if t.IsZero() {
+			return "never"
+		}
+		return time.Since(t).Round(time.Second).String() + " ago"
+	},
+	"in": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return "in " + time.Until(t).Round(time.Second).String()
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="30">
+<title>feedtrigger</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+th, td { text-align: left; padding: .3em .6em; border-bottom: 1px solid #ddd; vertical-align: top; }
+.bad { color: #b00; }
+.muted { color: #888; }
+form { display: inline; }
+details { font-size: .9em; }
+</style>
+</head>
+<body>
+<h1>feedtrigger</h1>
+<h2>Feeds</h2>
+<table>
+<tr><th>Feed</th><th>State</th><th>Last poll</th><th>Last success</th><th>Next poll</th><th>Triggered</th><th></th></tr>
+{{range .Feeds}}
+<tr>
+<td><a href="{{.URL}}">{{.URL}}</a>
+{{if .Errors}}<details><summary class="bad">{{len .Errors}} recent errors</summary>
+{{range .Errors}}<div>{{.Time.Format "2006-01-02 15:04:05"}} {{.Error}}</div>{{end}}
+</details>{{end}}</td>
+<td>{{if .Paused}}<span class="muted">paused</span>{{else if .Stalled}}<span class="bad">stalled</span>{{else if .ConsecutiveFailures}}<span class="bad">failing</span>{{else}}ok{{end}}</td>
+<td>{{ago .LastPoll}}</td>
+<td>{{ago .LastSuccess}}</td>
+<td>{{if .Paused}}-{{else}}{{in .NextPoll}}{{end}}</td>
+<td>{{.Triggered}}</td>
+<td>
+<form method="post" action="op"><input type="hidden" name="url" value="{{.URL}}"><button name="op" value="poll">Poll now</button></form>
+<form method="post" action="op"><input type="hidden" name="url" value="{{.URL}}">{{if .Paused}}<button name="op" value="resume">Resume</button>{{else}}<button name="op" value="pause">Pause</button>{{end}}</form>
+</td>
+</tr>
+{{end}}
+</table>
+<h2>Recent items</h2>
+<table>
+<tr><th>Delivered</th><th>Item</th><th>Feed</th></tr>
+{{range .Recent}}
+<tr><td>{{ago .At}}</td><td><a href="{{.Link}}">{{.Title}}</a></td><td class="muted">{{.Feed}}</td></tr>
+{{else}}
+<tr><td colspan="3" class="muted">nothing delivered since the start</td></tr>
+{{end}}
+</table>
+</body>
+</html>
+`))
+
+// Dashboard returns a web UI listing the feeds with their health, error
+// history and recent items, with buttons to poll, pause and resume feeds.
+// AdminHandler serves it at the root.
+func (a *FeedAction) Dashboard() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		stalled := make(map[string]bool)
+		for _, url := range a.Stalled() {
+			stalled[url] = true
+		}
+		var feeds []dashboardFeed
+		for _, s := range a.Status() {
+			feeds = append(feeds, dashboardFeed{
+				FeedStatus: s,
+				Stalled:    stalled[s.URL],
+				Errors:     a.PollErrors(s.URL),
+			})
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		dashboardPage.Execute(w, map[string]interface{}{
+			"Feeds":  feeds,
+			"Recent": a.Recent(),
+		})
+	})
+	mux.HandleFunc("/op", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		url := r.FormValue("url")
+		switch r.FormValue("op") {
+		case "poll":
+			a.PollNow(url)
+		case "pause":
+			a.PauseFeed(url)
+		case "resume":
+			a.ResumeFeed(url)
+		default:
+			http.Error(w, "unknown operation", http.StatusBadRequest)
+			return
+		}
+		http.Redirect(w, r, "./", http.StatusSeeOther)
+	})
+	return mux
+}
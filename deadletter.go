@@ -0,0 +1,163 @@
+package feedtrigger
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+const deadLetterPrefix = "deadletter/"
+
+// DefaultMaxDeadLetters is the default size of the dead-letter queue of a
+// feed.
+const DefaultMaxDeadLetters = 1000
+
+// DeadLetter is an item whose actions failed.
+type DeadLetter struct {
+	Feed  string       `json:"feed"`
+	Item  *gofeed.Item `json:"item"`
+	Error string       `json:"error"`
+	// Attempts is the number of failed deliveries, zero for the items put
+	// into the queue by OverflowDeadLetter.
+	Attempts    int       `json:"attempts"`
+	FirstFailed time.Time `json:"first_failed"`
+	LastFailed  time.Time `json:"last_failed"`
+}
+
+// bury puts the item into the dead-letter queue of the feed after the
+// number of failed delivery attempts, dropping the items failing first from
+// a full queue.
+func (a *FeedAction) bury(f Feed, i *gofeed.Item, cause error, attempts int) error {
+	a.dlqMu.Lock()
+	defer a.dlqMu.Unlock()
+
+	letters, err := a.deadLetters(f.URL)
+	if err != nil {
+		return err
+	}
+
+	now := a.now().UTC()
+	id := ItemID(i)
+	found := false
+	for n := range letters {
+		if ItemID(letters[n].Item) == id {
+			letters[n].Error = cause.Error()
+			letters[n].Attempts += attempts
+			letters[n].LastFailed = now
+			found = true
+			break
+		}
+	}
+	if !found {
+		letters = append(letters, DeadLetter{
+			Feed:        f.URL,
+			Item:        i,
+			Error:       cause.Error(),
+			Attempts:    attempts,
+			FirstFailed: now,
+			LastFailed:  now,
+		})
+	}
+	max := a.MaxDeadLetters
+	if max <= 0 {
+		max = DefaultMaxDeadLetters
+	}
+	if over := len(letters) - max; over > 0 {
+		a.logf("%s: dead-letter queue full, dropping %d items", f.URL, over)
+		letters = letters[over:]
+	}
+	return a.storeDeadLetters(f.URL, letters)
+}
+
+// DeadLetters returns the failed items of the feed.
+func (a *FeedAction) DeadLetters(feedURL string) ([]DeadLetter, error) {
+	feedURL = NormalizeURL(feedURL)
+	a.dlqMu.Lock()
+	defer a.dlqMu.Unlock()
+	return a.deadLetters(feedURL)
+}
+
+// RetryDeadLetters triggers the failed items of the feed again. Items that
+// succeed leave the queue, the others get their attempt count increased.
+// It returns the number of items delivered.
+func (a *FeedAction) RetryDeadLetters(feedURL string) (int, error) {
+	feedURL = NormalizeURL(feedURL)
+	var f *Feed
+	for _, feed := range a.ListFeeds() {
+		if feed.URL == feedURL {
+			f = &feed
+			break
+		}
+	}
+	if f == nil {
+		return 0, fmt.Errorf("unknown feed %s", feedURL)
+	}
+
+	letters, err := a.DeadLetters(feedURL)
+	if err != nil {
+		return 0, err
+	}
+	delivered := 0
+	for _, l := range letters {
+		if _, attempts, err := a.triggerOnce(context.Background(), *f, l.Item); err != nil {
+			if err := a.bury(*f, l.Item, err, attempts); err != nil {
+				return delivered, err
+			}
+			continue
+		}
+		if err := a.removeDeadLetter(feedURL, ItemID(l.Item)); err != nil {
+			return delivered, err
+		}
+		delivered++
+	}
+	return delivered, nil
+}
+
+// PurgeDeadLetters drops the failed items of the feed, only the item with
+// the ID if it isn't empty.
+func (a *FeedAction) PurgeDeadLetters(feedURL, itemID string) error {
+	feedURL = NormalizeURL(feedURL)
+	if itemID != "" {
+		return a.removeDeadLetter(feedURL, itemID)
+	}
+	a.dlqMu.Lock()
+	defer a.dlqMu.Unlock()
+	if err := a.feedKV(feedURL).Delete(deadLetterPrefix + feedURL); err != nil {
+		return fmt.Errorf("purging dead letters: %w", err)
+	}
+	return nil
+}
+
+func (a *FeedAction) removeDeadLetter(feedURL, itemID string) error {
+	a.dlqMu.Lock()
+	defer a.dlqMu.Unlock()
+
+	letters, err := a.deadLetters(feedURL)
+	if err != nil {
+		return err
+	}
+	for n := range letters {
+		if ItemID(letters[n].Item) == itemID {
+			letters = append(letters[:n], letters[n+1:]...)
+			break
+		}
+	}
+	return a.storeDeadLetters(feedURL, letters)
+}
+
+func (a *FeedAction) deadLetters(feedURL string) ([]DeadLetter, error) {
+	var letters []DeadLetter
+	if _, err := a.feedKV(feedURL).Get(deadLetterPrefix+feedURL, &letters); err != nil {
+		return nil, fmt.Errorf("get dead letters: %w", err)
+	}
+	return letters, nil
+}
+
+func (a *FeedAction) storeDeadLetters(feedURL string, letters []DeadLetter) error {
+	if err := a.feedKV(feedURL).Set(deadLetterPrefix+feedURL, letters); err != nil {
+		return fmt.Errorf("storing dead letters: %w", err)
+	}
+	return nil
+}
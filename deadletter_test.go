@@ -0,0 +1,58 @@
+package feedtrigger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger/stores"
+)
+
+func TestDeadLetterAttempts(t *testing.T) {
+	fetch := FetcherFunc(func(ctx context.Context, f Feed) (*gofeed.Feed, error) {
+		return &gofeed.Feed{Items: []*gofeed.Item{{GUID: "3"}, {GUID: "2"}, {GUID: "1"}}}, nil
+	})
+	f := NewFeed("http://example.com/feed.xml", func(*gofeed.Item) error {
+		return errors.New("down")
+	}, WithFirstRun(FirstRunTriggerAll))
+	f.Retry = &RetryPolicy{Attempts: 3, Backoff: time.Millisecond}
+	app, err := New(WithStore(&stores.MemoryStore{}), WithFeeds(*f), WithFetcher(fetch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.Logger = log.New(ioutil.Discard, "", 0)
+	app.DeadLetter = true
+	app.MaxDeadLetters = 2
+	feed := app.ListFeeds()[0]
+
+	if err := app.poll(context.Background(), feed); err != nil {
+		t.Fatal(err)
+	}
+	check := func(attempts int) {
+		t.Helper()
+		letters, err := app.DeadLetters(feed.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, l := range letters {
+			got = append(got, fmt.Sprintf("%s:%d", l.Item.GUID, l.Attempts))
+		}
+		// the oldest item failed first and was dropped from the full queue
+		want := []string{fmt.Sprintf("2:%d", attempts), fmt.Sprintf("3:%d", attempts)}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("dead letters %v, want %v", got, want)
+		}
+	}
+	check(3)
+	if n, err := app.RetryDeadLetters(feed.URL); n != 0 || err != nil {
+		t.Fatalf("retried: %d, %v", n, err)
+	}
+	check(6)
+}
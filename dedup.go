@@ -0,0 +1,166 @@
+package feedtrigger
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// DefaultDedupWindow is how long a triggered item blocks its duplicates by
+// default.
+const DefaultDedupWindow = 7 * 24 * time.Hour
+
+// SkipDuplicate is the reason of items already triggered from another feed.
+const SkipDuplicate SkipReason = "duplicate"
+
+// dedupKey is the store key of the recently triggered item keys.
+const dedupKey = "dedup"
+
+// Dedup suppresses items already triggered by any feed of the application,
+// e.g. an advisory published by several monitored sources.
+type Dedup struct {
+	// Key identifies duplicates, DedupByLink if nil. Items with an empty
+	// key are never suppressed.
+	Key func(*gofeed.Item) string
+	// Window is how long a triggered item blocks its duplicates,
+	// DefaultDedupWindow if zero.
+	Window time.Duration
+}
+
+// DedupByLink identifies items by their normalized link: the scheme and the
+// host are lowercased, the fragment, the trailing slash and the utm_
+// tracking parameters are dropped.
+func DedupByLink(i *gofeed.Item) string {
+	if i.Link == "" {
+		return ""
+	}
+	u, err := url.Parse(strings.TrimSpace(i.Link))
+	if err != nil {
+		return i.Link
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	u.Fragment = ""
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	q := u.Query()
+	for k := range q {
+		if strings.HasPrefix(k, "utm_") {
+			q.Del(k)
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// DedupByContent identifies items by the hash of their title and text with
+// the case and the whitespace normalized.
+func DedupByContent(i *gofeed.Item) string {
+	h := sha1.New()
+	for _, s := range []string{i.Title, i.Description, i.Content} {
+		h.Write([]byte(strings.ToLower(strings.Join(strings.Fields(s), " "))))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// dedupEntry is the item that claimed a key.
+type dedupEntry struct {
+	At   time.Time `json:"at"`
+	Feed string    `json:"feed"`
+	ID   string    `json:"id"`
+}
+
+// dedupSet maps hashes of item keys to the items triggered with them.
+type dedupSet map[string]dedupEntry
+
+func (d *Dedup) key(i *gofeed.Item) string {
+	key := d.Key
+	if key == nil {
+		key = DedupByLink
+	}
+	k := key(i)
+	if k == "" {
+		return ""
+	}
+	sum := sha1.Sum([]byte(k))
+	return hex.EncodeToString(sum[:])
+}
+
+func (d *Dedup) window() time.Duration {
+	if d.Window <= 0 {
+		return DefaultDedupWindow
+	}
+	return d.Window
+}
+
+// claim records the item as triggered unless a duplicate from another item
+// was triggered within the window, in which case it returns false. The same
+// item, e.g. replayed from the outbox, may claim its key again. The returned
+// release undoes the claim if triggering fails.
+func (a *FeedAction) claim(f Feed, i *gofeed.Item) (ok bool, release func(), err error) {
+	noop := func() {}
+	if a.Dedup == nil || IsCanary(i) {
+		return true, noop, nil
+	}
+	k := a.Dedup.key(i)
+	if k == "" {
+		return true, noop, nil
+	}
+
+	a.dedupMu.Lock()
+	defer a.dedupMu.Unlock()
+	set, err := a.dedupSet()
+	if err != nil {
+		return false, noop, err
+	}
+	now := a.now().UTC()
+	e := dedupEntry{At: now, Feed: f.URL, ID: ItemID(i)}
+	if old, found := set[k]; found && now.Sub(old.At) < a.Dedup.window() &&
+		(old.Feed != e.Feed || old.ID != e.ID) {
+		return false, noop, nil
+	}
+	set[k] = e
+	if err := a.storeDedup(set, now); err != nil {
+		return false, noop, err
+	}
+	return true, func() {
+		a.dedupMu.Lock()
+		defer a.dedupMu.Unlock()
+		set, err := a.dedupSet()
+		if err != nil {
+			return
+		}
+		if old := set[k]; old.At.Equal(e.At) && old.Feed == e.Feed && old.ID == e.ID {
+			delete(set, k)
+			a.storeDedup(set, a.now().UTC())
+		}
+	}, nil
+}
+
+// dedupSet returns the stored set, dedupMu must be held.
+func (a *FeedAction) dedupSet() (dedupSet, error) {
+	set := make(dedupSet)
+	if _, err := a.kv().Get(dedupKey, &set); err != nil {
+		return nil, fmt.Errorf("get dedup set: %w", err)
+	}
+	return set, nil
+}
+
+// storeDedup saves the set without the keys older than the window, dedupMu
+// must be held.
+func (a *FeedAction) storeDedup(set dedupSet, now time.Time) error {
+	for k, e := range set {
+		if now.Sub(e.At) >= a.Dedup.window() {
+			delete(set, k)
+		}
+	}
+	if err := a.kv().Set(dedupKey, set); err != nil {
+		return fmt.Errorf("storing dedup set: %w", err)
+	}
+	return nil
+}
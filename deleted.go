@@ -0,0 +1,176 @@
+package feedtrigger
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const deletedFeedsKey = "deleted-feeds"
+
+// DefaultDeleteGracePeriod is how long the state of a soft-deleted feed is
+// kept by default.
+const DefaultDeleteGracePeriod = 30 * 24 * time.Hour
+
+// DeletedFeed is a soft-deleted feed.
+type DeletedFeed struct {
+	URL       string    `json:"url"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// deletedFeeds keeps the settings of soft-deleted feeds for restoring.
+type deletedFeeds struct {
+	mu    sync.Mutex
+	feeds map[string]Feed
+}
+
+// SoftDeleteFeed stops polling the feed and hides it, keeping its stored
+// state for DeleteGracePeriod, so restoring or adding it again doesn't
+// trigger the items seen before.
+func (a *FeedAction) SoftDeleteFeed(url string) (bool, error) {
+	url = NormalizeURL(url)
+	var feed *Feed
+	for _, f := range a.ListFeeds() {
+		if f.URL == url {
+			feed = &f
+			break
+		}
+	}
+	if feed == nil || !a.RemoveFeed(url) {
+		return false, nil
+	}
+
+	a.deleted.mu.Lock()
+	defer a.deleted.mu.Unlock()
+	if a.deleted.feeds == nil {
+		a.deleted.feeds = make(map[string]Feed)
+	}
+	a.deleted.feeds[url] = *feed
+
+	tombstones, err := a.tombstones()
+	if err != nil {
+		return true, err
+	}
+	tombstones = append(dropTombstone(tombstones, url), DeletedFeed{URL: url, DeletedAt: a.now().UTC()})
+	return true, a.storeTombstones(tombstones)
+}
+
+// DeletedFeeds returns the soft-deleted feeds whose state is still kept.
+func (a *FeedAction) DeletedFeeds() ([]DeletedFeed, error) {
+	a.deleted.mu.Lock()
+	defer a.deleted.mu.Unlock()
+	return a.tombstones()
+}
+
+// RestoreFeed polls the soft-deleted feed again with its settings and
+// state. Feeds deleted before a restart have to be added with AddFeed.
+func (a *FeedAction) RestoreFeed(url string) error {
+	url = NormalizeURL(url)
+	a.deleted.mu.Lock()
+	f, ok := a.deleted.feeds[url]
+	if !ok {
+		a.deleted.mu.Unlock()
+		return fmt.Errorf("no deleted feed %s to restore", url)
+	}
+	a.deleted.mu.Unlock()
+	return a.AddFeed(f)
+}
+
+// undelete forgets the soft deletion of the feed, so its state isn't
+// purged.
+func (a *FeedAction) undelete(url string) error {
+	a.deleted.mu.Lock()
+	defer a.deleted.mu.Unlock()
+	delete(a.deleted.feeds, url)
+	tombstones, err := a.tombstones()
+	if err != nil {
+		return err
+	}
+	kept := dropTombstone(tombstones, url)
+	if len(kept) == len(tombstones) {
+		return nil
+	}
+	return a.storeTombstones(kept)
+}
+
+// PurgeFeed deletes the stored state of the feed: the seen items, outbox,
+// dead letters, branding, stats, notified and held items and archive.
+// Action results are kept.
+func (a *FeedAction) PurgeFeed(url string) error {
+	url = NormalizeURL(url)
+	kv := a.feedKV(url)
+	for _, p := range feedPrefixes {
+		if err := kv.Delete(p + url); err != nil {
+			return fmt.Errorf("purging %s: %w", url, err)
+		}
+	}
+	if err := a.purgeClaims(url); err != nil {
+		return fmt.Errorf("purging %s: %w", url, err)
+	}
+	if a.Archive != nil {
+		if a.Archive.Store == nil {
+			a.Archive.Store = a.kv()
+		}
+		if err := a.Archive.Purge(url); err != nil {
+			return err
+		}
+	}
+	return a.undelete(url)
+}
+
+// purgeDeleted purges the feeds deleted longer than the grace period ago.
+// Feeds configured again are undeleted instead.
+func (a *FeedAction) purgeDeleted() error {
+	active := make(map[string]bool)
+	for _, f := range a.ListFeeds() {
+		active[f.URL] = true
+	}
+
+	grace := a.DeleteGracePeriod
+	if grace <= 0 {
+		grace = DefaultDeleteGracePeriod
+	}
+	tombstones, err := a.DeletedFeeds()
+	if err != nil {
+		return err
+	}
+	for _, t := range tombstones {
+		if active[t.URL] {
+			if err := a.undelete(t.URL); err != nil {
+				return err
+			}
+			continue
+		}
+		if a.now().Sub(t.DeletedAt) > grace {
+			if err := a.PurgeFeed(t.URL); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (a *FeedAction) tombstones() ([]DeletedFeed, error) {
+	var tombstones []DeletedFeed
+	if _, err := a.kv().Get(deletedFeedsKey, &tombstones); err != nil {
+		return nil, fmt.Errorf("get deleted feeds: %w", err)
+	}
+	return tombstones, nil
+}
+
+func (a *FeedAction) storeTombstones(tombstones []DeletedFeed) error {
+	if err := a.kv().Set(deletedFeedsKey, tombstones); err != nil {
+		return fmt.Errorf("storing deleted feeds: %w", err)
+	}
+	return nil
+}
+
+func dropTombstone(tombstones []DeletedFeed, url string) []DeletedFeed {
+	out := tombstones[:0]
+	for _, t := range tombstones {
+		if t.URL != url {
+			out = append(out, t)
+		}
+	}
+	return out
+}
@@ -0,0 +1,274 @@
+package feedtrigger
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/philippgille/gokv"
+	"github.com/philippgille/gokv/bbolt"
+)
+
+// DefaultDeliveryRetryInterval is how often the delivery queue is replayed
+// if DeliveryQueue.RetryInterval is zero.
+const DefaultDeliveryRetryInterval = time.Minute
+
+const deliveryMetaKey = "meta"
+
+// DeliveryQueue keeps the items whose actions failed in a bbolt database
+// and delivers them again, in order, until the actions recover. Once a feed
+// has items waiting, its new items are queued behind them instead of being
+// delivered out of order. The queue survives restarts, so items aren't lost
+// during long outages of the destinations.
+//
+// A queue is used by a single application: tenants don't inherit it.
+type DeliveryQueue struct {
+	// Path is the bbolt database file of the queue.
+	Path string
+	// Store is used instead of the Path database when set.
+	Store gokv.Store
+	// MaxItems drops the oldest items when more are waiting, zero means no
+	// limit.
+	MaxItems int
+	// MaxAge drops the items waiting longer, zero means no limit.
+	MaxAge time.Duration
+	// RetryInterval is the delay between the replays of the queue,
+	// DefaultDeliveryRetryInterval if zero.
+	RetryInterval time.Duration
+
+	mu   sync.Mutex
+	meta deliveryMeta
+	// opened is set when the queue opened the Path database itself.
+	opened bool
+}
+
+// deliveryMeta is the stored index of the queue: the entries are stored
+// under sequence numbers from Head to Tail, some of them deleted already.
+type deliveryMeta struct {
+	Head  uint64         `json:"head"`
+	Tail  uint64         `json:"tail"`
+	Feeds map[string]int `json:"feeds,omitempty"`
+}
+
+// QueuedDelivery is an item waiting in the DeliveryQueue.
+type QueuedDelivery struct {
+	Feed     string       `json:"feed"`
+	Item     *gofeed.Item `json:"item"`
+	Queued   time.Time    `json:"queued"`
+	Attempts int          `json:"attempts"`
+	Error    string       `json:"error,omitempty"`
+}
+
+func entryKey(seq uint64) string {
+	return fmt.Sprintf("entry/%020d", seq)
+}
+
+// open opens the database and loads the index.
+func (q *DeliveryQueue) open() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.Store == nil {
+		opts := bbolt.DefaultOptions
+		opts.Path = q.Path
+		opts.BucketName = "deliveries"
+		s, err := bbolt.NewStore(opts)
+		if err != nil {
+			return fmt.Errorf("opening delivery queue: %w", err)
+		}
+		q.Store, q.opened = s, true
+	}
+	if _, err := q.Store.Get(deliveryMetaKey, &q.meta); err != nil {
+		return fmt.Errorf("loading delivery queue: %w", err)
+	}
+	if q.meta.Feeds == nil {
+		q.meta.Feeds = make(map[string]int)
+	}
+	return nil
+}
+
+// close closes the database opened by open.
+func (q *DeliveryQueue) close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.opened {
+		return nil
+	}
+	q.opened = false
+	err := q.Store.Close()
+	q.Store = nil
+	return err
+}
+
+// pending reports whether items of the feed are waiting.
+func (q *DeliveryQueue) pending(feed string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.meta.Feeds[feed] > 0
+}
+
+// Len returns the number of the waiting items.
+func (q *DeliveryQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	n := 0
+	for _, c := range q.meta.Feeds {
+		n += c
+	}
+	return n
+}
+
+// push appends the item to the queue, dropping the oldest items over
+// MaxItems.
+func (q *DeliveryQueue) push(feed string, i *gofeed.Item, cause error, now time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	d := QueuedDelivery{Feed: feed, Item: i, Queued: now}
+	if cause != nil {
+		d.Attempts = 1
+		d.Error = cause.Error()
+	}
+	if err := q.Store.Set(entryKey(q.meta.Tail), d); err != nil {
+		return fmt.Errorf("queueing delivery: %w", err)
+	}
+	q.meta.Tail++
+	q.meta.Feeds[feed]++
+
+	total := 0
+	for _, c := range q.meta.Feeds {
+		total += c
+	}
+	for seq := q.meta.Head; q.MaxItems > 0 && total > q.MaxItems && seq < q.meta.Tail; seq++ {
+		var old QueuedDelivery
+		found, err := q.Store.Get(entryKey(seq), &old)
+		if err != nil {
+			return err
+		}
+		if found {
+			if err := q.remove(seq, old.Feed); err != nil {
+				return err
+			}
+			total--
+		}
+	}
+	return q.storeMeta()
+}
+
+// remove deletes the entry, the caller stores the index.
+func (q *DeliveryQueue) remove(seq uint64, feed string) error {
+	if err := q.Store.Delete(entryKey(seq)); err != nil {
+		return err
+	}
+	if q.meta.Feeds[feed]--; q.meta.Feeds[feed] <= 0 {
+		delete(q.meta.Feeds, feed)
+	}
+	return nil
+}
+
+func (q *DeliveryQueue) storeMeta() error {
+	// skip the deleted entries at the head
+	for q.meta.Head < q.meta.Tail {
+		found, err := q.Store.Get(entryKey(q.meta.Head), &QueuedDelivery{})
+		if err != nil {
+			return err
+		}
+		if found {
+			break
+		}
+		q.meta.Head++
+	}
+	return q.Store.Set(deliveryMetaKey, q.meta)
+}
+
+// Waiting returns the waiting items in the order of delivery.
+func (q *DeliveryQueue) Waiting() ([]QueuedDelivery, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var waiting []QueuedDelivery
+	for seq := q.meta.Head; seq < q.meta.Tail; seq++ {
+		var d QueuedDelivery
+		found, err := q.Store.Get(entryKey(seq), &d)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			waiting = append(waiting, d)
+		}
+	}
+	return waiting, nil
+}
+
+// replayDeliveries delivers the queued items every RetryInterval until ctx
+// is done.
+func (a *FeedAction) replayDeliveries(ctx context.Context) {
+	q := a.DeliveryQueue
+	interval := q.RetryInterval
+	if interval <= 0 {
+		interval = DefaultDeliveryRetryInterval
+	}
+	t := a.clock().NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C():
+		}
+		if err := a.replayQueue(ctx); err != nil {
+			a.logf("delivery queue: %v", err)
+		}
+	}
+}
+
+// replayQueue delivers the queued items in order. A failure stops the
+// delivery of the items of the feed until the next replay.
+func (a *FeedAction) replayQueue(ctx context.Context) error {
+	q := a.DeliveryQueue
+	feeds := make(map[string]Feed)
+	for _, f := range a.ListFeeds() {
+		feeds[f.URL] = f
+	}
+	q.mu.Lock()
+	head, tail := q.meta.Head, q.meta.Tail
+	q.mu.Unlock()
+
+	failed := make(map[string]bool)
+	for seq := head; seq < tail && ctx.Err() == nil; seq++ {
+		var d QueuedDelivery
+		found, err := q.Store.Get(entryKey(seq), &d)
+		if err != nil {
+			return err
+		}
+		if !found || failed[d.Feed] {
+			continue
+		}
+		f, ok := feeds[d.Feed]
+		switch {
+		case !ok:
+			a.logf("delivery queue: dropping %s of the removed feed %s", ItemID(d.Item), d.Feed)
+		case q.MaxAge > 0 && a.now().Sub(d.Queued) > q.MaxAge:
+			a.logf("delivery queue: dropping %s of %s queued at %s", ItemID(d.Item), d.Feed, d.Queued)
+		default:
+			if err := a.trigger(ctx, f, d.Item); err != nil {
+				failed[d.Feed] = true
+				d.Attempts++
+				d.Error = err.Error()
+				if err := q.Store.Set(entryKey(seq), d); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		q.mu.Lock()
+		err = q.remove(seq, d.Feed)
+		if err == nil {
+			err = q.storeMeta()
+		}
+		q.mu.Unlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
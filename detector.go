@@ -0,0 +1,91 @@
+package feedtrigger
+
+import (
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// ChangeDetector decides which items of a feed are new by keying them in
+// the seen set: an item is new unless an item of the same key was seen.
+type ChangeDetector interface {
+	// Name identifies the strategy in the stored state. When the feed
+	// switches to another strategy, the items present at the time are
+	// recorded as seen under the new keys instead of being triggered.
+	Name() string
+	// Key identifies the item.
+	Key(i *gofeed.Item) string
+}
+
+// Built-in change detectors.
+var (
+	// DetectByID keys the items by ItemID, the default. It suits the feeds
+	// with stable GUIDs, e.g. GitHub commit feeds.
+	DetectByID ChangeDetector = detector{"id", ItemID}
+	// DetectByTitle keys the items by the normalized title, for the feeds
+	// regenerating GUIDs and links.
+	DetectByTitle ChangeDetector = detector{"title", func(i *gofeed.Item) string {
+		return strings.ToLower(strings.Join(strings.Fields(i.Title), " "))
+	}}
+	// DetectByTimestamp keys the items by the update time, the publication
+	// time if there's none, so an updated item is triggered again. The
+	// items without dates are keyed by ItemID.
+	DetectByTimestamp ChangeDetector = detector{"timestamp", func(i *gofeed.Item) string {
+		if t := i.UpdatedParsed; t != nil {
+			return ItemID(i) + "@" + t.UTC().Format(time.RFC3339Nano)
+		}
+		if t := i.PublishedParsed; t != nil {
+			return ItemID(i) + "@" + t.UTC().Format(time.RFC3339Nano)
+		}
+		return ItemID(i)
+	}}
+	// DetectByHash keys the items by a hash of their content, so any edit
+	// makes an item new.
+	DetectByHash ChangeDetector = detector{"hash", func(i *gofeed.Item) string {
+		return "sha1:" + contentHash(i)
+	}}
+)
+
+// detector is a ChangeDetector of a key function.
+type detector struct {
+	name string
+	key  func(*gofeed.Item) string
+}
+
+func (d detector) Name() string              { return d.name }
+func (d detector) Key(i *gofeed.Item) string { return d.key(i) }
+
+// DetectorByName returns the built-in change detector of the name: "id",
+// "title", "timestamp" or "hash".
+func DetectorByName(name string) (ChangeDetector, bool) {
+	for _, d := range []ChangeDetector{DetectByID, DetectByTitle, DetectByTimestamp, DetectByHash} {
+		if d.Name() == name {
+			return d, true
+		}
+	}
+	return nil, false
+}
+
+// detector returns the change detector of the feed.
+func (f Feed) detector() ChangeDetector {
+	if f.Detector == nil {
+		return DetectByID
+	}
+	return f.Detector
+}
+
+// redetect records the items as seen under the keys of the feed detector if
+// the head was written with another one.
+func (h *FeedHead) redetect(f Feed, items []*gofeed.Item, now time.Time) {
+	name := f.detector().Name()
+	if h.Detector == "" {
+		h.Detector = DetectByID.Name()
+	}
+	if h.Detector == name {
+		return
+	}
+	h.Detector = name
+	h.Seen, h.Hashes = nil, nil
+	h.markSeen(f, items, now)
+}
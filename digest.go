@@ -0,0 +1,164 @@
+package feedtrigger
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// DefaultDigestInterval is the period of a Digest without an Interval.
+const DefaultDigestInterval = time.Hour
+
+const digestPrefix = "digest/"
+
+// Digest buffers the new items of the feeds referencing it by name and
+// delivers them in a single OnDigest call every Interval instead of one by
+// one, e.g. as an hourly or a daily summary. The buffered items are kept in
+// the store, so they survive restarts.
+type Digest struct {
+	Name string
+	// Interval is the period of the digests, DefaultDigestInterval if
+	// zero. The digests are sent at the multiples of the interval since
+	// the Unix epoch in the Location, e.g. at its midnight for daily ones.
+	Interval time.Duration
+	// Location is the timezone the digests are aligned in, UTC if nil.
+	Location *time.Location
+	// GroupBy is the label key whose values group the items into separate
+	// digests, one digest per feed if empty.
+	GroupBy string
+	// OnDigest receives the items of a group, the ones from the most
+	// reliable sources first. A failed digest is retried with the next
+	// one.
+	OnDigest NewBatchAction
+}
+
+func (d *Digest) interval() time.Duration {
+	if d.Interval <= 0 {
+		return DefaultDigestInterval
+	}
+	return d.Interval
+}
+
+// group returns the digest group of the feed items.
+func (d *Digest) group(f Feed) string {
+	if d.GroupBy == "" {
+		return f.URL
+	}
+	return f.Labels[d.GroupBy]
+}
+
+// digest returns the digest of the feed, nil if it has none.
+func (a *FeedAction) digest(f Feed) *Digest {
+	if f.Digest == "" {
+		return nil
+	}
+	for _, d := range a.Digests {
+		if d.Name == f.Digest {
+			return d
+		}
+	}
+	return nil
+}
+
+// checkDigests returns an error if a feed references an unknown digest.
+func (a *FeedAction) checkDigests(feeds []Feed) error {
+	for _, f := range feeds {
+		if f.Digest != "" && a.digest(f) == nil {
+			return fmt.Errorf("feed %s: unknown digest %q", f.URL, f.Digest)
+		}
+	}
+	return nil
+}
+
+// buffer adds the item to the next digest.
+func (a *FeedAction) buffer(d *Digest, f Feed, i *gofeed.Item) error {
+	a.digestMu.Lock()
+	defer a.digestMu.Unlock()
+	groups := make(map[string][]*gofeed.Item)
+	if _, err := a.kv().Get(digestPrefix+d.Name, &groups); err != nil {
+		return fmt.Errorf("get digest: %w", err)
+	}
+	g := d.group(f)
+	groups[g] = append(groups[g], a.redact(i))
+	if err := a.kv().Set(digestPrefix+d.Name, groups); err != nil {
+		return fmt.Errorf("buffer digest item: %w", err)
+	}
+	return nil
+}
+
+// sendDigests sends the digests every interval until ctx is done.
+func (a *FeedAction) sendDigests(ctx context.Context, d *Digest) {
+	for {
+		now := a.now()
+		next := d.nextDigest(now)
+		t := a.clock().NewTimer(next.Sub(now))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C():
+		}
+		if err := a.flushDigest(d); err != nil {
+			a.logf("digest %s: %v", d.Name, err)
+		}
+	}
+}
+
+// flushDigest calls OnDigest for every group with buffered items, keeping
+// the groups it failed for.
+func (a *FeedAction) flushDigest(d *Digest) error {
+	a.digestMu.Lock()
+	defer a.digestMu.Unlock()
+	groups := make(map[string][]*gofeed.Item)
+	if _, err := a.kv().Get(digestPrefix+d.Name, &groups); err != nil {
+		return fmt.Errorf("get digest: %w", err)
+	}
+	if len(groups) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(groups))
+	for g := range groups {
+		names = append(names, g)
+	}
+	sort.Strings(names)
+
+	var failed []string
+	var err error
+	for _, g := range names {
+		items := groups[g]
+		ByReliability(items)
+		if e := d.OnDigest(items); e != nil {
+			err = e
+			failed = append(failed, g)
+			continue
+		}
+		delete(groups, g)
+	}
+	if len(groups) == 0 {
+		return a.kv().Delete(digestPrefix + d.Name)
+	}
+	if err := a.kv().Set(digestPrefix+d.Name, groups); err != nil {
+		return err
+	}
+	return fmt.Errorf("groups %s: %w", strings.Join(failed, ", "), err)
+}
+
+// SummaryAction adapts the item action to receive a digest as a single
+// item listing the titles and links of the digest items.
+func SummaryAction(action NewItemAction) NewBatchAction {
+	return func(items []*gofeed.Item) error {
+		var b strings.Builder
+		for _, i := range items {
+			fmt.Fprintf(&b, "- %s %s\n", i.Title, i.Link)
+		}
+		title := fmt.Sprintf("%d new items", len(items))
+		if len(items) == 1 {
+			title = "1 new item"
+		}
+		return action(&gofeed.Item{Title: title, Description: b.String(), Content: b.String()})
+	}
+}
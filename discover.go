@@ -0,0 +1,99 @@
+package feedtrigger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// maxDiscoverPage bounds the pages and feeds read by Discover.
+const maxDiscoverPage = 10 << 20
+
+// feedPaths are the common feed locations tried when a page doesn't link
+// its feeds.
+var feedPaths = []string{"/feed", "/rss", "/atom.xml", "/feed.xml", "/rss.xml", "/index.xml", "/feed/atom"}
+
+// Discover returns the feed URLs of the page: the page itself if it's a
+// feed, the feeds it references with <link rel="alternate">, or else the
+// common feed locations of the site that serve a feed.
+func Discover(ctx context.Context, pageURL string) ([]string, error) {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	body, _, err := get(ctx, pageURL, maxDiscoverPage)
+	if err != nil {
+		return nil, err
+	}
+	if !looksLikeHTML(body) && isFeed(body) {
+		return []string{pageURL}, nil
+	}
+
+	if feeds := alternateLinks(base, body); len(feeds) > 0 {
+		return feeds, nil
+	}
+
+	var feeds []string
+	for _, p := range feedPaths {
+		if ctx.Err() != nil {
+			return feeds, ctx.Err()
+		}
+		candidate := base.ResolveReference(&url.URL{Path: p}).String()
+		if body, _, err := get(ctx, candidate, maxDiscoverPage); err == nil && isFeed(body) {
+			feeds = append(feeds, candidate)
+		}
+	}
+	if len(feeds) == 0 {
+		return nil, errors.New("no feeds found")
+	}
+	return feeds, nil
+}
+
+func isFeed(body []byte) bool {
+	_, err := Feed{}.parse(body)
+	return err == nil
+}
+
+// alternateLinks returns the resolved feed links of the HTML page head.
+func alternateLinks(base *url.URL, body []byte) []string {
+	var feeds []string
+	seen := make(map[string]bool)
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return feeds
+		case html.StartTagToken, html.SelfClosingTagToken:
+			t := z.Token()
+			if t.Data == "body" {
+				return feeds
+			}
+			if t.Data != "link" {
+				continue
+			}
+			attrs := make(map[string]string, len(t.Attr))
+			for _, a := range t.Attr {
+				attrs[a.Key] = a.Val
+			}
+			alternate := false
+			for _, rel := range strings.Fields(strings.ToLower(attrs["rel"])) {
+				alternate = alternate || rel == "alternate"
+			}
+			typ := strings.ToLower(attrs["type"])
+			feedType := strings.Contains(typ, "rss") || strings.Contains(typ, "atom") || strings.Contains(typ, "json")
+			if !alternate || !feedType || attrs["href"] == "" {
+				continue
+			}
+			u, err := base.Parse(strings.TrimSpace(attrs["href"]))
+			if err != nil || seen[u.String()] {
+				continue
+			}
+			seen[u.String()] = true
+			feeds = append(feeds, u.String())
+		}
+	}
+}
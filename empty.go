@@ -0,0 +1,69 @@
+package feedtrigger
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// ErrEmptyFeed is a feed document without any items.
+var ErrEmptyFeed = errors.New("feed has no items")
+
+// EmptyPolicy is how a poll of a feed without items is handled.
+type EmptyPolicy string
+
+// Empty feed policies.
+const (
+	// EmptySkip ignores the empty document silently, the default.
+	EmptySkip EmptyPolicy = ""
+	// EmptyWarn reports ErrEmptyFeed to the OnPollError hook and the log,
+	// the poll still succeeds.
+	EmptyWarn EmptyPolicy = "warn"
+	// EmptyFail fails the poll with ErrEmptyFeed once the feed was empty
+	// Feed.MaxEmptyPolls times in a row.
+	EmptyFail EmptyPolicy = "fail"
+)
+
+// empty handles the poll of the feed without items according to its
+// EmptyPolicy. Items missing from a partially broken document are dropped
+// first.
+func (a *FeedAction) empty(f Feed, feed *gofeed.Feed, info *PollInfo) (bool, error) {
+	items := feed.Items[:0]
+	for _, i := range feed.Items {
+		if i != nil {
+			items = append(items, i)
+		}
+	}
+	feed.Items = items
+
+	s := a.state(f.URL)
+	s.mu.Lock()
+	if len(feed.Items) > 0 {
+		s.empty = 0
+		s.mu.Unlock()
+		return false, nil
+	}
+	s.empty++
+	n := s.empty
+	s.mu.Unlock()
+
+	switch f.EmptyPolicy {
+	case EmptyWarn:
+		a.logf("%s: %v", f.URL, ErrEmptyFeed)
+		if f.OnPollError != nil {
+			warning := *info
+			warning.Err = pipelineError(ErrParse, f.URL, "", ErrEmptyFeed)
+			f.OnPollError(warning)
+		}
+	case EmptyFail:
+		max := f.MaxEmptyPolls
+		if max < 1 {
+			max = 1
+		}
+		if n >= max {
+			return true, pipelineError(ErrParse, f.URL, "", fmt.Errorf("%w %d polls in a row", ErrEmptyFeed, n))
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,55 @@
+package feedtrigger_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+)
+
+func TestEmptyFailWithClock(t *testing.T) {
+	f := feedtrigger.NewFeed("http://example.com/feed.xml", func(*gofeed.Item) error { return nil },
+		feedtrigger.WithEmptyPolicy(feedtrigger.EmptyFail, 3))
+	f.RefreshPeriod = 10 * time.Minute
+	app, clock, fetched := runClocked(t, f, func(n int) (*gofeed.Feed, error) {
+		if n <= 4 {
+			return &gofeed.Feed{}, nil
+		}
+		return &gofeed.Feed{Items: []*gofeed.Item{{GUID: fmt.Sprint(n)}}}, nil
+	})
+
+	// the first two empty polls are ignored, the next ones fail the feed
+	// and back off until it has items again
+	now := start
+	expectFetch(t, fetched, now)
+	for n, tt := range []struct {
+		delay    time.Duration
+		failures int
+	}{
+		{10 * time.Minute, 0},
+		{10 * time.Minute, 0},
+		{10 * time.Minute, 1},
+		{20 * time.Minute, 2},
+		{10 * time.Minute, 0},
+	} {
+		d := nextPoll(t, app, now)
+		if d != tt.delay {
+			t.Fatalf("poll %d: next in %s, want %s", n+1, d, tt.delay)
+		}
+		if got := app.Status()[0].ConsecutiveFailures; got != tt.failures {
+			t.Fatalf("poll %d: %d consecutive failures, want %d", n+1, got, tt.failures)
+		}
+		now = now.Add(d)
+		clock.Set(now)
+		expectFetch(t, fetched, now)
+	}
+
+	errs := app.PollErrors(f.URL)
+	if len(errs) != 2 || !strings.Contains(errs[0].Error, "4 polls in a row") || !strings.Contains(errs[1].Error, "3 polls in a row") {
+		t.Errorf("poll errors %+v", errs)
+	}
+}
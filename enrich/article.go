@@ -0,0 +1,100 @@
+// Package enrich provides Feed.Enrichers adding data to items before they
+// are triggered.
+package enrich
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/mmcdole/gofeed"
+	"golang.org/x/net/html"
+
+	"ilya.app/feedtrigger"
+)
+
+// minArticleText is the length of text a semantic article element needs to
+// be taken as the article.
+const minArticleText = 200
+
+// noise are elements never part of the article text.
+const noise = "script, style, noscript, nav, header, footer, aside, form, iframe, svg"
+
+// FullArticle fetches the item link and sets the item content to the main
+// text of the page, unless the item already has longer content. Headers
+// are sent with the request, e.g. a cookie for paywalled sources.
+func FullArticle(headers map[string]string) feedtrigger.Enricher {
+	return func(ctx context.Context, i *gofeed.Item) error {
+		if i.Link == "" {
+			return nil
+		}
+		f := feedtrigger.Feed{URL: i.Link}
+		for k, v := range headers {
+			if f.Headers == nil {
+				f.Headers = make(map[string][]string)
+			}
+			f.Headers.Set(k, v)
+		}
+		body, err := feedtrigger.Download(ctx, f)
+		if err != nil {
+			return fmt.Errorf("fetching article: %w", err)
+		}
+
+		content, err := Readable(body)
+		if err != nil {
+			return err
+		}
+		if len(content) > len(i.Content) {
+			i.Content = content
+		}
+		return nil
+	}
+}
+
+// Readable extracts the main content of the HTML page: an article or main
+// element if it has enough text, otherwise the element with the most
+// paragraph text.
+func Readable(page []byte) (string, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(page))
+	if err != nil {
+		return "", fmt.Errorf("parsing article: %w", err)
+	}
+	doc.Find(noise).Remove()
+
+	var best *goquery.Selection
+	doc.Find("article, main, [role=main]").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		if len(strings.TrimSpace(s.Text())) >= minArticleText {
+			best = s
+			return false
+		}
+		return true
+	})
+
+	if best == nil {
+		scores := make(map[*html.Node]int)
+		max := 0
+		doc.Find("p").Each(func(_ int, p *goquery.Selection) {
+			parent := p.Parent()
+			if parent.Length() == 0 {
+				return
+			}
+			n := parent.Nodes[0]
+			scores[n] += len(strings.TrimSpace(p.Text()))
+			if scores[n] > max {
+				max = scores[n]
+				best = parent
+			}
+		})
+	}
+	if best == nil {
+		return "", nil
+	}
+
+	content, err := best.Html()
+	if err != nil {
+		return "", fmt.Errorf("rendering article: %w", err)
+	}
+	return strings.TrimSpace(content), nil
+}
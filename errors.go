@@ -0,0 +1,55 @@
+package feedtrigger
+
+import "errors"
+
+// The kinds of pipeline errors, matched by errors.Is on the errors returned
+// by Run and reported to the poll hooks, e.g.
+//
+//	if errors.Is(info.Err, feedtrigger.ErrAction) { ... }
+//
+// Use errors.As with *Error to get the feed and the item.
+var (
+	// ErrFetch is a failure to download the feed or get it from its Source.
+	ErrFetch = errors.New("fetch failed")
+	// ErrParse is a downloaded document that isn't a feed.
+	ErrParse = errors.New("parse failed")
+	// ErrStore is a failure to read or write the state in the store.
+	ErrStore = errors.New("store failed")
+	// ErrAction is an action returning an error.
+	ErrAction = errors.New("action failed")
+)
+
+// Error is an error of the pipeline with the feed and the item it happened
+// to.
+type Error struct {
+	// Kind is one of ErrFetch, ErrParse, ErrStore and ErrAction.
+	Kind error
+	Feed string
+	// Item is the ID of the item, empty for errors of the whole feed.
+	Item string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the error is of the kind.
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// pipelineError wraps err into an Error of the kind unless it's nil or
+// classified already.
+func pipelineError(kind error, feed, item string, err error) error {
+	var e *Error
+	if err == nil || errors.As(err, &e) {
+		return err
+	}
+	return &Error{Kind: kind, Feed: feed, Item: item, Err: err}
+}
@@ -0,0 +1,94 @@
+package feedtrigger
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// EventType is a kind of event, the types can be combined to subscribe to
+// several of them.
+type EventType uint
+
+// Event types.
+const (
+	// EventNewItem is published for every item delivered to the actions.
+	EventNewItem EventType = 1 << iota
+	// EventPollError is published for every failed poll.
+	EventPollError
+	// EventFeedUpdated is published for every change of the feed metadata.
+	EventFeedUpdated
+	// EventAnomaly is published for every anomaly of a feed with an
+	// AnomalyDetector.
+	EventAnomaly
+
+	EventAll = EventNewItem | EventPollError | EventFeedUpdated | EventAnomaly
+)
+
+// Event is something that happened to a feed.
+type Event struct {
+	Type EventType
+	Feed string
+	Time time.Time
+	// Item is set for EventNewItem.
+	Item *gofeed.Item
+	// Poll is set for EventPollError.
+	Poll *PollInfo
+	// Change is set for EventFeedUpdated.
+	Change *FeedChange
+	// Anomaly is set for EventAnomaly.
+	Anomaly *Anomaly
+}
+
+// EventHandler receives events. Handlers are called synchronously in the
+// order of the events, so slow ones should hand them off.
+type EventHandler func(Event)
+
+// bus dispatches the events to the subscribers.
+type bus struct {
+	mu   sync.RWMutex
+	next int
+	subs map[int]subscription
+}
+
+type subscription struct {
+	types   EventType
+	handler EventHandler
+}
+
+// Subscribe calls the handler with the events of the types until
+// unsubscribe is called, e.g.
+//
+//	a.Subscribe(EventNewItem|EventPollError, handler)
+func (a *FeedAction) Subscribe(types EventType, h EventHandler) (unsubscribe func()) {
+	b := &a.bus
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.subs == nil {
+		b.subs = make(map[int]subscription)
+	}
+	id := b.next
+	b.next++
+	b.subs[id] = subscription{types: types, handler: h}
+	return func() {
+		b.mu.Lock()
+		delete(b.subs, id)
+		b.mu.Unlock()
+	}
+}
+
+// publish passes the event to the subscribers of its type.
+func (a *FeedAction) publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = a.now()
+	}
+	b := &a.bus
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, s := range b.subs {
+		if s.types&e.Type != 0 {
+			s.handler(e)
+		}
+	}
+}
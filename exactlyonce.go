@@ -0,0 +1,234 @@
+package feedtrigger
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/philippgille/gokv"
+
+	"ilya.app/feedtrigger/stores"
+)
+
+const deliveryPrefix = "delivery/"
+
+// DefaultClaimTTL is how long the delivery claim of an instance lasts before
+// another one may take the item over, e.g. after a crash.
+const DefaultClaimTTL = 10 * time.Minute
+
+// deliveredRetention is how long the finished deliveries are remembered.
+const deliveredRetention = 7 * 24 * time.Hour
+
+// claimSwaps bounds the attempts to update the claim of an item racing the
+// other instances.
+const claimSwaps = 5
+
+// IdempotencyKeyField is the custom item field holding the IdempotencyKey
+// of the item when ExactlyOnce is set.
+const IdempotencyKeyField = "feedtrigger_idempotency_key"
+
+// SkipClaimed is the reason of items delivered or being delivered by another
+// instance, see FeedAction.ExactlyOnce.
+const SkipClaimed SkipReason = "claimed"
+
+// deliveryClaim is the stored claim of the delivery of an item.
+type deliveryClaim struct {
+	Owner string `json:"owner"`
+	// Expires is when the claim of an unfinished delivery lapses and At
+	// when the delivery finished.
+	Expires time.Time `json:"expires,omitempty"`
+	Done    bool      `json:"done,omitempty"`
+	At      time.Time `json:"at,omitempty"`
+}
+
+// IdempotencyKey returns the key of the delivery of the item, the same for
+// every attempt and instance, e.g. for the actions to pass to the APIs
+// dropping repeated requests.
+func IdempotencyKey(i *gofeed.Item) string {
+	sum := sha256.Sum256([]byte(ItemFeed(i).URL + "#" + ItemID(i)))
+	return hex.EncodeToString(sum[:16])
+}
+
+// owner identifies the instance in the delivery claims.
+func (a *FeedAction) owner() string {
+	if a.Leases != nil {
+		return a.Leases.owner()
+	}
+	return instanceID()
+}
+
+// claimKey is the store key of the delivery claim of the item of the feed.
+func claimKey(url, id string) string {
+	return deliveryPrefix + url + "#" + id
+}
+
+// swapper returns the store of the feed as a stores.Swapper, if it is one.
+func (a *FeedAction) swapper(url string) (stores.Swapper, bool) {
+	s := a.feedKV(url)
+	if m, ok := s.(measuredStore); ok {
+		s = m.Store
+	}
+	return stores.AsSwapper(s)
+}
+
+// claimDelivery claims the delivery of the item for the instance when the
+// application is ExactlyOnce and the store can compare and swap. It
+// returns false if the item was delivered or is being delivered by another
+// instance. finish records the outcome of the actions.
+func (a *FeedAction) claimDelivery(f Feed, i *gofeed.Item) (ok bool, finish func(delivered bool), err error) {
+	noop := func(bool) {}
+	if !a.ExactlyOnce || a.DryRun || IsCanary(i) {
+		return true, noop, nil
+	}
+	sw, ok := a.swapper(f.URL)
+	if !ok {
+		return true, noop, nil
+	}
+	kv := a.feedKV(f.URL)
+	id, owner := ItemID(i), a.owner()
+	key := claimKey(f.URL, id)
+
+	held := false
+	err = updateClaim(sw, kv, key, func(c *deliveryClaim) *deliveryClaim {
+		now := a.now().UTC()
+		held = c != nil && (c.Done || c.Owner != owner && now.Before(c.Expires))
+		if held {
+			return c
+		}
+		return &deliveryClaim{Owner: owner, Expires: now.Add(DefaultClaimTTL)}
+	})
+	if err != nil {
+		return false, noop, fmt.Errorf("claiming delivery: %w", err)
+	}
+	if held {
+		return false, noop, nil
+	}
+	return true, func(delivered bool) {
+		err := updateClaim(sw, kv, key, func(c *deliveryClaim) *deliveryClaim {
+			if c == nil || c.Owner != owner || c.Done {
+				return c
+			}
+			if delivered {
+				return &deliveryClaim{Owner: owner, Done: true, At: a.now().UTC()}
+			}
+			return nil
+		})
+		if err != nil {
+			a.logf("%s: %s: finishing delivery claim: %v", f.URL, id, err)
+		}
+	}, nil
+}
+
+// updateClaim replaces the stored delivery claim, nil if missing, with the
+// one fn returns, starting over if another instance changed it meanwhile. A
+// nil claim deletes it and the claim passed to fn leaves it as it is.
+func updateClaim(sw stores.Swapper, kv gokv.Store, key string, fn func(*deliveryClaim) *deliveryClaim) error {
+	for n := 0; n < claimSwaps; n++ {
+		var raw json.RawMessage
+		found, err := kv.Get(key, &raw)
+		if err != nil {
+			return err
+		}
+		var c *deliveryClaim
+		var old interface{}
+		if found {
+			c = &deliveryClaim{}
+			if err := json.Unmarshal(raw, c); err != nil {
+				return fmt.Errorf("decoding delivery claim: %w", err)
+			}
+			old = raw
+		}
+		nc := fn(c)
+		if nc == c {
+			return nil
+		}
+		var v interface{}
+		if nc != nil {
+			v = nc
+		}
+		swapped, err := sw.CompareAndSwap(key, old, v)
+		if err != nil {
+			return err
+		}
+		if swapped {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s changed concurrently %d times", key, claimSwaps)
+}
+
+// claimKeys returns the keys of the delivery claims starting with the
+// prefix, none if the store can't list its keys.
+func claimKeys(kv gokv.Store, prefix string) ([]string, error) {
+	if m, ok := kv.(measuredStore); ok {
+		kv = m.Store
+	}
+	l, ok := kv.(stores.Lister)
+	if !ok {
+		return nil, nil
+	}
+	keys, err := l.Keys()
+	if err != nil {
+		return nil, fmt.Errorf("listing keys: %w", err)
+	}
+	var claims []string
+	for _, k := range keys {
+		if strings.HasPrefix(k, prefix) {
+			claims = append(claims, k)
+		}
+	}
+	return claims, nil
+}
+
+// pruneClaims deletes the claims of the deliveries finished longer than
+// deliveredRetention ago from the stores of the feeds.
+func (a *FeedAction) pruneClaims() error {
+	seen := make(map[gokv.Store]bool)
+	for _, f := range a.ListFeeds() {
+		if seen[f.Store] {
+			continue
+		}
+		seen[f.Store] = true
+		kv := a.storeKV(f.Store)
+		sw, ok := a.swapper(f.URL)
+		if !ok {
+			continue
+		}
+		keys, err := claimKeys(kv, deliveryPrefix)
+		if err != nil {
+			return err
+		}
+		now := a.now().UTC()
+		for _, k := range keys {
+			err := updateClaim(sw, kv, k, func(c *deliveryClaim) *deliveryClaim {
+				if c != nil && c.Done && now.Sub(c.At) > deliveredRetention {
+					return nil
+				}
+				return c
+			})
+			if err != nil {
+				return fmt.Errorf("pruning %s: %w", k, err)
+			}
+		}
+	}
+	return nil
+}
+
+// purgeClaims deletes the delivery claims of the items of the feed.
+func (a *FeedAction) purgeClaims(url string) error {
+	kv := a.feedKV(url)
+	keys, err := claimKeys(kv, claimKey(url, ""))
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := kv.Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
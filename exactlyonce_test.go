@@ -0,0 +1,70 @@
+package feedtrigger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger/stores"
+)
+
+func TestClaimDelivery(t *testing.T) {
+	store := &stores.MemoryStore{}
+	f := *NewFeed("http://example.com/feed.xml", nil)
+	newApp := func(id string) *FeedAction {
+		a, err := New(WithStore(store), WithFeeds(f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.ExactlyOnce = true
+		a.Leases = &Leases{Owner: id}
+		return a
+	}
+	a, b := newApp("a"), newApp("b")
+	first, second := &gofeed.Item{GUID: "1"}, &gofeed.Item{GUID: "2"}
+
+	ok, finishA, err := a.claimDelivery(f, first)
+	if err != nil || !ok {
+		t.Fatalf("claiming: %v, %v", ok, err)
+	}
+	if ok, _, err := b.claimDelivery(f, first); err != nil || ok {
+		t.Fatalf("claimed item claimed again: %v, %v", ok, err)
+	}
+	// the claims are per item
+	ok, finishB, err := b.claimDelivery(f, second)
+	if err != nil || !ok {
+		t.Fatalf("claiming another item: %v, %v", ok, err)
+	}
+	var c deliveryClaim
+	if found, err := store.Get(claimKey(f.URL, "2"), &c); err != nil || !found || c.Owner != "b" {
+		t.Fatalf("claim of the item %+v, %v, %v", c, found, err)
+	}
+
+	finishA(true)
+	if ok, _, err := b.claimDelivery(f, first); err != nil || ok {
+		t.Fatalf("delivered item claimed again: %v, %v", ok, err)
+	}
+	finishB(false)
+	if ok, _, err := a.claimDelivery(f, second); err != nil || !ok {
+		t.Fatalf("failed delivery not claimed again: %v, %v", ok, err)
+	}
+
+	// delivered claims are pruned after the retention
+	a.Clock = fixedClock{SystemClock, time.Now().Add(deliveredRetention + time.Hour)}
+	if err := a.pruneClaims(); err != nil {
+		t.Fatal(err)
+	}
+	if found, _ := store.Get(claimKey(f.URL, "1"), &c); found {
+		t.Error("delivered claim kept after the retention")
+	}
+	if found, _ := store.Get(claimKey(f.URL, "2"), &c); !found {
+		t.Error("pending claim pruned")
+	}
+	if err := a.PurgeFeed(f.URL); err != nil {
+		t.Fatal(err)
+	}
+	if found, _ := store.Get(claimKey(f.URL, "2"), &c); found {
+		t.Error("claim kept after purging the feed")
+	}
+}
@@ -0,0 +1,127 @@
+package feedtrigger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// Stage is the decision of a pipeline stage about an item.
+type Stage struct {
+	Name string `json:"name"`
+	// Pass is false if the stage stops the item.
+	Pass   bool   `json:"pass"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Explanation is how the pipeline of a feed would handle an item.
+type Explanation struct {
+	Feed string `json:"feed"`
+	// Item is the item as the actions would receive it.
+	Item   *gofeed.Item `json:"item"`
+	Stages []Stage      `json:"stages"`
+	// Delivered is true if the item would reach the actions.
+	Delivered bool `json:"delivered"`
+}
+
+// Explain runs the item through the pipeline of the feed without triggering
+// any action or changing the stored state, and reports the decision of
+// every stage up to the one stopping the item. If i is nil the newest item
+// of the feed is fetched and used.
+func (a *FeedAction) Explain(ctx context.Context, f Feed, i *gofeed.Item) (*Explanation, error) {
+	if err := a.applyProfile(&f); err != nil {
+		return nil, err
+	}
+	if i == nil {
+		feed, err := a.fetch(ctx, f)
+		if err != nil {
+			return nil, fmt.Errorf("fetching feed: %w", err)
+		}
+		if feed == nil || len(feed.Items) == 0 {
+			return nil, errors.New("feed has no items to explain")
+		}
+		i = feed.Items[0]
+	}
+
+	i = copyItem(i)
+	f.normalize(&gofeed.Feed{Items: []*gofeed.Item{i}})
+	f.annotate([]*gofeed.Item{i})
+
+	e := &Explanation{Feed: f.URL, Item: i}
+	pass := func(name, detail string) {
+		e.Stages = append(e.Stages, Stage{Name: name, Pass: true, Detail: detail})
+	}
+	stop := func(name, detail string) (*Explanation, error) {
+		e.Stages = append(e.Stages, Stage{Name: name, Detail: detail})
+		return e, nil
+	}
+
+	head, found, err := a.loadHead(f.URL)
+	if err != nil {
+		return nil, fmt.Errorf("get from store: %w", err)
+	}
+	switch {
+	case !found && f.FirstRun == FirstRunSkip:
+		return stop("seen", "first poll of the feed only records the items")
+	case !found:
+		pass("seen", "first poll of the feed, backfilled if among the newest")
+	case len(head.unseen(f, []*gofeed.Item{i})) == 0:
+		return stop("seen", "already seen as "+f.detector().Key(i))
+	}
+	pass("seen", "new item "+f.detector().Key(i))
+
+	filters := a.filters(f)
+	for n, fn := range filters {
+		if !fn(i) {
+			return stop("filter", fmt.Sprintf("filter %d rejected the item", n))
+		}
+	}
+	pass("filter", fmt.Sprintf("%d filters passed", len(filters)))
+
+	if p := published(i); f.MaxItemAge > 0 && p != nil && p.Before(a.now().Add(-f.MaxItemAge)) {
+		return stop("age", "published "+p.UTC().Format(time.RFC3339)+", older than "+f.MaxItemAge.String())
+	}
+
+	if f.LinkCheck != LinkCheckOff && i.Link != "" {
+		status := linkStatus(ctx, i.Link)
+		dead := status == http.StatusNotFound || status == http.StatusGone
+		switch {
+		case dead && f.LinkCheck == LinkCheckDrop:
+			return stop("link check", "dead link, status "+strconv.Itoa(status))
+		case dead && f.LinkCheck == LinkCheckArchive:
+			i = copyItem(i)
+			i.Link = "https://web.archive.org/web/" + i.Link
+			pass("link check", "dead link replaced with "+i.Link)
+		default:
+			pass("link check", "status "+strconv.Itoa(status))
+		}
+	}
+
+	if len(f.Enrichers) > 0 {
+		pass("enrich", fmt.Sprintf("%d enrichers would run", len(f.Enrichers)))
+	}
+
+	e.Item = a.redactWith(i, func(rule string, n int) {
+		pass("redaction", fmt.Sprintf("rule %s matched %d times", rule, n))
+	})
+
+	for _, name := range actionNames(f) {
+		pass("action", name)
+	}
+	if f.OnBurst != nil {
+		pass("burst", "coalesced into a burst event")
+	}
+	if f.OnNewBatch != nil {
+		pass("batch", "included in the poll batch")
+	}
+	if a.Archive != nil {
+		pass("archive", "archived after delivery")
+	}
+	e.Delivered = true
+	return e, nil
+}
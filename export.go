@@ -0,0 +1,95 @@
+package feedtrigger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// StateDump is the portable representation of the stored state of the
+// feeds written by ExportState.
+type StateDump struct {
+	// Version is the HeadVersion of the exporting application.
+	Version  int         `json:"version"`
+	Exported time.Time   `json:"exported"`
+	Feeds    []FeedState `json:"feeds"`
+}
+
+// FeedState is the stored state of a feed: its head with the seen items and
+// its counters.
+type FeedState struct {
+	URL   string     `json:"url"`
+	Head  *FeedHead  `json:"head,omitempty"`
+	Stats *FeedStats `json:"stats,omitempty"`
+}
+
+// ExportState writes the stored state of the feeds as a JSON StateDump, e.g.
+// to back it up or to move it to another store. It's safe to call while
+// the application is running.
+func (a *FeedAction) ExportState(w io.Writer) error {
+	dump := StateDump{Version: HeadVersion, Exported: a.now().UTC()}
+	for _, f := range a.ListFeeds() {
+		fs := FeedState{URL: f.URL}
+		s := a.state(f.URL)
+		s.headMu.Lock()
+		head, found, err := a.loadHead(f.URL)
+		s.headMu.Unlock()
+		if err != nil {
+			return fmt.Errorf("exporting %s: %w", f.URL, err)
+		}
+		if found {
+			fs.Head = &head
+		}
+		st, found, err := a.Stats(f.URL)
+		if err != nil {
+			return fmt.Errorf("exporting %s: %w", f.URL, err)
+		}
+		if found {
+			fs.Stats = st
+		}
+		if fs.Head != nil || fs.Stats != nil {
+			dump.Feeds = append(dump.Feeds, fs)
+		}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(dump)
+}
+
+// ImportState stores the state of the feeds of the StateDump read from r,
+// replacing the state they have. The dumps of older versions are upgraded,
+// the ones of newer versions are refused.
+func (a *FeedAction) ImportState(r io.Reader) error {
+	var dump StateDump
+	if err := json.NewDecoder(r).Decode(&dump); err != nil {
+		return fmt.Errorf("reading state dump: %w", err)
+	}
+	if dump.Version > HeadVersion {
+		return fmt.Errorf("state dump version %d is newer than the supported %d", dump.Version, HeadVersion)
+	}
+	for _, fs := range dump.Feeds {
+		if fs.Head != nil {
+			if _, err := fs.Head.migrate(); err != nil {
+				return fmt.Errorf("importing %s: %w", fs.URL, err)
+			}
+			s := a.state(fs.URL)
+			s.headMu.Lock()
+			err := a.feedKV(fs.URL).Set(fs.URL, fs.Head)
+			s.headMu.Unlock()
+			if err != nil {
+				return fmt.Errorf("importing %s: %w", fs.URL, err)
+			}
+		}
+		if fs.Stats != nil {
+			s := a.state(fs.URL)
+			s.statsMu.Lock()
+			err := a.feedKV(fs.URL).Set(statsPrefix+fs.URL, fs.Stats)
+			s.statsMu.Unlock()
+			if err != nil {
+				return fmt.Errorf("importing %s: %w", fs.URL, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,979 @@
+package feedtrigger
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// CompileFilter compiles a filter expression, e.g.
+//
+//	item.title.contains('CVE') && item.published > now - duration('24h')
+//
+// The filter language is feedtrigger's own. It borrows the syntax and the
+// function names of CEL, the Common Expression Language, so the common
+// filters read the same, but it isn't CEL: there are no types, protocol
+// buffers or extensions, numbers are float64, the names are checked when
+// compiling and the types when evaluating. Its grammar, the lowest
+// precedence first:
+//
+//	expr    = or [ "?" expr ":" expr ]
+//	or      = and { "||" and }
+//	and     = rel { "&&" rel }
+//	rel     = add { ( "==" | "!=" | "<" | "<=" | ">" | ">=" | "in" ) add }
+//	add     = mul { ( "+" | "-" ) mul }
+//	mul     = unary { ( "*" | "/" | "%" ) unary }
+//	unary   = ( "!" | "-" ) unary | postfix
+//	postfix = primary { "." ident [ "(" [ args ] ")" ] | "[" expr "]" }
+//	primary = number | string | "true" | "false" | "null"
+//	        | ident [ "(" [ args ] ")" ] | "[" [ args ] "]" | "(" expr ")"
+//	args    = expr { "," expr }
+//
+// Strings are single or double quoted with backslash escapes.
+//
+// The expression sees the item, its feed and the current time:
+//
+//	item.title, .description, .content, .link, .guid, .author  strings
+//	item.categories                                            list of strings
+//	item.published, .updated                                   timestamps or null
+//	item.custom                                                map of strings
+//	feed.url, feed.labels, feed.metadata                        the feed
+//	now                                                         timestamp
+//
+// It supports the logical, comparison and arithmetic operators, in, lists,
+// the string methods contains, startsWith, endsWith, matches, lowerAscii,
+// upperAscii and trim, size, the exists and all macros and the duration
+// and timestamp functions. The filter passes the items for which the
+// expression is true; an expression failing on an item, e.g. comparing
+// its missing publish time, drops it.
+//
+// now is the system time, FeedAction.CompileFilter compiles filters using
+// the application Clock.
+func CompileFilter(src string) (ItemFilter, error) {
+	return compileFilter(src, SystemClock.Now)
+}
+
+// CompileFilter compiles a filter expression, see the CompileFilter
+// function, whose now is the time of the application Clock.
+func (a *FeedAction) CompileFilter(src string) (ItemFilter, error) {
+	return compileFilter(src, a.now)
+}
+
+func compileFilter(src string, now func() time.Time) (ItemFilter, error) {
+	p := &exprParser{src: src}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	n, err := p.parseExpr()
+	if err != nil {
+		return nil, fmt.Errorf("filter %q: %w", src, err)
+	}
+	if p.tok.kind != tokEOF {
+		return nil, fmt.Errorf("filter %q: unexpected %q at %d", src, p.tok.text, p.tok.pos)
+	}
+	if err := check(n, map[string]bool{"item": true, "feed": true, "now": true}); err != nil {
+		return nil, fmt.Errorf("filter %q: %w", src, err)
+	}
+	return func(i *gofeed.Item) bool {
+		v, err := n.eval(exprVars(i, now()))
+		b, ok := v.(bool)
+		return err == nil && ok && b
+	}, nil
+}
+
+// exprVars returns the variables of the expressions evaluated for the item
+// at the time.
+func exprVars(i *gofeed.Item, now time.Time) map[string]interface{} {
+	author := ""
+	if i.Author != nil {
+		author = i.Author.Name
+	}
+	var published, updated interface{}
+	if i.PublishedParsed != nil {
+		published = *i.PublishedParsed
+	}
+	if i.UpdatedParsed != nil {
+		updated = *i.UpdatedParsed
+	}
+	feed := ItemFeed(i)
+	return map[string]interface{}{
+		"item": map[string]interface{}{
+			"title":       i.Title,
+			"description": i.Description,
+			"content":     i.Content,
+			"link":        i.Link,
+			"guid":        i.GUID,
+			"author":      author,
+			"categories":  stringList(i.Categories),
+			"published":   published,
+			"updated":     updated,
+			"custom":      stringMap(i.Custom),
+		},
+		"feed": map[string]interface{}{
+			"url":      feed.URL,
+			"labels":   stringMap(feed.Labels),
+			"metadata": stringMap(feed.Metadata),
+		},
+		"now": now,
+	}
+}
+
+func stringList(s []string) []interface{} {
+	l := make([]interface{}, len(s))
+	for n, v := range s {
+		l[n] = v
+	}
+	return l
+}
+
+func stringMap(m map[string]string) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for k, v := range m {
+		out[k] = v
+	}
+	return out
+}
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+// exprParser is a recursive descent parser of the expressions.
+type exprParser struct {
+	src string
+	pos int
+	tok token
+}
+
+var operators = []string{"&&", "||", "==", "!=", "<=", ">=", "<", ">", "!", "+", "-", "*", "/", "%", "(", ")", "[", "]", ",", ".", "?", ":"}
+
+func (p *exprParser) next() error {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos == len(p.src) {
+		p.tok = token{kind: tokEOF, pos: start}
+		return nil
+	}
+	c := p.src[p.pos]
+	switch {
+	case c == '_' || unicode.IsLetter(rune(c)):
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || unicode.IsLetter(rune(p.src[p.pos])) || unicode.IsDigit(rune(p.src[p.pos]))) {
+			p.pos++
+		}
+		p.tok = token{kind: tokIdent, text: p.src[start:p.pos], pos: start}
+	case unicode.IsDigit(rune(c)):
+		for p.pos < len(p.src) && (unicode.IsDigit(rune(p.src[p.pos])) || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		p.tok = token{kind: tokNumber, text: p.src[start:p.pos], pos: start}
+	case c == '\'' || c == '"':
+		p.pos++
+		var b strings.Builder
+		for {
+			if p.pos >= len(p.src) {
+				return fmt.Errorf("unterminated string at %d", start)
+			}
+			r := p.src[p.pos]
+			p.pos++
+			if r == c {
+				break
+			}
+			if r == '\\' && p.pos < len(p.src) {
+				r = p.src[p.pos]
+				p.pos++
+				switch r {
+				case 'n':
+					r = '\n'
+				case 't':
+					r = '\t'
+				}
+			}
+			b.WriteByte(r)
+		}
+		p.tok = token{kind: tokString, text: b.String(), pos: start}
+	default:
+		for _, op := range operators {
+			if strings.HasPrefix(p.src[p.pos:], op) {
+				p.pos += len(op)
+				p.tok = token{kind: tokOp, text: op, pos: start}
+				return nil
+			}
+		}
+		return fmt.Errorf("unexpected %q at %d", c, start)
+	}
+	return nil
+}
+
+// is reports whether the current token is the operator or keyword.
+func (p *exprParser) is(text string) bool {
+	return (p.tok.kind == tokOp || p.tok.kind == tokIdent) && p.tok.text == text
+}
+
+func (p *exprParser) expect(text string) error {
+	if !p.is(text) {
+		return fmt.Errorf("expected %q at %d", text, p.tok.pos)
+	}
+	return p.next()
+}
+
+func (p *exprParser) parseExpr() (exprNode, error) {
+	cond, err := p.parseBinary(0)
+	if err != nil || !p.is("?") {
+		return cond, err
+	}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	then, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	els, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	return &condNode{cond, then, els}, nil
+}
+
+// precedence of the binary operators, the lowest first.
+var precedence = [][]string{
+	{"||"},
+	{"&&"},
+	{"==", "!=", "<", "<=", ">", ">=", "in"},
+	{"+", "-"},
+	{"*", "/", "%"},
+}
+
+func (p *exprParser) parseBinary(level int) (exprNode, error) {
+	if level == len(precedence) {
+		return p.parseUnary()
+	}
+	l, err := p.parseBinary(level + 1)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := ""
+		for _, o := range precedence[level] {
+			if p.is(o) {
+				op = o
+			}
+		}
+		if op == "" {
+			return l, nil
+		}
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		r, err := p.parseBinary(level + 1)
+		if err != nil {
+			return nil, err
+		}
+		l = &binaryNode{op, l, r}
+	}
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.is("!") || p.is("-") {
+		op := p.tok.text
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		x, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &unaryNode{op, x}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *exprParser) parsePostfix() (exprNode, error) {
+	x, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.is("."):
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			if p.tok.kind != tokIdent {
+				return nil, fmt.Errorf("expected a field or method at %d", p.tok.pos)
+			}
+			name := p.tok.text
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			if !p.is("(") {
+				x = &selectNode{x, name}
+				continue
+			}
+			args, err := p.parseArgs(")")
+			if err != nil {
+				return nil, err
+			}
+			x = &callNode{recv: x, name: name, args: args}
+		case p.is("["):
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			i, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			x = &indexNode{x, i}
+		default:
+			return x, nil
+		}
+	}
+}
+
+// parseArgs parses the comma separated expressions following the opening
+// token up to the closing one.
+func (p *exprParser) parseArgs(closing string) ([]exprNode, error) {
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	var args []exprNode
+	for !p.is(closing) {
+		if len(args) > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return args, p.next()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	t := p.tok
+	switch t.kind {
+	case tokNumber:
+		v, err := strconv.ParseFloat(t.text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad number %q at %d", t.text, t.pos)
+		}
+		return &literalNode{v}, p.next()
+	case tokString:
+		return &literalNode{t.text}, p.next()
+	case tokIdent:
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+		switch t.text {
+		case "true":
+			return &literalNode{true}, nil
+		case "false":
+			return &literalNode{false}, nil
+		case "null":
+			return &literalNode{nil}, nil
+		}
+		if p.is("(") {
+			args, err := p.parseArgs(")")
+			if err != nil {
+				return nil, err
+			}
+			return &callNode{name: t.text, args: args}, nil
+		}
+		return &identNode{t.text}, nil
+	case tokOp:
+		switch t.text {
+		case "(":
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+			x, err := p.parseExpr()
+			if err != nil {
+				return nil, err
+			}
+			return x, p.expect(")")
+		case "[":
+			elems, err := p.parseArgs("]")
+			if err != nil {
+				return nil, err
+			}
+			return &listNode{elems}, nil
+		}
+	}
+	if t.kind == tokEOF {
+		return nil, errors.New("unexpected end")
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", t.text, t.pos)
+}
+
+// exprNode is a node of the parsed expression.
+type exprNode interface {
+	eval(vars map[string]interface{}) (interface{}, error)
+}
+
+type (
+	literalNode struct{ v interface{} }
+	identNode   struct{ name string }
+	selectNode  struct {
+		x     exprNode
+		field string
+	}
+	indexNode struct{ x, i exprNode }
+	callNode  struct {
+		recv exprNode
+		name string
+		args []exprNode
+	}
+	unaryNode struct {
+		op string
+		x  exprNode
+	}
+	binaryNode struct {
+		op   string
+		l, r exprNode
+	}
+	condNode struct{ cond, then, els exprNode }
+	listNode struct{ elems []exprNode }
+)
+
+// functions are the global functions with their number of arguments.
+var functions = map[string]int{"duration": 1, "timestamp": 1, "size": 1, "string": 1}
+
+// methods are the methods with their number of arguments.
+var methods = map[string]int{
+	"contains": 1, "startsWith": 1, "endsWith": 1, "matches": 1,
+	"lowerAscii": 0, "upperAscii": 0, "trim": 0, "size": 0,
+	"exists": 2, "all": 2,
+}
+
+// check reports unknown identifiers and functions and wrong numbers of
+// arguments.
+func check(n exprNode, vars map[string]bool) error {
+	switch n := n.(type) {
+	case *identNode:
+		if !vars[n.name] {
+			return fmt.Errorf("unknown variable %q", n.name)
+		}
+	case *selectNode:
+		return check(n.x, vars)
+	case *indexNode:
+		if err := check(n.x, vars); err != nil {
+			return err
+		}
+		return check(n.i, vars)
+	case *unaryNode:
+		return check(n.x, vars)
+	case *binaryNode:
+		if err := check(n.l, vars); err != nil {
+			return err
+		}
+		return check(n.r, vars)
+	case *condNode:
+		for _, x := range []exprNode{n.cond, n.then, n.els} {
+			if err := check(x, vars); err != nil {
+				return err
+			}
+		}
+	case *listNode:
+		for _, x := range n.elems {
+			if err := check(x, vars); err != nil {
+				return err
+			}
+		}
+	case *callNode:
+		want, ok := functions[n.name]
+		if n.recv != nil {
+			want, ok = methods[n.name]
+		}
+		if !ok {
+			return fmt.Errorf("unknown function %q", n.name)
+		}
+		if len(n.args) != want {
+			return fmt.Errorf("%s takes %d arguments", n.name, want)
+		}
+		if n.recv != nil {
+			if err := check(n.recv, vars); err != nil {
+				return err
+			}
+		}
+		if n.name == "exists" || n.name == "all" {
+			v, ok := n.args[0].(*identNode)
+			if !ok {
+				return fmt.Errorf("%s takes a variable name first", n.name)
+			}
+			scoped := make(map[string]bool, len(vars)+1)
+			for k := range vars {
+				scoped[k] = true
+			}
+			scoped[v.name] = true
+			return check(n.args[1], scoped)
+		}
+		for _, a := range n.args {
+			if err := check(a, vars); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (n *literalNode) eval(map[string]interface{}) (interface{}, error) { return n.v, nil }
+
+func (n *identNode) eval(vars map[string]interface{}) (interface{}, error) {
+	return vars[n.name], nil
+}
+
+func (n *selectNode) eval(vars map[string]interface{}) (interface{}, error) {
+	x, err := n.x.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	m, ok := x.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("no field %q of %s", n.field, typeName(x))
+	}
+	v, ok := m[n.field]
+	if !ok {
+		return nil, fmt.Errorf("no such key %q", n.field)
+	}
+	return v, nil
+}
+
+func (n *indexNode) eval(vars map[string]interface{}) (interface{}, error) {
+	x, err := n.x.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	i, err := n.i.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch x := x.(type) {
+	case []interface{}:
+		f, ok := i.(float64)
+		if !ok || f < 0 || int(f) >= len(x) {
+			return nil, fmt.Errorf("bad index %v", i)
+		}
+		return x[int(f)], nil
+	case map[string]interface{}:
+		k, ok := i.(string)
+		if !ok {
+			return nil, fmt.Errorf("bad key %v", i)
+		}
+		v, ok := x[k]
+		if !ok {
+			return nil, fmt.Errorf("no such key %q", k)
+		}
+		return v, nil
+	}
+	return nil, fmt.Errorf("can't index %s", typeName(x))
+}
+
+func (n *condNode) eval(vars map[string]interface{}) (interface{}, error) {
+	c, err := evalBool(n.cond, vars)
+	if err != nil {
+		return nil, err
+	}
+	if c {
+		return n.then.eval(vars)
+	}
+	return n.els.eval(vars)
+}
+
+func (n *listNode) eval(vars map[string]interface{}) (interface{}, error) {
+	l := make([]interface{}, len(n.elems))
+	for i, e := range n.elems {
+		v, err := e.eval(vars)
+		if err != nil {
+			return nil, err
+		}
+		l[i] = v
+	}
+	return l, nil
+}
+
+func evalBool(n exprNode, vars map[string]interface{}) (bool, error) {
+	v, err := n.eval(vars)
+	if err != nil {
+		return false, err
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("expected a bool, got %s", typeName(v))
+	}
+	return b, nil
+}
+
+func (n *unaryNode) eval(vars map[string]interface{}) (interface{}, error) {
+	if n.op == "!" {
+		b, err := evalBool(n.x, vars)
+		return !b, err
+	}
+	x, err := n.x.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch x := x.(type) {
+	case float64:
+		return -x, nil
+	case time.Duration:
+		return -x, nil
+	}
+	return nil, fmt.Errorf("can't negate %s", typeName(x))
+}
+
+func (n *binaryNode) eval(vars map[string]interface{}) (interface{}, error) {
+	switch n.op {
+	case "&&", "||":
+		l, err := evalBool(n.l, vars)
+		if err != nil {
+			return nil, err
+		}
+		if l == (n.op == "||") {
+			return l, nil
+		}
+		return evalBool(n.r, vars)
+	}
+
+	l, err := n.l.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	r, err := n.r.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return equal(l, r), nil
+	case "!=":
+		return !equal(l, r), nil
+	case "in":
+		switch r := r.(type) {
+		case []interface{}:
+			for _, e := range r {
+				if equal(l, e) {
+					return true, nil
+				}
+			}
+			return false, nil
+		case map[string]interface{}:
+			k, ok := l.(string)
+			if !ok {
+				return false, nil
+			}
+			_, found := r[k]
+			return found, nil
+		}
+		return nil, fmt.Errorf("can't look up in %s", typeName(r))
+	case "<", "<=", ">", ">=":
+		c, err := compare(l, r)
+		if err != nil {
+			return nil, err
+		}
+		switch n.op {
+		case "<":
+			return c < 0, nil
+		case "<=":
+			return c <= 0, nil
+		case ">":
+			return c > 0, nil
+		}
+		return c >= 0, nil
+	}
+	return arithmetic(n.op, l, r)
+}
+
+func equal(l, r interface{}) bool {
+	if lt, ok := l.(time.Time); ok {
+		rt, ok := r.(time.Time)
+		return ok && lt.Equal(rt)
+	}
+	return reflect.DeepEqual(l, r)
+}
+
+func compare(l, r interface{}) (int, error) {
+	switch l := l.(type) {
+	case float64:
+		if r, ok := r.(float64); ok {
+			switch {
+			case l < r:
+				return -1, nil
+			case l > r:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	case string:
+		if r, ok := r.(string); ok {
+			return strings.Compare(l, r), nil
+		}
+	case time.Time:
+		if r, ok := r.(time.Time); ok {
+			switch {
+			case l.Before(r):
+				return -1, nil
+			case l.After(r):
+				return 1, nil
+			}
+			return 0, nil
+		}
+	case time.Duration:
+		if r, ok := r.(time.Duration); ok {
+			switch {
+			case l < r:
+				return -1, nil
+			case l > r:
+				return 1, nil
+			}
+			return 0, nil
+		}
+	}
+	return 0, fmt.Errorf("can't compare %s with %s", typeName(l), typeName(r))
+}
+
+func arithmetic(op string, l, r interface{}) (interface{}, error) {
+	switch l := l.(type) {
+	case float64:
+		if r, ok := r.(float64); ok {
+			switch op {
+			case "+":
+				return l + r, nil
+			case "-":
+				return l - r, nil
+			case "*":
+				return l * r, nil
+			case "/":
+				if r == 0 {
+					return nil, errors.New("division by zero")
+				}
+				return l / r, nil
+			case "%":
+				if int64(r) == 0 {
+					return nil, errors.New("division by zero")
+				}
+				return float64(int64(l) % int64(r)), nil
+			}
+		}
+	case string:
+		if r, ok := r.(string); ok && op == "+" {
+			return l + r, nil
+		}
+	case []interface{}:
+		if r, ok := r.([]interface{}); ok && op == "+" {
+			return append(append([]interface{}{}, l...), r...), nil
+		}
+	case time.Time:
+		switch r := r.(type) {
+		case time.Duration:
+			switch op {
+			case "+":
+				return l.Add(r), nil
+			case "-":
+				return l.Add(-r), nil
+			}
+		case time.Time:
+			if op == "-" {
+				return l.Sub(r), nil
+			}
+		}
+	case time.Duration:
+		switch r := r.(type) {
+		case time.Duration:
+			switch op {
+			case "+":
+				return l + r, nil
+			case "-":
+				return l - r, nil
+			}
+		case time.Time:
+			if op == "+" {
+				return r.Add(l), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("can't apply %s to %s and %s", op, typeName(l), typeName(r))
+}
+
+// regexps caches the compiled patterns of matches.
+var regexps sync.Map
+
+func (n *callNode) eval(vars map[string]interface{}) (interface{}, error) {
+	if n.recv == nil {
+		return n.function(vars)
+	}
+	recv, err := n.recv.eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	if n.name == "exists" || n.name == "all" {
+		return n.macro(recv, vars)
+	}
+	if n.name == "size" {
+		return size(recv)
+	}
+
+	s, ok := recv.(string)
+	if !ok {
+		return nil, fmt.Errorf("no method %s of %s", n.name, typeName(recv))
+	}
+	switch n.name {
+	case "lowerAscii":
+		return strings.ToLower(s), nil
+	case "upperAscii":
+		return strings.ToUpper(s), nil
+	case "trim":
+		return strings.TrimSpace(s), nil
+	}
+	v, err := n.args[0].eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	arg, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("%s takes a string", n.name)
+	}
+	switch n.name {
+	case "contains":
+		return strings.Contains(s, arg), nil
+	case "startsWith":
+		return strings.HasPrefix(s, arg), nil
+	case "endsWith":
+		return strings.HasSuffix(s, arg), nil
+	}
+	re, ok := regexps.Load(arg)
+	if !ok {
+		compiled, err := regexp.Compile(arg)
+		if err != nil {
+			return nil, err
+		}
+		re, _ = regexps.LoadOrStore(arg, compiled)
+	}
+	return re.(*regexp.Regexp).MatchString(s), nil
+}
+
+func (n *callNode) function(vars map[string]interface{}) (interface{}, error) {
+	v, err := n.args[0].eval(vars)
+	if err != nil {
+		return nil, err
+	}
+	switch n.name {
+	case "size":
+		return size(v)
+	case "string":
+		switch v := v.(type) {
+		case string:
+			return v, nil
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case time.Time:
+			return v.Format(time.RFC3339), nil
+		}
+		return fmt.Sprint(v), nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return nil, fmt.Errorf("%s takes a string", n.name)
+	}
+	if n.name == "duration" {
+		return time.ParseDuration(s)
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// macro evaluates exists and all, binding every element of the list to
+// the variable.
+func (n *callNode) macro(recv interface{}, vars map[string]interface{}) (interface{}, error) {
+	var elems []interface{}
+	switch recv := recv.(type) {
+	case []interface{}:
+		elems = recv
+	case map[string]interface{}:
+		for k := range recv {
+			elems = append(elems, k)
+		}
+	default:
+		return nil, fmt.Errorf("no method %s of %s", n.name, typeName(recv))
+	}
+	name := n.args[0].(*identNode).name
+	scoped := make(map[string]interface{}, len(vars)+1)
+	for k, v := range vars {
+		scoped[k] = v
+	}
+	all := n.name == "all"
+	for _, e := range elems {
+		scoped[name] = e
+		b, err := evalBool(n.args[1], scoped)
+		if err != nil {
+			return nil, err
+		}
+		if b != all {
+			return b, nil
+		}
+	}
+	return all, nil
+}
+
+func size(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		return float64(len([]rune(v))), nil
+	case []interface{}:
+		return float64(len(v)), nil
+	case map[string]interface{}:
+		return float64(len(v)), nil
+	}
+	return nil, fmt.Errorf("no size of %s", typeName(v))
+}
+
+func typeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "bool"
+	case time.Time:
+		return "timestamp"
+	case time.Duration:
+		return "duration"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "map"
+	}
+	return fmt.Sprintf("%T", v)
+}
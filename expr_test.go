@@ -0,0 +1,234 @@
+package feedtrigger
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// evalExpr parses, checks and evaluates the expression with the variables.
+func evalExpr(src string, vars map[string]interface{}) (interface{}, error) {
+	p := &exprParser{src: src}
+	if err := p.next(); err != nil {
+		return nil, err
+	}
+	n, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool, len(vars))
+	for k := range vars {
+		names[k] = true
+	}
+	if err := check(n, names); err != nil {
+		return nil, err
+	}
+	return n.eval(vars)
+}
+
+func TestEvalExpr(t *testing.T) {
+	now := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	vars := map[string]interface{}{
+		"s":    "Hello, World",
+		"n":    float64(3),
+		"l":    []interface{}{"a", "b", "c"},
+		"m":    map[string]interface{}{"k": "v"},
+		"t":    now,
+		"null": nil,
+	}
+	for _, tt := range []struct {
+		src  string
+		want interface{}
+	}{
+		{"1 + 2 * 3", float64(7)},
+		{"(1 + 2) * 3", float64(9)},
+		{"7 % 4 - -1", float64(4)},
+		{"n / 2", 1.5},
+		{"'a' + \"b\"", "ab"},
+		{"!true || false", false},
+		{"1 < 2 && 2 <= 2 && 3 > 2 && 3 >= 3", true},
+		{"n == 3 ? 'three' : 'other'", "three"},
+		{"'b' in l", true},
+		{"'z' in l", false},
+		{"'k' in m", true},
+		{"l[1]", "b"},
+		{"m['k']", "v"},
+		{"m.k", "v"},
+		{"[1, 2, 3]", []interface{}{float64(1), float64(2), float64(3)}},
+		{"size(l) + l.size() + size('héllo')", float64(11)},
+		{"s.contains('World')", true},
+		{"s.startsWith('Hello') && s.endsWith('World')", true},
+		{"s.matches('^H.*d$')", true},
+		{"s.lowerAscii()", "hello, world"},
+		{"s.upperAscii()", "HELLO, WORLD"},
+		{"'  x '.trim()", "x"},
+		{"l.exists(x, x == 'c')", true},
+		{"l.all(x, x == 'c')", false},
+		{"m.exists(k, k == 'k')", true},
+		{"[].all(x, false)", true},
+		{"duration('1h') > duration('30m')", true},
+		{"t - duration('24h') < t", true},
+		{"t > timestamp('2020-01-01T00:00:00Z')", true},
+		{"t - timestamp('2020-05-01T11:00:00Z')", time.Hour},
+		{"string(n)", "3"},
+		{"string(t)", "2020-05-01T12:00:00Z"},
+		{"null == null", true},
+		{"s != null", true},
+		{"false && s.nope", false},
+		{"'it\\'s\\n'", "it's\n"},
+	} {
+		got, err := evalExpr(tt.src, vars)
+		if err != nil {
+			t.Errorf("%s: %v", tt.src, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s = %#v, want %#v", tt.src, got, tt.want)
+		}
+	}
+}
+
+func TestEvalExprErrors(t *testing.T) {
+	vars := map[string]interface{}{
+		"s": "x",
+		"l": []interface{}{"a"},
+		"m": map[string]interface{}{"k": "v"},
+	}
+	for _, tt := range []struct {
+		src  string
+		want string
+	}{
+		// parsing
+		{"", "unexpected end"},
+		{"1 +", "unexpected end"},
+		{"'open", "unterminated string"},
+		{"1 @ 2", `unexpected '@'`},
+		{"(1 + 2", `expected ")"`},
+		{"true ? 1", `expected ":"`},
+		{"1.2.3", "bad number"},
+		{"s.1", "expected a field or method"},
+		// checking
+		{"x == 1", `unknown variable "x"`},
+		{"nope(1)", `unknown function "nope"`},
+		{"s.nope()", `unknown function "nope"`},
+		{"s.contains()", "contains takes 1 arguments"},
+		{"l.exists('x', true)", "exists takes a variable name first"},
+		{"l.exists(x, y)", `unknown variable "y"`},
+		// evaluating
+		{"1 / 0", "division by zero"},
+		{"1 % 0", "division by zero"},
+		{"s < 1", "can't compare string with number"},
+		{"s - 1", "can't apply - to string and number"},
+		{"-s", "can't negate string"},
+		{"!s", "expected a bool, got string"},
+		{"s && true", "expected a bool, got string"},
+		{"l[5]", "bad index 5"},
+		{"m[1]", "bad key 1"},
+		{"m.x", `no such key "x"`},
+		{"s.x", `no field "x" of string`},
+		{"s[0]", "can't index string"},
+		{"1 in s", "can't look up in string"},
+		{"size(1)", "no size of number"},
+		{"l.contains('a')", "no method contains of list"},
+		{"s.exists(x, true)", "no method exists of string"},
+		{"duration(1)", "duration takes a string"},
+		{"duration('soon')", "invalid duration"},
+		{"timestamp('yesterday')", "cannot parse"},
+	} {
+		got, err := evalExpr(tt.src, vars)
+		if err == nil {
+			t.Errorf("%s = %#v, want an error", tt.src, got)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %q, want %q", tt.src, err, tt.want)
+		}
+	}
+}
+
+func TestCompileFilter(t *testing.T) {
+	hourAgo := time.Now().Add(-time.Hour)
+	item := &gofeed.Item{
+		Title:           "CVE-2020-1234 in libfoo",
+		Link:            "http://example.com/1",
+		Categories:      []string{"security", "c"},
+		PublishedParsed: &hourAgo,
+		Custom:          map[string]string{FeedURLKey: "http://example.com/feed", LabelPrefix + "team": "sec"},
+	}
+	unpublished := &gofeed.Item{Title: "CVE-2020-1235"}
+	for _, tt := range []struct {
+		src  string
+		item *gofeed.Item
+		want bool
+	}{
+		{"item.title.contains('CVE')", item, true},
+		{"item.title.contains('CVE') && item.published > now - duration('24h')", item, true},
+		{"item.published > now - duration('30m')", item, false},
+		{"item.published > now - duration('24h')", unpublished, false},
+		{"item.categories.exists(c, c == 'security')", item, true},
+		{"'c' in item.categories", item, true},
+		{"feed.url.startsWith('http://example.com')", item, true},
+		{"feed.labels.team == 'sec'", item, true},
+		{"feed.labels.team == 'sec'", unpublished, false},
+		{"item.title", item, false},
+	} {
+		filter, err := CompileFilter(tt.src)
+		if err != nil {
+			t.Errorf("%s: %v", tt.src, err)
+			continue
+		}
+		if got := filter(tt.item); got != tt.want {
+			t.Errorf("%s on %q = %v, want %v", tt.src, tt.item.Title, got, tt.want)
+		}
+	}
+}
+
+func TestCompileFilterErrors(t *testing.T) {
+	for _, src := range []string{
+		"",
+		"item.title ==",
+		"item.title.contains('CVE'",
+		"item.title 'CVE'",
+		"entry.title == 'x'",
+		"item.title.includes('x')",
+	} {
+		if _, err := CompileFilter(src); err == nil {
+			t.Errorf("%q compiled", src)
+		} else if !strings.Contains(err.Error(), "filter") {
+			t.Errorf("%q: error %q doesn't name the filter", src, err)
+		}
+	}
+}
+
+// fixedClock is a clock stopped at the time.
+type fixedClock struct {
+	Clock
+	at time.Time
+}
+
+func (c fixedClock) Now() time.Time { return c.at }
+
+func TestCompileFilterClock(t *testing.T) {
+	published := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+	item := &gofeed.Item{PublishedParsed: &published}
+	a := &FeedAction{}
+	filter, err := a.CompileFilter("item.published > now - duration('1h')")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		now  time.Time
+		want bool
+	}{
+		{published.Add(30 * time.Minute), true},
+		{published.Add(2 * time.Hour), false},
+	} {
+		a.Clock = fixedClock{SystemClock, tt.now}
+		if got := filter(item); got != tt.want {
+			t.Errorf("at %s: %v, want %v", tt.now, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package feedtrigger
+
+import "expvar"
+
+// vars are the runtime counters published by expvar under "feedtrigger",
+// see the /debug/vars endpoint. They add up the polls of every FeedAction
+// of the process, the "feeds" map has the counters of each feed URL.
+var (
+	vars     = expvar.NewMap("feedtrigger")
+	feedVars = new(expvar.Map).Init()
+)
+
+func init() {
+	vars.Set("feeds", feedVars)
+}
+
+// count updates the counters with the outcome of a poll.
+func count(info PollInfo) {
+	fv, ok := feedVars.Get(info.Feed).(*expvar.Map)
+	if !ok {
+		fv = new(expvar.Map).Init()
+		feedVars.Set(info.Feed, fv)
+	}
+	for _, m := range []*expvar.Map{vars, fv} {
+		m.Add("polls", 1)
+		if info.Err != nil {
+			m.Add("poll_errors", 1)
+		}
+		m.Add("triggered", int64(info.Triggered))
+	}
+}
@@ -0,0 +1,243 @@
+package feedtrigger
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+)
+
+// Item is a feed item with typed access to the metadata of its Media RSS,
+// Dublin Core and iTunes extensions, e.g.
+//
+//	thumb := feedtrigger.Wrap(i).Media().Thumbnail
+type Item struct {
+	*gofeed.Item
+}
+
+// Wrap returns the item with the extension accessors.
+func Wrap(i *gofeed.Item) Item {
+	return Item{i}
+}
+
+// Media is the Media RSS metadata of an item.
+type Media struct {
+	Title       string
+	Description string
+	// Thumbnail is the URL of the first thumbnail.
+	Thumbnail  string
+	Thumbnails []MediaThumbnail
+	Contents   []MediaContent
+	Keywords   []string
+	Credits    []string
+}
+
+// MediaThumbnail is a media:thumbnail.
+type MediaThumbnail struct {
+	URL    string
+	Width  int
+	Height int
+}
+
+// MediaContent is a media:content.
+type MediaContent struct {
+	URL      string
+	Type     string
+	Medium   string
+	FileSize int64
+	Duration time.Duration
+	Width    int
+	Height   int
+}
+
+// Media returns the Media RSS metadata of the item, including the one
+// nested in media:group elements.
+func (i Item) Media() Media {
+	var m Media
+	media := i.Extensions["media"]
+	if media == nil {
+		return m
+	}
+	collect := func(els map[string][]ext.Extension) {
+		for _, e := range els["thumbnail"] {
+			m.Thumbnails = append(m.Thumbnails, MediaThumbnail{
+				URL:    e.Attrs["url"],
+				Width:  atoi(e.Attrs["width"]),
+				Height: atoi(e.Attrs["height"]),
+			})
+		}
+		for _, e := range els["content"] {
+			size, _ := strconv.ParseInt(e.Attrs["fileSize"], 10, 64)
+			m.Contents = append(m.Contents, MediaContent{
+				URL:      e.Attrs["url"],
+				Type:     e.Attrs["type"],
+				Medium:   e.Attrs["medium"],
+				FileSize: size,
+				Duration: time.Duration(atoi(e.Attrs["duration"])) * time.Second,
+				Width:    atoi(e.Attrs["width"]),
+				Height:   atoi(e.Attrs["height"]),
+			})
+			// thumbnails may be nested in the content
+			for _, t := range e.Children["thumbnail"] {
+				m.Thumbnails = append(m.Thumbnails, MediaThumbnail{
+					URL:    t.Attrs["url"],
+					Width:  atoi(t.Attrs["width"]),
+					Height: atoi(t.Attrs["height"]),
+				})
+			}
+		}
+		if m.Title == "" {
+			m.Title = first(els["title"])
+		}
+		if m.Description == "" {
+			m.Description = first(els["description"])
+		}
+		for _, k := range strings.Split(first(els["keywords"]), ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				m.Keywords = append(m.Keywords, k)
+			}
+		}
+		for _, c := range els["credit"] {
+			m.Credits = append(m.Credits, c.Value)
+		}
+	}
+	collect(media)
+	for _, g := range media["group"] {
+		collect(g.Children)
+	}
+	if len(m.Thumbnails) > 0 {
+		m.Thumbnail = m.Thumbnails[0].URL
+	}
+	return m
+}
+
+// DublinCore is the Dublin Core metadata of an item, the first value of
+// every element.
+type DublinCore struct {
+	Title       string
+	Creator     string
+	Subject     string
+	Description string
+	Publisher   string
+	Contributor string
+	Date        string
+	Type        string
+	Format      string
+	Identifier  string
+	Source      string
+	Language    string
+	Relation    string
+	Coverage    string
+	Rights      string
+}
+
+// DC returns the Dublin Core metadata of the item.
+func (i Item) DC() DublinCore {
+	dc := i.DublinCoreExt
+	if dc == nil {
+		if els := i.Extensions["dc"]; els != nil {
+			dc = ext.NewDublinCoreExtension(els)
+		}
+	}
+	if dc == nil {
+		return DublinCore{}
+	}
+	return DublinCore{
+		Title:       firstString(dc.Title),
+		Creator:     firstString(dc.Creator),
+		Subject:     firstString(dc.Subject),
+		Description: firstString(dc.Description),
+		Publisher:   firstString(dc.Publisher),
+		Contributor: firstString(dc.Contributor),
+		Date:        firstString(dc.Date),
+		Type:        firstString(dc.Type),
+		Format:      firstString(dc.Format),
+		Identifier:  firstString(dc.Identifier),
+		Source:      firstString(dc.Source),
+		Language:    firstString(dc.Language),
+		Relation:    firstString(dc.Relation),
+		Coverage:    firstString(dc.Coverage),
+		Rights:      firstString(dc.Rights),
+	}
+}
+
+// ITunes is the podcast metadata of an item.
+type ITunes struct {
+	Author      string
+	Subtitle    string
+	Summary     string
+	Image       string
+	Duration    time.Duration
+	Explicit    bool
+	Keywords    []string
+	Episode     int
+	Season      int
+	EpisodeType string
+}
+
+// ITunes returns the iTunes podcast metadata of the item.
+func (i Item) ITunes() ITunes {
+	it := i.ITunesExt
+	if it == nil {
+		if els := i.Extensions["itunes"]; els != nil {
+			it = ext.NewITunesItemExtension(els)
+		}
+	}
+	if it == nil {
+		return ITunes{}
+	}
+	var keywords []string
+	for _, k := range strings.Split(it.Keywords, ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			keywords = append(keywords, k)
+		}
+	}
+	explicit := strings.ToLower(it.Explicit)
+	return ITunes{
+		Author:      it.Author,
+		Subtitle:    it.Subtitle,
+		Summary:     it.Summary,
+		Image:       it.Image,
+		Duration:    itunesDuration(it.Duration),
+		Explicit:    explicit == "yes" || explicit == "true" || explicit == "explicit",
+		Keywords:    keywords,
+		Episode:     atoi(it.Episode),
+		Season:      atoi(it.Season),
+		EpisodeType: it.EpisodeType,
+	}
+}
+
+// itunesDuration parses the itunes:duration formats: seconds, MM:SS and
+// HH:MM:SS.
+func itunesDuration(s string) time.Duration {
+	var d time.Duration
+	for _, part := range strings.Split(strings.TrimSpace(s), ":") {
+		n, err := strconv.Atoi(part)
+		if err != nil {
+			return 0
+		}
+		d = d*60 + time.Duration(n)
+	}
+	return d * time.Second
+}
+
+func first(els []ext.Extension) string {
+	if len(els) == 0 {
+		return ""
+	}
+	return els[0].Value
+}
+
+func firstString(s []string) string {
+	if len(s) == 0 {
+		return ""
+	}
+	return s[0]
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(strings.TrimSpace(s))
+	return n
+}
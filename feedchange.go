@@ -0,0 +1,94 @@
+package feedtrigger
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// Feed-level fields watched for changes.
+const (
+	ChangeTitle       = "title"
+	ChangeDescription = "description"
+	ChangeLink        = "link"
+	// ChangeURL is a permanent redirect of the feed URL.
+	ChangeURL = "url"
+)
+
+// FeedChange is a change of the feed-level metadata.
+type FeedChange struct {
+	Feed  string
+	Field string
+	Old   string
+	New   string
+}
+
+// FeedChangeAction is triggered, when the feed metadata changes.
+type FeedChangeAction func(FeedChange) error
+
+// detectChanges updates the feed metadata of the head and calls
+// OnFeedChanged for every field that changed since the last poll.
+func (a *FeedAction) detectChanges(f Feed, head *FeedHead, feed *gofeed.Feed, found bool) error {
+	movedTo := a.state(f.URL).movedTo()
+	fields := []struct {
+		name  string
+		old   *string
+		value string
+	}{
+		{ChangeTitle, &head.FeedTitle, feed.Title},
+		{ChangeDescription, &head.FeedDescription, feed.Description},
+		{ChangeLink, &head.FeedLink, feed.Link},
+		{ChangeURL, &head.MovedTo, movedTo},
+	}
+
+	var changes []FeedChange
+	for _, fl := range fields {
+		old := *fl.old
+		if old == fl.value {
+			continue
+		}
+		*fl.old = fl.value
+		// records written before the metadata was kept have it empty
+		if found && (old != "" || fl.name == ChangeURL) && fl.value != "" {
+			changes = append(changes, FeedChange{Feed: f.URL, Field: fl.name, Old: old, New: fl.value})
+		}
+	}
+
+	if a.DryRun {
+		for _, c := range changes {
+			a.logf("dry run: %s: feed %s changed from %q to %q", c.Feed, c.Field, c.Old, c.New)
+		}
+		return nil
+	}
+	for _, c := range changes {
+		c := c
+		a.publish(Event{Type: EventFeedUpdated, Feed: f.URL, Change: &c})
+		if f.OnFeedChanged == nil {
+			continue
+		}
+		if err := f.OnFeedChanged(c); err != nil {
+			return fmt.Errorf("feed change func: %w", err)
+		}
+	}
+	return nil
+}
+
+// permanentRedirect returns the URL the response was permanently
+// redirected to, empty if any redirect on the way was temporary.
+func permanentRedirect(resp *http.Response) string {
+	r := resp.Request
+	if r == nil || r.Response == nil {
+		return ""
+	}
+	for req := r; req.Response != nil; req = req.Response.Request {
+		code := req.Response.StatusCode
+		if code != http.StatusMovedPermanently && code != http.StatusPermanentRedirect {
+			return ""
+		}
+		if req.Response.Request == nil {
+			break
+		}
+	}
+	return r.URL.String()
+}
@@ -0,0 +1,275 @@
+package feedtrigger
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/philippgille/gokv"
+)
+
+// FeedOption configures the feed built by NewFeed.
+type FeedOption func(*Feed)
+
+// WithRefreshPeriod polls the feed every d.
+func WithRefreshPeriod(d time.Duration) FeedOption {
+	return func(f *Feed) {
+		f.RefreshPeriod = d
+	}
+}
+
+// WithFilter adds item filters, see Feed.Filters.
+func WithFilter(filters ...ItemFilter) FeedOption {
+	return func(f *Feed) {
+		f.Filters = append(f.Filters, filters...)
+	}
+}
+
+// WithEnricher adds item enrichers, see Feed.Enrichers.
+func WithEnricher(enrichers ...Enricher) FeedOption {
+	return func(f *Feed) {
+		f.Enrichers = append(f.Enrichers, enrichers...)
+	}
+}
+
+// WithHeaders adds the headers to the feed requests.
+func WithHeaders(h http.Header) FeedOption {
+	return func(f *Feed) {
+		if f.Headers == nil {
+			f.Headers = make(http.Header)
+		}
+		for k, v := range h {
+			f.Headers[k] = append(f.Headers[k], v...)
+		}
+	}
+}
+
+// WithBasicAuth authenticates the feed requests with the credentials.
+func WithBasicAuth(username, password string) FeedOption {
+	return func(f *Feed) {
+		r := http.Request{Header: make(http.Header)}
+		r.SetBasicAuth(username, password)
+		WithHeaders(r.Header)(f)
+	}
+}
+
+// WithBearerToken authenticates the feed requests with the token.
+func WithBearerToken(token string) FeedOption {
+	return WithHeaders(http.Header{"Authorization": {"Bearer " + token}})
+}
+
+// WithLabels adds the labels, see Feed.Labels.
+func WithLabels(labels map[string]string) FeedOption {
+	return func(f *Feed) {
+		if f.Labels == nil {
+			f.Labels = make(map[string]string, len(labels))
+		}
+		for k, v := range labels {
+			f.Labels[k] = v
+		}
+	}
+}
+
+// WithMetadata adds the metadata, see Feed.Metadata.
+func WithMetadata(metadata map[string]string) FeedOption {
+	return func(f *Feed) {
+		if f.Metadata == nil {
+			f.Metadata = make(map[string]string, len(metadata))
+		}
+		for k, v := range metadata {
+			f.Metadata[k] = v
+		}
+	}
+}
+
+// WithFirstRun sets the first poll policy.
+func WithFirstRun(p FirstRun) FeedOption {
+	return func(f *Feed) {
+		f.FirstRun = p
+	}
+}
+
+// WithRetry retries the failed deliveries with the policy.
+func WithRetry(p RetryPolicy) FeedOption {
+	return func(f *Feed) {
+		f.Retry = &p
+	}
+}
+
+// WithActionTimeout bounds the duration of the actions.
+func WithActionTimeout(d time.Duration) FeedOption {
+	return func(f *Feed) {
+		f.ActionTimeout = d
+	}
+}
+
+// WithSource produces the feed with the source instead of fetching it.
+func WithSource(s Source) FeedOption {
+	return func(f *Feed) {
+		f.Source = s
+	}
+}
+
+// WithTranslators maps the parsed Atom and RSS documents into items with
+// the translators, nil ones keep the gofeed defaults.
+func WithTranslators(atom, rss gofeed.Translator) FeedOption {
+	return func(f *Feed) {
+		f.AtomTranslator = atom
+		f.RSSTranslator = rss
+	}
+}
+
+// WithParse parses the downloaded documents of the feed with fn.
+func WithParse(fn ParseFunc) FeedOption {
+	return func(f *Feed) {
+		f.Parse = fn
+	}
+}
+
+// WithMaxItemsPerPoll bounds the items triggered per poll, the rest is
+// handled by the overflow policy.
+func WithMaxItemsPerPoll(n int, o Overflow) FeedOption {
+	return func(f *Feed) {
+		f.MaxItemsPerPoll, f.Overflow = n, o
+	}
+}
+
+// WithProfile makes the feed inherit the settings of the profile.
+func WithProfile(name string) FeedOption {
+	return func(f *Feed) {
+		f.Profile = name
+	}
+}
+
+// WithInitialDelay postpones the first poll of the feed.
+func WithInitialDelay(d time.Duration) FeedOption {
+	return func(f *Feed) {
+		f.InitialDelay = d
+	}
+}
+
+// WithNotifyWindow suppresses the items whose title or link the feed
+// triggered within the window.
+func WithNotifyWindow(d time.Duration) FeedOption {
+	return func(f *Feed) {
+		f.NotifyWindow = d
+	}
+}
+
+// WithDeliveryWindows holds the items detected outside of the windows until
+// one opens.
+func WithDeliveryWindows(windows ...DeliveryWindow) FeedOption {
+	return func(f *Feed) {
+		f.DeliveryWindows = windows
+	}
+}
+
+// WithDigest sends the new items with the named FeedAction digest.
+func WithDigest(name string) FeedOption {
+	return func(f *Feed) {
+		f.Digest = name
+	}
+}
+
+// WithPriority orders the feed under load, see Feed.Priority.
+func WithPriority(priority int) FeedOption {
+	return func(f *Feed) {
+		f.Priority = priority
+	}
+}
+
+// WithGroup adds the feed to the named FeedAction group.
+func WithGroup(name string) FeedOption {
+	return func(f *Feed) {
+		f.Group = name
+	}
+}
+
+// WithMaxItemAge drops the new items published longer ago than age.
+func WithMaxItemAge(age time.Duration) FeedOption {
+	return func(f *Feed) {
+		f.MaxItemAge = age
+	}
+}
+
+// WithDetector decides which items of the feed are new with d.
+func WithDetector(d ChangeDetector) FeedOption {
+	return func(f *Feed) {
+		f.Detector = d
+	}
+}
+
+// WithSortByPublished tolerates the feed ordering its items by activity,
+// see Feed.SortByPublished.
+func WithSortByPublished() FeedOption {
+	return func(f *Feed) {
+		f.SortByPublished = true
+	}
+}
+
+// WithAnomalies reports the bursts and the silences of the feed detected
+// with d to action.
+func WithAnomalies(d *AnomalyDetector, action AnomalyAction) FeedOption {
+	return func(f *Feed) {
+		f.Anomalies = d
+		f.OnAnomaly = action
+	}
+}
+
+// WithEmptyPolicy handles the polls returning no items with policy, see
+// Feed.EmptyPolicy.
+func WithEmptyPolicy(policy EmptyPolicy, maxPolls int) FeedOption {
+	return func(f *Feed) {
+		f.EmptyPolicy = policy
+		f.MaxEmptyPolls = maxPolls
+	}
+}
+
+// WithFeedStore keeps the state of the feed in s, see Feed.Store.
+func WithFeedStore(s gokv.Store) FeedOption {
+	return func(f *Feed) {
+		f.Store = s
+	}
+}
+
+// WithTransform rewrites the items of the feed with the transforms, after
+// the ones set already.
+func WithTransform(transforms ...Transform) FeedOption {
+	return func(f *Feed) {
+		if f.Transform != nil {
+			transforms = append([]Transform{f.Transform}, transforms...)
+		}
+		f.Transform = ChainTransforms(transforms...)
+	}
+}
+
+// WithCharset transcodes the feed documents from the charset, see
+// Feed.Charset.
+func WithCharset(charset string) FeedOption {
+	return func(f *Feed) {
+		f.Charset = charset
+	}
+}
+
+// WithUnshortener resolves the shortened links of the feed items with u, see
+// Feed.Unshorten.
+func WithUnshortener(u *Unshortener) FeedOption {
+	return func(f *Feed) {
+		f.Unshorten = u
+	}
+}
+
+// WithLocation sets the timezone of the feed, see Feed.Location.
+func WithLocation(loc *time.Location) FeedOption {
+	return func(f *Feed) {
+		f.Location = loc
+	}
+}
+
+// WithDateLayouts parses the item dates with the layouts, see
+// Feed.DateLayouts.
+func WithDateLayouts(layouts ...string) FeedOption {
+	return func(f *Feed) {
+		f.DateLayouts = append(f.DateLayouts, layouts...)
+	}
+}
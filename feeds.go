@@ -0,0 +1,280 @@
+package feedtrigger
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/philippgille/gokv"
+)
+
+// ListFeeds returns a snapshot of the feeds. Use it instead of reading Feeds
+// while the application is running.
+func (a *FeedAction) ListFeeds() []Feed {
+	a.feedsMu.Lock()
+	defer a.feedsMu.Unlock()
+	return append([]Feed(nil), a.Feeds...)
+}
+
+// AddFeed adds the feed or replaces the one with the same URL once
+// normalized, see NormalizeURL. It returns a DuplicateFeedError for a feed
+// differing from another one only by the trailing slash. A running
+// application starts polling it right away.
+func (a *FeedAction) AddFeed(f Feed) error {
+	raw := f.URL
+	f.URL = NormalizeURL(raw)
+	if err := a.applyProfile(&f); err != nil {
+		return err
+	}
+
+	a.feedsMu.Lock()
+	defer a.feedsMu.Unlock()
+	key := dupKey(f.URL)
+	for _, o := range a.Feeds {
+		if o.URL != f.URL && dupKey(o.URL) == key {
+			return &DuplicateFeedError{URL: key, First: o.URL, Second: f.URL}
+		}
+	}
+	// the state is adopted only once the feed is valid
+	if raw != f.URL {
+		if err := a.moveState(a.storeKV(f.Store), raw, f.URL); err != nil {
+			return err
+		}
+	}
+	if err := a.undelete(f.URL); err != nil {
+		return err
+	}
+	replaced := false
+	for i := range a.Feeds {
+		if a.Feeds[i].URL == f.URL {
+			a.Feeds[i] = f
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		a.Feeds = append(a.Feeds, f)
+		if a.ops != nil {
+			a.watch(f.URL)
+		}
+	}
+	a.sendOp(schedOp{add: &f})
+	return nil
+}
+
+// RemoveFeed stops polling the feed with the url. Its stored state is kept.
+func (a *FeedAction) RemoveFeed(url string) bool {
+	url = NormalizeURL(url)
+	a.feedsMu.Lock()
+	defer a.feedsMu.Unlock()
+	for i := range a.Feeds {
+		if a.Feeds[i].URL == url {
+			a.Feeds = append(a.Feeds[:i], a.Feeds[i+1:]...)
+			a.sendOp(schedOp{remove: url})
+			return true
+		}
+	}
+	return false
+}
+
+// PollNow polls the feed right away unless it's being polled already.
+func (a *FeedAction) PollNow(url string) bool {
+	url = NormalizeURL(url)
+	a.feedsMu.Lock()
+	defer a.feedsMu.Unlock()
+	for _, f := range a.Feeds {
+		if f.URL == url {
+			a.sendOp(schedOp{poll: url})
+			return true
+		}
+	}
+	return false
+}
+
+// PauseFeed stops fetching the feed until ResumeFeed is called.
+func (a *FeedAction) PauseFeed(url string) {
+	url = NormalizeURL(url)
+	s := a.state(url)
+	s.mu.Lock()
+	s.paused = true
+	s.mu.Unlock()
+}
+
+// ResumeFeed resumes fetching the paused feed.
+func (a *FeedAction) ResumeFeed(url string) {
+	url = NormalizeURL(url)
+	s := a.state(url)
+	s.mu.Lock()
+	s.paused = false
+	s.mu.Unlock()
+}
+
+// Head returns the stored state of the feed.
+func (a *FeedAction) Head(url string) (*FeedHead, bool, error) {
+	url = NormalizeURL(url)
+	head, found, err := a.loadHead(url)
+	if err != nil || !found {
+		return nil, found, err
+	}
+	return &head, true, nil
+}
+
+// SyncFeeds makes feeds the authoritative feed set: feeds missing from it
+// are removed, new ones are added and the ones with changed settings are
+// replaced.
+func (a *FeedAction) SyncFeeds(feeds []Feed) (added, removed, updated []string, err error) {
+	wanted := make(map[string]Feed, len(feeds))
+	configured := make(map[string]string, len(feeds))
+	feeds = append([]Feed(nil), feeds...)
+	for n := range feeds {
+		raw := feeds[n].URL
+		feeds[n].URL = NormalizeURL(raw)
+		f := feeds[n]
+		key := dupKey(raw)
+		if first, dup := configured[key]; dup {
+			return nil, nil, nil, &DuplicateFeedError{URL: key, First: first, Second: raw}
+		}
+		configured[key] = raw
+		if err := a.applyProfile(&f); err != nil {
+			return nil, nil, nil, err
+		}
+		wanted[f.URL] = f
+	}
+
+	current := make(map[string]Feed)
+	for _, f := range a.ListFeeds() {
+		current[f.URL] = f
+	}
+
+	for url := range current {
+		if _, ok := wanted[url]; !ok {
+			a.RemoveFeed(url)
+			removed = append(removed, url)
+		}
+	}
+	for _, f := range feeds {
+		old, ok := current[f.URL]
+		f = wanted[f.URL]
+		switch {
+		case !ok:
+			added = append(added, f.URL)
+		case feedChanged(old, f):
+			updated = append(updated, f.URL)
+		default:
+			continue
+		}
+		if err := a.AddFeed(f); err != nil {
+			return added, removed, updated, err
+		}
+	}
+	return added, removed, updated, nil
+}
+
+// sendOp passes the change to the running scheduler, feedsMu must be held.
+func (a *FeedAction) sendOp(op schedOp) {
+	if a.ops == nil {
+		return
+	}
+	select {
+	case a.ops <- op:
+	case <-a.schedDone:
+	}
+}
+
+// feedChanged compares the settings of two feeds by their fingerprints.
+func feedChanged(old, new Feed) bool {
+	return fingerprint(old) != fingerprint(new)
+}
+
+var (
+	storeType    = reflect.TypeOf((*gokv.Store)(nil)).Elem()
+	locationType = reflect.TypeOf((*time.Location)(nil))
+)
+
+// fingerprint returns the hash of the settings of the feed. Functions can't
+// be compared, so only the presence of callbacks, filters and the like is
+// taken into account, the feeds built from a config carry the fingerprint
+// of their entry for the rest. Stores are compared by identity.
+func fingerprint(f Feed) string {
+	h := sha1.New()
+	writeSettings(h, reflect.ValueOf(f), make(map[uintptr]bool))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// writeSettings writes the value for fingerprint, seen are the pointers
+// written already.
+func writeSettings(w io.Writer, v reflect.Value, seen map[uintptr]bool) {
+	if v.Kind() == reflect.Ptr && v.Type().Implements(storeType) {
+		fmt.Fprintf(w, "%s@%x;", v.Type(), v.Pointer())
+		return
+	}
+	if v.Type() == locationType && !v.IsNil() && v.CanInterface() {
+		fmt.Fprintf(w, "%s;", v.Interface())
+		return
+	}
+	switch v.Kind() {
+	case reflect.Func:
+		fmt.Fprintf(w, "func:%v;", !v.IsNil())
+	case reflect.Interface:
+		if v.IsNil() {
+			io.WriteString(w, "nil;")
+			return
+		}
+		fmt.Fprintf(w, "%s:", v.Elem().Type())
+		writeSettings(w, v.Elem(), seen)
+	case reflect.Ptr:
+		if v.IsNil() {
+			io.WriteString(w, "nil;")
+			return
+		}
+		if seen[v.Pointer()] {
+			io.WriteString(w, "cycle;")
+			return
+		}
+		seen[v.Pointer()] = true
+		writeSettings(w, v.Elem(), seen)
+		delete(seen, v.Pointer())
+	case reflect.Struct:
+		io.WriteString(w, "{")
+		for i := 0; i < v.NumField(); i++ {
+			fmt.Fprintf(w, "%s=", v.Type().Field(i).Name)
+			writeSettings(w, v.Field(i), seen)
+		}
+		io.WriteString(w, "}")
+	case reflect.Slice, reflect.Array:
+		io.WriteString(w, "[")
+		for i := 0; i < v.Len(); i++ {
+			writeSettings(w, v.Index(i), seen)
+		}
+		io.WriteString(w, "]")
+	case reflect.Map:
+		entries := make([]string, 0, v.Len())
+		for _, k := range v.MapKeys() {
+			h := sha1.New()
+			writeSettings(h, k, seen)
+			io.WriteString(h, "=")
+			writeSettings(h, v.MapIndex(k), seen)
+			entries = append(entries, hex.EncodeToString(h.Sum(nil)))
+		}
+		sort.Strings(entries)
+		fmt.Fprintf(w, "%v;", entries)
+	case reflect.Bool:
+		fmt.Fprintf(w, "%v;", v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		fmt.Fprintf(w, "%d;", v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		fmt.Fprintf(w, "%d;", v.Uint())
+	case reflect.Float32, reflect.Float64:
+		fmt.Fprintf(w, "%v;", v.Float())
+	case reflect.String:
+		fmt.Fprintf(w, "%s;", strconv.Quote(v.String()))
+	default:
+		// channels and unsafe pointers aren't settings
+		fmt.Fprintf(w, "%s;", v.Type())
+	}
+}
@@ -0,0 +1,127 @@
+package feedtrigger
+
+import (
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger/stores"
+)
+
+func TestSyncFeedsUnchanged(t *testing.T) {
+	store := &stores.MemoryStore{}
+	feeds := func() []Feed {
+		loc, err := time.LoadLocation("Europe/Berlin")
+		if err != nil {
+			t.Skip(err)
+		}
+		f := NewFeed("http://example.com/feed.xml", func(*gofeed.Item) error { return nil },
+			WithEmptyPolicy(EmptyFail, 3))
+		f.Filters = []ItemFilter{LanguageFilter("en")}
+		f.Transform = ChainTransforms(TruncateContent(100))
+		f.Detector = DetectByHash
+		f.Anomalies = &AnomalyDetector{MinBurst: 5}
+		f.Retry = &RetryPolicy{Attempts: 3, Retryable: func(error) bool { return true }}
+		f.Location = loc
+		f.Store = store
+		return []Feed{*f, *NewFeed("http://example.com/other.xml", func(*gofeed.Item) error { return nil })}
+	}
+	app, err := New(WithStore(&stores.MemoryStore{}), WithFeeds(feeds()...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.Logger = log.New(ioutil.Discard, "", 0)
+
+	added, removed, updated, err := app.SyncFeeds(feeds())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(added)+len(removed)+len(updated) > 0 {
+		t.Errorf("same feeds: added %v, removed %v, updated %v", added, removed, updated)
+	}
+
+	for _, change := range []func(*Feed){
+		func(f *Feed) { f.RefreshPeriod = time.Hour },
+		func(f *Feed) { f.Retry.Attempts = 5 },
+		func(f *Feed) { f.Filters = nil },
+		func(f *Feed) { f.Store = &stores.MemoryStore{} },
+		func(f *Feed) { f.Location = time.UTC },
+	} {
+		changed := feeds()
+		change(&changed[0])
+		_, _, updated, err := app.SyncFeeds(changed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{changed[0].URL}; !reflect.DeepEqual(updated, want) {
+			t.Errorf("updated %v, want %v", updated, want)
+		}
+		if _, _, _, err := app.SyncFeeds(feeds()); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAddFeedInvalidKeepsState(t *testing.T) {
+	action := func(*gofeed.Item) error { return nil }
+	app, err := New(WithStore(&stores.MemoryStore{}), WithFeeds(*NewFeed("http://example.com/feed.xml", action)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.Logger = log.New(ioutil.Discard, "", 0)
+
+	for _, f := range []*Feed{
+		// a duplicate of the configured feed but for the trailing slash
+		NewFeed("HTTP://Example.com/feed.xml/", action),
+		NewFeed("HTTP://Example.com/new.xml", action, WithProfile("nope")),
+	} {
+		top := &gofeed.Item{GUID: "1"}
+		if err := app.storeHead(*f, &FeedHead{}, top); err != nil {
+			t.Fatal(err)
+		}
+		if err := app.AddFeed(*f); err == nil {
+			t.Errorf("%s added", f.URL)
+		}
+		if _, found, err := app.loadHead(f.URL); err != nil || !found {
+			t.Errorf("%s: state moved by the rejected feed: %v, %v", f.URL, found, err)
+		}
+		if _, found, err := app.loadHead(NormalizeURL(f.URL)); err != nil || found {
+			t.Errorf("%s: state adopted by the rejected feed: %v, %v", f.URL, found, err)
+		}
+	}
+}
+
+func TestAdminRemoveFeed(t *testing.T) {
+	app, err := New(WithStore(&stores.MemoryStore{}), WithFeeds(
+		*NewFeed("http://example.com/feed.xml", func(*gofeed.Item) error { return nil })))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.Logger = log.New(ioutil.Discard, "", 0)
+	h := app.AdminHandler()
+
+	for _, tt := range []struct {
+		method, url string
+		want        int
+	}{
+		{http.MethodGet, "/feeds/remove?url=http://example.com/feed.xml", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/feeds/remove?url=http://example.com/other.xml", http.StatusNotFound},
+		{http.MethodPost, "/feeds/remove?url=http://example.com/feed.xml", http.StatusNoContent},
+		{http.MethodPost, "/feeds/remove?url=http://example.com/feed.xml", http.StatusNotFound},
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(tt.method, tt.url, nil))
+		if w.Code != tt.want {
+			t.Errorf("%s %s: %d, want %d", tt.method, tt.url, w.Code, tt.want)
+		}
+	}
+	if feeds := app.ListFeeds(); len(feeds) != 0 {
+		t.Errorf("%d feeds left", len(feeds))
+	}
+}
@@ -0,0 +1,64 @@
+package feedtrigger
+
+import (
+	"github.com/philippgille/gokv"
+)
+
+// feedKV returns the store of the state of the feed with the url, its own
+// Store if set and kv otherwise. The soft-deleted feeds keep theirs until
+// purged.
+func (a *FeedAction) feedKV(url string) gokv.Store {
+	var s gokv.Store
+	a.feedsMu.Lock()
+	for _, f := range a.Feeds {
+		if f.URL == url {
+			s = f.Store
+			break
+		}
+	}
+	a.feedsMu.Unlock()
+	if s == nil {
+		a.deleted.mu.Lock()
+		s = a.deleted.feeds[url].Store
+		a.deleted.mu.Unlock()
+	}
+	return a.storeKV(s)
+}
+
+// storeKV returns the scoped store of a feed with the Store, the
+// application one if nil.
+func (a *FeedAction) storeKV(s gokv.Store) gokv.Store {
+	if s == nil {
+		return a.kv()
+	}
+
+	// feeds sharing a store share its scoped one, so the key list of the
+	// namespace stays consistent
+	a.feedStoreMu.Lock()
+	defer a.feedStoreMu.Unlock()
+	if a.feedStores == nil {
+		a.feedStores = make(map[gokv.Store]gokv.Store)
+	}
+	kv, ok := a.feedStores[s]
+	if !ok {
+		kv = a.scoped(s)
+		a.feedStores[s] = kv
+	}
+	return kv
+}
+
+// closeFeedStores closes the stores of the feeds used since the start,
+// except for FeedAction.Store.
+func (a *FeedAction) closeFeedStores() {
+	a.feedStoreMu.Lock()
+	defer a.feedStoreMu.Unlock()
+	for s := range a.feedStores {
+		if s == a.Store {
+			continue
+		}
+		if err := s.Close(); err != nil {
+			a.logf("closing feed store: %v", err)
+		}
+	}
+	a.feedStores = nil
+}
@@ -4,8 +4,10 @@ package feedtrigger
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"strings"
 	"sync"
 	"time"
@@ -15,144 +17,1356 @@ import (
 	"github.com/mmcdole/gofeed"
 	"github.com/philippgille/gokv"
 	"github.com/philippgille/gokv/bbolt"
+
+	"ilya.app/feedtrigger/stores"
 )
 
 // FeedAction is a the main configuration struct.
 type FeedAction struct {
 	Store gokv.Store
-	Feeds []Feed
+	// Namespace prefixes every key the application stores, so several of
+	// them can share a store. stores.Namespace enumerates and cleans the
+	// keys of a namespace.
+	Namespace string
+	Feeds     []Feed
+	// Profiles are feed settings bundles referenced by Feed.Profile.
+	Profiles map[string]*Profile
+	// Groups are feed groups referenced by Feed.Group.
+	Groups map[string]*FeedGroup
+
+	// HostRateLimit is the number of requests per second allowed to a single
+	// host across all feeds, zero means no limit.
+	HostRateLimit float64
+	// HostBurst is the number of requests to a host allowed at once before
+	// HostRateLimit applies.
+	HostBurst int
+
+	// MaxConcurrentPolls is the size of the worker pool polling feeds, zero
+	// means a worker per feed configured at the start.
+	MaxConcurrentPolls int
+
+	// Proxy is the proxy of the feeds without their own, see Feed.Proxy.
+	Proxy string
+
+	// Fetcher replaces the download and parsing of the feeds without a
+	// Source, e.g. to serve canned feeds in tests. Parser only replaces the
+	// parsing of the downloaded documents.
+	Fetcher Fetcher
+	Parser  Parser
+
+	// Logger receives the log of the application, the standard logger if
+	// nil.
+	Logger *log.Logger
+
+	// Stagger spreads the first polls of the feeds without an InitialDelay
+	// over their refresh period instead of polling all of them at the
+	// start. The offset of a feed is derived from its URL, so it's the same
+	// on every start.
+	Stagger bool
+
+	// Clock is the source of time of the scheduling, backoffs and TTLs,
+	// SystemClock if nil.
+	Clock Clock
+
+	// MaxConcurrentFetches bounds the number of feeds downloaded and
+	// parsed at once across all feeds, zero means no limit. It keeps the
+	// memory and the connections bounded whatever the number of feeds.
+	MaxConcurrentFetches int
+
+	// QueueSize decouples the delivery from the polls when set: the new
+	// items are handed to Dispatchers workers through a queue of the size,
+	// and the polls of a feed wait while the queue is full. The items are
+	// marked seen once queued, so Outbox should be set to keep the queued
+	// ones across restarts. Triggered of PollInfo counts the queued items.
+	QueueSize   int
+	Dispatchers int
+
+	// MaxConcurrentActions bounds the number of items delivered to actions
+	// at once across all feeds, zero means no limit. The items of a feed
+	// are always delivered one by one in order.
+	MaxConcurrentActions int
+
+	// ShutdownGracePeriod is how long Run waits for running polls after the
+	// context is canceled, DefaultShutdownGracePeriod if zero.
+	ShutdownGracePeriod time.Duration
+
+	// Redactions are applied to every item before it reaches actions.
+	Redactions []RedactionRule
+
+	// Archive keeps every triggered item when set.
+	Archive *Archive
+
+	// SlowStoreThreshold is the duration of the store operations logged as
+	// slow, DefaultSlowStoreThreshold if zero and none if negative. The
+	// latency of every operation is published by expvar.
+	SlowStoreThreshold time.Duration
+
+	// DeliveryQueue keeps the items whose actions failed on disk and
+	// delivers them again once the actions recover.
+	DeliveryQueue *DeliveryQueue
+
+	// DeadLetter keeps items whose actions failed in the dead-letter queue
+	// of the feed instead of aborting the poll. MaxDeadLetters bounds the
+	// queue of each feed, the items failing first are dropped when it's
+	// full. DefaultMaxDeadLetters if zero.
+	DeadLetter     bool
+	MaxDeadLetters int
+
+	// Outbox stores new items before triggering them and removes them once
+	// delivered, so the items left by a crash are delivered on the next
+	// start. Items may be triggered more than once but never get lost.
+	Outbox bool
+
+	// ExactlyOnce claims the delivery of every item in the store before
+	// running the actions, so the instances sharing the store or restarted
+	// after a crash don't trigger an item delivered already. It passes the
+	// IdempotencyKey of the item to the actions in its custom fields.
+	//
+	// Run fails unless the stores of the feeds implement stores.Swapper.
+	// The claims are only as atomic as their compare and swap: the memory
+	// and file stores swap atomically within one process only, so they
+	// don't guard separate processes sharing the files, and bbolt has no
+	// compare and swap at all.
+	ExactlyOnce bool
+
+	// FetchBranding fetches the favicon and image of every feed's site once
+	// and sets the IconKey custom field of its items for notifications.
+	FetchBranding bool
+
+	// HealthFactor is how many refresh periods a feed may go without a
+	// successful poll before Healthz reports it, DefaultHealthFactor if
+	// zero.
+	HealthFactor int
+
+	// DeleteGracePeriod is how long the state of soft-deleted feeds is
+	// kept, DefaultDeleteGracePeriod if zero.
+	DeleteGracePeriod time.Duration
+
+	// ThrottleCooldown is how long the feeds of a host answering 429 or 503
+	// without a Retry-After are deferred, DefaultThrottleCooldown if zero.
+	// The cooldowns are stored, so they survive restarts.
+	ThrottleCooldown time.Duration
+
+	// OrphanRetention is how long the stored state of the feeds not
+	// configured anymore is kept since they were last configured or polled,
+	// zero keeps it forever. Run reconciles the state on start, see
+	// Reconcile.
+	OrphanRetention time.Duration
+
+	// AuditRetention is how long the audit entries of the items are kept,
+	// none are recorded if zero, see Audit.
+	AuditRetention time.Duration
+
+	// Dedup suppresses items already triggered from another feed when set.
+	Dedup *Dedup
+
+	// Digests are the digests feeds can send their items with, see Digest.
+	Digests []*Digest
+
+	// Watchlist is matched against every new item of all feeds, the hits
+	// are passed to OnWatchlistHit.
+	Watchlist      *Watchlist
+	OnWatchlistHit func(keyword string, i *gofeed.Item)
+
+	// NamedActions are the actions the admin API wires the feeds to by
+	// name and ActionRegistry instantiates the new ones, see DefineAction.
+	NamedActions   map[string]NewItemAction
+	ActionRegistry ActionRegistry
+
+	// DryRun fetches feeds and logs the items that would be triggered
+	// without running actions or updating the stored state.
+	DryRun bool
+
+	// OnPoll is called after every poll of any feed and OnDelivered with
+	// every item delivered to the actions, e.g. to record the history.
+	OnPoll      PollHook
+	OnDelivered func(feed string, i *gofeed.Item)
+
+	// FollowMoves polls the URL a feed permanently redirects to instead of
+	// the configured one, carrying its state over, and calls OnFeedMoved.
+	FollowMoves bool
+	OnFeedMoved func(from, to string)
+
+	// OnSkip receives every item that was present in a feed but not acted
+	// on, with the reason.
+	OnSkip func(Skip)
+
+	// RemoteFeeds makes the feed set follow a remotely managed list.
+	RemoteFeeds *RemoteFeeds
+
+	// Canary enables periodic end-to-end self-tests of the trigger pipeline.
+	Canary *Canary
+
+	// Cluster partitions the feeds between the instances sharing the store
+	// when set.
+	Cluster *Cluster
+
+	// Leases keep the instances sharing the store from polling the same
+	// feed at once when set.
+	Leases *Leases
+
+	// Tenants are isolated feed groups run along with the feeds, see Tenant.
+	Tenants    []*Tenant
+	tenantsCtx context.Context
+
+	skips      skipCounter
+	recent     recentItems
+	bus        bus
+	redactions redactionCounter
+	feedsMu    sync.Mutex
+	ops        chan schedOp
+	schedDone  chan struct{}
+
+	deleted  deletedFeeds
+	dlqMu    sync.Mutex
+	outboxMu sync.Mutex
+	dedupMu  sync.Mutex
+	auditMu  sync.Mutex
+	namedMu  sync.Mutex
+
+	cooldowns cooldowns
+	known     knownFeeds
+	// renamedFeeds are the configured URLs of the feeds by the normalized
+	// ones, until their stored state is adopted.
+	renamedFeeds map[string]string
+
+	burstsMu sync.Mutex
+	bursts   map[string]*burstBuffer
+
+	statesMu    sync.Mutex
+	states      map[string]*feedState
+	kvOnce      sync.Once
+	namespaced  gokv.Store
+	feedStoreMu sync.Mutex
+	feedStores  map[gokv.Store]gokv.Store
+	limiterOnce sync.Once
+	limiter     *hostLimiter
+	actionsOnce sync.Once
+	actions     chan struct{}
+	notifyMu    sync.Mutex
+	heldMu      sync.Mutex
+	digestMu    sync.Mutex
+	fetchesOnce sync.Once
+	fetches     chan struct{}
+	queueMu     sync.RWMutex
+	queues      []chan dispatchJob
+	urgent      []chan dispatchJob
+
+	// Mutex was held while storing the state of any feed. The state is
+	// locked per feed now and the application doesn't hold it anymore.
+	//
+	// Deprecated: kept for the callers locking the application, it doesn't
+	// guard anything.
 	sync.Mutex
 }
 
+// DefaultShutdownGracePeriod is the default time given to running polls to
+// finish on shutdown.
+const DefaultShutdownGracePeriod = 30 * time.Second
+
 // NewItemAction is triggered, when new item is available.
 type NewItemAction func(*gofeed.Item) error
 
+// NewItemActionCtx is NewItemAction getting the context of the poll, so
+// actions making network calls can honor cancellation and deadlines. The
+// context carries the source feed, see ContextFeed.
+type NewItemActionCtx func(ctx context.Context, i *gofeed.Item) error
+
+// WithContext adapts an action ignoring the context.
+func WithContext(fn NewItemAction) NewItemActionCtx {
+	return func(_ context.Context, i *gofeed.Item) error {
+		return fn(i)
+	}
+}
+
+// UpdatedItemAction is triggered, when a seen item is edited.
+type UpdatedItemAction func(old, new *gofeed.Item) error
+
+// PollInfo describes a poll of a feed.
+type PollInfo struct {
+	Feed     string
+	Start    time.Time
+	Duration time.Duration
+	// Items is the number of items in the feed.
+	Items int
+	// Triggered is the number of items delivered to the actions.
+	Triggered int
+	// LastPublished is the publish time of the newest triggered item.
+	LastPublished time.Time
+	// Cost is the resource usage of the poll, including the deliveries of
+	// the feed items retried since the previous one.
+	Cost PollCost
+	Err  error
+}
+
+// PollHook is called around a poll.
+type PollHook func(PollInfo)
+
+// Enricher adds data to a new item before it's triggered, e.g. the full
+// article text. It gets a copy of the item it can modify.
+type Enricher func(ctx context.Context, i *gofeed.Item) error
+
+// NewBatchAction is triggered once per poll with all new items.
+type NewBatchAction func([]*gofeed.Item) error
+
 // Feed to poll (Atom/RSS).
 type Feed struct {
-	URL           string
-	OnNewRecord   NewItemAction
-	RefreshPeriod time.Duration
+	URL         string
+	OnNewRecord NewItemAction
+	// ActionNames are the names of the actions chained in OnNewRecord, e.g.
+	// the config ones, reported by Explain and the audit trail.
+	ActionNames []string
+	// OnNewRecordCtx runs after OnNewRecord for every new item.
+	OnNewRecordCtx NewItemActionCtx
+	// ActionTimeout bounds each OnNewRecord and OnNewRecordCtx call, zero
+	// means no limit. An action timing out fails with ErrActionTimeout and
+	// keeps running in the background.
+	ActionTimeout time.Duration
+	// Retry retries the delivery of items whose actions failed.
+	Retry *RetryPolicy
+	// Actions run after OnNewRecord for every new item, passing results to
+	// the next ones. The results are stored with the item.
+	Actions []Step
+	// OnBurst receives the items that arrived within CoalesceWindow from
+	// the first one as a single event, in addition to the item actions.
+	OnBurst BurstAction
+	// CoalesceWindow defaults to the refresh period.
+	CoalesceWindow time.Duration
+	// OnNewBatch receives all new items of a poll in one call, after
+	// the item actions were called for each of them. Any of them can be nil.
+	OnNewBatch NewBatchAction
+	// OnFeedChanged is triggered when the feed title, description or link
+	// changes or the URL starts redirecting permanently.
+	OnFeedChanged FeedChangeAction
+	// OnUpdatedRecord is triggered when the content of an already seen item
+	// changes. The old version is the archived one, nil without Archive.
+	OnUpdatedRecord UpdatedItemAction
+	RefreshPeriod   time.Duration
+	// InitialDelay postpones the first poll after the start.
+	InitialDelay time.Duration
+	// Detector decides which items are new, DetectByID if nil.
+	Detector ChangeDetector
+	// MaxItemAge drops the new items published longer ago, e.g. on the
+	// first poll or after the state was reset. The items without dates
+	// are kept.
+	MaxItemAge time.Duration
+	// Priority orders the feeds competing for the workers, the host rate
+	// limit and the dispatchers, the higher first. Under load the feeds of
+	// a negative priority skip the missed polls instead of catching up.
+	Priority int
+	// NotifyWindow suppresses the items whose normalized title or link the
+	// feed triggered within the window, e.g. entries bumped under a new ID.
+	NotifyWindow time.Duration
+	// DeliveryWindows are the periods the actions fire in, any time if
+	// empty. The items detected outside of them are held until one opens.
+	DeliveryWindows []DeliveryWindow
+	// Digest is the name of the FeedAction digest the new items are sent
+	// with instead of triggering the actions one by one.
+	Digest string
+	// Anomalies tracks the posting rate of the feed when set, its bursts
+	// and silences are reported to OnAnomaly.
+	Anomalies *AnomalyDetector
+	OnAnomaly AnomalyAction
+	// EmptyPolicy is how the polls returning no items are handled, see
+	// EmptyPolicy. MaxEmptyPolls is the number of the empty polls in a row
+	// failing the feed with EmptyFail, 1 if zero.
+	EmptyPolicy   EmptyPolicy
+	MaxEmptyPolls int
+	// SortByPublished tolerates the feeds ordering their items by activity
+	// rather than publication, e.g. forums: the items are sorted by the
+	// publication time and only the seen set decides which are new.
+	SortByPublished bool
+	// NewestFirst triggers new items in the feed order instead of the
+	// chronological one.
+	NewestFirst bool
+	// MaxSeen bounds the number of remembered item IDs, DefaultMaxSeen if
+	// zero.
+	MaxSeen int
+	// SeenTTL is how long an item ID is remembered after it left the feed,
+	// DefaultSeenTTL if zero.
+	SeenTTL time.Duration
+	// Headers are added to every feed request.
+	Headers http.Header
+	// Adaptive learns the poll interval from how often the feed publishes
+	// instead of polling every refresh period.
+	Adaptive *AdaptiveInterval
+	// IgnoreCacheHeaders polls every refresh period even if Cache-Control,
+	// Expires or Retry-After of the responses ask to wait longer.
+	IgnoreCacheHeaders bool
+	// Proxy is the URL of the HTTP or SOCKS5 proxy the feed is fetched
+	// through, e.g. socks5://127.0.0.1:9050 for Tor. Host names are
+	// resolved by a SOCKS5 proxy, so onion addresses work.
+	Proxy string
+	// TLS sets the client certificate, extra CAs and pins of the feed.
+	TLS *TLSConfig
+	// Charset is the encoding of the feed documents overriding the declared
+	// one, e.g. "windows-1251", or CharsetAuto to detect it when they aren't
+	// valid UTF-8. The documents are transcoded to UTF-8 before parsing.
+	Charset string
+	// Location is the timezone of the feed, UTC if nil: the dates without
+	// a zone are parsed and the delivery windows without a Location open
+	// in it.
+	Location *time.Location
+	// DateLayouts parse the item dates in nonstandard formats, e.g.
+	// "02.01.2006 15:04". They are tried before the gofeed date parsers.
+	// All item dates are converted to UTC.
+	DateLayouts []string
+	// MaxBodySize bounds the size of the feed document, DefaultMaxBodySize
+	// if zero. Larger documents fail the poll with ErrTooLarge.
+	MaxBodySize int64
+	// FetchTimeout bounds the request of the feed including the body,
+	// DefaultFetchTimeout if zero. Slower fetches fail with ErrFetchTimeout.
+	FetchTimeout time.Duration
+	// Push feeds are only fed by Push and never polled.
+	Push bool
+	// Transform rewrites the items before the filters, see Transform.
+	Transform Transform
+	// Filters drop new items for which any of them returns false.
+	Filters []ItemFilter
+	// Enrichers run in order for every new item passing the filters. An
+	// enricher failing is logged and the item is triggered as it is.
+	Enrichers []Enricher
+	// Source replaces fetching and parsing the URL when set.
+	Source Source
+	// AtomTranslator and RSSTranslator override how the parsed document is
+	// mapped into items, e.g. to take the link from a custom element. The
+	// gofeed defaults are used if nil.
+	AtomTranslator gofeed.Translator
+	RSSTranslator  gofeed.Translator
+	// Parse replaces the parsing of the downloaded document, including
+	// FeedAction.Parser, e.g. to fix up broken XML before calling ParseFeed.
+	Parse ParseFunc
+	// Unshorten resolves the shortened links of the new items and
+	// canonicalizes them before the link check and the deduplication.
+	Unshorten *Unshortener
+	// LinkCheck verifies item links before triggering.
+	LinkCheck LinkCheck
+	// MaxItemsPerPoll caps the number of items triggered per poll, the
+	// newest ones are kept and the rest is handled according to Overflow.
+	// Zero means no limit.
+	MaxItemsPerPoll int
+	Overflow        Overflow
+	// OnOverflow receives the items over the limit with OverflowDigest.
+	OnOverflow NewBatchAction
+	// FirstRun is what to do with the items present when the feed is polled
+	// for the first time, FirstRunSkip by default.
+	FirstRun FirstRun
+	// OnPollStart, OnPollSuccess and OnPollError are called around every
+	// poll of the feed, e.g. to report telemetry.
+	OnPollStart   PollHook
+	OnPollSuccess PollHook
+	OnPollError   PollHook
+	// Profile is a name of the FeedAction profile providing defaults for
+	// the settings left empty.
+	Profile string
+	// Group is a name of the FeedAction group the feed belongs to, see
+	// FeedGroup.
+	Group string
+	// Metadata is arbitrary data about the feed, e.g. the owner team or the
+	// TLP level, added to every item under MetadataPrefix so filters and
+	// actions can use it.
+	Metadata map[string]string
+	// Labels are short key-value tags of the feed, e.g. team=dfir, for
+	// actions to route its items by. Actions get them with ItemFeed.
+	Labels map[string]string
+	// Normalize strips HTML from the item texts, decodes entities, collapses
+	// whitespace and resolves relative links before filters and actions.
+	Normalize bool
+	// Store keeps the state of the feed instead of FeedAction.Store, e.g.
+	// to keep the seen items of busy feeds in Redis. It's scoped to the
+	// Namespace and closed by Run.
+	Store gokv.Store
+
+	// config is the fingerprint of the config entry the feed was built
+	// from, see Config.BuildFeeds.
+	config string
 }
 
-// NewFeed returns a feed by URL with default refresh period of 1 minute.
-func NewFeed(url string, action NewItemAction) *Feed {
-	return &Feed{
+// NewFeed returns a feed by URL with default refresh period of 1 minute,
+// changed by the options.
+func NewFeed(url string, action NewItemAction, opts ...FeedOption) *Feed {
+	f := &Feed{
 		URL:           url,
 		OnNewRecord:   action,
 		RefreshPeriod: 1 * time.Minute,
 	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
 }
 
-// FeedHead is the top item of the feed. It's needed for checking for updates
-// on every poll.
+// FeedHead is the stored state of the feed: its top item and the set of
+// recently seen items. It's needed for checking for updates on every poll.
 type FeedHead struct {
+	// Version is the schema version of the record, see HeadVersion.
+	Version   int    `json:"version"`
 	Title     string `json:"title,omitempty"`
 	Updated   string `json:"last_updated,omitempty"`
 	Published string `json:"published,omitempty"`
+	// Seen maps keys of the recently seen items to the last time they were
+	// present in the feed, see ChangeDetector.
+	Seen map[string]time.Time `json:"seen,omitempty"`
+	// Detector is the name of the ChangeDetector keying Seen, "id" if
+	// empty.
+	Detector string `json:"detector,omitempty"`
+	// FeedTitle, FeedDescription and FeedLink are the feed-level metadata
+	// watched for changes.
+	FeedTitle       string `json:"feed_title,omitempty"`
+	FeedDescription string `json:"feed_description,omitempty"`
+	FeedLink        string `json:"feed_link,omitempty"`
+	// MovedTo is where the feed URL permanently redirects.
+	MovedTo string `json:"moved_to,omitempty"`
+	// Hashes are content hashes of the seen items, kept for feeds with
+	// OnUpdatedRecord.
+	Hashes map[string]string `json:"hashes,omitempty"`
+	// Interval is the moving average of the intervals between items and
+	// LastItem the time of the newest one, kept for adaptive feeds.
+	Interval time.Duration `json:"interval,omitempty"`
+	LastItem time.Time     `json:"last_item,omitempty"`
+	// Activity is the posting rate, kept for feeds with Anomalies.
+	Activity *Activity `json:"activity,omitempty"`
+	// Dropped maps keys of the items of the document the Transform dropped
+	// to the time it did, so they aren't transformed again.
+	Dropped map[string]time.Time `json:"dropped,omitempty"`
 }
 
-// New application builder.
-func New(s gokv.Store, ff ...Feed) (*FeedAction, error) {
-	var err error
-	store := s
-	if store == nil {
-		store, err = bbolt.NewStore(bbolt.DefaultOptions)
+// New application builder. The store is a bbolt database in the working
+// directory unless WithStore or WithStoreDSN is given.
+func New(opts ...Option) (*FeedAction, error) {
+	app := &FeedAction{}
+	for _, opt := range opts {
+		if err := opt(app); err != nil {
+			return nil, err
+		}
+	}
+	if err := app.normalizeFeeds(); err != nil {
+		return nil, err
+	}
+	if app.Store == nil {
+		store, err := bbolt.NewStore(bbolt.DefaultOptions)
 		if err != nil {
 			return nil, fmt.Errorf("bbolt.NewStore: %w", err)
 		}
+		app.Store = store
 	}
+	return app, nil
+}
 
-	app := &FeedAction{
-		Store: store,
-		Feeds: ff,
+// NewWithStore is New with the store and the feeds.
+//
+// Deprecated: use New(WithStore(s), WithFeeds(ff...)).
+func NewWithStore(s gokv.Store, ff ...Feed) (*FeedAction, error) {
+	return New(WithStore(s), WithFeeds(ff...))
+}
+
+// NewWithStoreDSN is New with the store opened by stores.Open, e.g.
+// "bolt:///var/lib/feedtrigger.db".
+//
+// Deprecated: use New(WithStoreDSN(dsn), WithFeeds(ff...)).
+func NewWithStoreDSN(dsn string, ff ...Feed) (*FeedAction, error) {
+	return New(WithStoreDSN(dsn), WithFeeds(ff...))
+}
+
+// logf logs to the Logger of the application.
+func (a *FeedAction) logf(format string, v ...interface{}) {
+	if a.Logger != nil {
+		a.Logger.Printf(format, v...)
+		return
 	}
+	log.Printf(format, v...)
+}
 
-	return app, nil
+// kv returns the store scoped to the namespace.
+func (a *FeedAction) kv() gokv.Store {
+	a.kvOnce.Do(func() {
+		a.namespaced = a.scoped(a.Store)
+	})
+	return a.namespaced
 }
 
-// Run polling and processing loop.
+// scoped returns the store scoped to the namespace with its operations
+// measured.
+func (a *FeedAction) scoped(s gokv.Store) gokv.Store {
+	if a.Namespace != "" {
+		s = stores.Namespace(s, a.Namespace)
+	}
+	slow := a.SlowStoreThreshold
+	if slow == 0 {
+		slow = DefaultSlowStoreThreshold
+	}
+	return measuredStore{Store: s, slow: slow, logf: a.logf}
+}
+
+// Run polling and processing loop. Feeds are polled by a pool of
+// MaxConcurrentPolls workers in the order of their next poll time. A failed
+// poll is recorded in the feed status and retried with a growing delay, see
+// MaxFailureBackoff.
+//
+// When ctx is canceled no new polls are started and Run waits up to
+// ShutdownGracePeriod for the running ones to trigger their items and store
+// the state before closing the store, then returns ctx.Err().
 func (a *FeedAction) Run(ctx context.Context) error {
 	defer a.Store.Close()
+	defer a.closeFeedStores()
+	defer a.flushBursts()
+
+	a.feedsMu.Lock()
+	if err := a.normalizeFeeds(); err != nil {
+		a.feedsMu.Unlock()
+		return err
+	}
+	if err := a.applyProfiles(); err != nil {
+		a.feedsMu.Unlock()
+		return err
+	}
+	if err := a.checkDigests(a.Feeds); err != nil {
+		a.feedsMu.Unlock()
+		return err
+	}
+	feeds := append([]Feed(nil), a.Feeds...)
+	ops := make(chan schedOp)
+	schedDone := make(chan struct{})
+	a.ops, a.schedDone = ops, schedDone
+	a.tenantsCtx = ctx
+	a.feedsMu.Unlock()
+	defer func() {
+		a.feedsMu.Lock()
+		a.ops, a.schedDone = nil, nil
+		a.feedsMu.Unlock()
+	}()
+	if err := a.startTenants(); err != nil {
+		return err
+	}
+	defer a.stopTenants()
+
+	if a.Archive != nil && a.Archive.Store == nil {
+		a.Archive.Store = a.kv()
+	}
+
+	for _, f := range feeds {
+		a.watch(f.URL)
+	}
+	if !a.DryRun {
+		if err := a.purgeDeleted(); err != nil {
+			return err
+		}
+	}
+	if !a.DryRun {
+		if err := a.adoptRenamed(); err != nil {
+			return err
+		}
+	}
+	if r, err := a.Reconcile(); err != nil {
+		a.logf("reconciling the stored state: %v", err)
+	} else if len(r.New) > 0 || len(r.Orphaned) > 0 || len(r.Pruned) > 0 {
+		a.logf("stored state: %d new feeds, %d orphaned, %d pruned", len(r.New), len(r.Orphaned), len(r.Pruned))
+	}
+
+	if a.ExactlyOnce && !a.DryRun {
+		for _, f := range feeds {
+			if _, ok := a.swapper(f.URL); !ok {
+				return fmt.Errorf("exactly-once delivery: the store of %s can't compare and swap", f.URL)
+			}
+		}
+		if err := a.pruneClaims(); err != nil {
+			a.logf("pruning delivery claims: %v", err)
+		}
+	}
+
+	if a.Outbox && !a.DryRun {
+		if err := a.replayOutbox(ctx, feeds); err != nil {
+			return fmt.Errorf("replaying outbox: %w", err)
+		}
+	}
+
+	if a.DeliveryQueue != nil && !a.DryRun {
+		if err := a.DeliveryQueue.open(); err != nil {
+			return err
+		}
+		defer a.DeliveryQueue.close()
+	}
+
+	if a.Cluster != nil && !a.DryRun {
+		if err := a.register(); err != nil {
+			return err
+		}
+		defer a.deregister()
+	}
+
+	workers := a.MaxConcurrentPolls
+	if workers <= 0 {
+		workers = len(feeds)
+	}
+	if workers == 0 {
+		workers = 1
+	}
+
+	// in-flight polls outlive ctx until the grace period is over
+	workCtx, cancelWork := context.WithCancel(context.Background())
+	defer cancelWork()
+
+	dispatchers := a.startDispatchers(workCtx)
+	defer a.closeQueue()
+
 	g, gctx := errgroup.WithContext(ctx)
-	for _, f := range a.Feeds {
-		f := f
+	jobs := make(chan *scheduled)
+	done := make(chan *scheduled)
+	for i := 0; i < workers; i++ {
 		g.Go(func() error {
-			// log.Printf("start polling %s", f.URL)
-			err := a.run(gctx, f) // fail early
-			if err != nil {
-				return err
-			}
-			for range time.NewTicker(f.RefreshPeriod).C {
-				// log.Printf("run on tick %s", f.URL)
-				err := a.run(gctx, f)
-				if err != nil {
-					return err
+			for s := range jobs {
+				if gctx.Err() != nil {
+					return nil
+				}
+				if a.paused(s.feed.URL) || s.feed.Push {
+					select {
+					case done <- s:
+						continue
+					case <-gctx.Done():
+						return nil
+					}
+				}
+				err := a.poll(workCtx, s.feed)
+				switch {
+				case errors.Is(err, ErrBlocked):
+					s.delay = a.blockedBackoff(s.feed)
+					a.logf("%v, next poll in %s", err, s.delay)
+				case errors.Is(err, ErrThrottled):
+					s.delay = a.nextDelay(s.feed)
+					if until := a.cooldown(s.feed.URL); !until.IsZero() {
+						s.delay = until.Sub(a.now())
+					}
+					if s.delay <= 0 {
+						s.delay = 2 * s.feed.RefreshPeriod
+					}
+					a.logf("%v, next poll in %s", err, s.delay)
+				case err != nil && gctx.Err() != nil:
+					return nil
+				case err != nil:
+					// only the cancellation of ctx stops Run, a failed poll is
+					// retried later
+					s.delay = a.failureBackoff(s.feed)
+					a.logf("%v, next poll in %s", err, s.delay)
+				default:
+					a.unblocked(s.feed)
+					s.delay = a.nextDelay(s.feed)
+					if d := a.adaptiveDelay(s.feed); d > s.delay {
+						s.delay = d
+					}
+				}
+				select {
+				case done <- s:
+				case <-gctx.Done():
+					return nil
 				}
 			}
 			return nil
 		})
 	}
+	if a.Canary != nil {
+		g.Go(func() error {
+			a.Canary.run(gctx, a)
+			return nil
+		})
+	}
+	if a.Cluster != nil && !a.DryRun {
+		g.Go(func() error {
+			a.heartbeats(gctx)
+			return nil
+		})
+	}
+	if a.DeliveryQueue != nil && !a.DryRun {
+		g.Go(func() error {
+			a.replayDeliveries(gctx)
+			return nil
+		})
+	}
+	if !a.DryRun {
+		g.Go(func() error {
+			a.releaseHeld(gctx)
+			return nil
+		})
+		for _, d := range a.Digests {
+			d := d
+			g.Go(func() error {
+				a.sendDigests(gctx, d)
+				return nil
+			})
+		}
+	}
+	if a.RemoteFeeds != nil {
+		g.Go(func() error {
+			a.RemoteFeeds.run(gctx, a)
+			return nil
+		})
+	}
+	g.Go(func() error {
+		defer close(jobs)
+		defer close(schedDone)
+		a.schedule(gctx, feeds, ops, jobs, done)
+		return nil
+	})
+
+	errc := make(chan error, 1)
+	go func() {
+		err := g.Wait()
+		// deliver the queued items within the grace period too
+		a.closeQueue()
+		dispatchers.Wait()
+		errc <- err
+	}()
+
+	select {
+	case err := <-errc:
+		if err == nil {
+			err = ctx.Err()
+		}
+		return err
+	case <-gctx.Done():
+	}
+
+	grace := a.ShutdownGracePeriod
+	if grace <= 0 {
+		grace = DefaultShutdownGracePeriod
+	}
+	t := a.clock().NewTimer(grace)
+	defer t.Stop()
+	select {
+	case err := <-errc:
+		if err == nil {
+			err = ctx.Err()
+		}
+		return err
+	case <-t.C():
+		cancelWork()
+		return fmt.Errorf("polls still running after the %s grace period", grace)
+	}
+}
+
+// poll runs a poll of the feed between its lifecycle hooks.
+func (a *FeedAction) poll(ctx context.Context, f Feed) error {
+	if a.Cluster != nil {
+		owner, ok := a.Cluster.assigned(f.URL)
+		if !ok {
+			a.leased(f.URL, owner)
+			return nil
+		}
+		a.leased(f.URL, "")
+	}
+	if a.Leases != nil && !a.DryRun {
+		holder, release, err := a.acquire(ctx, f.URL)
+		if err != nil {
+			a.logf("%s: %v", f.URL, err)
+			return nil
+		}
+		a.leased(f.URL, holder)
+		if release == nil {
+			return nil
+		}
+		defer release()
+	}
+	info := PollInfo{Feed: f.URL, Start: a.now()}
+	if f.OnPollStart != nil {
+		f.OnPollStart(info)
+	}
+	err := a.run(ctx, f, &info)
+	info.Duration = a.now().Sub(info.Start)
+	info.Cost = a.state(f.URL).takeCost()
+	info.Err = err
+	a.polled(info)
+	if a.OnPoll != nil {
+		a.OnPoll(info)
+	}
+	if err != nil {
+		a.publish(Event{Type: EventPollError, Feed: f.URL, Poll: &info})
+	}
+	if to := NormalizeURL(a.state(f.URL).movedTo()); err == nil && to != "" && to != f.URL && a.FollowMoves && !a.DryRun {
+		if err := a.moveFeed(f, to); err != nil {
+			a.logf("%s: %v", f.URL, err)
+		}
+	}
+	if !a.DryRun {
+		if err := a.recordStats(info); err != nil {
+			a.logf("%s: %v", f.URL, err)
+		}
+	}
+	switch {
+	case err != nil && f.OnPollError != nil:
+		f.OnPollError(info)
+	case err == nil && f.OnPollSuccess != nil:
+		f.OnPollSuccess(info)
+	}
+	return err
+}
+
+func (a *FeedAction) run(ctx context.Context, f Feed, info *PollInfo) error {
+	if until := a.cooldown(f.URL); !until.IsZero() {
+		return pipelineError(ErrFetch, f.URL, "", fmt.Errorf("%s: %s throttles the requests until %s: %w",
+			f.URL, hostOf(f.URL), until.Format(time.RFC3339), ErrThrottled))
+	}
+	if err := a.waitHost(ctx, f.URL, f.Priority); err != nil {
+		return err
+	}
 
-	return g.Wait()
+	feed, err := a.fetch(ctx, f)
+	if err != nil {
+		return pipelineError(ErrFetch, f.URL, "", fmt.Errorf("fetching feed: %w", err))
+	}
+	return a.process(ctx, f, feed, info, false)
 }
 
-func (a *FeedAction) run(ctx context.Context, f Feed) error {
-	feed, err := gofeed.NewParser().ParseURLWithContext(f.URL, ctx)
+// process triggers the new items of the fetched or pushed feed document
+// and stores its state. Pushed items are new on the first push too.
+func (a *FeedAction) process(ctx context.Context, f Feed, feed *gofeed.Feed, info *PollInfo, pushed bool) error {
+	s := a.state(f.URL)
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+
+	if a.Watchlist != nil {
+		a.Watchlist.refresh(a.logf)
+	}
+	if feed == nil {
+		feed = &gofeed.Feed{}
+	}
+	if empty, err := a.empty(f, feed, info); empty {
+		return err
+	}
+	f.normalize(feed)
+
+	head, found, err := a.loadHead(f.URL)
 	if err != nil {
-		return fmt.Errorf("fetching feed: %w", err)
+		return pipelineError(ErrStore, f.URL, "", fmt.Errorf("get from store: %w", err))
+	}
+	if !found && !a.DryRun {
+		if err := a.remember(f.URL); err != nil {
+			return pipelineError(ErrStore, f.URL, "", err)
+		}
+	}
+
+	if !a.transform(f, feed, &head, a.now().UTC()) {
+		if a.DryRun {
+			return nil
+		}
+		// keep the top item, only the dropped ones changed
+		top := &gofeed.Item{Title: head.Title, Updated: head.Updated, Published: head.Published}
+		return a.storeHead(f, &head, top)
 	}
+	f.annotate(feed.Items)
+	f.sortItems(feed)
+	if a.FetchBranding && !a.DryRun {
+		a.brand(ctx, f, feed)
+	}
+	info.Items = len(feed.Items)
 	zitem := feed.Items[0]
 
-	var head FeedHead
-	found, err := a.Store.Get(f.URL, &head)
-	if err != nil {
-		return fmt.Errorf("get from store: %w", err)
+	if err := a.detectChanges(f, &head, feed, found); err != nil {
+		return err
 	}
 
-	if !found { //first run
-		a.Lock()
-		err := a.Store.Set(f.URL, &FeedHead{
-			Title:     zitem.Title,
-			Updated:   zitem.Updated,
-			Published: zitem.Published,
-		})
-		if err != nil {
-			return fmt.Errorf("storing: %w", err)
+	now := a.now().UTC()
+	var fresh, edited []*gofeed.Item
+	if !found && !pushed { //first run
+		head.observe(f, feed.Items, now)
+		fresh = f.FirstRun.backfill(feed.Items)
+		if len(fresh) == 0 && a.DryRun {
+			a.logf("dry run: %s: first poll, %d items would be marked seen", f.URL, len(feed.Items))
+			return nil
+		}
+		if len(fresh) == 0 {
+			head.markSeen(f, feed.Items, now)
+			return a.storeHead(f, &head, zitem)
+		}
+	} else {
+		if found {
+			head.redetect(f, feed.Items, now)
+		}
+		fresh = head.unseen(f, feed.Items)
+		head.observe(f, fresh, now)
+		if anomalies := head.track(f, fresh, now); len(anomalies) > 0 && !a.DryRun {
+			a.reportAnomalies(f, anomalies)
+		}
+		for _, i := range without(feed.Items, fresh) {
+			a.skip(f, i, SkipSeen, "")
+		}
+		if f.OnUpdatedRecord != nil {
+			edited = a.filter(f, head.edited(f, feed.Items))
+		}
+	}
+	fresh = a.dropOld(f, a.filter(f, fresh), now)
+	if !f.NewestFirst {
+		for i, j := 0, len(fresh)-1; i < j; i, j = i+1, j-1 {
+			fresh[i], fresh[j] = fresh[j], fresh[i]
+		}
+	}
+
+	fresh, rest := f.limit(fresh)
+	if a.DryRun {
+		if len(rest) > 0 {
+			a.logf("dry run: %s: %d items over the limit", f.URL, len(rest))
+		}
+		for _, item := range fresh {
+			a.logf("dry run: %s: would trigger %q %s", f.URL, item.Title, item.Link)
+		}
+		for _, item := range edited {
+			a.logf("dry run: %s: would trigger update of %q %s", f.URL, item.Title, item.Link)
 		}
-		a.Unlock()
 		return nil
 	}
 
-	for i := 0; i < len(feed.Items); i++ {
-		if head.Title != feed.Items[i].Title {
-			err = f.OnNewRecord(feed.Items[i])
-			if err != nil {
-				return fmt.Errorf("trigger func: %w", err)
+	if err := a.overflow(f, rest); err != nil {
+		return err
+	}
+
+	if a.Outbox {
+		// the items are delivered from the outbox even if the run is
+		// interrupted, so the state can move on right away
+		if err := a.enqueue(f, fresh); err != nil {
+			return pipelineError(ErrStore, f.URL, "", err)
+		}
+		head.markSeen(f, feed.Items, now)
+		if err := a.storeHead(f, &head, zitem); err != nil {
+			return err
+		}
+	}
+
+	if n, ok, err := a.queue(ctx, f, fresh); ok {
+		info.Triggered += n
+		if err != nil {
+			if a.Outbox {
+				return err
 			}
-		} else {
-			break
+			head.markSeen(f, without(feed.Items, fresh[n:]), now)
+			if err := a.storeHead(f, &head, zitem); err != nil {
+				return err
+			}
+			return err
 		}
+		fresh = nil
+	}
+
+	var delivered []*gofeed.Item
+	for n, item := range fresh {
+		if ctx.Err() != nil {
+			if a.Outbox {
+				return ctx.Err()
+			}
+			// keep the progress, the rest is triggered on the next run
+			head.markSeen(f, without(feed.Items, fresh[n:]), now)
+			if err := a.storeHead(f, &head, zitem); err != nil {
+				return err
+			}
+			return ctx.Err()
+		}
+		id := ItemID(item)
+		item, err := a.handle(ctx, f, item)
+		if err != nil {
+			return err
+		}
+		if a.Outbox {
+			if err := a.dequeue(f.URL, id); err != nil {
+				return pipelineError(ErrStore, f.URL, id, err)
+			}
+		}
+		if item != nil {
+			delivered = append(delivered, item)
+			info.Triggered++
+			if p := item.PublishedParsed; p != nil && p.After(info.LastPublished) {
+				info.LastPublished = *p
+			}
+		}
+	}
+
+	for _, item := range edited {
+		if err := a.update(f, item); err != nil {
+			return err
+		}
+	}
+
+	if f.OnNewBatch != nil && len(delivered) > 0 {
+		batch := make([]*gofeed.Item, len(delivered))
+		for n, item := range delivered {
+			batch[n] = a.redact(item)
+		}
+		if err := f.OnNewBatch(batch); err != nil {
+			return pipelineError(ErrAction, f.URL, "", fmt.Errorf("batch trigger func: %w", err))
+		}
+	}
+
+	head.markSeen(f, feed.Items, now)
+	return a.storeHead(f, &head, zitem)
+}
+
+// handle checks the link of the new item and triggers it unless a duplicate
+// was triggered already, returning the item as delivered or nil if it was
+// dropped or put to the delivery or the dead-letter queue.
+func (a *FeedAction) handle(ctx context.Context, f Feed, item *gofeed.Item) (*gofeed.Item, error) {
+	item = a.unshorten(ctx, f, item)
+	item, ok := a.checkLink(ctx, f, item)
+	if !ok {
+		return nil, nil
+	}
+	ok, release, err := a.claim(f, item)
+	if err != nil {
+		return nil, pipelineError(ErrStore, f.URL, ItemID(item), err)
+	}
+	if !ok {
+		a.skip(f, item, SkipDuplicate, "")
+		return nil, nil
+	}
+	ok, unnotify, err := a.notify(f, item, replaying(ctx))
+	if err != nil {
+		release()
+		return nil, pipelineError(ErrStore, f.URL, ItemID(item), err)
+	}
+	if !ok {
+		release()
+		a.skip(f, item, SkipRenotified, "")
+		return nil, nil
+	}
+	item = a.enrich(ctx, f, item)
+	a.watchlist(a.redact(item))
+	if d := a.digest(f); d != nil && !IsCanary(item) {
+		a.audit(f, item, AuditEntry{Status: AuditDeferred, Detail: "digest " + d.Name})
+		return nil, pipelineError(ErrStore, f.URL, ItemID(item), a.buffer(d, f, item))
+	}
+	if !IsCanary(item) {
+		held, err := a.holding(f)
+		if err != nil {
+			release()
+			unnotify()
+			return nil, pipelineError(ErrStore, f.URL, ItemID(item), err)
+		}
+		if held || !f.inWindow(a.now()) {
+			// keep the order behind the items held already
+			a.audit(f, item, AuditEntry{Status: AuditDeferred, Detail: "held"})
+			return nil, pipelineError(ErrStore, f.URL, ItemID(item), a.hold(f, item))
+		}
+	}
+	q := a.DeliveryQueue
+	if q != nil && q.pending(f.URL) {
+		// keep the order behind the items waiting for the actions
+		a.audit(f, item, AuditEntry{Status: AuditDeferred, Detail: "queued"})
+		return nil, pipelineError(ErrStore, f.URL, ItemID(item), q.push(f.URL, item, nil, a.now().UTC()))
+	}
+	claimed, attempts, err := a.triggerOnce(ctx, f, item)
+	if err == nil && !claimed {
+		return nil, nil
+	}
+	if err != nil && q != nil {
+		a.audit(f, item, AuditEntry{Status: AuditDeferred, Detail: "queued for retry"})
+		return nil, pipelineError(ErrStore, f.URL, ItemID(item), q.push(f.URL, item, err, a.now().UTC()))
+	}
+	if err != nil {
+		release()
+		unnotify()
+	}
+	if err != nil && a.DeadLetter {
+		a.audit(f, item, AuditEntry{Status: AuditDeadLetter, Error: err.Error()})
+		return nil, pipelineError(ErrStore, f.URL, ItemID(item), a.bury(f, item, err, attempts))
 	}
-	a.Lock()
-	err = a.Store.Set(f.URL, &FeedHead{
-		Title:     zitem.Title,
-		Updated:   zitem.Updated,
-		Published: zitem.Published,
-	})
 	if err != nil {
-		return fmt.Errorf("storing head: %w", err)
+		return nil, pipelineError(ErrAction, f.URL, ItemID(item), fmt.Errorf("trigger func: %w", err))
+	}
+	return item, nil
+}
+
+// update triggers OnUpdatedRecord for the edited item and archives the new
+// version.
+func (a *FeedAction) update(f Feed, i *gofeed.Item) error {
+	var old *gofeed.Item
+	if a.Archive != nil {
+		archived, found, err := a.Archive.Get(f.URL, ItemID(i))
+		if err != nil {
+			return pipelineError(ErrStore, f.URL, ItemID(i), fmt.Errorf("get archived item: %w", err))
+		}
+		if found {
+			old = archived.Item
+		}
+	}
+	i = a.redact(i)
+	if err := f.OnUpdatedRecord(old, i); err != nil {
+		return pipelineError(ErrAction, f.URL, ItemID(i), fmt.Errorf("update trigger func: %w", err))
+	}
+	if a.Archive != nil {
+		return a.Archive.Put(f.URL, i)
+	}
+	return nil
+}
+
+// enrich returns a copy of the item with the feed enrichers applied, the
+// item itself if there are none.
+func (a *FeedAction) enrich(ctx context.Context, f Feed, i *gofeed.Item) *gofeed.Item {
+	if len(f.Enrichers) == 0 {
+		return i
+	}
+	c := copyItem(i)
+	for n, e := range f.Enrichers {
+		if err := e(ctx, c); err != nil {
+			a.logf("%s: enricher %d: %s: %v", f.URL, n, ItemID(i), err)
+		}
+	}
+	return c
+}
+
+// filter returns items passing all feed filters.
+func (a *FeedAction) filter(f Feed, items []*gofeed.Item) []*gofeed.Item {
+	filters := a.filters(f)
+	if len(filters) == 0 {
+		return items
+	}
+	var passed []*gofeed.Item
+	for _, i := range items {
+		ok := true
+		for n, fn := range filters {
+			if !fn(i) {
+				a.skip(f, i, SkipFiltered, fmt.Sprintf("filter %d", n))
+				ok = false
+				break
+			}
+		}
+		if ok {
+			passed = append(passed, i)
+		}
 	}
-	a.Unlock()
+	return passed
+}
 
+// storeHead saves the feed state with top as the head item.
+func (a *FeedAction) storeHead(f Feed, head *FeedHead, top *gofeed.Item) error {
+	head.Version = HeadVersion
+	head.Detector = f.detector().Name()
+	head.Title = top.Title
+	head.Updated = top.Updated
+	head.Published = top.Published
+
+	s := a.state(f.URL)
+	s.headMu.Lock()
+	defer s.headMu.Unlock()
+	if err := a.feedKV(f.URL).Set(f.URL, head); err != nil {
+		return pipelineError(ErrStore, f.URL, "", fmt.Errorf("storing head: %w", err))
+	}
+	a.adapt(f, head)
 	return nil
 }
 
+// trigger passes a new item to the feed action.
+func (a *FeedAction) trigger(ctx context.Context, f Feed, i *gofeed.Item) error {
+	_, _, err := a.triggerOnce(ctx, f, i)
+	return err
+}
+
+// triggerOnce is trigger returning false if the item was skipped as
+// claimed by another instance, see ExactlyOnce, and the number of delivery
+// attempts.
+func (a *FeedAction) triggerOnce(ctx context.Context, f Feed, i *gofeed.Item) (bool, int, error) {
+	i = a.redact(i)
+	ok, finish, err := a.claimDelivery(f, i)
+	if err != nil {
+		return false, 0, pipelineError(ErrStore, f.URL, ItemID(i), err)
+	}
+	if !ok {
+		a.skip(f, i, SkipClaimed, "")
+		return false, 0, nil
+	}
+	if a.ExactlyOnce {
+		i = copyItem(i)
+		setCustom(i, IdempotencyKeyField, IdempotencyKey(i))
+	}
+	attempts, err := a.deliverRetrying(ctx, f, i)
+	finish(err == nil)
+	if err != nil {
+		a.audit(f, i, AuditEntry{Status: AuditFailed, Actions: actionNames(f), Attempts: attempts, Error: err.Error()})
+		return true, attempts, err
+	}
+	a.audit(f, i, AuditEntry{Status: AuditDelivered, Actions: actionNames(f), Attempts: attempts})
+	if !IsCanary(i) {
+		now := a.now()
+		a.recent.add(Delivery{Feed: f.URL, Title: i.Title, Link: i.Link, At: now})
+		a.publish(Event{Type: EventNewItem, Feed: f.URL, Time: now, Item: i})
+		if a.OnDelivered != nil {
+			a.OnDelivered(f.URL, i)
+		}
+	}
+	a.coalesce(f, i)
+	if a.Archive != nil && !IsCanary(i) {
+		return true, attempts, a.Archive.Put(f.URL, i)
+	}
+	return true, attempts, nil
+}
+
+// deliver runs the feed actions for the item once MaxConcurrentActions
+// allows.
+func (a *FeedAction) deliver(ctx context.Context, f Feed, i *gofeed.Item) error {
+	if a.MaxConcurrentActions > 0 {
+		a.actionsOnce.Do(func() {
+			a.actions = make(chan struct{}, a.MaxConcurrentActions)
+		})
+		select {
+		case a.actions <- struct{}{}:
+			defer func() { <-a.actions }()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	start := a.now()
+	defer func() { a.charge(f.URL, PollCost{Actions: a.now().Sub(start)}) }()
+	if f.OnNewRecord != nil {
+		if err := call(ctx, f, i, WithContext(f.OnNewRecord)); err != nil {
+			return err
+		}
+	}
+	if f.OnNewRecordCtx != nil {
+		if err := call(withFeed(ctx, f), f, i, f.OnNewRecordCtx); err != nil {
+			return err
+		}
+	}
+	return a.runSteps(f, i)
+}
+
+// ErrActionTimeout is returned when an action runs longer than
+// Feed.ActionTimeout.
+var ErrActionTimeout = errors.New("action timed out")
+
+// call runs the action within the feed ActionTimeout.
+func call(ctx context.Context, f Feed, i *gofeed.Item, fn NewItemActionCtx) error {
+	if f.ActionTimeout <= 0 {
+		return fn(ctx, i)
+	}
+	ctx, cancel := context.WithTimeout(ctx, f.ActionTimeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- fn(ctx, i)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("%w after %s", ErrActionTimeout, f.ActionTimeout)
+		}
+		return ctx.Err()
+	}
+}
+
+// waitHost blocks until the per-host rate limit allows fetching url, after
+// the waiting fetches of a higher priority.
+func (a *FeedAction) waitHost(ctx context.Context, url string, priority int) error {
+	if a.HostRateLimit <= 0 {
+		return nil
+	}
+	a.limiterOnce.Do(func() {
+		a.limiter = newHostLimiter(a.HostRateLimit, a.HostBurst, a.clock())
+	})
+	return a.limiter.Wait(ctx, url, priority)
+}
+
 // Person from the feed.
 type Person struct {
 	*gofeed.Person
 }
 
-/// NewPerson gives us a builder pattern.
+// NewPerson gives us a builder pattern.
 func NewPerson(p *gofeed.Person) *Person {
 	return &Person{p}
 }
@@ -0,0 +1,135 @@
+package feedtriggertest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"ilya.app/feedtrigger"
+)
+
+// Clock is a virtual feedtrigger.Clock: its timers and tickers fire only
+// when the test advances it.
+type Clock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []*waiter
+}
+
+// NewClock returns a clock set to the time.
+func NewClock(now time.Time) *Clock {
+	return &Clock{now: now}
+}
+
+type waiter struct {
+	clock  *Clock
+	at     time.Time
+	period time.Duration
+	c      chan time.Time
+	f      func()
+}
+
+// Now implements feedtrigger.Clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTimer implements feedtrigger.Clock.
+func (c *Clock) NewTimer(d time.Duration) feedtrigger.Timer {
+	return c.add(&waiter{at: c.Now().Add(d), c: make(chan time.Time, 1)})
+}
+
+// NewTicker implements feedtrigger.Clock.
+func (c *Clock) NewTicker(d time.Duration) feedtrigger.Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+	return ticker{c.add(&waiter{at: c.Now().Add(d), period: d, c: make(chan time.Time, 1)})}
+}
+
+// AfterFunc implements feedtrigger.Clock.
+func (c *Clock) AfterFunc(d time.Duration, f func()) feedtrigger.Timer {
+	return c.add(&waiter{at: c.Now().Add(d), f: f})
+}
+
+func (c *Clock) add(w *waiter) *waiter {
+	w.clock = c
+	c.mu.Lock()
+	c.waiters = append(c.waiters, w)
+	c.mu.Unlock()
+	return w
+}
+
+// Advance moves the clock forward, firing the timers and tickers due in
+// order.
+func (c *Clock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set moves the clock to the time, firing the timers and tickers due.
+func (c *Clock) Set(t time.Time) {
+	for {
+		c.mu.Lock()
+		sort.SliceStable(c.waiters, func(i, j int) bool { return c.waiters[i].at.Before(c.waiters[j].at) })
+		if len(c.waiters) == 0 || c.waiters[0].at.After(t) {
+			if t.After(c.now) {
+				c.now = t
+			}
+			c.mu.Unlock()
+			return
+		}
+		w := c.waiters[0]
+		c.now = w.at
+		if w.period > 0 {
+			w.at = w.at.Add(w.period)
+		} else {
+			c.waiters = c.waiters[1:]
+		}
+		now := c.now
+		c.mu.Unlock()
+
+		switch {
+		case w.f != nil:
+			go w.f()
+		default:
+			// like time.Ticker, drop the ticks of a slow receiver
+			select {
+			case w.c <- now:
+			default:
+			}
+		}
+	}
+}
+
+// Waiters returns the number of pending timers and tickers, e.g. to wait
+// until the code under test blocks on the clock before advancing it.
+func (c *Clock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.waiters)
+}
+
+// C implements feedtrigger.Timer and feedtrigger.Ticker.
+func (w *waiter) C() <-chan time.Time {
+	return w.c
+}
+
+// Stop implements feedtrigger.Timer.
+func (w *waiter) Stop() bool {
+	c := w.clock
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for n, o := range c.waiters {
+		if o == w {
+			c.waiters = append(c.waiters[:n], c.waiters[n+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+type ticker struct{ *waiter }
+
+func (t ticker) Stop() { t.waiter.Stop() }
@@ -0,0 +1,62 @@
+package feedtriggertest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// Collector is an action recording the items it's called with.
+type Collector struct {
+	// Err is returned by Action, e.g. to test retries.
+	Err error
+
+	mu    sync.Mutex
+	items []*gofeed.Item
+	added chan struct{}
+}
+
+// Action records the item. It's a feedtrigger.NewItemAction.
+func (c *Collector) Action(i *gofeed.Item) error {
+	c.mu.Lock()
+	c.items = append(c.items, i)
+	if c.added != nil {
+		close(c.added)
+		c.added = nil
+	}
+	err := c.Err
+	c.mu.Unlock()
+	return err
+}
+
+// Items returns the items recorded so far.
+func (c *Collector) Items() []*gofeed.Item {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]*gofeed.Item(nil), c.items...)
+}
+
+// Wait waits up to the timeout for n items to be recorded and returns the
+// recorded items.
+func (c *Collector) Wait(n int, timeout time.Duration) []*gofeed.Item {
+	deadline := time.After(timeout)
+	for {
+		c.mu.Lock()
+		if len(c.items) >= n {
+			items := append([]*gofeed.Item(nil), c.items...)
+			c.mu.Unlock()
+			return items
+		}
+		if c.added == nil {
+			c.added = make(chan struct{})
+		}
+		added := c.added
+		c.mu.Unlock()
+		select {
+		case <-added:
+		case <-deadline:
+			return c.Items()
+		}
+	}
+}
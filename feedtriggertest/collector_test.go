@@ -0,0 +1,38 @@
+package feedtriggertest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+func TestCollector(t *testing.T) {
+	c := &Collector{}
+	go func() {
+		for _, id := range []string{"1", "2", "3"} {
+			time.Sleep(time.Millisecond)
+			c.Action(&gofeed.Item{GUID: id})
+		}
+	}()
+	items := c.Wait(3, 5*time.Second)
+	if len(items) != 3 || items[0].GUID != "1" || items[2].GUID != "3" {
+		t.Fatalf("items %v", items)
+	}
+	if got := c.Items(); len(got) != 3 {
+		t.Errorf("%d items", len(got))
+	}
+
+	if items := c.Wait(4, 10*time.Millisecond); len(items) != 3 {
+		t.Errorf("timed out wait returned %d items", len(items))
+	}
+
+	c.Err = errors.New("failed")
+	if err := c.Action(&gofeed.Item{GUID: "4"}); err != c.Err {
+		t.Errorf("error %v, want %v", err, c.Err)
+	}
+	if got := c.Items(); len(got) != 4 {
+		t.Errorf("failed call not recorded: %d items", len(got))
+	}
+}
@@ -0,0 +1,260 @@
+// Package feedtriggertest provides helpers for testing feedtrigger
+// applications and actions without network access: a feed server playing
+// scripted snapshots, a recording store and an action collecting items.
+package feedtriggertest
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+// Format is the syntax the server renders the feed in.
+type Format int
+
+// Formats.
+const (
+	Atom Format = iota
+	RSS
+)
+
+// Item is an entry of the served feed.
+type Item struct {
+	ID        string
+	Title     string
+	Link      string
+	Content   string
+	Published time.Time
+}
+
+// Server serves a feed whose items are changed by the test between polls.
+// It answers conditional requests with 304 Not Modified while the feed is
+// unchanged, and scripted responses queued with Respond take precedence
+// over the feed, one per request.
+type Server struct {
+	*httptest.Server
+	Format Format
+	Title  string
+
+	started time.Time
+
+	mu       sync.Mutex
+	items    []Item
+	script   []int
+	requests int
+}
+
+// NewServer starts a server of the feed with the items, newest first.
+func NewServer(format Format, items ...Item) *Server {
+	s := &Server{
+		Format: format,
+		Title:  "feedtriggertest",
+		// the feed date is fixed to keep the unchanged feed identical
+		started: time.Now(),
+		items:   append([]Item(nil), items...),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Append publishes the items on top of the feed.
+func (s *Server) Append(items ...Item) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items = append(append([]Item(nil), items...), s.items...)
+}
+
+// Remove unpublishes the items of the IDs.
+func (s *Server) Remove(ids ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	kept := s.items[:0]
+	for _, i := range s.items {
+		if !contains(ids, i.ID) {
+			kept = append(kept, i)
+		}
+	}
+	s.items = kept
+}
+
+// Reorder moves the items of the IDs to the top of the feed in the order
+// given, keeping the rest after them.
+func (s *Server) Reorder(ids ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var top, rest []Item
+	for _, id := range ids {
+		for _, i := range s.items {
+			if i.ID == id {
+				top = append(top, i)
+			}
+		}
+	}
+	for _, i := range s.items {
+		if !contains(ids, i.ID) {
+			rest = append(rest, i)
+		}
+	}
+	s.items = append(top, rest...)
+}
+
+// Items returns the items of the feed.
+func (s *Server) Items() []Item {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Item(nil), s.items...)
+}
+
+// Respond queues responses of the statuses for the next requests, e.g.
+// Respond(500, 500, 304) fails twice and then claims the feed unchanged.
+func (s *Server) Respond(statuses ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.script = append(s.script, statuses...)
+}
+
+// Requests returns the number of requests served.
+func (s *Server) Requests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests++
+	status := 0
+	if len(s.script) > 0 {
+		status, s.script = s.script[0], s.script[1:]
+	}
+	body, err := s.render()
+	s.mu.Unlock()
+	if status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	sum := sha1.Sum(body)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if s.Format == RSS {
+		w.Header().Set("Content-Type", "application/rss+xml")
+	} else {
+		w.Header().Set("Content-Type", "application/atom+xml")
+	}
+	w.Write(body)
+}
+
+func (s *Server) render() ([]byte, error) {
+	var v interface{}
+	switch s.Format {
+	case RSS:
+		feed := rss{Version: "2.0", Channel: rssChannel{Title: s.Title, Link: s.URL}}
+		for _, i := range s.items {
+			feed.Channel.Items = append(feed.Channel.Items, rssItem{
+				GUID:        i.ID,
+				Title:       i.Title,
+				Link:        i.Link,
+				Description: i.Content,
+				PubDate:     date(i.Published, time.RFC1123Z),
+			})
+		}
+		v = feed
+	case Atom:
+		feed := atom{Title: s.Title, ID: s.URL, Updated: s.started.UTC().Format(time.RFC3339)}
+		for _, i := range s.items {
+			e := atomEntry{
+				ID:        i.ID,
+				Title:     i.Title,
+				Content:   i.Content,
+				Published: date(i.Published, time.RFC3339),
+				Updated:   date(i.Published, time.RFC3339),
+			}
+			if i.Link != "" {
+				e.Link = &atomLink{Href: i.Link}
+			}
+			feed.Entries = append(feed.Entries, e)
+		}
+		if len(s.items) > 0 && !s.items[0].Published.IsZero() {
+			feed.Updated = s.items[0].Published.UTC().Format(time.RFC3339)
+		}
+		v = feed
+	default:
+		return nil, fmt.Errorf("unknown format %d", s.Format)
+	}
+	b, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), b...), nil
+}
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title string    `xml:"title"`
+	Link  string    `xml:"link"`
+	Items []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	GUID        string `xml:"guid,omitempty"`
+	Title       string `xml:"title,omitempty"`
+	Link        string `xml:"link,omitempty"`
+	Description string `xml:"description,omitempty"`
+	PubDate     string `xml:"pubDate,omitempty"`
+}
+
+type atom struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	ID        string    `xml:"id"`
+	Title     string    `xml:"title"`
+	Link      *atomLink `xml:"link,omitempty"`
+	Content   string    `xml:"content,omitempty"`
+	Published string    `xml:"published,omitempty"`
+	Updated   string    `xml:"updated,omitempty"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+}
+
+func date(t time.Time, layout string) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(layout)
+}
+
+func contains(ids []string, id string) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,112 @@
+package feedtriggertest
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// get requests the feed, conditionally on the etag if set, and returns the
+// status, the etag and the IDs of the served items.
+func get(t *testing.T, s *Server, etag string) (int, string, []string) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, s.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return resp.StatusCode, resp.Header.Get("ETag"), nil
+	}
+
+	var ids []string
+	switch s.Format {
+	case RSS:
+		var feed rss
+		if err := xml.Unmarshal(body, &feed); err != nil {
+			t.Fatal(err)
+		}
+		for _, i := range feed.Channel.Items {
+			ids = append(ids, i.GUID)
+		}
+	case Atom:
+		var feed atom
+		if err := xml.Unmarshal(body, &feed); err != nil {
+			t.Fatal(err)
+		}
+		for _, e := range feed.Entries {
+			ids = append(ids, e.ID)
+		}
+	}
+	return resp.StatusCode, resp.Header.Get("ETag"), ids
+}
+
+func TestServer(t *testing.T) {
+	for _, format := range []Format{Atom, RSS} {
+		published := time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+		s := NewServer(format,
+			Item{ID: "2", Title: "Two", Published: published},
+			Item{ID: "1", Title: "One", Published: published.Add(-time.Hour)})
+
+		check := func(step string, want ...string) string {
+			t.Helper()
+			status, etag, ids := get(t, s, "")
+			if status != http.StatusOK {
+				t.Fatalf("%d: %s: status %d", format, step, status)
+			}
+			if !reflect.DeepEqual(ids, want) {
+				t.Fatalf("%d: %s: items %v, want %v", format, step, ids, want)
+			}
+			return etag
+		}
+		check("start", "2", "1")
+		s.Append(Item{ID: "4"}, Item{ID: "3"})
+		check("append", "4", "3", "2", "1")
+		s.Remove("3", "1")
+		check("remove", "4", "2")
+		s.Append(Item{ID: "5"})
+		s.Reorder("2", "5")
+		etag := check("reorder", "2", "5", "4")
+		if ids := s.Items(); len(ids) != 3 || ids[0].Title != "Two" {
+			t.Errorf("%d: items %v", format, ids)
+		}
+
+		if status, _, _ := get(t, s, etag); status != http.StatusNotModified {
+			t.Errorf("%d: unchanged feed: status %d, want 304", format, status)
+		}
+		s.Append(Item{ID: "6"})
+		if status, _, _ := get(t, s, etag); status != http.StatusOK {
+			t.Errorf("%d: changed feed: status %d, want 200", format, status)
+		}
+		if got := s.Requests(); got != 6 {
+			t.Errorf("%d: %d requests, want 6", format, got)
+		}
+		s.Close()
+	}
+}
+
+func TestServerRespond(t *testing.T) {
+	s := NewServer(RSS, Item{ID: "1"})
+	defer s.Close()
+	s.Respond(http.StatusInternalServerError, http.StatusNotModified)
+	s.Respond(http.StatusTooManyRequests)
+	for _, want := range []int{500, 304, 429, 200, 200} {
+		if status, _, _ := get(t, s, ""); status != want {
+			t.Errorf("status %d, want %d", status, want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package feedtriggertest
+
+import (
+	"encoding/json"
+	"sync"
+
+	"ilya.app/feedtrigger/stores"
+)
+
+// Op is a write recorded by Recorder.
+type Op struct {
+	// Delete is set for deletions, Value for the others.
+	Delete bool
+	Key    string
+	Value  json.RawMessage
+}
+
+// Recorder is an in-memory store recording the writes to it.
+type Recorder struct {
+	stores.MemoryStore
+
+	mu  sync.Mutex
+	ops []Op
+}
+
+// Set implements gokv.Store.
+func (r *Recorder) Set(k string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := r.MemoryStore.Set(k, v); err != nil {
+		return err
+	}
+	r.record(Op{Key: k, Value: b})
+	return nil
+}
+
+// Delete implements gokv.Store.
+func (r *Recorder) Delete(k string) error {
+	if err := r.MemoryStore.Delete(k); err != nil {
+		return err
+	}
+	r.record(Op{Delete: true, Key: k})
+	return nil
+}
+
+func (r *Recorder) record(op Op) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ops = append(r.ops, op)
+}
+
+// Ops returns the writes in the order they were made.
+func (r *Recorder) Ops() []Op {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Op(nil), r.ops...)
+}
+
+// Keys returns the keys written at least once, in the order of their first
+// write.
+func (r *Recorder) Keys() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var keys []string
+	seen := make(map[string]bool)
+	for _, op := range r.ops {
+		if !seen[op.Key] {
+			seen[op.Key] = true
+			keys = append(keys, op.Key)
+		}
+	}
+	return keys
+}
+
+// Reset forgets the recorded writes, keeping the stored values.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.ops = nil
+}
@@ -0,0 +1,49 @@
+package feedtriggertest
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	var r Recorder
+	for _, k := range []string{"a", "b", "a"} {
+		if err := r.Set(k, k+"!"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := r.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Op{
+		{Key: "a", Value: []byte(`"a!"`)},
+		{Key: "b", Value: []byte(`"b!"`)},
+		{Key: "a", Value: []byte(`"a!"`)},
+		{Delete: true, Key: "b"},
+	}
+	if ops := r.Ops(); !reflect.DeepEqual(ops, want) {
+		t.Errorf("ops %+v, want %+v", ops, want)
+	}
+	if keys := r.Keys(); !reflect.DeepEqual(keys, []string{"a", "b"}) {
+		t.Errorf("keys %v", keys)
+	}
+
+	r.Reset()
+	if ops := r.Ops(); len(ops) != 0 {
+		t.Errorf("ops %+v after reset", ops)
+	}
+	var v string
+	if found, err := r.Get("a", &v); err != nil || !found || v != "a!" {
+		t.Errorf("get after reset: %q, %v, %v", v, found, err)
+	}
+	if found, err := r.Get("b", &v); err != nil || found {
+		t.Errorf("deleted key found: %v, %v", found, err)
+	}
+	if err := r.Set("c", func() {}); err == nil {
+		t.Error("unencodable value stored")
+	}
+	if ops := r.Ops(); len(ops) != 0 {
+		t.Errorf("failed write recorded: %+v", ops)
+	}
+}
@@ -0,0 +1,124 @@
+package feedtrigger
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
+
+// ErrDuplicateFeed matches the DuplicateFeedError errors.
+var ErrDuplicateFeed = errors.New("duplicate feed")
+
+// DuplicateFeedError is returned for two feeds whose URLs have the same key,
+// which would poll the same endpoint twice.
+type DuplicateFeedError struct {
+	// URL is the key of the URLs and First and Second the configured ones.
+	URL    string
+	First  string
+	Second string
+}
+
+func (e *DuplicateFeedError) Error() string {
+	if e.First == e.Second {
+		return fmt.Sprintf("duplicate feed %s", e.URL)
+	}
+	return fmt.Sprintf("duplicate feed %s: %s and %s", e.URL, e.First, e.Second)
+}
+
+// Is reports whether the target is ErrDuplicateFeed.
+func (e *DuplicateFeedError) Is(target error) bool {
+	return target == ErrDuplicateFeed
+}
+
+// NormalizeURL returns the canonical form of an HTTP feed URL, the one the
+// feed is fetched from and its state stored under: the scheme and host
+// lowercased, the default port and the fragment dropped. Other URLs are
+// returned as they are.
+func NormalizeURL(raw string) string {
+	return normalizeURL(raw, false)
+}
+
+// dupKey returns the key two feeds are duplicates by: the normalized URL
+// without the trailing slash of the path. The slash isn't dropped from the
+// fetched URL since servers may serve different documents with and
+// without it.
+func dupKey(raw string) string {
+	return normalizeURL(raw, true)
+}
+
+func normalizeURL(raw string, trim bool) string {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || u.Host == "" {
+		return raw
+	}
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return raw
+	}
+	u.Scheme = scheme
+	u.Host = strings.ToLower(u.Host)
+	if host, port, err := net.SplitHostPort(u.Host); err == nil &&
+		(scheme == "http" && port == "80" || scheme == "https" && port == "443") {
+		u.Host = host
+		if strings.Contains(host, ":") {
+			u.Host = "[" + host + "]"
+		}
+	}
+	u.Fragment = ""
+	if !trim {
+		return u.String()
+	}
+	u.Path = trimSlash(u.Path)
+	if u.RawPath != "" {
+		u.RawPath = trimSlash(u.RawPath)
+	}
+	return u.String()
+}
+
+// trimSlash drops the trailing slashes of the path but the root one.
+func trimSlash(path string) string {
+	if path = strings.TrimRight(path, "/"); path == "" {
+		return "/"
+	}
+	return path
+}
+
+// normalizeFeeds normalizes the URLs of the feeds, remembering the renamed
+// ones for their stored state to be adopted, and reports the duplicates.
+// feedsMu must be held once the application runs.
+func (a *FeedAction) normalizeFeeds() error {
+	seen := make(map[string]string, len(a.Feeds))
+	for n := range a.Feeds {
+		raw := a.Feeds[n].URL
+		key := dupKey(raw)
+		if first, dup := seen[key]; dup {
+			return &DuplicateFeedError{URL: key, First: first, Second: raw}
+		}
+		seen[key] = raw
+		if norm := NormalizeURL(raw); norm != raw {
+			if a.renamedFeeds == nil {
+				a.renamedFeeds = make(map[string]string)
+			}
+			a.renamedFeeds[norm] = raw
+			a.Feeds[n].URL = norm
+		}
+	}
+	return nil
+}
+
+// adoptRenamed moves the state stored under the configured URLs of the
+// normalized feeds to the normalized ones, unless they have their own.
+func (a *FeedAction) adoptRenamed() error {
+	a.feedsMu.Lock()
+	renamed := a.renamedFeeds
+	a.renamedFeeds = nil
+	a.feedsMu.Unlock()
+	for norm, raw := range renamed {
+		if err := a.moveState(a.feedKV(norm), raw, norm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,304 @@
+package feedtrigger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// UserAgent is sent with every feed request unless overridden by the feed
+// headers.
+const UserAgent = "feedtrigger/1.0"
+
+// ErrBlocked is returned when a feed URL answers with an HTML page, usually
+// a captcha, bot check or an error page served with a 200 status.
+var ErrBlocked = errors.New("got an HTML page instead of the feed")
+
+// DefaultMaxBodySize is the default limit of the feed document size.
+const DefaultMaxBodySize = 10 << 20
+
+// DefaultFetchTimeout is the default limit of the duration of a fetch.
+const DefaultFetchTimeout = 2 * time.Minute
+
+// ErrTooLarge is returned when a feed document exceeds Feed.MaxBodySize.
+var ErrTooLarge = errors.New("feed document too large")
+
+// ErrFetchTimeout is returned when a fetch takes longer than
+// Feed.FetchTimeout.
+var ErrFetchTimeout = errors.New("fetch timed out")
+
+// MaxBlockedBackoff bounds the delay of polls of a blocked feed.
+const MaxBlockedBackoff = 6 * time.Hour
+
+// MaxFailureBackoff bounds the delay of polls of a failing feed.
+const MaxFailureBackoff = time.Hour
+
+// Source produces the feed of a Feed instead of fetching and parsing its
+// URL, e.g. by scraping a page or calling an API.
+type Source interface {
+	Fetch(ctx context.Context, f Feed) (*gofeed.Feed, error)
+}
+
+// Fetcher fetches and parses feeds, see FeedAction.Fetcher.
+type Fetcher interface {
+	Fetch(ctx context.Context, f Feed) (*gofeed.Feed, error)
+}
+
+// FetcherFunc adapts a function to Fetcher.
+type FetcherFunc func(ctx context.Context, f Feed) (*gofeed.Feed, error)
+
+// Fetch calls fn.
+func (fn FetcherFunc) Fetch(ctx context.Context, f Feed) (*gofeed.Feed, error) {
+	return fn(ctx, f)
+}
+
+// Parser parses downloaded feed documents, see FeedAction.Parser.
+type Parser interface {
+	Parse(f Feed, body []byte) (*gofeed.Feed, error)
+}
+
+// ParseFunc parses the downloaded document of a feed, see Feed.Parse.
+type ParseFunc func(f Feed, body []byte) (*gofeed.Feed, error)
+
+// ParseFeed parses the feed document with gofeed and the feed translators.
+// Feed.Parse functions fixing up broken documents call it with the fixed
+// document.
+func ParseFeed(f Feed, body []byte) (*gofeed.Feed, error) {
+	return f.parse(body)
+}
+
+// fetch downloads and parses the feed once MaxConcurrentFetches allows.
+func (a *FeedAction) fetch(ctx context.Context, f Feed) (*gofeed.Feed, error) {
+	if a.MaxConcurrentFetches > 0 {
+		a.fetchesOnce.Do(func() {
+			a.fetches = make(chan struct{}, a.MaxConcurrentFetches)
+		})
+		select {
+		case a.fetches <- struct{}{}:
+			defer func() { <-a.fetches }()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if f.Proxy == "" {
+		f.Proxy = a.Proxy
+	}
+	start := a.now()
+	if f.Source != nil || a.Fetcher != nil {
+		defer func() { a.charge(f.URL, PollCost{Fetch: a.now().Sub(start)}) }()
+	}
+	if f.Source != nil {
+		return f.Source.Fetch(ctx, f)
+	}
+	if a.Fetcher != nil {
+		return a.Fetcher.Fetch(ctx, f)
+	}
+
+	resp, body, err := download(ctx, f)
+	a.charge(f.URL, PollCost{Fetch: a.now().Sub(start), Bytes: int64(len(body))})
+	a.requested(f, resp)
+	if resp != nil && (resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable) {
+		a.throttled(f, resp)
+		return nil, fmt.Errorf("%s: %s: %w", f.URL, resp.Status, ErrThrottled)
+	}
+	if err != nil {
+		return nil, err
+	}
+	s := a.state(f.URL)
+	s.mu.Lock()
+	s.moved = permanentRedirect(resp)
+	s.mu.Unlock()
+	if looksLikeHTML(body) {
+		return nil, fmt.Errorf("%s: %w", f.URL, ErrBlocked)
+	}
+	if body, err = f.decode(resp.Header.Get("Content-Type"), body); err != nil {
+		return nil, pipelineError(ErrParse, f.URL, "", err)
+	}
+
+	start = a.now()
+	feed, err := a.parse(f, body)
+	a.charge(f.URL, PollCost{Parse: a.now().Sub(start)})
+	if err != nil {
+		if strings.Contains(resp.Header.Get("Content-Type"), "text/html") {
+			return nil, fmt.Errorf("%s: %w", f.URL, ErrBlocked)
+		}
+		return nil, pipelineError(ErrParse, f.URL, "", fmt.Errorf("parsing: %w", err))
+	}
+	return feed, nil
+}
+
+// parse parses the downloaded document of the feed with its Parse, the
+// application Parser or gofeed.
+func (a *FeedAction) parse(f Feed, body []byte) (*gofeed.Feed, error) {
+	switch {
+	case f.Parse != nil:
+		return f.Parse(f, body)
+	case a.Parser != nil:
+		return a.Parser.Parse(f, body)
+	}
+	return f.parse(body)
+}
+
+// Download requests the feed URL with the feed headers and returns the body
+// of a successful response. Sources use it to share the fetch settings.
+func Download(ctx context.Context, f Feed) ([]byte, error) {
+	_, body, err := download(ctx, f)
+	return body, err
+}
+
+func download(ctx context.Context, f Feed) (*http.Response, []byte, error) {
+	timeout := f.FetchTimeout
+	if timeout <= 0 {
+		timeout = DefaultFetchTimeout
+	}
+	fetchCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	resp, body, err := doDownload(fetchCtx, f)
+	if err != nil && ctx.Err() == nil && errors.Is(fetchCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("%s: %w after %s", f.URL, ErrFetchTimeout, timeout)
+	}
+	return resp, body, err
+}
+
+func doDownload(ctx context.Context, f Feed) (*http.Response, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.URL, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	for k, vv := range f.Headers {
+		req.Header.Del(k)
+		for _, v := range vv {
+			req.Header.Add(k, v)
+		}
+	}
+
+	client, err := f.client()
+	if err != nil {
+		return nil, nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp, nil, gofeed.HTTPError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+		}
+	}
+
+	limit := f.MaxBodySize
+	if limit <= 0 {
+		limit = DefaultMaxBodySize
+	}
+	if resp.ContentLength > limit {
+		return resp, nil, fmt.Errorf("%s: %w: %d bytes", f.URL, ErrTooLarge, resp.ContentLength)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return resp, nil, err
+	}
+	if int64(len(body)) > limit {
+		return resp, nil, fmt.Errorf("%s: %w: over %d bytes", f.URL, ErrTooLarge, limit)
+	}
+	return resp, body, nil
+}
+
+// looksLikeHTML sniffs the beginning of the document for an HTML root.
+func looksLikeHTML(body []byte) bool {
+	head := body
+	if len(head) > 512 {
+		head = head[:512]
+	}
+	head = bytes.ToLower(bytes.TrimSpace(bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))))
+	for bytes.HasPrefix(head, []byte("<!--")) {
+		end := bytes.Index(head, []byte("-->"))
+		if end < 0 {
+			break
+		}
+		head = bytes.TrimSpace(head[end+3:])
+	}
+	return bytes.HasPrefix(head, []byte("<!doctype html")) || bytes.HasPrefix(head, []byte("<html"))
+}
+
+// blockedBackoff records a blocked poll and returns how long to wait before
+// the next one.
+func (a *FeedAction) blockedBackoff(f Feed) time.Duration {
+	s := a.state(f.URL)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blocked++
+	s.blockedStreak++
+	vars.Add("blocked_polls", 1)
+
+	d := f.RefreshPeriod
+	for i := 0; i < s.blockedStreak && d < MaxBlockedBackoff; i++ {
+		d *= 2
+	}
+	if d > MaxBlockedBackoff {
+		d = MaxBlockedBackoff
+	}
+	return d
+}
+
+// failureBackoff returns the delay of the next poll after a failed one,
+// the refresh period doubled with every failed poll in a row after the
+// first one.
+func (a *FeedAction) failureBackoff(f Feed) time.Duration {
+	s := a.state(f.URL)
+	s.mu.Lock()
+	failures := s.failures
+	s.mu.Unlock()
+
+	d := f.RefreshPeriod
+	for i := 1; i < failures && d < MaxFailureBackoff; i++ {
+		d *= 2
+	}
+	if d > MaxFailureBackoff && d > f.RefreshPeriod {
+		d = MaxFailureBackoff
+	}
+	if r := a.nextDelay(f); r > d {
+		d = r
+	}
+	return d
+}
+
+// unblocked resets the blocked streak after a successful fetch.
+func (a *FeedAction) unblocked(f Feed) {
+	s := a.state(f.URL)
+	s.mu.Lock()
+	s.blockedStreak = 0
+	s.mu.Unlock()
+}
+
+// parsers are the reusable parsers of the feeds without translators.
+var parsers = sync.Pool{New: func() interface{} { return gofeed.NewParser() }}
+
+// parse parses the feed document with the feed translators.
+func (f Feed) parse(body []byte) (*gofeed.Feed, error) {
+	if f.AtomTranslator == nil && f.RSSTranslator == nil {
+		p := parsers.Get().(*gofeed.Parser)
+		defer parsers.Put(p)
+		return p.Parse(bytes.NewReader(body))
+	}
+	p := gofeed.NewParser()
+	if f.AtomTranslator != nil {
+		p.AtomTranslator = f.AtomTranslator
+	}
+	if f.RSSTranslator != nil {
+		p.RSSTranslator = f.RSSTranslator
+	}
+	return p.Parse(bytes.NewReader(body))
+}
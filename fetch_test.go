@@ -0,0 +1,46 @@
+package feedtrigger
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// benchFeed is an RSS document with n items.
+func benchFeed(n int) []byte {
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?><rss version="2.0"><channel><title>bench</title><link>http://example.com/</link>`)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, `<item><title>Item %d</title><link>http://example.com/%d</link><guid>%d</guid><pubDate>Mon, 02 Jan 2006 15:04:05 GMT</pubDate><description>Description of the item %d</description></item>`, i, i, i, i)
+	}
+	b.WriteString(`</channel></rss>`)
+	return b.Bytes()
+}
+
+func BenchmarkParsePooled(b *testing.B) {
+	body := benchFeed(50)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := (Feed{}).parse(body); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// BenchmarkParseNew builds a parser per document as before the pool, for
+// comparison.
+func BenchmarkParseNew(b *testing.B) {
+	body := benchFeed(50)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := gofeed.NewParser().Parse(bytes.NewReader(body)); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
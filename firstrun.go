@@ -0,0 +1,37 @@
+package feedtrigger
+
+import "github.com/mmcdole/gofeed"
+
+// FirstRun is the first poll policy of a feed: the number of the newest
+// items to trigger, or one of the constants.
+type FirstRun int
+
+// First poll policies.
+const (
+	// FirstRunSkip only records the items present on the first poll.
+	FirstRunSkip FirstRun = 0
+	// FirstRunTriggerAll triggers every item present on the first poll.
+	FirstRunTriggerAll FirstRun = -1
+)
+
+// TriggerLastN triggers the n newest items present on the first poll.
+func TriggerLastN(n int) FirstRun {
+	if n < 0 {
+		n = 0
+	}
+	return FirstRun(n)
+}
+
+// backfill returns the items of the first poll to trigger, in the feed
+// order.
+func (fr FirstRun) backfill(items []*gofeed.Item) []*gofeed.Item {
+	switch {
+	case fr == FirstRunTriggerAll:
+		return items
+	case fr <= 0:
+		return nil
+	case int(fr) < len(items):
+		return items[:fr]
+	}
+	return items
+}
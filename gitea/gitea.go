@@ -0,0 +1,145 @@
+// Package gitea is a feedtrigger source polling the API of a Gitea (or
+// Forgejo) instance.
+package gitea
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+	"ilya.app/feedtrigger/github"
+)
+
+// Kind is the type of repository activity to monitor.
+type Kind string
+
+// Kinds of activity.
+const (
+	Commits  Kind = "commits"
+	Tags     Kind = "tags"
+	Releases Kind = "releases"
+)
+
+// Source converts Gitea API responses into feed items. Commits and releases
+// are served by a GitHub compatible API and handled by the github package.
+type Source struct {
+	// BaseURL is the instance root, e.g. https://gitea.example.com.
+	BaseURL string
+	Owner   string
+	Repo    string
+	Kind    Kind
+	// Branch limits commits to a branch, the default branch if empty.
+	Branch string
+	// Token is an access token.
+	Token string
+}
+
+// NewFeed returns a feed of the repository activity.
+func NewFeed(baseURL, owner, repo string, kind Kind, token string, action feedtrigger.NewItemAction) *feedtrigger.Feed {
+	s := &Source{
+		BaseURL: baseURL,
+		Owner:   owner,
+		Repo:    repo,
+		Kind:    kind,
+		Token:   token,
+	}
+	f := feedtrigger.NewFeed(s.URL(), action)
+	f.Source = s
+	return f
+}
+
+func (s *Source) base() string {
+	return strings.TrimSuffix(s.BaseURL, "/")
+}
+
+func (s *Source) compat() *github.Source {
+	kind := github.Commits
+	if s.Kind == Releases {
+		kind = github.Releases
+	}
+	return &github.Source{
+		Owner:   s.Owner,
+		Repo:    s.Repo,
+		Kind:    kind,
+		Branch:  s.Branch,
+		Token:   s.Token,
+		BaseURL: s.base() + "/api/v1",
+	}
+}
+
+// URL returns the API endpoint of the source.
+func (s *Source) URL() string {
+	if s.Kind == Tags {
+		return fmt.Sprintf("%s/api/v1/repos/%s/%s/tags?limit=50",
+			s.base(), url.PathEscape(s.Owner), url.PathEscape(s.Repo))
+	}
+	return s.compat().URL()
+}
+
+// Fetch implements feedtrigger.Source.
+func (s *Source) Fetch(ctx context.Context, f feedtrigger.Feed) (*gofeed.Feed, error) {
+	if s.Kind != Tags {
+		feed, err := s.compat().Fetch(ctx, f)
+		if err != nil {
+			return nil, err
+		}
+		feed.Title = fmt.Sprintf("%s/%s %s", s.Owner, s.Repo, s.Kind)
+		feed.Link = fmt.Sprintf("%s/%s/%s", s.base(), s.Owner, s.Repo)
+		feed.FeedType = "gitea"
+		return feed, nil
+	}
+
+	if s.Token != "" {
+		headers := make(http.Header, len(f.Headers)+1)
+		for k, v := range f.Headers {
+			headers[k] = v
+		}
+		headers.Set("Authorization", "token "+s.Token)
+		f.Headers = headers
+	}
+	body, err := feedtrigger.Download(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	var tags []struct {
+		Name    string `json:"name"`
+		Message string `json:"message"`
+		Commit  struct {
+			SHA     string    `json:"sha"`
+			Created time.Time `json:"created"`
+		} `json:"commit"`
+	}
+	if err := json.Unmarshal(body, &tags); err != nil {
+		return nil, fmt.Errorf("gitea tags: %w", err)
+	}
+
+	web := fmt.Sprintf("%s/%s/%s", s.base(), s.Owner, s.Repo)
+	feed := &gofeed.Feed{
+		Title:    fmt.Sprintf("%s/%s tags", s.Owner, s.Repo),
+		Link:     web,
+		FeedType: "gitea",
+	}
+	for _, t := range tags {
+		item := &gofeed.Item{
+			Title:   t.Name,
+			Content: t.Message,
+			Link:    web + "/src/tag/" + url.PathEscape(t.Name),
+			GUID:    "tag:" + t.Name + ":" + t.Commit.SHA,
+		}
+		if !t.Commit.Created.IsZero() {
+			created := t.Commit.Created.UTC()
+			item.Published = created.Format(time.RFC3339)
+			item.PublishedParsed = &created
+		}
+		feed.Items = append(feed.Items, item)
+	}
+	return feed, nil
+}
@@ -0,0 +1,132 @@
+package github
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+)
+
+var (
+	// type(scope)!: subject
+	headerRe = regexp.MustCompile(`^(\w+)(?:\(([^)]*)\))?(!)?:\s*(.*)$`)
+	refRe    = regexp.MustCompile(`(?:^|[\s(])(?:[\w.-]+/[\w.-]+)?#(\d+)\b`)
+)
+
+// Commit is a commit message parsed according to the Conventional Commits
+// specification.
+type Commit struct {
+	// Type is e.g. feat or fix, empty for non-conventional messages.
+	Type     string
+	Scope    string
+	Breaking bool
+	Subject  string
+	// Refs are referenced issue and pull request numbers.
+	Refs []int
+}
+
+// ParseCommit parses the commit message.
+func ParseCommit(msg string) Commit {
+	msg = strings.TrimSpace(msg)
+	header := msg
+	if n := strings.IndexByte(msg, '\n'); n >= 0 {
+		header = msg[:n]
+	}
+
+	c := Commit{Subject: header}
+	if m := headerRe.FindStringSubmatch(header); m != nil {
+		c.Type = strings.ToLower(m[1])
+		c.Scope = m[2]
+		c.Breaking = m[3] == "!"
+		c.Subject = m[4]
+	}
+	if strings.Contains(msg, "BREAKING CHANGE:") || strings.Contains(msg, "BREAKING-CHANGE:") {
+		c.Breaking = true
+	}
+
+	seen := make(map[int]bool)
+	for _, m := range refRe.FindAllStringSubmatch(msg, -1) {
+		n, err := strconv.Atoi(m[1])
+		if err != nil || seen[n] {
+			continue
+		}
+		seen[n] = true
+		c.Refs = append(c.Refs, n)
+	}
+	return c
+}
+
+// ItemCommit parses the commit of a commit feed item: the title holds the
+// header and the content the full message, if present.
+func ItemCommit(i *gofeed.Item) Commit {
+	msg := i.Title
+	if i.Content != "" {
+		body := i.Content
+		if strings.Contains(body, "<") {
+			body = stripTags(body)
+		}
+		if strings.HasPrefix(strings.TrimSpace(body), strings.TrimSpace(i.Title)) {
+			msg = body
+		} else {
+			msg = i.Title + "\n\n" + body
+		}
+	}
+	return ParseCommit(msg)
+}
+
+// ConventionalFilter passes commits of one of the types (any type if none)
+// with a scope starting with one of the scope prefixes (any scope if none).
+func ConventionalFilter(types, scopes []string) feedtrigger.ItemFilter {
+	return func(i *gofeed.Item) bool {
+		c := ItemCommit(i)
+		if len(types) > 0 && !contains(types, c.Type) {
+			return false
+		}
+		if len(scopes) == 0 {
+			return true
+		}
+		for _, s := range scopes {
+			if strings.HasPrefix(c.Scope, strings.TrimSuffix(s, "/")) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Annotate stores the parsed commit in the custom fields of the item:
+// commit_type, commit_scope, commit_breaking and commit_refs.
+func Annotate(i *gofeed.Item) {
+	c := ItemCommit(i)
+	if i.Custom == nil {
+		i.Custom = make(map[string]string)
+	}
+	i.Custom["commit_type"] = c.Type
+	i.Custom["commit_scope"] = c.Scope
+	i.Custom["commit_breaking"] = strconv.FormatBool(c.Breaking)
+	refs := make([]string, len(c.Refs))
+	for n, r := range c.Refs {
+		refs[n] = strconv.Itoa(r)
+	}
+	i.Custom["commit_refs"] = strings.Join(refs, ",")
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+var tagRe = regexp.MustCompile(`<[^>]*>`)
+
+func stripTags(s string) string {
+	s = tagRe.ReplaceAllString(s, "")
+	r := strings.NewReplacer("&lt;", "<", "&gt;", ">", "&quot;", `"`, "&#39;", "'", "&amp;", "&")
+	return r.Replace(s)
+}
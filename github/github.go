@@ -0,0 +1,262 @@
+// Package github is a feedtrigger source polling the GitHub REST API, so
+// private repositories can be monitored and the rate limits of the public
+// Atom endpoints don't apply.
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+)
+
+// DefaultBaseURL is the GitHub API root.
+const DefaultBaseURL = "https://api.github.com"
+
+// Kind is the type of repository activity to monitor.
+type Kind string
+
+// Kinds of activity.
+const (
+	Commits  Kind = "commits"
+	Releases Kind = "releases"
+	Issues   Kind = "issues"
+)
+
+// Source converts GitHub API responses into feed items. Use it as
+// Feed.Source of a feed with the URL returned by Source.URL.
+type Source struct {
+	Owner string
+	Repo  string
+	Kind  Kind
+	// Branch limits commits to a branch, the default branch if empty.
+	Branch string
+	// Token is a personal access token. GITHUB_TOKEN from the environment
+	// is used if empty and BaseURL is the default one.
+	Token string
+	// BaseURL is the API root, DefaultBaseURL if empty.
+	BaseURL string
+}
+
+// NewFeed returns a feed of the repository activity.
+func NewFeed(owner, repo string, kind Kind, token string, action feedtrigger.NewItemAction) *feedtrigger.Feed {
+	s := &Source{
+		Owner: owner,
+		Repo:  repo,
+		Kind:  kind,
+		Token: token,
+	}
+	f := feedtrigger.NewFeed(s.URL(), action)
+	f.Source = s
+	return f
+}
+
+// URL returns the API endpoint of the source.
+func (s *Source) URL() string {
+	base := s.BaseURL
+	if base == "" {
+		base = DefaultBaseURL
+	}
+	q := url.Values{"per_page": {"50"}}
+	if s.Kind == Commits && s.Branch != "" {
+		q.Set("sha", s.Branch)
+	}
+	if s.Kind == Issues {
+		q.Set("state", "all")
+		q.Set("sort", "created")
+	}
+	return fmt.Sprintf("%s/repos/%s/%s/%s?%s",
+		strings.TrimSuffix(base, "/"), url.PathEscape(s.Owner), url.PathEscape(s.Repo), s.Kind, q.Encode())
+}
+
+// Fetch implements feedtrigger.Source.
+func (s *Source) Fetch(ctx context.Context, f feedtrigger.Feed) (*gofeed.Feed, error) {
+	headers := make(http.Header, len(f.Headers)+2)
+	for k, v := range f.Headers {
+		headers[k] = v
+	}
+	headers.Set("Accept", "application/vnd.github.v3+json")
+	token := s.Token
+	if token == "" && (s.BaseURL == "" || s.BaseURL == DefaultBaseURL) {
+		token = os.Getenv("GITHUB_TOKEN")
+	}
+	if token != "" {
+		headers.Set("Authorization", "token "+token)
+	}
+	f.Headers = headers
+
+	body, err := feedtrigger.Download(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	feed := &gofeed.Feed{
+		Title:    fmt.Sprintf("%s/%s %s", s.Owner, s.Repo, s.Kind),
+		Link:     fmt.Sprintf("https://github.com/%s/%s", s.Owner, s.Repo),
+		FeedType: "github",
+	}
+	switch s.Kind {
+	case Commits:
+		feed.Items, err = commitItems(body)
+	case Releases:
+		feed.Items, err = releaseItems(body)
+	case Issues:
+		feed.Items, err = issueItems(body)
+	default:
+		err = fmt.Errorf("unknown kind %q", s.Kind)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("github %s: %w", s.Kind, err)
+	}
+	return feed, nil
+}
+
+type user struct {
+	Login string `json:"login"`
+}
+
+func commitItems(body []byte) ([]*gofeed.Item, error) {
+	var commits []struct {
+		SHA     string `json:"sha"`
+		HTMLURL string `json:"html_url"`
+		Commit  struct {
+			Message string `json:"message"`
+			Author  struct {
+				Name  string    `json:"name"`
+				Email string    `json:"email"`
+				Date  time.Time `json:"date"`
+			} `json:"author"`
+		} `json:"commit"`
+		Author *user `json:"author"`
+	}
+	if err := json.Unmarshal(body, &commits); err != nil {
+		return nil, err
+	}
+
+	var items []*gofeed.Item
+	for _, c := range commits {
+		title := c.Commit.Message
+		if n := strings.IndexByte(title, '\n'); n >= 0 {
+			title = title[:n]
+		}
+		item := &gofeed.Item{
+			Title:   title,
+			Content: c.Commit.Message,
+			Link:    c.HTMLURL,
+			GUID:    c.SHA,
+			Author: &gofeed.Person{
+				Name:  c.Commit.Author.Name,
+				Email: c.Commit.Author.Email,
+			},
+		}
+		if c.Author != nil && c.Author.Login != "" {
+			item.Author.Name = c.Author.Login
+		}
+		setDate(item, c.Commit.Author.Date)
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func releaseItems(body []byte) ([]*gofeed.Item, error) {
+	var releases []struct {
+		ID          int64     `json:"id"`
+		HTMLURL     string    `json:"html_url"`
+		TagName     string    `json:"tag_name"`
+		Name        string    `json:"name"`
+		Body        string    `json:"body"`
+		Draft       bool      `json:"draft"`
+		Prerelease  bool      `json:"prerelease"`
+		PublishedAt time.Time `json:"published_at"`
+		Author      *user     `json:"author"`
+	}
+	if err := json.Unmarshal(body, &releases); err != nil {
+		return nil, err
+	}
+
+	var items []*gofeed.Item
+	for _, r := range releases {
+		if r.Draft {
+			continue
+		}
+		title := r.Name
+		if title == "" {
+			title = r.TagName
+		}
+		item := &gofeed.Item{
+			Title:   title,
+			Content: r.Body,
+			Link:    r.HTMLURL,
+			GUID:    fmt.Sprintf("release:%d", r.ID),
+			Custom:  map[string]string{"tag": r.TagName},
+		}
+		if r.Prerelease {
+			item.Categories = []string{"prerelease"}
+		}
+		if r.Author != nil {
+			item.Author = &gofeed.Person{Name: r.Author.Login}
+		}
+		setDate(item, r.PublishedAt)
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func issueItems(body []byte) ([]*gofeed.Item, error) {
+	var issues []struct {
+		ID          int64     `json:"id"`
+		Number      int       `json:"number"`
+		HTMLURL     string    `json:"html_url"`
+		Title       string    `json:"title"`
+		Body        string    `json:"body"`
+		State       string    `json:"state"`
+		CreatedAt   time.Time `json:"created_at"`
+		UpdatedAt   time.Time `json:"updated_at"`
+		User        *user     `json:"user"`
+		PullRequest *struct{} `json:"pull_request"`
+	}
+	if err := json.Unmarshal(body, &issues); err != nil {
+		return nil, err
+	}
+
+	var items []*gofeed.Item
+	for _, is := range issues {
+		category := "issue"
+		if is.PullRequest != nil {
+			category = "pull_request"
+		}
+		item := &gofeed.Item{
+			Title:      fmt.Sprintf("#%d %s", is.Number, is.Title),
+			Content:    is.Body,
+			Link:       is.HTMLURL,
+			GUID:       fmt.Sprintf("issue:%d", is.ID),
+			Categories: []string{category, is.State},
+		}
+		if is.User != nil {
+			item.Author = &gofeed.Person{Name: is.User.Login}
+		}
+		setDate(item, is.CreatedAt)
+		updated := is.UpdatedAt.UTC()
+		item.Updated = updated.Format(time.RFC3339)
+		item.UpdatedParsed = &updated
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func setDate(item *gofeed.Item, t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	t = t.UTC()
+	item.Published = t.Format(time.RFC3339)
+	item.PublishedParsed = &t
+}
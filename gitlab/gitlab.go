@@ -0,0 +1,223 @@
+// Package gitlab is a feedtrigger source polling the GitLab REST API of
+// gitlab.com or a self-hosted instance.
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+)
+
+// DefaultBaseURL is the gitlab.com root.
+const DefaultBaseURL = "https://gitlab.com"
+
+// Kind is the type of project activity to monitor.
+type Kind string
+
+// Kinds of activity.
+const (
+	Commits  Kind = "commits"
+	Tags     Kind = "tags"
+	Releases Kind = "releases"
+)
+
+// Source converts GitLab API responses into feed items. Use it as
+// Feed.Source of a feed with the URL returned by Source.URL.
+type Source struct {
+	// BaseURL is the instance root, DefaultBaseURL if empty.
+	BaseURL string
+	// Project is the full project path, e.g. group/subgroup/project.
+	Project string
+	Kind    Kind
+	// Branch limits commits to a branch, the default branch if empty.
+	Branch string
+	// Token is a personal or project access token sent as PRIVATE-TOKEN.
+	Token string
+}
+
+// NewFeed returns a feed of the project activity.
+func NewFeed(baseURL, project string, kind Kind, token string, action feedtrigger.NewItemAction) *feedtrigger.Feed {
+	s := &Source{
+		BaseURL: baseURL,
+		Project: project,
+		Kind:    kind,
+		Token:   token,
+	}
+	f := feedtrigger.NewFeed(s.URL(), action)
+	f.Source = s
+	return f
+}
+
+func (s *Source) base() string {
+	if s.BaseURL == "" {
+		return DefaultBaseURL
+	}
+	return strings.TrimSuffix(s.BaseURL, "/")
+}
+
+// URL returns the API endpoint of the source.
+func (s *Source) URL() string {
+	project := s.base() + "/api/v4/projects/" + url.PathEscape(s.Project)
+	switch s.Kind {
+	case Commits:
+		q := url.Values{"per_page": {"50"}}
+		if s.Branch != "" {
+			q.Set("ref_name", s.Branch)
+		}
+		return project + "/repository/commits?" + q.Encode()
+	case Tags:
+		return project + "/repository/tags?per_page=50"
+	}
+	return project + "/releases?per_page=50"
+}
+
+// Fetch implements feedtrigger.Source.
+func (s *Source) Fetch(ctx context.Context, f feedtrigger.Feed) (*gofeed.Feed, error) {
+	if s.Token != "" {
+		headers := make(http.Header, len(f.Headers)+1)
+		for k, v := range f.Headers {
+			headers[k] = v
+		}
+		headers.Set("PRIVATE-TOKEN", s.Token)
+		f.Headers = headers
+	}
+
+	body, err := feedtrigger.Download(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	web := s.base() + "/" + s.Project
+	feed := &gofeed.Feed{
+		Title:    fmt.Sprintf("%s %s", s.Project, s.Kind),
+		Link:     web,
+		FeedType: "gitlab",
+	}
+	switch s.Kind {
+	case Commits:
+		feed.Items, err = commitItems(body)
+	case Tags:
+		feed.Items, err = tagItems(body, web)
+	case Releases:
+		feed.Items, err = releaseItems(body, web)
+	default:
+		err = fmt.Errorf("unknown kind %q", s.Kind)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("gitlab %s: %w", s.Kind, err)
+	}
+	return feed, nil
+}
+
+func commitItems(body []byte) ([]*gofeed.Item, error) {
+	var commits []struct {
+		ID          string    `json:"id"`
+		Title       string    `json:"title"`
+		Message     string    `json:"message"`
+		AuthorName  string    `json:"author_name"`
+		AuthorEmail string    `json:"author_email"`
+		CreatedAt   time.Time `json:"created_at"`
+		WebURL      string    `json:"web_url"`
+	}
+	if err := json.Unmarshal(body, &commits); err != nil {
+		return nil, err
+	}
+
+	var items []*gofeed.Item
+	for _, c := range commits {
+		item := &gofeed.Item{
+			Title:   c.Title,
+			Content: c.Message,
+			Link:    c.WebURL,
+			GUID:    c.ID,
+			Author:  &gofeed.Person{Name: c.AuthorName, Email: c.AuthorEmail},
+		}
+		setDate(item, c.CreatedAt)
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func tagItems(body []byte, web string) ([]*gofeed.Item, error) {
+	var tags []struct {
+		Name    string `json:"name"`
+		Message string `json:"message"`
+		Commit  struct {
+			ID        string    `json:"id"`
+			Title     string    `json:"title"`
+			CreatedAt time.Time `json:"created_at"`
+		} `json:"commit"`
+	}
+	if err := json.Unmarshal(body, &tags); err != nil {
+		return nil, err
+	}
+
+	var items []*gofeed.Item
+	for _, t := range tags {
+		item := &gofeed.Item{
+			Title:   t.Name,
+			Content: t.Message,
+			Link:    web + "/-/tags/" + url.PathEscape(t.Name),
+			GUID:    "tag:" + t.Name + ":" + t.Commit.ID,
+		}
+		if item.Content == "" {
+			item.Content = t.Commit.Title
+		}
+		setDate(item, t.Commit.CreatedAt)
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func releaseItems(body []byte, web string) ([]*gofeed.Item, error) {
+	var releases []struct {
+		TagName     string    `json:"tag_name"`
+		Name        string    `json:"name"`
+		Description string    `json:"description"`
+		ReleasedAt  time.Time `json:"released_at"`
+		Author      *struct {
+			Username string `json:"username"`
+		} `json:"author"`
+	}
+	if err := json.Unmarshal(body, &releases); err != nil {
+		return nil, err
+	}
+
+	var items []*gofeed.Item
+	for _, r := range releases {
+		title := r.Name
+		if title == "" {
+			title = r.TagName
+		}
+		item := &gofeed.Item{
+			Title:   title,
+			Content: r.Description,
+			Link:    web + "/-/releases/" + url.PathEscape(r.TagName),
+			GUID:    "release:" + r.TagName,
+			Custom:  map[string]string{"tag": r.TagName},
+		}
+		if r.Author != nil {
+			item.Author = &gofeed.Person{Name: r.Author.Username}
+		}
+		setDate(item, r.ReleasedAt)
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func setDate(item *gofeed.Item, t time.Time) {
+	if t.IsZero() {
+		return
+	}
+	t = t.UTC()
+	item.Published = t.Format(time.RFC3339)
+	item.PublishedParsed = &t
+}
@@ -3,9 +3,11 @@ module ilya.app/feedtrigger
 go 1.14
 
 require (
+	github.com/PuerkitoBio/goquery v1.5.0
 	github.com/ilyaglow/go-pypi v0.0.3-0.20200823222104-b11d6afa10fe
 	github.com/mmcdole/gofeed v1.0.0
 	github.com/philippgille/gokv v0.6.0
 	github.com/philippgille/gokv/bbolt v0.6.0
+	golang.org/x/net v0.0.0-20181220203305-927f97764cc3
 	golang.org/x/sync v0.0.0-20200625203802-6e8e738ad208
 )
@@ -0,0 +1,204 @@
+package feedtrigger
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/philippgille/gokv"
+)
+
+// FeedGroup is a named set of feeds sharing default settings and managed as
+// a unit: the feeds referencing it by Feed.Group are paused, resumed, polled
+// and replaced together. Unlike a Tenant, a group runs within the
+// application, sharing its workers and state.
+type FeedGroup struct {
+	Name string
+	// RefreshPeriod is used by the feeds without their own.
+	RefreshPeriod time.Duration
+	// Filters are run before the feed's own filters.
+	Filters []ItemFilter
+	// Labels are merged with the feed labels, the feed values win.
+	Labels map[string]string
+	// OnNewRecord and Actions are the action chain of the feeds without
+	// any.
+	OnNewRecord NewItemAction
+	Actions     []Step
+	// Store keeps the state of the feeds without their own, see Feed.Store.
+	Store gokv.Store
+}
+
+// GroupStatus describes a feed group.
+type GroupStatus struct {
+	Name    string `json:"name"`
+	Feeds   int    `json:"feeds"`
+	Paused  int    `json:"paused"`
+	Failing int    `json:"failing"`
+}
+
+// apply fills in the feed settings missing locally. Applying it again
+// doesn't change the feed.
+func (g *FeedGroup) apply(f *Feed) {
+	if f.RefreshPeriod == 0 {
+		f.RefreshPeriod = g.RefreshPeriod
+	}
+	if f.Store == nil {
+		f.Store = g.Store
+	}
+	if f.OnNewRecord == nil && f.OnNewRecordCtx == nil && len(f.Actions) == 0 && f.OnNewBatch == nil {
+		f.OnNewRecord = g.OnNewRecord
+		f.Actions = g.Actions
+	}
+	if len(g.Labels) > 0 {
+		l := make(map[string]string, len(g.Labels)+len(f.Labels))
+		for k, v := range g.Labels {
+			l[k] = v
+		}
+		for k, v := range f.Labels {
+			l[k] = v
+		}
+		f.Labels = l
+	}
+}
+
+// applyGroup fills in the settings of the feed group.
+func (a *FeedAction) applyGroup(f *Feed) error {
+	if f.Group == "" {
+		return nil
+	}
+	g, ok := a.Groups[f.Group]
+	if !ok {
+		return fmt.Errorf("feed %s: unknown group %q", f.URL, f.Group)
+	}
+	g.apply(f)
+	return nil
+}
+
+// group returns the group of the feed, nil if it has none.
+func (a *FeedAction) group(f Feed) *FeedGroup {
+	if f.Group == "" {
+		return nil
+	}
+	return a.Groups[f.Group]
+}
+
+// filters returns the filters of the feed group followed by the feed ones.
+func (a *FeedAction) filters(f Feed) []ItemFilter {
+	if g := a.group(f); g != nil && len(g.Filters) > 0 {
+		return append(append([]ItemFilter{}, g.Filters...), f.Filters...)
+	}
+	return f.Filters
+}
+
+// groupFeeds returns the URLs of the feeds of the group.
+func (a *FeedAction) groupFeeds(name string) ([]string, error) {
+	if _, ok := a.Groups[name]; !ok {
+		return nil, fmt.Errorf("unknown group %q", name)
+	}
+	var urls []string
+	for _, f := range a.ListFeeds() {
+		if f.Group == name {
+			urls = append(urls, f.URL)
+		}
+	}
+	return urls, nil
+}
+
+// PauseGroup stops fetching the feeds of the group until ResumeGroup is
+// called.
+func (a *FeedAction) PauseGroup(name string) error {
+	urls, err := a.groupFeeds(name)
+	for _, url := range urls {
+		a.PauseFeed(url)
+	}
+	return err
+}
+
+// ResumeGroup resumes fetching the feeds of the group.
+func (a *FeedAction) ResumeGroup(name string) error {
+	urls, err := a.groupFeeds(name)
+	for _, url := range urls {
+		a.ResumeFeed(url)
+	}
+	return err
+}
+
+// PollGroup polls the feeds of the group right away.
+func (a *FeedAction) PollGroup(name string) error {
+	urls, err := a.groupFeeds(name)
+	for _, url := range urls {
+		a.PollNow(url)
+	}
+	return err
+}
+
+// SyncGroup makes feeds the authoritative feed set of the group like
+// SyncFeeds does for the application, leaving the other feeds alone.
+func (a *FeedAction) SyncGroup(name string, feeds []Feed) (added, removed, updated []string, err error) {
+	if _, ok := a.Groups[name]; !ok {
+		return nil, nil, nil, fmt.Errorf("unknown group %q", name)
+	}
+	var all []Feed
+	for _, f := range a.ListFeeds() {
+		if f.Group != name {
+			all = append(all, f)
+		}
+	}
+	for _, f := range feeds {
+		if f.Group != name {
+			return nil, nil, nil, fmt.Errorf("feed %s isn't in group %q", f.URL, name)
+		}
+		all = append(all, f)
+	}
+	return a.SyncFeeds(all)
+}
+
+// GroupFeedsStatus returns the status of the feeds of the group.
+func (a *FeedAction) GroupFeedsStatus(name string) ([]FeedStatus, error) {
+	urls, err := a.groupFeeds(name)
+	if err != nil {
+		return nil, err
+	}
+	members := make(map[string]bool, len(urls))
+	for _, url := range urls {
+		members[url] = true
+	}
+	var status []FeedStatus
+	for _, fs := range a.Status() {
+		if members[fs.URL] {
+			status = append(status, fs)
+		}
+	}
+	return status, nil
+}
+
+// GroupsStatus returns the state of the feed groups.
+func (a *FeedAction) GroupsStatus() []GroupStatus {
+	byName := make(map[string]*GroupStatus, len(a.Groups))
+	for name := range a.Groups {
+		byName[name] = &GroupStatus{Name: name}
+	}
+	group := make(map[string]string)
+	for _, f := range a.ListFeeds() {
+		group[f.URL] = f.Group
+	}
+	for _, fs := range a.Status() {
+		gs, ok := byName[group[fs.URL]]
+		if !ok {
+			continue
+		}
+		gs.Feeds++
+		if fs.Paused {
+			gs.Paused++
+		}
+		if fs.ConsecutiveFailures > 0 {
+			gs.Failing++
+		}
+	}
+	status := make([]GroupStatus, 0, len(byName))
+	for _, gs := range byName {
+		status = append(status, *gs)
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Name < status[j].Name })
+	return status
+}
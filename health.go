@@ -0,0 +1,73 @@
+package feedtrigger
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultHealthFactor is the default number of refresh periods a feed may
+// go without a successful poll.
+const DefaultHealthFactor = 3
+
+// Stalled returns URLs of the feeds without a successful poll for more than
+// HealthFactor refresh periods. Paused and push feeds and the feeds polled
+// by another instance aren't stalled.
+func (a *FeedAction) Stalled() []string {
+	factor := a.HealthFactor
+	if factor <= 0 {
+		factor = DefaultHealthFactor
+	}
+
+	now := a.now()
+	var stalled []string
+	for _, f := range a.ListFeeds() {
+		if f.Push {
+			continue
+		}
+		s := a.state(f.URL)
+		s.mu.Lock()
+		last := s.lastSuccess
+		if last.IsZero() {
+			last = s.since
+		}
+		paused := s.paused || s.leasedBy != ""
+		s.mu.Unlock()
+		if !paused && !last.IsZero() && now.Sub(last) > time.Duration(factor)*f.period() {
+			stalled = append(stalled, f.URL)
+		}
+	}
+	sort.Strings(stalled)
+	return stalled
+}
+
+// Healthz is a liveness probe handler failing while any feed is stalled.
+func (a *FeedAction) Healthz() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if stalled := a.Stalled(); len(stalled) > 0 {
+			http.Error(w, fmt.Sprintf("stalled feeds:\n%s", strings.Join(stalled, "\n")), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+}
+
+// Running reports whether Run is polling.
+func (a *FeedAction) Running() bool {
+	a.feedsMu.Lock()
+	defer a.feedsMu.Unlock()
+	return a.ops != nil
+}
+
+// Readyz is a readiness probe handler succeeding once Run is polling.
+func (a *FeedAction) Readyz() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.Running() {
+			http.Error(w, "not running", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+}
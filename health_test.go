@@ -0,0 +1,60 @@
+package feedtrigger_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+)
+
+// get returns the status and body of the handler response.
+func get(h http.Handler) (int, string) {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	return w.Code, w.Body.String()
+}
+
+func TestFailingFeedHealth(t *testing.T) {
+	f := feedtrigger.NewFeed("http://example.com/feed.xml", func(*gofeed.Item) error { return nil })
+	f.RefreshPeriod = 10 * time.Minute
+	app, clock, fetched := runClocked(t, f, func(n int) (*gofeed.Feed, error) {
+		return nil, fmt.Errorf("fetch %d failed", n)
+	})
+
+	now := start
+	expectFetch(t, fetched, now)
+	for _, d := range []time.Duration{10 * time.Minute, 20 * time.Minute} {
+		if got := nextPoll(t, app, now); got != d {
+			t.Fatalf("next poll in %s, want %s", got, d)
+		}
+		now = now.Add(d)
+		clock.Set(now)
+		expectFetch(t, fetched, now)
+	}
+	nextPoll(t, app, now)
+
+	// the feed keeps being polled and is reported as failing, but it isn't
+	// stalled before HealthFactor refresh periods
+	if code, body := get(app.Healthz()); code != http.StatusOK {
+		t.Errorf("healthz: %d %s", code, body)
+	}
+	_, body := get(app.Dashboard())
+	if !strings.Contains(body, "failing") || !strings.Contains(body, "fetch 3 failed") {
+		t.Errorf("dashboard doesn't show the failures:\n%s", body)
+	}
+
+	clock.Set(start.Add(feedtrigger.DefaultHealthFactor*f.RefreshPeriod + time.Second))
+	code, body := get(app.Healthz())
+	if code != http.StatusServiceUnavailable || !strings.Contains(body, f.URL) {
+		t.Errorf("healthz of a stalled feed: %d %s", code, body)
+	}
+	if _, body := get(app.Dashboard()); !strings.Contains(body, "stalled") {
+		t.Errorf("dashboard doesn't show the stalled feed:\n%s", body)
+	}
+}
@@ -0,0 +1,281 @@
+// Package history records feeds, polls and triggered items in SQL tables of
+// a SQLite database, so the history can be queried, e.g. the items
+// triggered last week per feed. The database also implements gokv.Store,
+// so a single file can hold the application state too.
+//
+// The package uses database/sql and feedtrigger ships no SQLite driver, as
+// the drivers are either cgo or large dependencies. The history is thus
+// not a built-in backend of the feedtrigger command: a program registers a
+// driver, e.g. by importing github.com/mattn/go-sqlite3, whose name is
+// passed to Open. Importing the package makes the "sqlite" scheme
+// available to stores.Open with the driver name in the "driver" query
+// parameter:
+//
+//	sqlite:///var/lib/feedtrigger.db?driver=sqlite3
+package history
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/philippgille/gokv"
+
+	"ilya.app/feedtrigger"
+	"ilya.app/feedtrigger/stores"
+)
+
+// timeLayout is understood by the SQLite date and time functions and sorts
+// lexically.
+const timeLayout = "2006-01-02 15:04:05.000"
+
+var schema = []string{
+	`CREATE TABLE IF NOT EXISTS kv (
+		key   TEXT PRIMARY KEY,
+		value BLOB NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS feeds (
+		url        TEXT PRIMARY KEY,
+		first_poll TEXT NOT NULL,
+		last_poll  TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS polls (
+		id          INTEGER PRIMARY KEY,
+		feed        TEXT NOT NULL,
+		started     TEXT NOT NULL,
+		duration_ms INTEGER NOT NULL,
+		items       INTEGER NOT NULL,
+		triggered   INTEGER NOT NULL,
+		error       TEXT
+	)`,
+	`CREATE INDEX IF NOT EXISTS polls_feed ON polls (feed, started)`,
+	`CREATE TABLE IF NOT EXISTS items (
+		feed      TEXT NOT NULL,
+		id        TEXT NOT NULL,
+		title     TEXT,
+		link      TEXT,
+		published TEXT,
+		triggered TEXT NOT NULL,
+		item      TEXT NOT NULL,
+		PRIMARY KEY (feed, id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS items_triggered ON items (triggered)`,
+}
+
+func init() {
+	stores.Register("sqlite", func(dsn *url.URL) (gokv.Store, error) {
+		driver := dsn.Query().Get("driver")
+		if driver == "" {
+			driver = "sqlite3"
+		}
+		path := dsn.Opaque
+		if path == "" {
+			path = dsn.Host + dsn.Path
+		}
+		return Open(driver, path)
+	})
+}
+
+// DB is a SQLite database with the history tables.
+type DB struct {
+	// SQL is the database for custom queries.
+	SQL *sql.DB
+}
+
+// Open opens the database with the driver and creates the tables.
+func Open(driver, dsn string) (*DB, error) {
+	registered := false
+	for _, d := range sql.Drivers() {
+		registered = registered || d == driver
+	}
+	if !registered {
+		return nil, fmt.Errorf("no %q database driver, the program has to import one", driver)
+	}
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("opening history database: %w", err)
+	}
+	d, err := New(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// New creates the tables in the database.
+func New(db *sql.DB) (*DB, error) {
+	for _, stmt := range schema {
+		if _, err := db.Exec(stmt); err != nil {
+			return nil, fmt.Errorf("creating history tables: %w", err)
+		}
+	}
+	return &DB{SQL: db}, nil
+}
+
+// Attach records the polls and the delivered items of the application,
+// keeping its existing hooks.
+func (d *DB) Attach(a *feedtrigger.FeedAction) {
+	onPoll, onDelivered := a.OnPoll, a.OnDelivered
+	a.OnPoll = func(info feedtrigger.PollInfo) {
+		if err := d.RecordPoll(info); err != nil {
+			log.Printf("history: %v", err)
+		}
+		if onPoll != nil {
+			onPoll(info)
+		}
+	}
+	a.OnDelivered = func(feed string, i *gofeed.Item) {
+		if err := d.RecordItem(feed, i, time.Now()); err != nil {
+			log.Printf("history: %v", err)
+		}
+		if onDelivered != nil {
+			onDelivered(feed, i)
+		}
+	}
+}
+
+// RecordPoll stores the poll and the feed.
+func (d *DB) RecordPoll(info feedtrigger.PollInfo) error {
+	start := info.Start.UTC().Format(timeLayout)
+	var errText interface{}
+	if info.Err != nil {
+		errText = info.Err.Error()
+	}
+	tx, err := d.SQL.Begin()
+	if err != nil {
+		return fmt.Errorf("recording poll: %w", err)
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`INSERT OR IGNORE INTO feeds (url, first_poll, last_poll) VALUES (?, ?, ?)`,
+		info.Feed, start, start); err != nil {
+		return fmt.Errorf("recording poll: %w", err)
+	}
+	if _, err := tx.Exec(`UPDATE feeds SET last_poll = ? WHERE url = ?`, start, info.Feed); err != nil {
+		return fmt.Errorf("recording poll: %w", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO polls (feed, started, duration_ms, items, triggered, error) VALUES (?, ?, ?, ?, ?, ?)`,
+		info.Feed, start, info.Duration.Milliseconds(), info.Items, info.Triggered, errText); err != nil {
+		return fmt.Errorf("recording poll: %w", err)
+	}
+	return tx.Commit()
+}
+
+// RecordItem stores the item triggered from the feed at the time.
+func (d *DB) RecordItem(feed string, i *gofeed.Item, at time.Time) error {
+	b, err := json.Marshal(i)
+	if err != nil {
+		return fmt.Errorf("encoding item: %w", err)
+	}
+	var published interface{}
+	if i.PublishedParsed != nil {
+		published = i.PublishedParsed.UTC().Format(timeLayout)
+	}
+	_, err = d.SQL.Exec(`INSERT OR REPLACE INTO items (feed, id, title, link, published, triggered, item) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		feed, feedtrigger.ItemID(i), i.Title, i.Link, published, at.UTC().Format(timeLayout), string(b))
+	if err != nil {
+		return fmt.Errorf("recording item: %w", err)
+	}
+	return nil
+}
+
+// Item is a triggered item of the history.
+type Item struct {
+	Feed      string
+	Item      *gofeed.Item
+	Triggered time.Time
+}
+
+// Items returns the items of the feed triggered since the time, the newest
+// first. An empty feed means all feeds.
+func (d *DB) Items(feed string, since time.Time) ([]Item, error) {
+	rows, err := d.SQL.Query(`SELECT feed, triggered, item FROM items
+		WHERE (? = '' OR feed = ?) AND triggered >= ? ORDER BY triggered DESC`,
+		feed, feed, since.UTC().Format(timeLayout))
+	if err != nil {
+		return nil, fmt.Errorf("querying items: %w", err)
+	}
+	defer rows.Close()
+	var items []Item
+	for rows.Next() {
+		var it Item
+		var triggered, raw string
+		if err := rows.Scan(&it.Feed, &triggered, &raw); err != nil {
+			return nil, fmt.Errorf("querying items: %w", err)
+		}
+		if it.Triggered, err = time.Parse(timeLayout, triggered); err != nil {
+			return nil, fmt.Errorf("querying items: %w", err)
+		}
+		if err := json.Unmarshal([]byte(raw), &it.Item); err != nil {
+			return nil, fmt.Errorf("decoding item: %w", err)
+		}
+		items = append(items, it)
+	}
+	return items, rows.Err()
+}
+
+// TriggeredPerFeed returns the number of items triggered since the time
+// per feed URL.
+func (d *DB) TriggeredPerFeed(since time.Time) (map[string]int, error) {
+	rows, err := d.SQL.Query(`SELECT feed, COUNT(*) FROM items WHERE triggered >= ? GROUP BY feed`,
+		since.UTC().Format(timeLayout))
+	if err != nil {
+		return nil, fmt.Errorf("querying items: %w", err)
+	}
+	defer rows.Close()
+	counts := make(map[string]int)
+	for rows.Next() {
+		var feed string
+		var n int
+		if err := rows.Scan(&feed, &n); err != nil {
+			return nil, fmt.Errorf("querying items: %w", err)
+		}
+		counts[feed] = n
+	}
+	return counts, rows.Err()
+}
+
+// Set implements gokv.Store.
+func (d *DB) Set(k string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encoding %s: %w", k, err)
+	}
+	if _, err := d.SQL.Exec(`INSERT OR REPLACE INTO kv (key, value) VALUES (?, ?)`, k, b); err != nil {
+		return fmt.Errorf("storing %s: %w", k, err)
+	}
+	return nil
+}
+
+// Get implements gokv.Store.
+func (d *DB) Get(k string, v interface{}) (bool, error) {
+	var b []byte
+	err := d.SQL.QueryRow(`SELECT value FROM kv WHERE key = ?`, k).Scan(&b)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("getting %s: %w", k, err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return true, fmt.Errorf("decoding %s: %w", k, err)
+	}
+	return true, nil
+}
+
+// Delete implements gokv.Store.
+func (d *DB) Delete(k string) error {
+	if _, err := d.SQL.Exec(`DELETE FROM kv WHERE key = ?`, k); err != nil {
+		return fmt.Errorf("deleting %s: %w", k, err)
+	}
+	return nil
+}
+
+// Close implements gokv.Store.
+func (d *DB) Close() error {
+	return d.SQL.Close()
+}
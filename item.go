@@ -0,0 +1,28 @@
+package feedtrigger
+
+import "github.com/mmcdole/gofeed"
+
+// copyItem returns a copy of the item that can be modified without affecting
+// the original: the author and custom fields are copied as well.
+func copyItem(i *gofeed.Item) *gofeed.Item {
+	c := *i
+	if i.Author != nil {
+		author := *i.Author
+		c.Author = &author
+	}
+	if i.Custom != nil {
+		c.Custom = make(map[string]string, len(i.Custom))
+		for k, v := range i.Custom {
+			c.Custom[k] = v
+		}
+	}
+	return &c
+}
+
+// setCustom sets a custom field of the item.
+func setCustom(i *gofeed.Item, k, v string) {
+	if i.Custom == nil {
+		i.Custom = make(map[string]string)
+	}
+	i.Custom[k] = v
+}
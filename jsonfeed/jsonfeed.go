@@ -0,0 +1,208 @@
+// Package jsonfeed parses JSON Feed 1.0 and 1.1 documents, including the
+// 1.1 authors and language and the feed extensions, into feedtrigger items.
+package jsonfeed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+)
+
+// Item custom fields.
+const (
+	// ExtensionPrefix prefixes the fields holding the JSON of the item
+	// extensions, e.g. "jsonfeed__podcast" for the "_podcast" object.
+	ExtensionPrefix = "jsonfeed_"
+	// LanguageKey holds the language of the item if it differs from the
+	// feed one.
+	LanguageKey = "jsonfeed_language"
+)
+
+type document struct {
+	Version     string   `json:"version"`
+	Title       string   `json:"title"`
+	HomePageURL string   `json:"home_page_url"`
+	FeedURL     string   `json:"feed_url"`
+	Description string   `json:"description"`
+	Icon        string   `json:"icon"`
+	Favicon     string   `json:"favicon"`
+	Language    string   `json:"language"`
+	Author      *author  `json:"author"`
+	Authors     []author `json:"authors"`
+	Items       []item   `json:"items"`
+}
+
+type author struct {
+	Name string `json:"name"`
+	URL  string `json:"url"`
+}
+
+type item struct {
+	ID            json.RawMessage `json:"id"`
+	URL           string          `json:"url"`
+	ExternalURL   string          `json:"external_url"`
+	Title         string          `json:"title"`
+	ContentHTML   string          `json:"content_html"`
+	ContentText   string          `json:"content_text"`
+	Summary       string          `json:"summary"`
+	Image         string          `json:"image"`
+	BannerImage   string          `json:"banner_image"`
+	DatePublished string          `json:"date_published"`
+	DateModified  string          `json:"date_modified"`
+	Author        *author         `json:"author"`
+	Authors       []author        `json:"authors"`
+	Tags          []string        `json:"tags"`
+	Language      string          `json:"language"`
+	Attachments   []struct {
+		URL         string `json:"url"`
+		MimeType    string `json:"mime_type"`
+		SizeInBytes int64  `json:"size_in_bytes"`
+	} `json:"attachments"`
+}
+
+// Parse parses the JSON Feed document of the feed. Use it as Feed.Parse.
+func Parse(f feedtrigger.Feed, body []byte) (*gofeed.Feed, error) {
+	var doc document
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil, fmt.Errorf("jsonfeed: %w", err)
+	}
+	if !strings.HasPrefix(doc.Version, "https://jsonfeed.org/version/") {
+		return nil, fmt.Errorf("jsonfeed: unsupported version %q", doc.Version)
+	}
+	var raw struct {
+		Items []map[string]json.RawMessage `json:"items"`
+	}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, fmt.Errorf("jsonfeed: %w", err)
+	}
+
+	feed := &gofeed.Feed{
+		Title:       doc.Title,
+		Description: doc.Description,
+		Link:        doc.HomePageURL,
+		FeedLink:    doc.FeedURL,
+		Language:    doc.Language,
+		Author:      person(doc.Author, doc.Authors),
+		FeedType:    "json",
+		FeedVersion: strings.TrimPrefix(doc.Version, "https://jsonfeed.org/version/"),
+	}
+	if doc.Icon != "" {
+		feed.Image = &gofeed.Image{URL: doc.Icon}
+	} else if doc.Favicon != "" {
+		feed.Image = &gofeed.Image{URL: doc.Favicon}
+	}
+	for n, it := range doc.Items {
+		i := &gofeed.Item{
+			GUID:        id(it.ID),
+			Link:        it.URL,
+			Title:       it.Title,
+			Content:     it.ContentHTML,
+			Description: it.Summary,
+			Published:   it.DatePublished,
+			Updated:     it.DateModified,
+			Author:      person(it.Author, it.Authors),
+			Categories:  it.Tags,
+		}
+		if i.Link == "" {
+			i.Link = it.ExternalURL
+		}
+		if i.Content == "" {
+			i.Content = it.ContentText
+		}
+		if i.Description == "" {
+			i.Description = it.ContentText
+		}
+		if i.Author == nil {
+			i.Author = feed.Author
+		}
+		i.PublishedParsed = date(it.DatePublished)
+		i.UpdatedParsed = date(it.DateModified)
+		if it.Image != "" {
+			i.Image = &gofeed.Image{URL: it.Image}
+		} else if it.BannerImage != "" {
+			i.Image = &gofeed.Image{URL: it.BannerImage}
+		}
+		for _, a := range it.Attachments {
+			e := &gofeed.Enclosure{URL: a.URL, Type: a.MimeType}
+			if a.SizeInBytes > 0 {
+				e.Length = fmt.Sprint(a.SizeInBytes)
+			}
+			i.Enclosures = append(i.Enclosures, e)
+		}
+		if it.Language != "" && it.Language != doc.Language {
+			custom(i, LanguageKey, it.Language)
+		}
+		for k, v := range raw.Items[n] {
+			if strings.HasPrefix(k, "_") {
+				custom(i, ExtensionPrefix+k, string(v))
+			}
+		}
+		feed.Items = append(feed.Items, i)
+	}
+	return feed, nil
+}
+
+// Source fetches and parses a JSON Feed. Use it as Feed.Source, or Parse as
+// Feed.Parse to keep the conditional requests of the regular fetch.
+type Source struct{}
+
+// NewFeed returns a feed of the JSON Feed at url.
+func NewFeed(url string, action feedtrigger.NewItemAction) *feedtrigger.Feed {
+	f := feedtrigger.NewFeed(url, action)
+	f.Source = Source{}
+	return f
+}
+
+// Fetch implements feedtrigger.Source.
+func (Source) Fetch(ctx context.Context, f feedtrigger.Feed) (*gofeed.Feed, error) {
+	body, err := feedtrigger.Download(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(f, body)
+}
+
+// id returns the item ID, which JSON Feed 1.0 allowed to be a number.
+func id(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	return strings.TrimSpace(string(raw))
+}
+
+// person returns the first of the 1.1 authors, the 1.0 author otherwise.
+func person(a *author, authors []author) *gofeed.Person {
+	if len(authors) > 0 {
+		a = &authors[0]
+	}
+	if a == nil || a.Name == "" {
+		return nil
+	}
+	return &gofeed.Person{Name: a.Name}
+}
+
+func date(s string) *time.Time {
+	if s == "" {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
+
+func custom(i *gofeed.Item, k, v string) {
+	if i.Custom == nil {
+		i.Custom = make(map[string]string)
+	}
+	i.Custom[k] = v
+}
@@ -0,0 +1,153 @@
+package feedtrigger
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// stopwords are the most frequent words of the languages written in the
+// Latin script, telling them apart.
+var stopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "in", "is", "for", "that", "with", "on", "this", "are", "by", "be", "from", "an", "or", "it", "as", "was", "has", "have", "not", "been", "which", "new", "can", "may", "via", "could", "allows", "vulnerability"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "mit", "von", "den", "zu", "ein", "eine", "auf", "für", "im", "sich", "des", "dem", "auch", "wird", "werden", "oder", "bei", "nach", "sind"},
+	"fr": {"le", "la", "les", "et", "des", "est", "une", "un", "du", "dans", "pour", "que", "qui", "sur", "pas", "par", "au", "avec", "sont", "ce", "aux", "été", "cette", "être"},
+	"es": {"el", "la", "los", "las", "y", "que", "del", "en", "un", "una", "por", "con", "para", "es", "se", "al", "lo", "como", "más", "pero", "sus", "ha", "este", "esta"},
+	"it": {"il", "di", "che", "la", "e", "per", "un", "una", "del", "della", "non", "sono", "gli", "le", "con", "è", "nel", "alla", "questo", "anche", "dei", "delle"},
+	"pt": {"o", "a", "os", "as", "de", "que", "do", "da", "em", "um", "uma", "para", "com", "não", "no", "na", "por", "mais", "dos", "das", "foi", "são", "ao"},
+	"nl": {"de", "het", "een", "en", "van", "is", "dat", "niet", "op", "te", "zijn", "met", "voor", "die", "wordt", "ook", "aan", "bij", "naar", "kan"},
+}
+
+// DetectLanguage guesses the ISO 639-1 code of the language of the text
+// from its script, the letters specific to a language and the frequent
+// words. It returns an empty string if the text is too short or ambiguous.
+func DetectLanguage(text string) string {
+	var latin, cyrillic, total int
+	scripts := map[string]int{}
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		total++
+		switch {
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.In(r, unicode.Hiragana, unicode.Katakana):
+			scripts["ja"]++
+		case unicode.Is(unicode.Han, r):
+			scripts["zh"]++
+		case unicode.Is(unicode.Hangul, r):
+			scripts["ko"]++
+		case unicode.Is(unicode.Arabic, r):
+			scripts["ar"]++
+		case unicode.Is(unicode.Hebrew, r):
+			scripts["he"]++
+		case unicode.Is(unicode.Greek, r):
+			scripts["el"]++
+		}
+	}
+	if total == 0 {
+		return ""
+	}
+	if scripts["ja"] > 0 {
+		// Japanese mixes kana with Han
+		scripts["ja"] += scripts["zh"]
+		scripts["zh"] = 0
+	}
+	best, max := "", 0
+	for lang, n := range scripts {
+		if n > max {
+			best, max = lang, n
+		}
+	}
+	switch {
+	case cyrillic > latin && cyrillic > max:
+		return cyrillicLanguage(text)
+	case latin > max:
+		return latinLanguage(text)
+	case max*2 > total:
+		return best
+	}
+	return ""
+}
+
+// cyrillicLanguage tells Russian from Ukrainian and Bulgarian by their
+// distinctive letters.
+func cyrillicLanguage(text string) string {
+	var ru, uk, bg int
+	for _, r := range strings.ToLower(text) {
+		switch r {
+		case 'ы', 'э', 'ё':
+			ru++
+		case 'ї', 'є', 'і', 'ґ':
+			uk++
+		case 'ъ':
+			bg++
+		}
+	}
+	switch {
+	case uk > ru && uk > bg:
+		return "uk"
+	case bg > ru && bg > uk:
+		return "bg"
+	}
+	return "ru"
+}
+
+// latinLanguage picks the language whose frequent words occur the most.
+func latinLanguage(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	})
+	scores := make(map[string]int, len(stopwords))
+	for lang, list := range stopwords {
+		set := make(map[string]bool, len(list))
+		for _, w := range list {
+			set[w] = true
+		}
+		for _, w := range words {
+			if set[w] {
+				scores[lang]++
+			}
+		}
+	}
+	best, max, tie := "", 0, false
+	for lang, n := range scores {
+		switch {
+		case n > max:
+			best, max, tie = lang, n, false
+		case n == max:
+			tie = true
+		}
+	}
+	if max == 0 || tie {
+		return ""
+	}
+	return best
+}
+
+// ItemLanguage detects the language of the item title and text.
+func ItemLanguage(i *gofeed.Item) string {
+	text := i.Description
+	if text == "" {
+		text = i.Content
+	}
+	return DetectLanguage(i.Title + " " + StripHTML(text))
+}
+
+// LanguageFilter passes items in one of the languages, given as ISO 639-1
+// codes, e.g. "en" and "ru". Items whose language can't be detected, like
+// a bare CVE identifier, pass too.
+func LanguageFilter(langs ...string) ItemFilter {
+	allowed := make(map[string]bool, len(langs))
+	for _, l := range langs {
+		allowed[strings.ToLower(l)] = true
+	}
+	return func(i *gofeed.Item) bool {
+		lang := ItemLanguage(i)
+		return lang == "" || allowed[lang]
+	}
+}
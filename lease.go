@@ -0,0 +1,131 @@
+package feedtrigger
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+const leasePrefix = "lease/"
+
+// DefaultLeaseTTL is the default time a lease outlives its last renewal.
+const DefaultLeaseTTL = time.Minute
+
+// leaseSettle is how long an instance waits after taking a lease before it
+// checks that no other instance took it at the same time.
+const leaseSettle = 200 * time.Millisecond
+
+// Leases make the instances sharing a store take turns polling each feed,
+// so only one of them polls it at a time. An instance holds the lease of a
+// feed while polling it and renews it every third of TTL. The lease of an
+// instance that died expires after TTL and another one takes over.
+//
+// Not every store can compare and swap, so the lease is taken by writing
+// it, waiting a moment and reading it back, which leaves a narrow window
+// for two instances to poll at once. The stored state keeps them from
+// triggering the items twice after that, and FeedAction.ExactlyOnce closes
+// the window with the stores that can.
+type Leases struct {
+	// Owner identifies the instance, the host name and process ID if
+	// empty.
+	Owner string
+	// TTL is DefaultLeaseTTL if zero.
+	TTL time.Duration
+}
+
+// lease is the stored lease of a feed.
+type lease struct {
+	Owner   string    `json:"owner"`
+	Expires time.Time `json:"expires"`
+}
+
+func (l *Leases) owner() string {
+	if l.Owner != "" {
+		return l.Owner
+	}
+	return instanceID()
+}
+
+// instanceID identifies the process by the host name and process ID.
+func instanceID() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s/%d", host, os.Getpid())
+}
+
+func (l *Leases) ttl() time.Duration {
+	if l.TTL > 0 {
+		return l.TTL
+	}
+	return DefaultLeaseTTL
+}
+
+// acquire takes the lease of the feed unless another live instance holds
+// it, in which case it returns its owner. The lease is renewed until
+// release is called.
+func (a *FeedAction) acquire(ctx context.Context, url string) (holder string, release func(), err error) {
+	owner, ttl := a.Leases.owner(), a.Leases.ttl()
+	key := leasePrefix + url
+
+	var cur lease
+	found, err := a.kv().Get(key, &cur)
+	if err != nil {
+		return "", nil, fmt.Errorf("get lease: %w", err)
+	}
+	if found && cur.Owner != owner && a.now().Before(cur.Expires) {
+		return cur.Owner, nil, nil
+	}
+	if err := a.kv().Set(key, lease{Owner: owner, Expires: a.now().Add(ttl)}); err != nil {
+		return "", nil, fmt.Errorf("storing lease: %w", err)
+	}
+	select {
+	case <-time.After(leaseSettle):
+	case <-ctx.Done():
+		return "", nil, ctx.Err()
+	}
+	if _, err := a.kv().Get(key, &cur); err != nil {
+		return "", nil, fmt.Errorf("get lease: %w", err)
+	}
+	if cur.Owner != owner {
+		return cur.Owner, nil, nil
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		t := a.clock().NewTicker(ttl / 3)
+		defer t.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-t.C():
+				if err := a.kv().Set(key, lease{Owner: owner, Expires: a.now().Add(ttl)}); err != nil {
+					a.logf("%s: renewing lease: %v", url, err)
+				}
+			}
+		}
+	}()
+	return "", func() {
+		close(stop)
+		<-done
+		var cur lease
+		if _, err := a.kv().Get(key, &cur); err != nil || cur.Owner != owner {
+			return
+		}
+		if err := a.kv().Delete(key); err != nil {
+			a.logf("%s: releasing lease: %v", url, err)
+		}
+	}, nil
+}
+
+// leased records the instance polling the feed instead of this one, empty
+// if it's this one. The feed is polled by another instance when that one
+// holds its lease or the feed is assigned to it in the cluster.
+func (a *FeedAction) leased(url, holder string) {
+	s := a.state(url)
+	s.mu.Lock()
+	s.leasedBy = holder
+	s.mu.Unlock()
+}
@@ -0,0 +1,83 @@
+package feedtrigger
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// LinkCheck is what to do with items whose link is dead (404 or 410).
+type LinkCheck int
+
+// Link check modes.
+const (
+	// LinkCheckOff doesn't check links.
+	LinkCheckOff LinkCheck = iota
+	// LinkCheckAnnotate sets the LinkStatusKey custom field of the item to
+	// the response status code.
+	LinkCheckAnnotate
+	// LinkCheckDrop skips items with dead links.
+	LinkCheckDrop
+	// LinkCheckArchive replaces dead links with the Wayback Machine ones.
+	LinkCheckArchive
+)
+
+// LinkStatusKey is the custom item field the link status is stored in.
+const LinkStatusKey = "feedtrigger_link_status"
+
+// SkipDeadLink is the reason of items dropped by LinkCheckDrop.
+const SkipDeadLink SkipReason = "dead link"
+
+const linkCheckTimeout = 10 * time.Second
+
+// checkLink applies the feed link check to the item. It returns the item to
+// trigger, a copy if it had to be changed, or false if it should be skipped.
+func (a *FeedAction) checkLink(ctx context.Context, f Feed, i *gofeed.Item) (*gofeed.Item, bool) {
+	if f.LinkCheck == LinkCheckOff || i.Link == "" {
+		return i, true
+	}
+
+	status := linkStatus(ctx, i.Link)
+	dead := status == http.StatusNotFound || status == http.StatusGone
+	switch f.LinkCheck {
+	case LinkCheckAnnotate:
+		if status != 0 {
+			i = copyItem(i)
+			setCustom(i, LinkStatusKey, strconv.Itoa(status))
+		}
+	case LinkCheckDrop:
+		if dead {
+			a.skip(f, i, SkipDeadLink, strconv.Itoa(status))
+			return nil, false
+		}
+	case LinkCheckArchive:
+		if dead {
+			i = copyItem(i)
+			setCustom(i, LinkStatusKey, strconv.Itoa(status))
+			i.Link = "https://web.archive.org/web/" + i.Link
+		}
+	}
+	return i, true
+}
+
+// linkStatus returns the status code of a HEAD request to the link or zero
+// if it can't be determined.
+func linkStatus(ctx context.Context, link string) int {
+	ctx, cancel := context.WithTimeout(ctx, linkCheckTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, link, nil)
+	if err != nil {
+		return 0
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
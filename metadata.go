@@ -0,0 +1,90 @@
+package feedtrigger
+
+import (
+	"context"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// MetadataPrefix is the prefix of the custom item fields holding the feed
+// metadata.
+const MetadataPrefix = "feedtrigger_meta_"
+
+// LabelPrefix is the prefix of the custom item fields holding the feed
+// labels.
+const LabelPrefix = "feedtrigger_label_"
+
+// FeedURLKey is the custom item field holding the URL of its feed.
+const FeedURLKey = "feedtrigger_feed"
+
+// FeedInfo identifies the feed an item came from.
+type FeedInfo struct {
+	URL      string
+	Labels   map[string]string
+	Metadata map[string]string
+}
+
+// ItemFeed returns the feed the item came from, so actions shared by
+// several feeds can tell them apart.
+func ItemFeed(i *gofeed.Item) FeedInfo {
+	return FeedInfo{
+		URL:      i.Custom[FeedURLKey],
+		Labels:   prefixed(i, LabelPrefix),
+		Metadata: prefixed(i, MetadataPrefix),
+	}
+}
+
+type feedKey struct{}
+
+// withFeed returns the context carrying the feed.
+func withFeed(ctx context.Context, f Feed) context.Context {
+	return context.WithValue(ctx, feedKey{}, FeedInfo{URL: f.URL, Labels: f.Labels, Metadata: f.Metadata})
+}
+
+// ContextFeed returns the feed whose item is being delivered with the
+// context.
+func ContextFeed(ctx context.Context) (FeedInfo, bool) {
+	f, ok := ctx.Value(feedKey{}).(FeedInfo)
+	return f, ok
+}
+
+// ItemMetadata returns the metadata of the feed the item came from.
+func ItemMetadata(i *gofeed.Item) map[string]string {
+	return prefixed(i, MetadataPrefix)
+}
+
+// ItemLabels returns the labels of the feed the item came from.
+func ItemLabels(i *gofeed.Item) map[string]string {
+	return prefixed(i, LabelPrefix)
+}
+
+// prefixed returns the custom fields of the item with the prefix, without
+// it.
+func prefixed(i *gofeed.Item, prefix string) map[string]string {
+	var m map[string]string
+	for k, v := range i.Custom {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		if m == nil {
+			m = make(map[string]string)
+		}
+		m[strings.TrimPrefix(k, prefix)] = v
+	}
+	return m
+}
+
+// annotate adds the feed URL, labels and metadata to the custom fields of
+// the items.
+func (f Feed) annotate(items []*gofeed.Item) {
+	for _, i := range items {
+		setCustom(i, FeedURLKey, f.URL)
+		for k, v := range f.Labels {
+			setCustom(i, LabelPrefix+k, v)
+		}
+		for k, v := range f.Metadata {
+			setCustom(i, MetadataPrefix+k, v)
+		}
+	}
+}
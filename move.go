@@ -0,0 +1,98 @@
+package feedtrigger
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/philippgille/gokv"
+)
+
+// feedPrefixes prefix the feed URL in the store keys of the per-feed state.
+var feedPrefixes = []string{"", outboxPrefix, deadLetterPrefix, brandingPrefix, statsPrefix, notifiedPrefix, heldPrefix, auditPrefix}
+
+// moveFeed carries the state of the feed over to the URL it permanently
+// redirects to and polls that one instead: the stored records move to the
+// keys of the new URL unless it has its own state already, and the
+// deduplicated items are attributed to it.
+func (a *FeedAction) moveFeed(f Feed, to string) error {
+	from := f.URL
+	if err := a.moveState(a.feedKV(from), from, to); err != nil {
+		return err
+	}
+
+	if a.Dedup != nil {
+		a.dedupMu.Lock()
+		set, err := a.dedupSet()
+		if err == nil {
+			for k, e := range set {
+				if e.Feed == from {
+					e.Feed = to
+					set[k] = e
+				}
+			}
+			err = a.storeDedup(set, a.now().UTC())
+		}
+		a.dedupMu.Unlock()
+		if err != nil {
+			return fmt.Errorf("moving %s: %w", from, err)
+		}
+	}
+
+	moved := f
+	moved.URL = to
+	a.RemoveFeed(from)
+	if err := a.AddFeed(moved); err != nil {
+		return fmt.Errorf("moving %s: %w", from, err)
+	}
+	a.logf("%s: moved permanently to %s", from, to)
+	if a.OnFeedMoved != nil {
+		a.OnFeedMoved(from, to)
+	}
+	return nil
+}
+
+// moveState moves the records of the feed in the store to the keys of the
+// new URL unless it has its own state already.
+func (a *FeedAction) moveState(kv gokv.Store, from, to string) error {
+	if from == to {
+		return nil
+	}
+	// lock in the order of the URLs, a move the other way at the same
+	// time would deadlock otherwise
+	first, second := a.state(from), a.state(to)
+	if to < from {
+		first, second = second, first
+	}
+	first.headMu.Lock()
+	second.headMu.Lock()
+	unlock := func() {
+		second.headMu.Unlock()
+		first.headMu.Unlock()
+	}
+	for _, p := range feedPrefixes {
+		k, nk := p+from, p+to
+		var v json.RawMessage
+		found, err := kv.Get(k, &v)
+		if err != nil {
+			unlock()
+			return fmt.Errorf("moving %s: %w", from, err)
+		}
+		if !found {
+			continue
+		}
+		var existing json.RawMessage
+		taken, err := kv.Get(nk, &existing)
+		if err == nil && !taken {
+			err = kv.Set(nk, v)
+		}
+		if err == nil {
+			err = kv.Delete(k)
+		}
+		if err != nil {
+			unlock()
+			return fmt.Errorf("moving %s: %w", from, err)
+		}
+	}
+	unlock()
+	return nil
+}
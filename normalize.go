@@ -0,0 +1,68 @@
+package feedtrigger
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+)
+
+var (
+	scriptRe = regexp.MustCompile(`(?is)<(script|style)\b.*?</(script|style)\s*>`)
+	tagRe    = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// StripHTML removes the tags from s, decodes the entities and collapses the
+// whitespace.
+func StripHTML(s string) string {
+	s = scriptRe.ReplaceAllString(s, " ")
+	s = tagRe.ReplaceAllString(s, " ")
+	return strings.Join(strings.Fields(html.UnescapeString(s)), " ")
+}
+
+// normalize converts the item dates to UTC and, if the feed is Normalize,
+// cleans the text fields of the items and resolves their relative links
+// against the feed link, or the feed URL if it has none.
+func (f Feed) normalize(feed *gofeed.Feed) {
+	f.normalizeTimes(feed.Items)
+	if !f.Normalize {
+		return
+	}
+	base, err := url.Parse(f.URL)
+	if err != nil {
+		return
+	}
+	if feed.Link != "" {
+		if l, err := base.Parse(feed.Link); err == nil {
+			base = l
+		}
+	}
+	resolve := func(ref string) string {
+		if ref == "" {
+			return ""
+		}
+		u, err := base.Parse(strings.TrimSpace(ref))
+		if err != nil {
+			return ref
+		}
+		return u.String()
+	}
+
+	for _, i := range feed.Items {
+		i.Title = StripHTML(i.Title)
+		i.Description = StripHTML(i.Description)
+		i.Content = StripHTML(i.Content)
+		if i.Author != nil {
+			i.Author.Name = StripHTML(i.Author.Name)
+		}
+		i.Link = resolve(i.Link)
+		if i.Image != nil {
+			i.Image.URL = resolve(i.Image.URL)
+		}
+		for _, e := range i.Enclosures {
+			e.URL = resolve(e.URL)
+		}
+	}
+}
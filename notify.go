@@ -0,0 +1,85 @@
+package feedtrigger
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// SkipRenotified is the reason of items whose title or link the feed
+// triggered within its NotifyWindow.
+const SkipRenotified SkipReason = "renotified"
+
+const notifiedPrefix = "notified/"
+
+// notifyKeys returns the hashes of the normalized title and link of the
+// item, the ones not empty.
+func notifyKeys(i *gofeed.Item) []string {
+	var keys []string
+	title := strings.ToLower(strings.Join(strings.Fields(i.Title), " "))
+	for _, k := range []string{"title:" + title, "link:" + DedupByLink(i)} {
+		if strings.HasSuffix(k, ":") {
+			continue
+		}
+		sum := sha1.Sum([]byte(k))
+		keys = append(keys, hex.EncodeToString(sum[:]))
+	}
+	return keys
+}
+
+// notify records the item as notified unless the feed triggered an item of
+// the same title or link within its NotifyWindow, in which case it returns
+// false. Replayed items are recorded without the check. The returned
+// release undoes the record if triggering fails.
+func (a *FeedAction) notify(f Feed, i *gofeed.Item, replay bool) (ok bool, release func(), err error) {
+	noop := func() {}
+	if f.NotifyWindow <= 0 || IsCanary(i) {
+		return true, noop, nil
+	}
+	keys := notifyKeys(i)
+	if len(keys) == 0 {
+		return true, noop, nil
+	}
+
+	a.notifyMu.Lock()
+	defer a.notifyMu.Unlock()
+	kv := a.feedKV(f.URL)
+	notified := make(map[string]time.Time)
+	if _, err := kv.Get(notifiedPrefix+f.URL, &notified); err != nil {
+		return false, noop, err
+	}
+	now := a.now().UTC()
+	for k, at := range notified {
+		if now.Sub(at) >= f.NotifyWindow {
+			delete(notified, k)
+		}
+	}
+	for _, k := range keys {
+		if _, found := notified[k]; found && !replay {
+			return false, noop, nil
+		}
+	}
+	for _, k := range keys {
+		notified[k] = now
+	}
+	if err := kv.Set(notifiedPrefix+f.URL, notified); err != nil {
+		return false, noop, err
+	}
+	return true, func() {
+		a.notifyMu.Lock()
+		defer a.notifyMu.Unlock()
+		notified := make(map[string]time.Time)
+		if _, err := kv.Get(notifiedPrefix+f.URL, &notified); err != nil {
+			return
+		}
+		for _, k := range keys {
+			if notified[k].Equal(now) {
+				delete(notified, k)
+			}
+		}
+		kv.Set(notifiedPrefix+f.URL, notified)
+	}, nil
+}
@@ -0,0 +1,126 @@
+package feedtrigger
+
+import (
+	"log"
+
+	"github.com/philippgille/gokv"
+
+	"ilya.app/feedtrigger/stores"
+)
+
+// Option configures the application built by New.
+type Option func(*FeedAction) error
+
+// WithStore keeps the state in the store.
+func WithStore(s gokv.Store) Option {
+	return func(a *FeedAction) error {
+		a.Store = s
+		return nil
+	}
+}
+
+// WithStoreDSN keeps the state in the store opened by stores.Open, e.g.
+// "bolt:///var/lib/feedtrigger.db".
+func WithStoreDSN(dsn string) Option {
+	return func(a *FeedAction) error {
+		s, err := stores.Open(dsn)
+		if err != nil {
+			return err
+		}
+		a.Store = s
+		return nil
+	}
+}
+
+// WithFeeds adds the feeds.
+func WithFeeds(ff ...Feed) Option {
+	return func(a *FeedAction) error {
+		a.Feeds = append(a.Feeds, ff...)
+		return nil
+	}
+}
+
+// WithNamespace prefixes the stored keys, see FeedAction.Namespace.
+func WithNamespace(ns string) Option {
+	return func(a *FeedAction) error {
+		a.Namespace = ns
+		return nil
+	}
+}
+
+// WithLogger sends the log of the application to the logger.
+func WithLogger(l *log.Logger) Option {
+	return func(a *FeedAction) error {
+		a.Logger = l
+		return nil
+	}
+}
+
+// WithMaxConcurrency bounds the polls at once, see
+// FeedAction.MaxConcurrentPolls.
+func WithMaxConcurrency(n int) Option {
+	return func(a *FeedAction) error {
+		a.MaxConcurrentPolls = n
+		return nil
+	}
+}
+
+// WithHostRateLimit limits the requests per second to a host, see
+// FeedAction.HostRateLimit.
+func WithHostRateLimit(rps float64, burst int) Option {
+	return func(a *FeedAction) error {
+		a.HostRateLimit, a.HostBurst = rps, burst
+		return nil
+	}
+}
+
+// WithProxy fetches the feeds without their own proxy through the proxy.
+func WithProxy(proxy string) Option {
+	return func(a *FeedAction) error {
+		a.Proxy = proxy
+		return nil
+	}
+}
+
+// WithClock makes the application use the clock, see FeedAction.Clock.
+func WithClock(c Clock) Option {
+	return func(a *FeedAction) error {
+		a.Clock = c
+		return nil
+	}
+}
+
+// WithFetcher replaces the fetching of the feeds, see FeedAction.Fetcher.
+func WithFetcher(f Fetcher) Option {
+	return func(a *FeedAction) error {
+		a.Fetcher = f
+		return nil
+	}
+}
+
+// WithDryRun logs what the application would do without running the
+// actions or changing the state.
+func WithDryRun() Option {
+	return func(a *FeedAction) error {
+		a.DryRun = true
+		return nil
+	}
+}
+
+// WithFollowMoves polls the URLs the feeds permanently redirect to instead
+// of the configured ones, see FeedAction.FollowMoves.
+func WithFollowMoves() Option {
+	return func(a *FeedAction) error {
+		a.FollowMoves = true
+		return nil
+	}
+}
+
+// WithStagger spreads the first polls over the refresh periods, see
+// FeedAction.Stagger.
+func WithStagger() Option {
+	return func(a *FeedAction) error {
+		a.Stagger = true
+		return nil
+	}
+}
@@ -0,0 +1,113 @@
+package feedtrigger
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/mmcdole/gofeed"
+)
+
+const outboxPrefix = "outbox/"
+
+// Pending returns items of the feed stored in the outbox and not yet
+// delivered.
+func (a *FeedAction) Pending(feedURL string) ([]*gofeed.Item, error) {
+	feedURL = NormalizeURL(feedURL)
+	a.outboxMu.Lock()
+	defer a.outboxMu.Unlock()
+	return a.pending(feedURL)
+}
+
+// enqueue adds the items to the outbox of the feed.
+func (a *FeedAction) enqueue(f Feed, items []*gofeed.Item) error {
+	a.outboxMu.Lock()
+	defer a.outboxMu.Unlock()
+
+	pending, err := a.pending(f.URL)
+	if err != nil {
+		return err
+	}
+	queued := make(map[string]bool, len(pending))
+	for _, i := range pending {
+		queued[ItemID(i)] = true
+	}
+	for _, i := range items {
+		if !queued[ItemID(i)] {
+			pending = append(pending, i)
+		}
+	}
+	return a.storePending(f.URL, pending)
+}
+
+// dequeue removes the item with the ID from the outbox of the feed.
+func (a *FeedAction) dequeue(feedURL, id string) error {
+	a.outboxMu.Lock()
+	defer a.outboxMu.Unlock()
+
+	pending, err := a.pending(feedURL)
+	if err != nil {
+		return err
+	}
+	for n, i := range pending {
+		if ItemID(i) == id {
+			pending = append(pending[:n], pending[n+1:]...)
+			break
+		}
+	}
+	return a.storePending(feedURL, pending)
+}
+
+type replayKey struct{}
+
+// replaying reports whether the item handled with the context is replayed
+// from the outbox. The interrupted run may have recorded it in the
+// NotifyWindow already, so it isn't suppressed as renotified.
+func replaying(ctx context.Context) bool {
+	replay, _ := ctx.Value(replayKey{}).(bool)
+	return replay
+}
+
+// replayOutbox delivers the items left in the outboxes of the feeds by an
+// interrupted run.
+func (a *FeedAction) replayOutbox(ctx context.Context, feeds []Feed) error {
+	ctx = context.WithValue(ctx, replayKey{}, true)
+	for _, f := range feeds {
+		pending, err := a.Pending(f.URL)
+		if err != nil {
+			return err
+		}
+		for _, item := range pending {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if _, err := a.handle(ctx, f, item); err != nil {
+				return err
+			}
+			if err := a.dequeue(f.URL, ItemID(item)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (a *FeedAction) pending(feedURL string) ([]*gofeed.Item, error) {
+	var pending []*gofeed.Item
+	if _, err := a.feedKV(feedURL).Get(outboxPrefix+feedURL, &pending); err != nil {
+		return nil, fmt.Errorf("get outbox: %w", err)
+	}
+	return pending, nil
+}
+
+func (a *FeedAction) storePending(feedURL string, pending []*gofeed.Item) error {
+	if len(pending) == 0 {
+		if err := a.feedKV(feedURL).Delete(outboxPrefix + feedURL); err != nil {
+			return fmt.Errorf("clearing outbox: %w", err)
+		}
+		return nil
+	}
+	if err := a.feedKV(feedURL).Set(outboxPrefix+feedURL, pending); err != nil {
+		return fmt.Errorf("storing outbox: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package feedtrigger
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger/stores"
+)
+
+// TestReplayNotified replays an item the interrupted run recorded in the
+// NotifyWindow before triggering it.
+func TestReplayNotified(t *testing.T) {
+	var triggered []string
+	f := NewFeed("http://example.com/feed.xml", func(i *gofeed.Item) error {
+		triggered = append(triggered, i.GUID)
+		return nil
+	})
+	f.NotifyWindow = time.Hour
+	app, err := New(WithStore(&stores.MemoryStore{}), WithFeeds(*f))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.Logger = log.New(ioutil.Discard, "", 0)
+	app.Outbox = true
+	feed := app.ListFeeds()[0]
+
+	item := &gofeed.Item{GUID: "1", Title: "Hello", Link: "http://example.com/1"}
+	if err := app.enqueue(feed, []*gofeed.Item{item}); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _, err := app.notify(feed, item, false); !ok || err != nil {
+		t.Fatalf("notify: %v, %v", ok, err)
+	}
+
+	if err := app.replayOutbox(context.Background(), []Feed{feed}); err != nil {
+		t.Fatal(err)
+	}
+	if len(triggered) != 1 {
+		t.Fatalf("triggered %v", triggered)
+	}
+	if pending, err := app.Pending(feed.URL); err != nil || len(pending) != 0 {
+		t.Fatalf("pending %v, %v", pending, err)
+	}
+
+	// the window still holds for the items of the next polls
+	again := &gofeed.Item{GUID: "2", Title: "Hello", Link: "http://example.com/2"}
+	if ok, _, err := app.notify(feed, again, false); ok || err != nil {
+		t.Errorf("renotified: %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,99 @@
+package feedtrigger
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// Overflow is what to do with the new items over Feed.MaxItemsPerPoll.
+type Overflow int
+
+// Overflow policies.
+const (
+	// OverflowDrop skips the items.
+	OverflowDrop Overflow = iota
+	// OverflowDigest passes the items to Feed.OnOverflow in one call.
+	OverflowDigest
+	// OverflowDeadLetter puts the items to the dead-letter queue to be
+	// retried later.
+	OverflowDeadLetter
+)
+
+// SkipOverflow is the reason of items dropped by OverflowDrop.
+const SkipOverflow SkipReason = "overflow"
+
+// errOverflow is the dead-letter error of the items over the limit.
+var errOverflow = errors.New("over the per-poll item limit")
+
+var overflowNames = map[Overflow]string{
+	OverflowDrop:       "drop",
+	OverflowDigest:     "digest",
+	OverflowDeadLetter: "deadletter",
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (o Overflow) MarshalText() ([]byte, error) {
+	name, ok := overflowNames[o]
+	if !ok {
+		return nil, fmt.Errorf("unknown overflow policy %d", o)
+	}
+	return []byte(name), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (o *Overflow) UnmarshalText(b []byte) error {
+	for v, name := range overflowNames {
+		if name == string(b) {
+			*o = v
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown overflow policy %q", b)
+}
+
+// limit splits the new items in trigger order into the ones to trigger,
+// the newest MaxItemsPerPoll, and the rest.
+func (f Feed) limit(items []*gofeed.Item) (keep, rest []*gofeed.Item) {
+	n := f.MaxItemsPerPoll
+	if n <= 0 || len(items) <= n {
+		return items, nil
+	}
+	if f.NewestFirst {
+		return items[:n], items[n:]
+	}
+	return items[len(items)-n:], items[:len(items)-n]
+}
+
+// overflow handles the items over the per-poll limit.
+func (a *FeedAction) overflow(f Feed, items []*gofeed.Item) error {
+	if len(items) == 0 {
+		return nil
+	}
+	switch f.Overflow {
+	case OverflowDigest:
+		if f.OnOverflow == nil {
+			break
+		}
+		digest := make([]*gofeed.Item, len(items))
+		for n, i := range items {
+			digest[n] = a.redact(i)
+		}
+		if err := f.OnOverflow(digest); err != nil {
+			return fmt.Errorf("overflow func: %w", err)
+		}
+		return nil
+	case OverflowDeadLetter:
+		for _, i := range items {
+			if err := a.bury(f, i, errOverflow, 0); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for _, i := range items {
+		a.skip(f, i, SkipOverflow, fmt.Sprintf("limit %d", f.MaxItemsPerPoll))
+	}
+	return nil
+}
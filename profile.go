@@ -0,0 +1,207 @@
+package feedtrigger
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// ItemFilter reports whether the new item should be triggered.
+type ItemFilter func(*gofeed.Item) bool
+
+// Profile is a named bundle of feed settings. Feeds referencing a profile by
+// name inherit every setting they don't define themselves.
+type Profile struct {
+	Name          string
+	RefreshPeriod time.Duration
+	Headers       http.Header
+	Proxy         string
+	TLS           *TLSConfig
+	MaxBodySize   int64
+	FetchTimeout  time.Duration
+	Adaptive      *AdaptiveInterval
+	Charset       string
+	Location      *time.Location
+	DateLayouts   []string
+	// Filters are run before the feed's own filters.
+	Filters []ItemFilter
+	// Enrichers are run before the feed's own enrichers.
+	Enrichers   []Enricher
+	OnNewRecord NewItemAction
+	// OnNewRecordCtx is inherited along with OnNewRecord.
+	OnNewRecordCtx NewItemActionCtx
+	ActionTimeout  time.Duration
+	Retry          *RetryPolicy
+	Actions        []Step
+	OnNewBatch     NewBatchAction
+	// Metadata is merged with the feed metadata, the feed values win.
+	Metadata map[string]string
+	// Labels are merged with the feed labels, the feed values win.
+	Labels   map[string]string
+	FirstRun FirstRun
+	// MaxItemsPerPoll and the overflow settings apply to feeds without
+	// a limit.
+	MaxItemsPerPoll int
+	Overflow        Overflow
+	OnOverflow      NewBatchAction
+	Normalize       bool
+	NotifyWindow    time.Duration
+	DeliveryWindows []DeliveryWindow
+	Digest          string
+	Priority        int
+	MaxItemAge      time.Duration
+	Detector        ChangeDetector
+	SortByPublished bool
+	EmptyPolicy     EmptyPolicy
+	MaxEmptyPolls   int
+	Anomalies       *AnomalyDetector
+	OnAnomaly       AnomalyAction
+}
+
+// apply fills in the feed settings missing locally.
+func (p *Profile) apply(f *Feed) {
+	if f.RefreshPeriod == 0 {
+		f.RefreshPeriod = p.RefreshPeriod
+	}
+	if f.MaxItemsPerPoll == 0 {
+		f.MaxItemsPerPoll = p.MaxItemsPerPoll
+		f.Overflow = p.Overflow
+		f.OnOverflow = p.OnOverflow
+	}
+	if f.Proxy == "" {
+		f.Proxy = p.Proxy
+	}
+	if f.TLS == nil {
+		f.TLS = p.TLS
+	}
+	if f.MaxBodySize == 0 {
+		f.MaxBodySize = p.MaxBodySize
+	}
+	if f.FetchTimeout == 0 {
+		f.FetchTimeout = p.FetchTimeout
+	}
+	if f.Charset == "" {
+		f.Charset = p.Charset
+	}
+	if f.Location == nil {
+		f.Location = p.Location
+	}
+	if len(f.DateLayouts) == 0 {
+		f.DateLayouts = p.DateLayouts
+	}
+	if f.Adaptive == nil {
+		f.Adaptive = p.Adaptive
+	}
+	if f.ActionTimeout == 0 {
+		f.ActionTimeout = p.ActionTimeout
+	}
+	if f.Retry == nil {
+		f.Retry = p.Retry
+	}
+	if f.FirstRun == FirstRunSkip {
+		f.FirstRun = p.FirstRun
+	}
+	if !f.Normalize {
+		f.Normalize = p.Normalize
+	}
+	if f.NotifyWindow == 0 {
+		f.NotifyWindow = p.NotifyWindow
+	}
+	if len(f.DeliveryWindows) == 0 {
+		f.DeliveryWindows = p.DeliveryWindows
+	}
+	if f.Digest == "" {
+		f.Digest = p.Digest
+	}
+	if f.Priority == 0 {
+		f.Priority = p.Priority
+	}
+	if f.MaxItemAge == 0 {
+		f.MaxItemAge = p.MaxItemAge
+	}
+	if f.Detector == nil {
+		f.Detector = p.Detector
+	}
+	if !f.SortByPublished {
+		f.SortByPublished = p.SortByPublished
+	}
+	if f.EmptyPolicy == EmptySkip {
+		f.EmptyPolicy = p.EmptyPolicy
+	}
+	if f.MaxEmptyPolls == 0 {
+		f.MaxEmptyPolls = p.MaxEmptyPolls
+	}
+	if f.Anomalies == nil {
+		f.Anomalies = p.Anomalies
+		f.OnAnomaly = p.OnAnomaly
+	}
+	if f.OnNewRecord == nil && f.OnNewRecordCtx == nil && len(f.Actions) == 0 && f.OnNewBatch == nil {
+		f.OnNewRecord = p.OnNewRecord
+		f.OnNewRecordCtx = p.OnNewRecordCtx
+		f.Actions = p.Actions
+		f.OnNewBatch = p.OnNewBatch
+	}
+	if len(p.Headers) > 0 {
+		h := make(http.Header, len(p.Headers)+len(f.Headers))
+		for k, v := range p.Headers {
+			h[k] = v
+		}
+		for k, v := range f.Headers {
+			h[k] = v
+		}
+		f.Headers = h
+	}
+	if len(p.Metadata) > 0 {
+		m := make(map[string]string, len(p.Metadata)+len(f.Metadata))
+		for k, v := range p.Metadata {
+			m[k] = v
+		}
+		for k, v := range f.Metadata {
+			m[k] = v
+		}
+		f.Metadata = m
+	}
+	if len(p.Labels) > 0 {
+		l := make(map[string]string, len(p.Labels)+len(f.Labels))
+		for k, v := range p.Labels {
+			l[k] = v
+		}
+		for k, v := range f.Labels {
+			l[k] = v
+		}
+		f.Labels = l
+	}
+	if len(p.Enrichers) > 0 {
+		f.Enrichers = append(append([]Enricher{}, p.Enrichers...), f.Enrichers...)
+	}
+	if len(p.Filters) > 0 {
+		f.Filters = append(append([]ItemFilter{}, p.Filters...), f.Filters...)
+	}
+}
+
+// applyProfiles resolves profile references of the feeds.
+func (a *FeedAction) applyProfiles() error {
+	for i := range a.Feeds {
+		if err := a.applyProfile(&a.Feeds[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// applyProfile resolves the profile reference of the feed, then fills in
+// the settings of its group.
+func (a *FeedAction) applyProfile(f *Feed) error {
+	if f.Profile == "" {
+		return a.applyGroup(f)
+	}
+	p, ok := a.Profiles[f.Profile]
+	if !ok {
+		return fmt.Errorf("feed %s: unknown profile %q", f.URL, f.Profile)
+	}
+	p.apply(f)
+	f.Profile = ""
+	return a.applyGroup(f)
+}
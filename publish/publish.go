@@ -0,0 +1,319 @@
+// Package publish re-publishes items triggered across feeds as a single
+// merged Atom, RSS or JSON Feed.
+package publish
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+)
+
+// DefaultMaxItems is the default number of items in the output feed.
+const DefaultMaxItems = 100
+
+// Entry is a published item with its source attribution.
+type Entry struct {
+	Item        *gofeed.Item
+	Source      string
+	SourceTitle string
+	Received    time.Time
+}
+
+// Publisher collects triggered items and serves them as a feed.
+type Publisher struct {
+	Title    string
+	Link     string
+	MaxItems int
+
+	mu      sync.RWMutex
+	entries []Entry
+}
+
+// New returns a publisher of the feed with the title.
+func New(title, link string) *Publisher {
+	return &Publisher{
+		Title:    title,
+		Link:     link,
+		MaxItems: DefaultMaxItems,
+	}
+}
+
+// Action returns a trigger action adding items of the source feed to the
+// output. The title is used for attribution and may be empty.
+func (p *Publisher) Action(source, title string) feedtrigger.NewItemAction {
+	return func(i *gofeed.Item) error {
+		p.Add(Entry{
+			Item:        i,
+			Source:      source,
+			SourceTitle: title,
+			Received:    time.Now().UTC(),
+		})
+		return nil
+	}
+}
+
+// Add puts the entry on top of the output feed.
+func (p *Publisher) Add(e Entry) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	max := p.MaxItems
+	if max <= 0 {
+		max = DefaultMaxItems
+	}
+	p.entries = append([]Entry{e}, p.entries...)
+	if len(p.entries) > max {
+		p.entries = p.entries[:max]
+	}
+}
+
+// Entries returns published entries, newest first.
+func (p *Publisher) Entries() []Entry {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return append([]Entry(nil), p.entries...)
+}
+
+// ServeHTTP writes the output feed. The format is picked by the path suffix
+// (.atom, .rss, .json) or the format query parameter, Atom by default.
+func (p *Publisher) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		switch {
+		case strings.HasSuffix(r.URL.Path, ".rss"), strings.HasSuffix(r.URL.Path, ".xml"):
+			format = "rss"
+		case strings.HasSuffix(r.URL.Path, ".json"):
+			format = "json"
+		default:
+			format = "atom"
+		}
+	}
+
+	entries := p.Entries()
+	var err error
+	switch format {
+	case "atom":
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		err = p.writeXML(w, p.atom(entries))
+	case "rss":
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		err = p.writeXML(w, p.rss(entries))
+	case "json":
+		w.Header().Set("Content-Type", "application/feed+json; charset=utf-8")
+		err = json.NewEncoder(w).Encode(p.jsonFeed(entries))
+	default:
+		http.Error(w, "unknown format "+format, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (p *Publisher) writeXML(w http.ResponseWriter, v interface{}) error {
+	if _, err := w.Write([]byte(xml.Header)); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(v)
+}
+
+func (p *Publisher) updated(entries []Entry) time.Time {
+	if len(entries) == 0 {
+		return time.Now().UTC()
+	}
+	return entries[0].Received
+}
+
+func sourceTitle(e Entry) string {
+	if e.SourceTitle != "" {
+		return e.SourceTitle
+	}
+	return e.Source
+}
+
+func published(e Entry) time.Time {
+	switch {
+	case e.Item.PublishedParsed != nil:
+		return e.Item.PublishedParsed.UTC()
+	case e.Item.UpdatedParsed != nil:
+		return e.Item.UpdatedParsed.UTC()
+	}
+	return e.Received
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Link    *atomLink   `xml:"link,omitempty"`
+	Updated string      `xml:"updated"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Title   string     `xml:"title"`
+	ID      string     `xml:"id"`
+	Link    atomLink   `xml:"link"`
+	Updated string     `xml:"updated"`
+	Author  *atomName  `xml:"author,omitempty"`
+	Summary string     `xml:"summary,omitempty"`
+	Source  atomSource `xml:"source"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomName struct {
+	Name string `xml:"name"`
+}
+
+type atomSource struct {
+	ID    string   `xml:"id"`
+	Title string   `xml:"title"`
+	Link  atomLink `xml:"link"`
+}
+
+func (p *Publisher) atom(entries []Entry) atomFeed {
+	feed := atomFeed{
+		Title:   p.Title,
+		ID:      p.Link,
+		Updated: p.updated(entries).Format(time.RFC3339),
+	}
+	if feed.ID == "" {
+		feed.ID = "urn:feedtrigger:publish"
+	}
+	if p.Link != "" {
+		feed.Link = &atomLink{Href: p.Link, Rel: "self"}
+	}
+	for _, e := range entries {
+		entry := atomEntry{
+			Title:   e.Item.Title,
+			ID:      feedtrigger.ItemID(e.Item),
+			Link:    atomLink{Href: e.Item.Link},
+			Updated: published(e).Format(time.RFC3339),
+			Summary: e.Item.Description,
+			Source: atomSource{
+				ID:    e.Source,
+				Title: sourceTitle(e),
+				Link:  atomLink{Href: e.Source, Rel: "self"},
+			},
+		}
+		if e.Item.Author != nil && e.Item.Author.Name != "" {
+			entry.Author = &atomName{Name: e.Item.Author.Name}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return feed
+}
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	GUID        string    `xml:"guid"`
+	PubDate     string    `xml:"pubDate"`
+	Description string    `xml:"description,omitempty"`
+	Source      rssSource `xml:"source"`
+}
+
+type rssSource struct {
+	URL   string `xml:"url,attr"`
+	Title string `xml:",chardata"`
+}
+
+func (p *Publisher) rss(entries []Entry) rss {
+	out := rss{
+		Version: "2.0",
+		Channel: rssChannel{
+			Title:         p.Title,
+			Link:          p.Link,
+			Description:   p.Title,
+			LastBuildDate: p.updated(entries).Format(time.RFC1123Z),
+		},
+	}
+	for _, e := range entries {
+		out.Channel.Items = append(out.Channel.Items, rssItem{
+			Title:       e.Item.Title,
+			Link:        e.Item.Link,
+			GUID:        feedtrigger.ItemID(e.Item),
+			PubDate:     published(e).Format(time.RFC1123Z),
+			Description: e.Item.Description,
+			Source:      rssSource{URL: e.Source, Title: sourceTitle(e)},
+		})
+	}
+	return out
+}
+
+type jsonFeed struct {
+	Version string     `json:"version"`
+	Title   string     `json:"title"`
+	FeedURL string     `json:"feed_url,omitempty"`
+	Items   []jsonItem `json:"items"`
+}
+
+type jsonItem struct {
+	ID            string     `json:"id"`
+	URL           string     `json:"url,omitempty"`
+	Title         string     `json:"title,omitempty"`
+	ContentHTML   string     `json:"content_html,omitempty"`
+	Summary       string     `json:"summary,omitempty"`
+	DatePublished string     `json:"date_published,omitempty"`
+	Authors       []jsonName `json:"authors,omitempty"`
+	Source        jsonSource `json:"_feedtrigger"`
+}
+
+type jsonName struct {
+	Name string `json:"name"`
+}
+
+type jsonSource struct {
+	Source      string `json:"source"`
+	SourceTitle string `json:"source_title"`
+}
+
+func (p *Publisher) jsonFeed(entries []Entry) jsonFeed {
+	out := jsonFeed{
+		Version: "https://jsonfeed.org/version/1.1",
+		Title:   p.Title,
+		FeedURL: p.Link,
+		Items:   []jsonItem{},
+	}
+	for _, e := range entries {
+		item := jsonItem{
+			ID:            feedtrigger.ItemID(e.Item),
+			URL:           e.Item.Link,
+			Title:         e.Item.Title,
+			ContentHTML:   e.Item.Content,
+			Summary:       e.Item.Description,
+			DatePublished: published(e).Format(time.RFC3339),
+			Source:        jsonSource{Source: e.Source, SourceTitle: sourceTitle(e)},
+		}
+		if e.Item.Author != nil && e.Item.Author.Name != "" {
+			item.Authors = []jsonName{{Name: e.Item.Author.Name}}
+		}
+		out.Items = append(out.Items, item)
+	}
+	return out
+}
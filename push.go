@@ -0,0 +1,142 @@
+package feedtrigger
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// ErrUnknownFeed is returned when pushing to a feed that isn't configured.
+var ErrUnknownFeed = errors.New("unknown feed")
+
+// Push runs the feed document received from elsewhere, e.g. a script or a
+// partner, through the pipeline of the configured feed with the url as if
+// it was polled: the new items are triggered and the state is stored. It
+// may hold only some of the items, the seen ones are remembered for
+// SeenTTL regardless.
+func (a *FeedAction) Push(ctx context.Context, url string, feed *gofeed.Feed) (PollInfo, error) {
+	url = NormalizeURL(url)
+	info := PollInfo{Feed: url, Start: a.now()}
+	var (
+		f     Feed
+		found bool
+	)
+	for _, ff := range a.ListFeeds() {
+		if ff.URL == url {
+			f, found = ff, true
+			break
+		}
+	}
+	if !found {
+		return info, fmt.Errorf("%s: %w", url, ErrUnknownFeed)
+	}
+	if len(feed.Items) == 0 {
+		return info, errors.New("no items")
+	}
+
+	err := a.process(ctx, f, feed, &info, true)
+	info.Duration = a.now().Sub(info.Start)
+	info.Cost = a.state(url).takeCost()
+	info.Err = err
+	a.polled(info)
+	if a.OnPoll != nil {
+		a.OnPoll(info)
+	}
+	if err != nil {
+		a.publish(Event{Type: EventPollError, Feed: url, Poll: &info})
+	}
+	return info, err
+}
+
+// PushHandler receives pushed documents for Push. The url query parameter
+// is the feed and the body an Atom, RSS or JSON feed, or a JSON item or
+// array of items sent as application/json. Requests must carry the token
+// as a bearer token unless it's empty.
+func (a *FeedAction) PushHandler(token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if token != "" && subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) != 1 {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		url := r.URL.Query().Get("url")
+		var f Feed
+		for _, ff := range a.ListFeeds() {
+			if ff.URL == url {
+				f = ff
+			}
+		}
+		if f.URL == "" {
+			http.NotFound(w, r)
+			return
+		}
+
+		limit := f.MaxBodySize
+		if limit <= 0 {
+			limit = DefaultMaxBodySize
+		}
+		body, err := ioutil.ReadAll(io.LimitReader(r.Body, limit+1))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if int64(len(body)) > limit {
+			http.Error(w, ErrTooLarge.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		feed, err := pushed(f, r.Header.Get("Content-Type"), body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		info, err := a.Push(r.Context(), url, feed)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, struct {
+			Items     int `json:"items"`
+			Triggered int `json:"triggered"`
+		}{info.Items, info.Triggered})
+	})
+}
+
+// pushed decodes the body of a push request.
+func pushed(f Feed, contentType string, body []byte) (*gofeed.Feed, error) {
+	if typ, _, _ := mime.ParseMediaType(contentType); typ == "application/json" {
+		var items []*gofeed.Item
+		if err := json.Unmarshal(body, &items); err != nil {
+			var item gofeed.Item
+			if err := json.Unmarshal(body, &item); err != nil {
+				return nil, fmt.Errorf("decoding items: %w", err)
+			}
+			items = []*gofeed.Item{&item}
+		}
+		var valid []*gofeed.Item
+		for _, i := range items {
+			if i != nil && (i.GUID != "" || i.Link != "") {
+				valid = append(valid, i)
+			}
+		}
+		if len(valid) > 0 {
+			return &gofeed.Feed{Items: valid}, nil
+		}
+	}
+	feed, err := f.parse(body)
+	if err != nil {
+		return nil, fmt.Errorf("parsing: %w", err)
+	}
+	return feed, nil
+}
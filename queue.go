@@ -0,0 +1,159 @@
+package feedtrigger
+
+import (
+	"context"
+	"hash/fnv"
+	"sync"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// DefaultDispatchers is the number of dispatchers of the delivery queue if
+// FeedAction.Dispatchers is zero.
+const DefaultDispatchers = 4
+
+// dispatchJob is a new item waiting in the delivery queue.
+type dispatchJob struct {
+	feed  Feed
+	item  *gofeed.Item
+	batch *dispatchBatch
+}
+
+// dispatchBatch collects the items of a poll delivered by the dispatcher
+// for the feed OnNewBatch.
+type dispatchBatch struct {
+	left      int
+	delivered []*gofeed.Item
+}
+
+// startDispatchers opens the delivery queue served by the dispatchers until
+// closeQueue. Every feed is served by one of the dispatchers, so its items
+// are still delivered in order. The dispatchers serve the items of the
+// positive priority feeds first.
+func (a *FeedAction) startDispatchers(ctx context.Context) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	if a.QueueSize <= 0 || a.DryRun {
+		return &wg
+	}
+	n := a.Dispatchers
+	if n <= 0 {
+		n = DefaultDispatchers
+	}
+	size := a.QueueSize / n
+	if size < 1 {
+		size = 1
+	}
+	a.queueMu.Lock()
+	a.queues = make([]chan dispatchJob, n)
+	a.urgent = make([]chan dispatchJob, n)
+	for i := range a.queues {
+		q, urgent := make(chan dispatchJob, size), make(chan dispatchJob, size)
+		a.queues[i], a.urgent[i] = q, urgent
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			a.dispatch(ctx, urgent, q)
+		}()
+	}
+	a.queueMu.Unlock()
+	return &wg
+}
+
+// closeQueue stops accepting items, the dispatchers exit once they
+// delivered the queued ones.
+func (a *FeedAction) closeQueue() {
+	a.queueMu.Lock()
+	defer a.queueMu.Unlock()
+	for n, q := range a.queues {
+		close(q)
+		close(a.urgent[n])
+	}
+	a.queues, a.urgent = nil, nil
+}
+
+// queue hands the items to the dispatcher of the feed, blocking while its
+// queue is full. It returns how many items were queued, all of them unless
+// ctx is done, and false if the queue isn't open.
+func (a *FeedAction) queue(ctx context.Context, f Feed, items []*gofeed.Item) (int, bool, error) {
+	a.queueMu.RLock()
+	defer a.queueMu.RUnlock()
+	if len(a.queues) == 0 {
+		return 0, false, nil
+	}
+	h := fnv.New32a()
+	h.Write([]byte(f.URL))
+	q := a.queues[h.Sum32()%uint32(len(a.queues))]
+	if f.Priority > 0 {
+		q = a.urgent[h.Sum32()%uint32(len(a.urgent))]
+	}
+
+	batch := &dispatchBatch{left: len(items)}
+	for n, i := range items {
+		select {
+		case q <- dispatchJob{feed: f, item: i, batch: batch}:
+		case <-ctx.Done():
+			return n, true, ctx.Err()
+		}
+	}
+	return len(items), true, nil
+}
+
+// dispatch delivers the queued items, the urgent ones first, until both
+// queues are closed.
+func (a *FeedAction) dispatch(ctx context.Context, urgent, q <-chan dispatchJob) {
+	for urgent != nil || q != nil {
+		var (
+			j  dispatchJob
+			ok bool
+		)
+		select {
+		case j, ok = <-urgent:
+			if !ok {
+				urgent = nil
+				continue
+			}
+		default:
+			select {
+			case j, ok = <-urgent:
+				if !ok {
+					urgent = nil
+					continue
+				}
+			case j, ok = <-q:
+				if !ok {
+					q = nil
+					continue
+				}
+			}
+		}
+		a.dispatchJob(ctx, j)
+	}
+}
+
+// dispatchJob delivers the queued item. Failed deliveries are logged, the
+// feed Retry and the DeadLetter queue keep them from being lost.
+func (a *FeedAction) dispatchJob(ctx context.Context, j dispatchJob) {
+	f := j.feed
+	id := ItemID(j.item)
+	item, err := a.handle(ctx, f, j.item)
+	if err == nil && a.Outbox {
+		err = pipelineError(ErrStore, f.URL, id, a.dequeue(f.URL, id))
+	}
+	if err != nil {
+		a.logf("%s: %s: %v", f.URL, id, err)
+	} else if item != nil {
+		j.batch.delivered = append(j.batch.delivered, item)
+	}
+
+	j.batch.left--
+	if j.batch.left > 0 || f.OnNewBatch == nil || len(j.batch.delivered) == 0 {
+		return
+	}
+	batch := make([]*gofeed.Item, len(j.batch.delivered))
+	for n, item := range j.batch.delivered {
+		batch[n] = a.redact(item)
+	}
+	if err := f.OnNewBatch(batch); err != nil {
+		a.logf("%s: batch trigger func: %v", f.URL, err)
+	}
+}
@@ -0,0 +1,113 @@
+package feedtrigger
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// hostLimiter is a set of token buckets keyed by hostname.
+type hostLimiter struct {
+	rps   float64
+	burst int
+	clock Clock
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// waiting counts the waiting requests by priority.
+	waiting map[int]int
+}
+
+func newHostLimiter(rps float64, burst int, clock Clock) *hostLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &hostLimiter{
+		rps:     rps,
+		burst:   burst,
+		clock:   clock,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Wait blocks until a request to the host of rawurl is allowed or ctx is done.
+// The requests of a higher priority waiting for the host go first.
+func (l *hostLimiter) Wait(ctx context.Context, rawurl string, priority int) error {
+	host := hostOf(rawurl)
+
+	for waiting := false; ; waiting = true {
+		d := l.reserve(host, priority, waiting)
+		if d == 0 {
+			return nil
+		}
+		t := l.clock.NewTimer(d)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			l.mu.Lock()
+			l.buckets[host].done(priority)
+			l.mu.Unlock()
+			return ctx.Err()
+		case <-t.C():
+		}
+	}
+}
+
+// reserve takes a token for the host and returns zero, or returns how long to
+// wait for the next token to become available, registering the request as
+// waiting unless it's waiting already.
+func (l *hostLimiter) reserve(host string, priority int, waiting bool) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	b, ok := l.buckets[host]
+	if !ok {
+		b = &bucket{tokens: float64(l.burst), last: now, waiting: make(map[int]int)}
+		l.buckets[host] = b
+	}
+
+	b.tokens += now.Sub(b.last).Seconds() * l.rps
+	if b.tokens > float64(l.burst) {
+		b.tokens = float64(l.burst)
+	}
+	b.last = now
+
+	if b.tokens >= 1 && !b.preempted(priority) {
+		b.tokens--
+		if waiting {
+			b.done(priority)
+		}
+		return 0
+	}
+	if !waiting {
+		b.waiting[priority]++
+	}
+	if b.tokens >= 1 {
+		// let the preempting request take the token
+		return time.Duration(float64(time.Second) / l.rps)
+	}
+	return time.Duration((1 - b.tokens) / l.rps * float64(time.Second))
+}
+
+// preempted reports whether requests of a higher priority are waiting.
+func (b *bucket) preempted(priority int) bool {
+	for p, n := range b.waiting {
+		if p > priority && n > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// done unregisters a waiting request.
+func (b *bucket) done(priority int) {
+	if b.waiting[priority]--; b.waiting[priority] <= 0 {
+		delete(b.waiting, priority)
+	}
+}
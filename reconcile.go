@@ -0,0 +1,187 @@
+package feedtrigger
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"ilya.app/feedtrigger/stores"
+)
+
+// knownFeedsKey is the key of the feeds with stored state and the last time
+// they were configured.
+const knownFeedsKey = "known-feeds"
+
+// knownFeeds serializes the updates of the known feeds.
+type knownFeeds struct {
+	mu sync.Mutex
+}
+
+// Orphan is the stored state of a feed that isn't configured.
+type Orphan struct {
+	URL string `json:"url"`
+	// LastUsed is the last time the feed was configured or polled by any
+	// instance sharing the store, the time it was found if unknown.
+	LastUsed time.Time `json:"last_used,omitempty"`
+}
+
+// Reconciliation compares the configured feeds with the stored state.
+type Reconciliation struct {
+	// New are the configured feeds without stored state.
+	New []string `json:"new,omitempty"`
+	// Orphaned is the stored state of the feeds not configured, the
+	// soft-deleted ones aside.
+	Orphaned []Orphan `json:"orphaned,omitempty"`
+	// Pruned are the orphans purged for being unused for longer than
+	// OrphanRetention.
+	Pruned []string `json:"pruned,omitempty"`
+}
+
+// Reconcile finds the configured feeds without stored state and the stored
+// state of the feeds not configured anymore, purging the orphans unused for
+// longer than OrphanRetention. The stored feeds are known from the feeds
+// configured since the upgrade and from the keys of the stores listing
+// them, see stores.Lister. An orphan used by another instance sharing the
+// store stays as long as the instance polls it.
+func (a *FeedAction) Reconcile() (*Reconciliation, error) {
+	configured := make(map[string]bool)
+	for _, f := range a.ListFeeds() {
+		configured[f.URL] = true
+	}
+	tombstones, err := a.DeletedFeeds()
+	if err != nil {
+		return nil, err
+	}
+	deleted := make(map[string]bool, len(tombstones))
+	for _, t := range tombstones {
+		deleted[t.URL] = true
+	}
+
+	a.known.mu.Lock()
+	defer a.known.mu.Unlock()
+	known, err := a.knownFeeds()
+	if err != nil {
+		return nil, err
+	}
+	stored, err := a.storedFeeds()
+	if err != nil {
+		return nil, err
+	}
+	for url := range known {
+		stored[url] = true
+	}
+
+	now := a.now().UTC()
+	r := &Reconciliation{}
+	for url := range configured {
+		var head json.RawMessage
+		found, err := a.feedKV(url).Get(url, &head)
+		if err != nil {
+			return nil, fmt.Errorf("get from store: %w", err)
+		}
+		if !found {
+			r.New = append(r.New, url)
+		}
+		known[url] = now
+	}
+	for url := range stored {
+		if configured[url] || deleted[url] {
+			continue
+		}
+		o := Orphan{URL: url, LastUsed: known[url]}
+		if st, found, err := a.Stats(url); err == nil && found && st.LastPoll.After(o.LastUsed) {
+			o.LastUsed = st.LastPoll
+		}
+		if o.LastUsed.IsZero() {
+			// the retention of the orphans found in the keys starts now
+			o.LastUsed = now
+		}
+		if _, ok := known[url]; !ok {
+			known[url] = o.LastUsed
+		}
+		if a.OrphanRetention > 0 && now.Sub(o.LastUsed) > a.OrphanRetention && !a.DryRun {
+			if err := a.PurgeFeed(url); err != nil {
+				return r, err
+			}
+			delete(known, url)
+			r.Pruned = append(r.Pruned, url)
+			continue
+		}
+		r.Orphaned = append(r.Orphaned, o)
+	}
+	sort.Strings(r.New)
+	sort.Strings(r.Pruned)
+	sort.Slice(r.Orphaned, func(i, j int) bool { return r.Orphaned[i].URL < r.Orphaned[j].URL })
+
+	if !a.DryRun {
+		if err := a.kv().Set(knownFeedsKey, known); err != nil {
+			return r, fmt.Errorf("storing known feeds: %w", err)
+		}
+	}
+	return r, nil
+}
+
+func (a *FeedAction) knownFeeds() (map[string]time.Time, error) {
+	known := make(map[string]time.Time)
+	if _, err := a.kv().Get(knownFeedsKey, &known); err != nil {
+		return nil, fmt.Errorf("get known feeds: %w", err)
+	}
+	return known, nil
+}
+
+// remember adds the feed whose state was stored for the first time to the
+// known feeds.
+func (a *FeedAction) remember(url string) error {
+	a.known.mu.Lock()
+	defer a.known.mu.Unlock()
+	known, err := a.knownFeeds()
+	if err != nil {
+		return err
+	}
+	if _, ok := known[url]; ok {
+		return nil
+	}
+	known[url] = a.now().UTC()
+	if err := a.kv().Set(knownFeedsKey, known); err != nil {
+		return fmt.Errorf("storing known feeds: %w", err)
+	}
+	return nil
+}
+
+// storedFeeds returns the feeds with state among the keys of the store, none
+// if it can't list them.
+func (a *FeedAction) storedFeeds() (map[string]bool, error) {
+	feeds := make(map[string]bool)
+	s := a.kv()
+	if m, ok := s.(measuredStore); ok {
+		s = m.Store
+	}
+	l, ok := s.(stores.Lister)
+	if !ok {
+		return feeds, nil
+	}
+	keys, err := l.Keys()
+	if err != nil {
+		return nil, fmt.Errorf("listing keys: %w", err)
+	}
+	for _, k := range keys {
+		if strings.HasPrefix(k, deliveryPrefix) {
+			// the claims lapse with the retention of the deliveries
+			continue
+		}
+		for _, p := range feedPrefixes[1:] {
+			if strings.HasPrefix(k, p) {
+				k = strings.TrimPrefix(k, p)
+				break
+			}
+		}
+		// the other keys aren't URLs
+		if strings.Contains(k, "://") {
+			feeds[k] = true
+		}
+	}
+	return feeds, nil
+}
@@ -0,0 +1,164 @@
+package feedtrigger
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// DefaultRedactionReplacement is put in place of redacted text.
+const DefaultRedactionReplacement = "[REDACTED]"
+
+// Item fields redaction rules can target.
+const (
+	FieldTitle       = "title"
+	FieldDescription = "description"
+	FieldContent     = "content"
+	FieldLink        = "link"
+	FieldAuthor      = "author"
+)
+
+// RedactionRule masks matches of Pattern in the item fields before the item
+// reaches actions.
+type RedactionRule struct {
+	Name    string
+	Pattern *regexp.Regexp
+	// Fields the rule applies to, all text fields if empty.
+	Fields []string
+	// Replacement for the matches, DefaultRedactionReplacement if empty.
+	Replacement string
+}
+
+// Built-in redaction rules.
+var (
+	RedactEmails = RedactionRule{
+		Name:    "emails",
+		Pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	}
+	RedactTokens = RedactionRule{
+		Name: "tokens",
+		Pattern: regexp.MustCompile(`\b(AKIA[0-9A-Z]{16}|gh[pousr]_[A-Za-z0-9]{36,}|xox[abprs]-[A-Za-z0-9-]{10,}|` +
+			`glpat-[A-Za-z0-9_-]{20}|sk_live_[A-Za-z0-9]{24,})\b`),
+	}
+)
+
+// builtinRedactions are available to the config by name.
+var builtinRedactions = map[string]RedactionRule{
+	RedactEmails.Name: RedactEmails,
+	RedactTokens.Name: RedactTokens,
+}
+
+// RedactionConfig is a redaction rule in the config file. A rule with only a
+// name refers to a built-in rule.
+type RedactionConfig struct {
+	Name        string   `json:"name"`
+	Pattern     string   `json:"pattern,omitempty"`
+	Fields      []string `json:"fields,omitempty"`
+	Replacement string   `json:"replacement,omitempty"`
+}
+
+// Rule compiles the config entry.
+func (rc RedactionConfig) Rule() (RedactionRule, error) {
+	if rc.Pattern == "" {
+		r, ok := builtinRedactions[rc.Name]
+		if !ok {
+			return r, fmt.Errorf("unknown redaction rule %q", rc.Name)
+		}
+		r.Fields = rc.Fields
+		r.Replacement = rc.Replacement
+		return r, nil
+	}
+
+	re, err := regexp.Compile(rc.Pattern)
+	if err != nil {
+		return RedactionRule{}, fmt.Errorf("redaction rule %q: %w", rc.Name, err)
+	}
+	return RedactionRule{
+		Name:        rc.Name,
+		Pattern:     re,
+		Fields:      rc.Fields,
+		Replacement: rc.Replacement,
+	}, nil
+}
+
+// redactionCounter counts redactions per rule.
+type redactionCounter struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func (c *redactionCounter) add(rule string, n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts == nil {
+		c.counts = make(map[string]int64)
+	}
+	c.counts[rule] += int64(n)
+}
+
+// Redacted returns the number of redacted matches per rule name since the
+// start.
+func (a *FeedAction) Redacted() map[string]int64 {
+	a.redactions.mu.Lock()
+	defer a.redactions.mu.Unlock()
+	out := make(map[string]int64, len(a.redactions.counts))
+	for k, v := range a.redactions.counts {
+		out[k] = v
+	}
+	return out
+}
+
+// redact returns a copy of the item with the redaction rules applied, the
+// original is left intact for deduplication.
+func (a *FeedAction) redact(i *gofeed.Item) *gofeed.Item {
+	return a.redactWith(i, a.redactions.add)
+}
+
+// redactWith is redact reporting the number of matches of every rule to
+// count.
+func (a *FeedAction) redactWith(i *gofeed.Item, count func(rule string, n int)) *gofeed.Item {
+	if len(a.Redactions) == 0 {
+		return i
+	}
+
+	c := copyItem(i)
+	for _, r := range a.Redactions {
+		replacement := r.Replacement
+		if replacement == "" {
+			replacement = DefaultRedactionReplacement
+		}
+		fields := r.Fields
+		if len(fields) == 0 {
+			fields = []string{FieldTitle, FieldDescription, FieldContent, FieldLink, FieldAuthor}
+		}
+
+		for _, field := range fields {
+			var targets []*string
+			switch field {
+			case FieldTitle:
+				targets = []*string{&c.Title}
+			case FieldDescription:
+				targets = []*string{&c.Description}
+			case FieldContent:
+				targets = []*string{&c.Content}
+			case FieldLink:
+				targets = []*string{&c.Link}
+			case FieldAuthor:
+				if c.Author != nil {
+					targets = []*string{&c.Author.Name, &c.Author.Email}
+				}
+			}
+			for _, s := range targets {
+				n := len(r.Pattern.FindAllStringIndex(*s, -1))
+				if n == 0 {
+					continue
+				}
+				*s = r.Pattern.ReplaceAllLiteralString(*s, replacement)
+				count(r.Name, n)
+			}
+		}
+	}
+	return c
+}
@@ -0,0 +1,99 @@
+package feedtrigger
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Types of the action parameters.
+const (
+	ParamString   = "string"
+	ParamNumber   = "number"
+	ParamBool     = "bool"
+	ParamDuration = "duration"
+	ParamStrings  = "strings"
+)
+
+// ActionParam describes a parameter an action type is instantiated with.
+type ActionParam struct {
+	Name string `json:"name"`
+	// Type is one of ParamString, ParamNumber, ParamBool, ParamDuration and
+	// ParamStrings.
+	Type     string `json:"type"`
+	Required bool   `json:"required,omitempty"`
+	Doc      string `json:"doc,omitempty"`
+}
+
+// ActionType is an action type of a registry and its parameter schema.
+type ActionType struct {
+	Name   string        `json:"name"`
+	Params []ActionParam `json:"params,omitempty"`
+}
+
+// ActionRegistry instantiates actions by type name from their parameters,
+// see the actions package.
+type ActionRegistry interface {
+	Types() []ActionType
+	New(typ string, params map[string]interface{}) (NewItemAction, error)
+}
+
+// DefineAction instantiates an action of the ActionRegistry type as the
+// named action the feeds can be wired to, replacing the one of the name.
+func (a *FeedAction) DefineAction(name, typ string, params map[string]interface{}) error {
+	if a.ActionRegistry == nil {
+		return fmt.Errorf("action %s: no action registry", name)
+	}
+	action, err := a.ActionRegistry.New(typ, params)
+	if err != nil {
+		return fmt.Errorf("action %s: %w", name, err)
+	}
+	a.namedMu.Lock()
+	defer a.namedMu.Unlock()
+	if a.NamedActions == nil {
+		a.NamedActions = make(map[string]NewItemAction)
+	}
+	a.NamedActions[name] = action
+	return nil
+}
+
+// ListActions returns the names of the NamedActions, sorted.
+func (a *FeedAction) ListActions() []string {
+	a.namedMu.Lock()
+	defer a.namedMu.Unlock()
+	names := make([]string, 0, len(a.NamedActions))
+	for name := range a.NamedActions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetFeedActions replaces the actions of the feed with the chain of the
+// named actions. A running application uses them for the next items.
+func (a *FeedAction) SetFeedActions(url string, names ...string) error {
+	url = NormalizeURL(url)
+	a.namedMu.Lock()
+	chain := make([]NewItemAction, 0, len(names))
+	for _, name := range names {
+		action, ok := a.NamedActions[name]
+		if !ok {
+			a.namedMu.Unlock()
+			return fmt.Errorf("feed %s: unknown action %q", url, name)
+		}
+		chain = append(chain, action)
+	}
+	a.namedMu.Unlock()
+
+	for _, f := range a.ListFeeds() {
+		if f.URL != url {
+			continue
+		}
+		f.OnNewRecord = nil
+		if len(chain) > 0 {
+			f.OnNewRecord = Chain(chain...)
+		}
+		f.ActionNames = append([]string(nil), names...)
+		return a.AddFeed(f)
+	}
+	return fmt.Errorf("unknown feed %s", url)
+}
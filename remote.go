@@ -0,0 +1,126 @@
+package feedtrigger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// RemoteFeeds keeps the feed set in sync with a list published at a URL,
+// e.g. a raw file in a Git repository managed by a central team. The list
+// is either an OPML document or a JSON config (see Config).
+type RemoteFeeds struct {
+	URL      string
+	Interval time.Duration
+	// Actions resolves action names of the JSON config entries.
+	Actions map[string]NewItemAction
+	// DefaultActions are used for OPML outlines and the entries without
+	// actions or a profile.
+	DefaultActions []string
+	// OnSync is called after every sync attempt. Logs by default.
+	OnSync func(added, removed, updated []string, err error)
+}
+
+func (r *RemoteFeeds) run(ctx context.Context, a *FeedAction) {
+	t := a.clock().NewTicker(r.Interval)
+	defer t.Stop()
+	for {
+		added, removed, updated, err := r.sync(ctx, a)
+		if r.OnSync != nil {
+			r.OnSync(added, removed, updated, err)
+		} else if err != nil {
+			a.logf("syncing feeds from %s: %v", r.URL, err)
+		} else if len(added)+len(removed)+len(updated) > 0 {
+			a.logf("synced feeds from %s: %d added, %d removed, %d updated",
+				r.URL, len(added), len(removed), len(updated))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C():
+		}
+	}
+}
+
+func (r *RemoteFeeds) sync(ctx context.Context, a *FeedAction) (added, removed, updated []string, err error) {
+	cfg, err := r.fetch(ctx)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	for i := range cfg.Feeds {
+		if len(cfg.Feeds[i].Actions) == 0 && cfg.Feeds[i].Profile == "" {
+			cfg.Feeds[i].Actions = r.DefaultActions
+		}
+	}
+	feeds, err := cfg.BuildFeeds(r.Actions)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return a.SyncFeeds(feeds)
+}
+
+// fetch downloads the list and converts it into a config.
+func (r *RemoteFeeds) fetch(ctx context.Context) (*Config, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching feed list: %s", resp.Status)
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	trimmed := bytes.TrimSpace(body)
+	if bytes.HasPrefix(trimmed, []byte("<")) {
+		return ParseOPML(bytes.NewReader(body))
+	}
+	var cfg Config
+	if err := json.Unmarshal(body, &cfg); err != nil {
+		return nil, fmt.Errorf("parsing feed list: %w", err)
+	}
+	return &cfg, nil
+}
+
+type opmlOutline struct {
+	XMLURL   string        `xml:"xmlUrl,attr"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// ParseOPML reads feed URLs of an OPML subscription list into a config.
+func ParseOPML(r io.Reader) (*Config, error) {
+	var doc struct {
+		Outlines []opmlOutline `xml:"body>outline"`
+	}
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("parsing OPML: %w", err)
+	}
+
+	var cfg Config
+	var walk func([]opmlOutline)
+	walk = func(outlines []opmlOutline) {
+		for _, o := range outlines {
+			if o.XMLURL != "" {
+				cfg.Feeds = append(cfg.Feeds, FeedConfig{URL: o.XMLURL})
+			}
+			walk(o.Outlines)
+		}
+	}
+	walk(doc.Outlines)
+	return &cfg, nil
+}
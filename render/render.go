@@ -0,0 +1,110 @@
+// Package render renders feed items with text/template or html/template,
+// so notification actions can take a message template from the config.
+//
+// Templates see the item fields, e.g. {{.Title}} and {{.Link}}, plus Feed,
+// the URL of the feed the item came from, and its Labels and Metadata.
+package render
+
+import (
+	htemplate "html/template"
+	"regexp"
+	"strings"
+	ttemplate "text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+)
+
+// Data is what templates are executed with.
+type Data struct {
+	*gofeed.Item
+	Feed     string
+	Labels   map[string]string
+	Metadata map[string]string
+}
+
+// DataOf returns the template data of the item.
+func DataOf(i *gofeed.Item) Data {
+	f := feedtrigger.ItemFeed(i)
+	return Data{
+		Item:     i,
+		Feed:     f.URL,
+		Labels:   f.Labels,
+		Metadata: f.Metadata,
+	}
+}
+
+var tagRe = regexp.MustCompile(`<[^>]*>`)
+
+// Funcs are available to the templates:
+//
+//	truncate n s   cuts s to n characters
+//	strip s        removes HTML tags
+//	date layout t  formats the time, e.g. {{date "2006-01-02" .PublishedParsed}}
+var Funcs = map[string]interface{}{
+	"truncate": func(n int, s string) string {
+		if utf8.RuneCountInString(s) <= n {
+			return s
+		}
+		return string([]rune(s)[:n]) + "…"
+	},
+	"strip": func(s string) string {
+		return strings.TrimSpace(tagRe.ReplaceAllString(s, ""))
+	},
+	"date": func(layout string, t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.Format(layout)
+	},
+}
+
+// Template is a parsed text or HTML message template.
+type Template struct {
+	text *ttemplate.Template
+	html *htemplate.Template
+}
+
+// Text parses a plain text template.
+func Text(src string) (*Template, error) {
+	t, err := ttemplate.New("message").Funcs(Funcs).Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	return &Template{text: t}, nil
+}
+
+// HTML parses an HTML template, the item fields are escaped.
+func HTML(src string) (*Template, error) {
+	t, err := htemplate.New("message").Funcs(Funcs).Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	return &Template{html: t}, nil
+}
+
+// Render executes the template for the item.
+func (t *Template) Render(i *gofeed.Item) (string, error) {
+	var b strings.Builder
+	var err error
+	if t.html != nil {
+		err = t.html.Execute(&b, DataOf(i))
+	} else {
+		err = t.text.Execute(&b, DataOf(i))
+	}
+	return b.String(), err
+}
+
+// Action renders every new item and passes the message to send.
+func (t *Template) Action(send func(i *gofeed.Item, message string) error) feedtrigger.NewItemAction {
+	return func(i *gofeed.Item) error {
+		msg, err := t.Render(i)
+		if err != nil {
+			return err
+		}
+		return send(i, msg)
+	}
+}
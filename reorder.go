@@ -0,0 +1,25 @@
+package feedtrigger
+
+import (
+	"sort"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// sortItems puts the items of the feed ordering them by activity in the
+// order of publication, the newest first. The items without dates go last.
+func (f Feed) sortItems(feed *gofeed.Feed) {
+	if !f.SortByPublished {
+		return
+	}
+	at := func(i *gofeed.Item) time.Time {
+		if p := published(i); p != nil {
+			return *p
+		}
+		return time.Time{}
+	}
+	sort.SliceStable(feed.Items, func(i, j int) bool {
+		return at(feed.Items[i]).After(at(feed.Items[j]))
+	})
+}
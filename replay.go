@@ -0,0 +1,152 @@
+package feedtrigger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// Replayed is how Replay handled an item.
+type Replayed struct {
+	// Item is the item as the actions received or would receive it.
+	Item *gofeed.Item
+	// Delivered is true if the item passed the transforms and the filters,
+	// and the actions succeeded if they were run.
+	Delivered bool
+	// Stage is the stage that stopped the item, "transform", "filter" or
+	// "action", and Detail tells why.
+	Stage  string
+	Detail string
+}
+
+// Replay runs the items, e.g. archived ones or the ones of a saved snapshot
+// of the feed, through the current transforms and filters of the feed, and
+// its actions too if run is set, as if they were new. Nothing is fetched
+// and the stored state is neither consulted nor changed: the items are
+// not checked against the seen ones, the deduplication or MaxItemAge, and
+// the action results aren't stored, so new rules can be tried on historical
+// data before deploying them.
+func (a *FeedAction) Replay(ctx context.Context, f Feed, items []*gofeed.Item, run bool) ([]Replayed, error) {
+	if err := a.applyProfile(&f); err != nil {
+		return nil, err
+	}
+	filters := a.filters(f)
+
+	out := make([]Replayed, 0, len(items))
+	for _, i := range items {
+		if ctx.Err() != nil {
+			return out, ctx.Err()
+		}
+		r := Replayed{Item: copyItem(i)}
+		f.normalize(&gofeed.Feed{Items: []*gofeed.Item{r.Item}})
+		f.annotate([]*gofeed.Item{r.Item})
+		out = append(out, r)
+		last := &out[len(out)-1]
+
+		if f.Transform != nil {
+			t, err := f.Transform(copyItem(last.Item))
+			switch {
+			case err != nil:
+				last.Detail = fmt.Sprintf("transform failed, item kept: %v", err)
+			case t == nil:
+				last.Stage, last.Detail = "transform", "transform dropped the item"
+				continue
+			default:
+				last.Item = t
+			}
+		}
+		rejected := false
+		for n, fn := range filters {
+			if !fn(last.Item) {
+				last.Stage, last.Detail = "filter", fmt.Sprintf("filter %d rejected the item", n)
+				rejected = true
+				break
+			}
+		}
+		if rejected {
+			continue
+		}
+
+		last.Item = a.redactWith(last.Item, func(string, int) {})
+		if run {
+			if err := replayActions(ctx, f, last.Item); err != nil {
+				last.Stage, last.Detail = "action", err.Error()
+				continue
+			}
+		}
+		last.Delivered = true
+	}
+	return out, nil
+}
+
+// ReplayArchive replays the items of the feed archived since the time, see
+// Replay.
+func (a *FeedAction) ReplayArchive(ctx context.Context, f Feed, since time.Time, run bool) ([]Replayed, error) {
+	if a.Archive == nil {
+		return nil, errors.New("replaying archived items requires the archive")
+	}
+	if a.Archive.Store == nil {
+		a.Archive.Store = a.kv()
+	}
+	archived, err := a.Archive.Items(f.URL, since)
+	if err != nil {
+		return nil, err
+	}
+	items := make([]*gofeed.Item, len(archived))
+	for n, ai := range archived {
+		items[n] = ai.Item
+	}
+	return a.Replay(ctx, f, items, run)
+}
+
+// replayActions runs the feed actions for the item like deliver, keeping
+// the step results in memory only.
+func replayActions(ctx context.Context, f Feed, i *gofeed.Item) error {
+	if f.OnNewRecord != nil {
+		if err := call(ctx, f, i, WithContext(f.OnNewRecord)); err != nil {
+			return err
+		}
+	}
+	if f.OnNewRecordCtx != nil {
+		if err := call(withFeed(ctx, f), f, i, f.OnNewRecordCtx); err != nil {
+			return err
+		}
+	}
+	results := make(Results, len(f.Actions))
+	for _, s := range f.Actions {
+		r, err := s.Action(i, results)
+		if err != nil {
+			return fmt.Errorf("action %s: %w", s.Name, err)
+		}
+		if r != nil {
+			results[s.Name] = r
+		}
+	}
+	return nil
+}
+
+// ParseSnapshot parses a saved document of the feed, e.g. for Replay,
+// returning its items oldest first unless the feed is NewestFirst.
+func (a *FeedAction) ParseSnapshot(f Feed, body []byte) ([]*gofeed.Item, error) {
+	if err := a.applyProfile(&f); err != nil {
+		return nil, err
+	}
+	body, err := f.decode("", body)
+	if err != nil {
+		return nil, fmt.Errorf("decoding snapshot: %w", err)
+	}
+	feed, err := a.parse(f, body)
+	if err != nil {
+		return nil, fmt.Errorf("parsing snapshot: %w", err)
+	}
+	items := feed.Items
+	if !f.NewestFirst {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+	return items, nil
+}
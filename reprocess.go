@@ -0,0 +1,52 @@
+package feedtrigger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// Reprocess runs the items archived since the time through the current
+// filters and actions of the feeds, all configured feeds if none are given.
+// Nothing is fetched and the stored feed state is left untouched, so new
+// rules can be applied to the history retroactively. It returns the number
+// of delivered items.
+func (a *FeedAction) Reprocess(ctx context.Context, since time.Time, feeds ...Feed) (int, error) {
+	if a.Archive == nil {
+		return 0, errors.New("reprocessing requires the archive")
+	}
+	if a.Archive.Store == nil {
+		a.Archive.Store = a.kv()
+	}
+	if len(feeds) == 0 {
+		feeds = a.ListFeeds()
+	}
+
+	delivered := 0
+	for _, f := range feeds {
+		if err := a.applyProfile(&f); err != nil {
+			return delivered, err
+		}
+		archived, err := a.Archive.Items(f.URL, since)
+		if err != nil {
+			return delivered, err
+		}
+
+		for _, ai := range archived {
+			if ctx.Err() != nil {
+				return delivered, ctx.Err()
+			}
+			if len(a.filter(f, []*gofeed.Item{ai.Item})) == 0 {
+				continue
+			}
+			if err := a.deliver(ctx, f, a.redact(ai.Item)); err != nil {
+				return delivered, fmt.Errorf("reprocessing %s: %w", ItemID(ai.Item), err)
+			}
+			delivered++
+		}
+	}
+	return delivered, nil
+}
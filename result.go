@@ -0,0 +1,76 @@
+package feedtrigger
+
+import (
+	"fmt"
+
+	"github.com/mmcdole/gofeed"
+)
+
+const resultsPrefix = "results/"
+
+// Result is what an action reports about a delivery, e.g. a created ticket
+// ID or a chat message timestamp.
+type Result map[string]string
+
+// Results are results of the actions run for an item keyed by action name.
+type Results map[string]Result
+
+// ResultAction is an action returning a result. It receives the results of
+// the previous steps, including the ones stored from earlier deliveries of
+// the same item.
+type ResultAction func(i *gofeed.Item, prev Results) (Result, error)
+
+// Step is a named ResultAction of Feed.Actions.
+type Step struct {
+	Name   string
+	Action ResultAction
+}
+
+// ResultOf adapts an action without a result to a ResultAction.
+func ResultOf(action NewItemAction) ResultAction {
+	return func(i *gofeed.Item, _ Results) (Result, error) {
+		return nil, action(i)
+	}
+}
+
+// runSteps runs the feed steps for the item and stores their results.
+func (a *FeedAction) runSteps(f Feed, i *gofeed.Item) error {
+	if len(f.Actions) == 0 {
+		return nil
+	}
+
+	results, err := a.ItemResults(f.URL, ItemID(i))
+	if err != nil {
+		return err
+	}
+	if results == nil {
+		results = make(Results, len(f.Actions))
+	}
+
+	var stepErr error
+	for _, s := range f.Actions {
+		r, err := s.Action(i, results)
+		if err != nil {
+			stepErr = fmt.Errorf("action %s: %w", s.Name, err)
+			break
+		}
+		if r != nil {
+			results[s.Name] = r
+		}
+	}
+
+	// keep the results of the steps that succeeded even if a later one failed
+	if err := a.feedKV(f.URL).Set(resultsPrefix+f.URL+"#"+ItemID(i), results); err != nil {
+		return fmt.Errorf("storing results: %w", err)
+	}
+	return stepErr
+}
+
+// ItemResults returns the stored action results of the item of the feed.
+func (a *FeedAction) ItemResults(feedURL, itemID string) (Results, error) {
+	var results Results
+	if _, err := a.feedKV(feedURL).Get(resultsPrefix+feedURL+"#"+itemID, &results); err != nil {
+		return nil, fmt.Errorf("get results: %w", err)
+	}
+	return results, nil
+}
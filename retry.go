@@ -0,0 +1,88 @@
+package feedtrigger
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// DefaultRetryBackoff is the delay before the first retry of a failed
+// delivery by default.
+const DefaultRetryBackoff = time.Second
+
+// RetryPolicy retries delivering an item whose actions failed before the
+// failure aborts the poll or puts the item to the dead-letter queue.
+type RetryPolicy struct {
+	// Attempts is the total number of deliveries tried, one if zero.
+	Attempts int
+	// Backoff is the delay before the first retry, doubled for each next
+	// one up to MaxBackoff. DefaultRetryBackoff if zero.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Retryable reports whether the error is worth retrying. All errors
+	// except the Permanent ones and context cancellation are by default.
+	Retryable func(error) bool
+}
+
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks the action error as not worth retrying, e.g. a 4xx
+// response.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+// IsPermanent reports whether the error was marked with Permanent.
+func IsPermanent(err error) bool {
+	var p permanentError
+	return errors.As(err, &p)
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return !IsPermanent(err)
+}
+
+// deliverRetrying delivers the item according to the feed retry policy,
+// returning the number of deliveries tried.
+func (a *FeedAction) deliverRetrying(ctx context.Context, f Feed, i *gofeed.Item) (int, error) {
+	p := f.Retry
+	if p == nil || p.Attempts <= 1 {
+		return 1, a.deliver(ctx, f, i)
+	}
+	delay := p.Backoff
+	if delay <= 0 {
+		delay = DefaultRetryBackoff
+	}
+	var err error
+	for n := 1; ; n++ {
+		err = a.deliver(ctx, f, i)
+		if err == nil || n >= p.Attempts || !p.retryable(err) {
+			return n, err
+		}
+		t := a.clock().NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return n, err
+		case <-t.C():
+		}
+		delay *= 2
+		if p.MaxBackoff > 0 && delay > p.MaxBackoff {
+			delay = p.MaxBackoff
+		}
+	}
+}
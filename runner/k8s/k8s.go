@@ -0,0 +1,392 @@
+// Package k8s runs a single active poller among the replicas of a
+// Kubernetes Deployment. The replicas elect the leader with a
+// coordination.k8s.io/v1 Lease and only the leader runs the application.
+// A leader shutting down releases the lease, so another replica takes over
+// right away; a crashed one is replaced once the lease expires.
+//
+// The pod service account needs the get, create and update verbs on the
+// leases of its namespace.
+//
+// The runner talks to the API server over plain HTTP instead of using the
+// leaderelection package of client-go, which would bring the whole
+// Kubernetes client and its dependencies into feedtrigger for three
+// requests. It does what client-go does for a Lease lock:
+//
+//   - writes carry the resourceVersion read before, so of the replicas
+//     racing for the lease only the first write succeeds and the others get
+//     409 Conflict and read the lease again;
+//   - the service account token is read on every request, so the tokens
+//     rotated by the kubelet are picked up like client-go's
+//     BearerTokenFile does;
+//   - a leader failing to renew for RenewDeadline stops with
+//     ErrLostLeadership, before the others may take over after
+//     LeaseDuration.
+//
+// The tests check these against a fake API server rejecting stale writes;
+// they aren't run against a real cluster.
+package k8s
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"ilya.app/feedtrigger"
+)
+
+// Defaults of the Runner timings.
+const (
+	DefaultLeaseDuration = 15 * time.Second
+	DefaultRenewDeadline = 10 * time.Second
+	DefaultRetryPeriod   = 2 * time.Second
+)
+
+const serviceAccount = "/var/run/secrets/kubernetes.io/serviceaccount/"
+
+// microTime is the layout of the Lease times.
+const microTime = "2006-01-02T15:04:05.000000Z07:00"
+
+// ErrLostLeadership is returned by Run when the lease couldn't be renewed.
+// The application can't be run again, so the process should exit and let
+// Kubernetes restart it.
+var ErrLostLeadership = errors.New("lost the leader lease")
+
+// Runner runs the application while holding the leader lease.
+type Runner struct {
+	// Name of the Lease.
+	Name string
+	// Namespace of the Lease, the namespace of the pod if empty.
+	Namespace string
+	// Identity of the replica, the host name (the pod name) if empty.
+	Identity string
+
+	// LeaseDuration is how long the followers wait before taking over
+	// the lease, RenewDeadline how long the leader keeps trying to renew
+	// it and RetryPeriod the interval of the attempts.
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+
+	// Host is the API server URL and Client the client authenticating to
+	// it, the in-cluster configuration if unset.
+	Host   string
+	Client *http.Client
+
+	// Logger logs the leadership changes and the failed lease requests,
+	// the standard logger if nil.
+	Logger *log.Logger
+
+	once sync.Once
+	err  error
+}
+
+type lease struct {
+	APIVersion string    `json:"apiVersion"`
+	Kind       string    `json:"kind"`
+	Metadata   metadata  `json:"metadata"`
+	Spec       leaseSpec `json:"spec"`
+}
+
+type metadata struct {
+	Name            string `json:"name"`
+	Namespace       string `json:"namespace"`
+	ResourceVersion string `json:"resourceVersion,omitempty"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity,omitempty"`
+	LeaseDurationSeconds int    `json:"leaseDurationSeconds,omitempty"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int    `json:"leaseTransitions,omitempty"`
+}
+
+// errConflict is returned when the Lease was updated by another replica.
+var errConflict = errors.New("lease updated concurrently")
+
+// Run blocks until the replica becomes the leader, then runs the
+// application until ctx is done or the leadership is lost.
+func (r *Runner) Run(ctx context.Context, app *feedtrigger.FeedAction) error {
+	if err := r.init(); err != nil {
+		return err
+	}
+
+	if err := r.acquire(ctx); err != nil {
+		return err
+	}
+	r.logf("%s: became the leader", r.Identity)
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		done <- app.Run(runCtx)
+	}()
+
+	lost := make(chan struct{})
+	go func() {
+		r.renew(runCtx)
+		if runCtx.Err() == nil {
+			close(lost)
+			cancel()
+		}
+	}()
+
+	err := <-done
+	select {
+	case <-lost:
+		return ErrLostLeadership
+	default:
+	}
+	cancel()
+	if rerr := r.release(); rerr != nil {
+		r.logf("%s: releasing the lease: %v", r.Identity, rerr)
+	}
+	return err
+}
+
+// logf logs to the Logger of the runner.
+func (r *Runner) logf(format string, v ...interface{}) {
+	if r.Logger != nil {
+		r.Logger.Printf(format, v...)
+		return
+	}
+	log.Printf(format, v...)
+}
+
+func (r *Runner) init() error {
+	r.once.Do(func() {
+		if r.Name == "" {
+			r.err = errors.New("lease name required")
+			return
+		}
+		if r.Identity == "" {
+			if r.Identity, r.err = os.Hostname(); r.err != nil {
+				return
+			}
+		}
+		if r.Namespace == "" {
+			ns, err := ioutil.ReadFile(serviceAccount + "namespace")
+			if err != nil {
+				r.err = fmt.Errorf("reading the pod namespace: %w", err)
+				return
+			}
+			r.Namespace = strings.TrimSpace(string(ns))
+		}
+		if r.LeaseDuration <= 0 {
+			r.LeaseDuration = DefaultLeaseDuration
+		}
+		if r.RenewDeadline <= 0 {
+			r.RenewDeadline = DefaultRenewDeadline
+		}
+		if r.RetryPeriod <= 0 {
+			r.RetryPeriod = DefaultRetryPeriod
+		}
+		if r.Host == "" {
+			host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+			if host == "" || port == "" {
+				r.err = errors.New("not running in a cluster, set Host and Client")
+				return
+			}
+			r.Host = "https://" + net.JoinHostPort(host, port)
+		}
+		if r.Client == nil {
+			ca, err := ioutil.ReadFile(serviceAccount + "ca.crt")
+			if err != nil {
+				r.err = fmt.Errorf("reading the cluster CA: %w", err)
+				return
+			}
+			pool := x509.NewCertPool()
+			pool.AppendCertsFromPEM(ca)
+			t := http.DefaultTransport.(*http.Transport).Clone()
+			t.TLSClientConfig = &tls.Config{RootCAs: pool}
+			r.Client = &http.Client{Transport: &tokenTransport{base: t, file: serviceAccount + "token"}}
+		}
+	})
+	return r.err
+}
+
+// acquire waits until the lease is free or expired and takes it.
+func (r *Runner) acquire(ctx context.Context) error {
+	for {
+		ok, err := r.tryAcquire(ctx)
+		if err != nil && !errors.Is(err, errConflict) {
+			r.logf("%s: acquiring the lease: %v", r.Identity, err)
+		}
+		if ok {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(r.RetryPeriod):
+		}
+	}
+}
+
+// renew keeps renewing the lease until ctx is done or a renewal doesn't
+// succeed within RenewDeadline.
+func (r *Runner) renew(ctx context.Context) {
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.RetryPeriod):
+		}
+		ok, err := r.tryAcquire(ctx)
+		switch {
+		case ok:
+			last = time.Now()
+		case err == nil:
+			r.logf("%s: the lease was taken over", r.Identity)
+			return
+		default:
+			r.logf("%s: renewing the lease: %v", r.Identity, err)
+		}
+		if time.Since(last) > r.RenewDeadline {
+			return
+		}
+	}
+}
+
+// tryAcquire takes or renews the lease if it's free, expired or held
+// already.
+func (r *Runner) tryAcquire(ctx context.Context) (bool, error) {
+	now := time.Now()
+	l, found, err := r.get(ctx)
+	if err != nil {
+		return false, err
+	}
+	if !found {
+		l = &lease{
+			APIVersion: "coordination.k8s.io/v1",
+			Kind:       "Lease",
+			Metadata:   metadata{Name: r.Name, Namespace: r.Namespace},
+		}
+	}
+
+	spec := &l.Spec
+	if spec.HolderIdentity != "" && spec.HolderIdentity != r.Identity {
+		renewed, err := time.Parse(microTime, spec.RenewTime)
+		expiry := time.Duration(spec.LeaseDurationSeconds) * time.Second
+		if err == nil && now.Before(renewed.Add(expiry)) {
+			return false, nil
+		}
+	}
+	if spec.HolderIdentity != r.Identity {
+		spec.HolderIdentity = r.Identity
+		spec.AcquireTime = now.Format(microTime)
+		spec.LeaseTransitions++
+	}
+	spec.LeaseDurationSeconds = int(r.LeaseDuration / time.Second)
+	spec.RenewTime = now.Format(microTime)
+
+	method, url := http.MethodPut, r.path(r.Name)
+	if !found {
+		method, url = http.MethodPost, r.path("")
+	}
+	if err := r.write(ctx, method, url, l); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// release gives up the lease so a follower takes over right away.
+func (r *Runner) release() error {
+	ctx, cancel := context.WithTimeout(context.Background(), r.RenewDeadline)
+	defer cancel()
+	l, found, err := r.get(ctx)
+	if err != nil || !found || l.Spec.HolderIdentity != r.Identity {
+		return err
+	}
+	l.Spec.HolderIdentity = ""
+	l.Spec.LeaseDurationSeconds = 1
+	return r.write(ctx, http.MethodPut, r.path(r.Name), l)
+}
+
+func (r *Runner) path(name string) string {
+	p := fmt.Sprintf("%s/apis/coordination.k8s.io/v1/namespaces/%s/leases", r.Host, r.Namespace)
+	if name != "" {
+		p += "/" + name
+	}
+	return p
+}
+
+func (r *Runner) get(ctx context.Context) (*lease, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.path(r.Name), nil)
+	if err != nil {
+		return nil, false, err
+	}
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return nil, false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("getting the lease: %s", resp.Status)
+	}
+	var l lease
+	if err := json.NewDecoder(resp.Body).Decode(&l); err != nil {
+		return nil, false, fmt.Errorf("decoding the lease: %w", err)
+	}
+	return &l, true, nil
+}
+
+// write creates or updates the lease, failing with errConflict if it
+// changed since it was read.
+func (r *Runner) write(ctx context.Context, method, url string, l *lease) error {
+	body, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := r.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusConflict:
+		return errConflict
+	case resp.StatusCode < 200 || resp.StatusCode >= 300:
+		return fmt.Errorf("writing the lease: %s", resp.Status)
+	}
+	return nil
+}
+
+// tokenTransport authenticates with the service account token in the
+// file, read on every request since the kubelet rotates it.
+type tokenTransport struct {
+	base http.RoundTripper
+	file string
+}
+
+func (t *tokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	token, err := ioutil.ReadFile(t.file)
+	if err != nil {
+		return nil, fmt.Errorf("reading the service account token: %w", err)
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	return t.base.RoundTrip(req)
+}
@@ -0,0 +1,267 @@
+package k8s
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"ilya.app/feedtrigger"
+	"ilya.app/feedtrigger/stores"
+)
+
+const leasePath = "/apis/coordination.k8s.io/v1/namespaces/ns/leases"
+
+// apiServer is a fake API server keeping one Lease, rejecting the writes
+// of stale versions like the real one.
+type apiServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	lease   *lease
+	version int
+	// fail makes the writes fail with the status when set.
+	fail int
+}
+
+func newAPIServer() *apiServer {
+	s := &apiServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+func (s *apiServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == leasePath+"/feedtrigger":
+		if s.lease == nil {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(s.lease)
+		return
+	case r.Method == http.MethodPost && r.URL.Path == leasePath,
+		r.Method == http.MethodPut && r.URL.Path == leasePath+"/feedtrigger":
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+		return
+	}
+	if s.fail != 0 {
+		w.WriteHeader(s.fail)
+		return
+	}
+	var l lease
+	if err := json.NewDecoder(r.Body).Decode(&l); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch {
+	case r.Method == http.MethodPost && s.lease != nil,
+		r.Method == http.MethodPut && (s.lease == nil || l.Metadata.ResourceVersion != s.lease.Metadata.ResourceVersion):
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	s.version++
+	l.Metadata.ResourceVersion = strconv.Itoa(s.version)
+	s.lease = &l
+	json.NewEncoder(w).Encode(&l)
+}
+
+// holder returns the holder of the lease.
+func (s *apiServer) holder() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.lease == nil {
+		return ""
+	}
+	return s.lease.Spec.HolderIdentity
+}
+
+func (s *apiServer) runner(identity string) *Runner {
+	return &Runner{
+		Name:          "feedtrigger",
+		Namespace:     "ns",
+		Identity:      identity,
+		LeaseDuration: time.Second,
+		RenewDeadline: 200 * time.Millisecond,
+		RetryPeriod:   10 * time.Millisecond,
+		Host:          s.URL,
+		Client:        s.Client(),
+		Logger:        log.New(ioutil.Discard, "", 0),
+	}
+}
+
+func newApp(t *testing.T) *feedtrigger.FeedAction {
+	t.Helper()
+	app, err := feedtrigger.New(feedtrigger.WithStore(&stores.MemoryStore{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.Logger = log.New(ioutil.Discard, "", 0)
+	return app
+}
+
+// waitFor waits for the lease to be held by the identity.
+func waitFor(t *testing.T, s *apiServer, identity string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for s.holder() != identity {
+		if time.Now().After(deadline) {
+			t.Fatalf("lease held by %q, want %q", s.holder(), identity)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRunnerLeads(t *testing.T) {
+	s := newAPIServer()
+	defer s.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- s.runner("a").Run(ctx, newApp(t)) }()
+	waitFor(t, s, "a")
+
+	// the lease is renewed
+	time.Sleep(50 * time.Millisecond)
+	s.mu.Lock()
+	if s.version < 2 {
+		t.Error("lease not renewed")
+	}
+	s.mu.Unlock()
+
+	cancel()
+	if err := <-done; err != nil && !errors.Is(err, context.Canceled) {
+		t.Fatalf("run: %v", err)
+	}
+	if h := s.holder(); h != "" {
+		t.Errorf("lease held by %q after the shutdown", h)
+	}
+}
+
+func TestRunnerTakesOver(t *testing.T) {
+	s := newAPIServer()
+	defer s.Close()
+	s.lease = &lease{
+		Metadata: metadata{Name: "feedtrigger", Namespace: "ns", ResourceVersion: "0"},
+		Spec: leaseSpec{
+			HolderIdentity:       "other",
+			LeaseDurationSeconds: 1,
+			RenewTime:            time.Now().Format(microTime),
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	started := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- s.runner("a").Run(ctx, newApp(t)) }()
+	waitFor(t, s, "a")
+	if d := time.Since(started); d < 500*time.Millisecond {
+		t.Errorf("lease taken over after %s before it expired", d)
+	}
+	s.mu.Lock()
+	transitions := s.lease.Spec.LeaseTransitions
+	s.mu.Unlock()
+	if transitions != 1 {
+		t.Errorf("%d lease transitions, want 1", transitions)
+	}
+	cancel()
+	<-done
+}
+
+func TestRunnerStaleWrite(t *testing.T) {
+	s := newAPIServer()
+	defer s.Close()
+	a, b := s.runner("a"), s.runner("b")
+	for _, r := range []*Runner{a, b} {
+		if err := r.init(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := context.Background()
+	if ok, err := a.tryAcquire(ctx); !ok || err != nil {
+		t.Fatalf("acquiring a free lease: %v, %v", ok, err)
+	}
+	if ok, err := b.tryAcquire(ctx); ok || err != nil {
+		t.Fatalf("acquiring a held lease: %v, %v", ok, err)
+	}
+
+	// b read the lease before a renewed it
+	l, _, err := b.get(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok, err := a.tryAcquire(ctx); !ok || err != nil {
+		t.Fatalf("renewing: %v, %v", ok, err)
+	}
+	l.Spec.HolderIdentity = "b"
+	if err := b.write(ctx, http.MethodPut, b.path(b.Name), l); !errors.Is(err, errConflict) {
+		t.Fatalf("stale write: %v, want a conflict", err)
+	}
+	if h := s.holder(); h != "a" {
+		t.Errorf("lease held by %q", h)
+	}
+}
+
+func TestRunnerLosesLeadership(t *testing.T) {
+	s := newAPIServer()
+	defer s.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- s.runner("a").Run(context.Background(), newApp(t)) }()
+	waitFor(t, s, "a")
+	s.mu.Lock()
+	s.fail = http.StatusInternalServerError
+	s.mu.Unlock()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrLostLeadership) {
+			t.Fatalf("run: %v, want ErrLostLeadership", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("still leading after the renewals failed")
+	}
+}
+
+func TestTokenRotation(t *testing.T) {
+	var got []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = append(got, r.Header.Get("Authorization"))
+	}))
+	defer srv.Close()
+	dir, err := ioutil.TempDir("", "k8s")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "token")
+	client := &http.Client{Transport: &tokenTransport{base: http.DefaultTransport, file: file}}
+
+	// the kubelet replaces the token file while the runner is running
+	for _, token := range []string{"first", "second"} {
+		if err := ioutil.WriteFile(file, []byte(token+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+	}
+	if want := []string{"Bearer first", "Bearer second"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("authorized with %v, want %v", got, want)
+	}
+}
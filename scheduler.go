@@ -0,0 +1,203 @@
+package feedtrigger
+
+import (
+	"container/heap"
+	"context"
+	"hash/fnv"
+	"time"
+)
+
+// scheduled is a feed in the poll queue.
+type scheduled struct {
+	feed Feed
+	at   time.Time
+	// index is the position in the heap the feed is in, -1 while it's
+	// polled or waits to replace the polled one.
+	index int
+	// delay overrides the refresh period for the next poll once.
+	delay time.Duration
+	// removed is set when the feed was removed while being polled.
+	removed bool
+	// replacement takes over when the feed was updated while being polled.
+	// Until then, the polled one stays the scheduled feed of the URL.
+	replacement *scheduled
+	// ready is set while the feed is due and waits for a worker.
+	ready bool
+}
+
+// pollQueue is a min-heap of feeds ordered by the next poll time.
+type pollQueue []*scheduled
+
+func (q pollQueue) Len() int           { return len(q) }
+func (q pollQueue) Less(i, j int) bool { return q[i].at.Before(q[j].at) }
+func (q pollQueue) Swap(i, j int) {
+	q[i], q[j] = q[j], q[i]
+	q[i].index = i
+	q[j].index = j
+}
+func (q *pollQueue) Push(x interface{}) {
+	s := x.(*scheduled)
+	s.index = len(*q)
+	*q = append(*q, s)
+}
+func (q *pollQueue) Pop() interface{} {
+	old := *q
+	n := len(old)
+	s := old[n-1]
+	old[n-1] = nil
+	s.index = -1
+	*q = old[:n-1]
+	return s
+}
+
+// readyQueue is a heap of due feeds ordered by the priority, then by the
+// poll time.
+type readyQueue struct{ pollQueue }
+
+func (q readyQueue) Less(i, j int) bool {
+	if pi, pj := q.pollQueue[i].feed.Priority, q.pollQueue[j].feed.Priority; pi != pj {
+		return pi > pj
+	}
+	return q.pollQueue.Less(i, j)
+}
+
+// remove takes the feed out of the heap it's in, if any.
+func remove(q *pollQueue, ready *readyQueue, s *scheduled) {
+	switch {
+	case s.index < 0:
+	case s.ready:
+		heap.Remove(ready, s.index)
+	default:
+		heap.Remove(q, s.index)
+	}
+	s.ready = false
+}
+
+// schedOp changes the set of scheduled feeds: add (or replace) a feed,
+// remove the one with the URL or poll it right away.
+type schedOp struct {
+	add    *Feed
+	remove string
+	poll   string
+}
+
+// schedule hands due feeds to the workers via jobs, the ones of the higher
+// Priority first, and puts them back into the queue when they come back via
+// done.
+func (a *FeedAction) schedule(ctx context.Context, feeds []Feed, ops <-chan schedOp, jobs chan<- *scheduled, done <-chan *scheduled) {
+	q := make(pollQueue, 0, len(feeds))
+	var ready readyQueue
+	byURL := make(map[string]*scheduled, len(feeds))
+	now := a.now()
+	for _, f := range feeds {
+		s := &scheduled{feed: f, at: a.firstPoll(f, now), index: -1}
+		heap.Push(&q, s)
+		a.scheduledAt(f.URL, s.at)
+		byURL[f.URL] = s
+	}
+
+	for {
+		var (
+			out   chan<- *scheduled
+			next  *scheduled
+			wait  <-chan time.Time
+			timer Timer
+		)
+		now := a.now()
+		for q.Len() > 0 && !q[0].at.After(now) {
+			s := heap.Pop(&q).(*scheduled)
+			s.ready = true
+			heap.Push(&ready, s)
+		}
+		if ready.Len() > 0 {
+			next, out = ready.pollQueue[0], jobs
+		} else if q.Len() > 0 {
+			timer = a.clock().NewTimer(q[0].at.Sub(now))
+			wait = timer.C()
+		}
+
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case out <- next:
+			heap.Pop(&ready)
+			next.ready = false
+		case s := <-done:
+			if s.removed {
+				break
+			}
+			if r := s.replacement; r != nil {
+				r.at = a.now().Add(r.feed.RefreshPeriod)
+				heap.Push(&q, r)
+				byURL[r.feed.URL] = r
+				a.scheduledAt(r.feed.URL, r.at)
+				break
+			}
+			if s.delay > 0 {
+				s.at = a.now().Add(s.delay)
+				s.delay = 0
+			} else {
+				s.at = s.at.Add(s.feed.RefreshPeriod)
+				if now := a.now(); s.at.Before(now) && s.feed.Priority < 0 {
+					// low priority feeds skip the polls missed under load
+					s.at = now.Add(s.feed.RefreshPeriod)
+				} else if s.at.Before(now) {
+					s.at = now
+				}
+			}
+			heap.Push(&q, s)
+			a.scheduledAt(s.feed.URL, s.at)
+		case op := <-ops:
+			if op.add != nil {
+				s := &scheduled{feed: *op.add, at: a.now().Add(op.add.InitialDelay), index: -1}
+				old, ok := byURL[op.add.URL]
+				switch {
+				case ok && old.index < 0:
+					// the polled feed is replaced once it's back, the
+					// latest update wins
+					old.replacement = s
+				case ok:
+					// keep the cadence of the feed being replaced
+					s.at = old.at
+					remove(&q, &ready, old)
+					fallthrough
+				default:
+					heap.Push(&q, s)
+					byURL[op.add.URL] = s
+					a.scheduledAt(s.feed.URL, s.at)
+				}
+			}
+			if old, ok := byURL[op.remove]; ok {
+				if old.index >= 0 {
+					remove(&q, &ready, old)
+				} else {
+					old.removed = true
+					old.replacement = nil
+				}
+				delete(byURL, op.remove)
+			}
+			if s, ok := byURL[op.poll]; ok && s.index >= 0 && !s.ready {
+				s.at = a.now()
+				heap.Fix(&q, s.index)
+				a.scheduledAt(s.feed.URL, s.at)
+			}
+		case <-wait:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+	}
+}
+
+// firstPoll returns the time of the first poll of the feed after the start.
+func (a *FeedAction) firstPoll(f Feed, now time.Time) time.Time {
+	if f.InitialDelay > 0 || !a.Stagger || f.RefreshPeriod <= 0 {
+		return now.Add(f.InitialDelay)
+	}
+	h := fnv.New64a()
+	h.Write([]byte(f.URL))
+	return now.Add(time.Duration(h.Sum64() % uint64(f.RefreshPeriod)))
+}
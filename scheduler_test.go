@@ -0,0 +1,177 @@
+package feedtrigger_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+	"ilya.app/feedtrigger/feedtriggertest"
+	"ilya.app/feedtrigger/stores"
+)
+
+var start = time.Date(2020, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// runClocked runs the application with the feed on a virtual clock. The
+// fetches are sent to the returned channel.
+func runClocked(t *testing.T, f *feedtrigger.Feed, fetch func(n int) (*gofeed.Feed, error)) (*feedtrigger.FeedAction, *feedtriggertest.Clock, <-chan time.Time) {
+	t.Helper()
+	clock := feedtriggertest.NewClock(start)
+	fetched := make(chan time.Time, 16)
+	n := 0
+	fetcher := feedtrigger.FetcherFunc(func(ctx context.Context, f feedtrigger.Feed) (*gofeed.Feed, error) {
+		n++
+		fetched <- clock.Now()
+		return fetch(n)
+	})
+	app, err := feedtrigger.New(feedtrigger.WithStore(&stores.MemoryStore{}), feedtrigger.WithFeeds(*f), feedtrigger.WithFetcher(fetcher))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.Clock = clock
+	app.Logger = log.New(ioutil.Discard, "", 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		app.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+	return app, clock, fetched
+}
+
+// nextPoll waits for the feed to be scheduled after the time and returns
+// the delay since then.
+func nextPoll(t *testing.T, app *feedtrigger.FeedAction, after time.Time) time.Duration {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if st := app.Status(); len(st) == 1 && st[0].NextPoll.After(after) {
+			return st[0].NextPoll.Sub(after)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatal("feed not scheduled")
+	return 0
+}
+
+// expectFetch waits for a fetch at the time.
+func expectFetch(t *testing.T, fetched <-chan time.Time, at time.Time) {
+	t.Helper()
+	select {
+	case got := <-fetched:
+		if !got.Equal(at) {
+			t.Fatalf("fetched at %s, want %s", got, at)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no fetch at %s", at)
+	}
+}
+
+func TestScheduleWithClock(t *testing.T) {
+	f := feedtrigger.NewFeed("http://example.com/feed.xml", func(*gofeed.Item) error { return nil })
+	f.RefreshPeriod = time.Minute
+	app, clock, fetched := runClocked(t, f, func(n int) (*gofeed.Feed, error) {
+		return &gofeed.Feed{Items: []*gofeed.Item{{GUID: fmt.Sprint(n)}}}, nil
+	})
+
+	expectFetch(t, fetched, start)
+	now := start
+	for n := 0; n < 3; n++ {
+		if d := nextPoll(t, app, now); d != time.Minute {
+			t.Fatalf("poll %d: next in %s, want a minute", n, d)
+		}
+		clock.Advance(30 * time.Second)
+		select {
+		case <-fetched:
+			t.Fatal("fetched before the refresh period")
+		case <-time.After(20 * time.Millisecond):
+		}
+		clock.Advance(30 * time.Second)
+		now = now.Add(time.Minute)
+		expectFetch(t, fetched, now)
+	}
+}
+
+func TestBlockedBackoffWithClock(t *testing.T) {
+	f := feedtrigger.NewFeed("http://example.com/feed.xml", func(*gofeed.Item) error { return nil })
+	f.RefreshPeriod = time.Minute
+	app, clock, fetched := runClocked(t, f, func(n int) (*gofeed.Feed, error) {
+		if n <= 3 {
+			return nil, fmt.Errorf("fetch %d: %w", n, feedtrigger.ErrBlocked)
+		}
+		return &gofeed.Feed{Items: []*gofeed.Item{{GUID: fmt.Sprint(n)}}}, nil
+	})
+
+	now := start
+	expectFetch(t, fetched, now)
+	// the delay doubles with every blocked poll in a row, then gets back
+	// to the refresh period
+	for _, want := range []time.Duration{2 * time.Minute, 4 * time.Minute, 8 * time.Minute, time.Minute} {
+		d := nextPoll(t, app, now)
+		if d != want {
+			t.Fatalf("next poll in %s, want %s", d, want)
+		}
+		now = now.Add(d)
+		clock.Set(now)
+		expectFetch(t, fetched, now)
+	}
+}
+
+func TestFailureBackoffWithClock(t *testing.T) {
+	f := feedtrigger.NewFeed("http://example.com/feed.xml", func(*gofeed.Item) error { return nil })
+	f.RefreshPeriod = 10 * time.Minute
+	app, clock, fetched := runClocked(t, f, func(n int) (*gofeed.Feed, error) {
+		if n <= 14 {
+			return nil, fmt.Errorf("fetch %d failed", n)
+		}
+		return &gofeed.Feed{Items: []*gofeed.Item{{GUID: fmt.Sprint(n)}}}, nil
+	})
+
+	now := start
+	expectFetch(t, fetched, now)
+	// a failing feed stays scheduled, the delay doubles up to
+	// MaxFailureBackoff and gets back to the refresh period after a success
+	want := []time.Duration{10 * time.Minute, 20 * time.Minute, 40 * time.Minute}
+	for len(want) < 14 {
+		want = append(want, feedtrigger.MaxFailureBackoff)
+	}
+	want = append(want, 10*time.Minute)
+	for n, w := range want {
+		d := nextPoll(t, app, now)
+		if d != w {
+			t.Fatalf("poll %d: next in %s, want %s", n+1, d, w)
+		}
+		if n < 14 {
+			st := app.Status()[0]
+			if st.ConsecutiveFailures != n+1 {
+				t.Fatalf("poll %d: %d consecutive failures", n+1, st.ConsecutiveFailures)
+			}
+		}
+		now = now.Add(d)
+		clock.Set(now)
+		expectFetch(t, fetched, now)
+	}
+
+	nextPoll(t, app, now)
+	errs := app.PollErrors(f.URL)
+	if len(errs) != 10 {
+		t.Fatalf("%d poll errors kept, want 10", len(errs))
+	}
+	if !strings.Contains(errs[0].Error, "fetch 14 failed") || !strings.Contains(errs[9].Error, "fetch 5 failed") {
+		t.Errorf("poll errors from %q to %q", errs[9].Error, errs[0].Error)
+	}
+	if st := app.Status()[0]; st.ConsecutiveFailures != 0 {
+		t.Errorf("%d consecutive failures after a success", st.ConsecutiveFailures)
+	}
+}
@@ -0,0 +1,83 @@
+package feedtrigger
+
+import "fmt"
+
+// HeadVersion is the schema version of the FeedHead records written by
+// this version of the package.
+const HeadVersion = 1
+
+// headMigrations upgrade a FeedHead record from the version of its index to
+// the next one.
+var headMigrations = []func(h *FeedHead){
+	// 0: records written before versioning have the current layout and
+	// are only stamped. The ones predating the seen set still only know
+	// the top item, which unseen falls back to.
+	func(h *FeedHead) {},
+}
+
+// migrate upgrades the record to HeadVersion, reporting whether it
+// changed. Records from a newer version are refused instead of being
+// misread.
+func (h *FeedHead) migrate() (bool, error) {
+	if h.Version > HeadVersion {
+		return false, fmt.Errorf("state schema version %d is newer than the supported %d", h.Version, HeadVersion)
+	}
+	migrated := false
+	for ; h.Version < HeadVersion; h.Version++ {
+		headMigrations[h.Version](h)
+		migrated = true
+	}
+	return migrated, nil
+}
+
+// loadHead reads the stored state of the feed upgrading it to the current
+// schema.
+func (a *FeedAction) loadHead(url string) (FeedHead, bool, error) {
+	var head FeedHead
+	found, err := a.feedKV(url).Get(url, &head)
+	if err != nil || !found {
+		return head, found, err
+	}
+	if _, err := head.migrate(); err != nil {
+		return head, true, fmt.Errorf("%s: %w", url, err)
+	}
+	return head, true, nil
+}
+
+// MigrateState upgrades the stored state of the feeds, all configured feeds
+// if none are given, to the current schema. It returns the URLs of the
+// upgraded records.
+func (a *FeedAction) MigrateState(urls ...string) ([]string, error) {
+	if len(urls) == 0 {
+		for _, f := range a.ListFeeds() {
+			urls = append(urls, f.URL)
+		}
+	}
+	var migrated []string
+	for _, url := range urls {
+		var head FeedHead
+		found, err := a.feedKV(url).Get(url, &head)
+		if err != nil {
+			return migrated, fmt.Errorf("get from store: %w", err)
+		}
+		if !found {
+			continue
+		}
+		changed, err := head.migrate()
+		if err != nil {
+			return migrated, fmt.Errorf("%s: %w", url, err)
+		}
+		if !changed {
+			continue
+		}
+		s := a.state(url)
+		s.headMu.Lock()
+		err = a.feedKV(url).Set(url, head)
+		s.headMu.Unlock()
+		if err != nil {
+			return migrated, fmt.Errorf("storing head: %w", err)
+		}
+		migrated = append(migrated, url)
+	}
+	return migrated, nil
+}
@@ -0,0 +1,130 @@
+package scrape
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+)
+
+// HFeed reads the microformats2 h-entry items of an h-feed page, e.g. an
+// IndieWeb blog without a feed. Use it as Feed.Source.
+type HFeed struct{}
+
+// NewHFeed returns a feed of the h-feed page at url.
+func NewHFeed(url string, action feedtrigger.NewItemAction) *feedtrigger.Feed {
+	f := feedtrigger.NewFeed(url, action)
+	f.Source = HFeed{}
+	return f
+}
+
+// Fetch implements feedtrigger.Source. The entries of the first h-feed are
+// used, all the entries of the page if it has none.
+func (HFeed) Fetch(ctx context.Context, f feedtrigger.Feed) (*gofeed.Feed, error) {
+	base, err := url.Parse(f.URL)
+	if err != nil {
+		return nil, err
+	}
+	body, err := feedtrigger.Download(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("parsing page: %w", err)
+	}
+
+	root := doc.Find(".h-feed").First()
+	feed := &gofeed.Feed{
+		Title:    text(doc.Find("title").First()),
+		Link:     f.URL,
+		FeedType: "h-feed",
+	}
+	if root.Length() == 0 {
+		root = doc.Selection
+	} else if name := property(root, "p-name"); name.Length() > 0 {
+		feed.Title = text(name)
+	}
+	root.Find(".h-entry").Each(func(_ int, sel *goquery.Selection) {
+		if item := hEntry(base, sel); item != nil {
+			feed.Items = append(feed.Items, item)
+		}
+	})
+	if len(feed.Items) == 0 {
+		return nil, fmt.Errorf("scrape: no h-entry on %s", f.URL)
+	}
+	return feed, nil
+}
+
+// hEntry converts the h-entry into an item, nil if it has no URL.
+func hEntry(base *url.URL, sel *goquery.Selection) *gofeed.Item {
+	href, ok := property(sel, "u-url").Attr("href")
+	if !ok {
+		return nil
+	}
+	u, err := base.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return nil
+	}
+	item := &gofeed.Item{
+		Link:        u.String(),
+		GUID:        u.String(),
+		Title:       text(property(sel, "p-name")),
+		Description: text(property(sel, "p-summary")),
+	}
+	if uid := property(sel, "u-uid"); uid.Length() > 0 {
+		item.GUID = strings.TrimSpace(uid.AttrOr("href", text(uid)))
+	}
+	if content := property(sel, "e-content"); content.Length() > 0 {
+		item.Content, _ = content.Html()
+		if item.Description == "" {
+			item.Description = text(content)
+		}
+	}
+	if item.Title == "" {
+		// Notes have no name, their text is the title.
+		item.Title = item.Description
+	}
+	if author := property(sel, "p-author"); author.Length() > 0 {
+		name := text(property(author, "p-name"))
+		if name == "" {
+			name = text(author)
+		}
+		item.Author = &gofeed.Person{Name: name}
+	}
+	sel.Find(".p-category").Each(func(_ int, c *goquery.Selection) {
+		item.Categories = append(item.Categories, text(c))
+	})
+	if photo := property(sel, "u-photo"); photo.Length() > 0 {
+		if src, ok := photo.Attr("src"); ok {
+			if u, err := base.Parse(strings.TrimSpace(src)); err == nil {
+				item.Image = &gofeed.Image{URL: u.String()}
+			}
+		}
+	}
+	var s Source
+	if published := property(sel, "dt-published"); published.Length() > 0 {
+		item.Published = published.AttrOr("datetime", text(published))
+		if t, ok := s.parseDate(item.Published); ok {
+			item.PublishedParsed = &t
+		}
+	}
+	if updated := property(sel, "dt-updated"); updated.Length() > 0 {
+		item.Updated = updated.AttrOr("datetime", text(updated))
+		if t, ok := s.parseDate(item.Updated); ok {
+			item.UpdatedParsed = &t
+		}
+	}
+	return item
+}
+
+// property returns the first element of the microformats class.
+func property(sel *goquery.Selection, class string) *goquery.Selection {
+	return sel.Find("." + class).First()
+}
@@ -0,0 +1,162 @@
+// Package scrape turns HTML pages without a feed into feeds of synthetic
+// items using CSS selectors.
+package scrape
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+)
+
+// dateLayouts are tried in order when Selectors.DateLayout is empty.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+	"January 2, 2006",
+	"Jan 2, 2006",
+	"2 January 2006",
+	"02 Jan 2006",
+}
+
+// Selectors locate item parts on the page. Title, Link, Date and Summary
+// are relative to the Item element.
+type Selectors struct {
+	// Item matches every entry container.
+	Item string
+	// Title is the item title element, the link text is used if empty.
+	Title string
+	// Link is the element with the href attribute, the first link of the
+	// item if empty.
+	Link string
+	// Date is the element with the datetime attribute or the date text.
+	Date string
+	// DateLayout parses the date text, common layouts are tried if empty.
+	DateLayout string
+	Summary    string
+}
+
+// Source scrapes the feed URL with the selectors. Use it as Feed.Source.
+type Source struct {
+	Selectors Selectors
+}
+
+// New returns a scraping source.
+func New(sel Selectors) *Source {
+	return &Source{Selectors: sel}
+}
+
+// NewFeed returns a feed scraping the page at url.
+func NewFeed(url string, sel Selectors, action feedtrigger.NewItemAction) *feedtrigger.Feed {
+	f := feedtrigger.NewFeed(url, action)
+	f.Source = New(sel)
+	return f
+}
+
+// Fetch implements feedtrigger.Source.
+func (s *Source) Fetch(ctx context.Context, f feedtrigger.Feed) (*gofeed.Feed, error) {
+	if s.Selectors.Item == "" {
+		return nil, errors.New("scrape: item selector is required")
+	}
+	base, err := url.Parse(f.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := feedtrigger.Download(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("parsing page: %w", err)
+	}
+
+	feed := &gofeed.Feed{
+		Title:    strings.TrimSpace(doc.Find("title").First().Text()),
+		Link:     f.URL,
+		FeedType: "html",
+	}
+	doc.Find(s.Selectors.Item).Each(func(_ int, sel *goquery.Selection) {
+		if item := s.item(base, sel); item != nil {
+			feed.Items = append(feed.Items, item)
+		}
+	})
+	if len(feed.Items) == 0 {
+		return nil, fmt.Errorf("scrape: no items match %q", s.Selectors.Item)
+	}
+	return feed, nil
+}
+
+func (s *Source) item(base *url.URL, sel *goquery.Selection) *gofeed.Item {
+	link := sel.Find("a[href]").First()
+	if s.Selectors.Link != "" {
+		link = sel.Find(s.Selectors.Link).First()
+	}
+	if sel.Is("a[href]") && link.Length() == 0 {
+		link = sel
+	}
+	href, ok := link.Attr("href")
+	if !ok {
+		return nil
+	}
+	u, err := base.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return nil
+	}
+
+	title := text(link)
+	if s.Selectors.Title != "" {
+		title = text(sel.Find(s.Selectors.Title).First())
+	}
+
+	item := &gofeed.Item{
+		Title: title,
+		Link:  u.String(),
+		GUID:  u.String(),
+	}
+	if s.Selectors.Summary != "" {
+		item.Description = text(sel.Find(s.Selectors.Summary).First())
+	}
+	if s.Selectors.Date != "" {
+		date := sel.Find(s.Selectors.Date).First()
+		raw, ok := date.Attr("datetime")
+		if !ok {
+			raw = text(date)
+		}
+		item.Published = raw
+		if t, ok := s.parseDate(raw); ok {
+			item.PublishedParsed = &t
+		}
+	}
+	return item
+}
+
+func (s *Source) parseDate(raw string) (time.Time, bool) {
+	layouts := dateLayouts
+	if s.Selectors.DateLayout != "" {
+		layouts = []string{s.Selectors.DateLayout}
+	}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, raw); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+func text(sel *goquery.Selection) string {
+	return strings.Join(strings.Fields(sel.Text()), " ")
+}
@@ -0,0 +1,168 @@
+package scrape
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger"
+)
+
+// MaxDiffLines limits the changed lines listed in the item of a Watch.
+const MaxDiffLines = 50
+
+// Watch monitors a page without a feed, e.g. a changelog or an advisory
+// page: it hashes the normalized text of the page, or of the Selector
+// region, and reports a synthetic item whenever the hash changes. Use it as
+// Feed.Source.
+//
+// The item is keyed by the hash, so a page changing back to a version
+// seen before isn't reported again.
+type Watch struct {
+	// Selector is the watched region, the whole body if empty. All the
+	// matching elements are watched.
+	Selector string
+	// Ignore matches the elements left out, e.g. counters and timestamps
+	// changing on every request.
+	Ignore string
+
+	mu   sync.Mutex
+	last map[string]snapshot
+}
+
+// snapshot is the last version of a watched page.
+type snapshot struct {
+	hash  string
+	lines []string
+	at    time.Time
+}
+
+// NewWatch returns a feed watching the region of the page at url.
+func NewWatch(url, selector string, action feedtrigger.NewItemAction) *feedtrigger.Feed {
+	f := feedtrigger.NewFeed(url, action)
+	f.Source = &Watch{Selector: selector}
+	return f
+}
+
+// Fetch implements feedtrigger.Source. The feed has a single item for the
+// current version of the page, its description listing the lines changed
+// since the previous version when the source saw it.
+func (w *Watch) Fetch(ctx context.Context, f feedtrigger.Feed) (*gofeed.Feed, error) {
+	body, err := feedtrigger.Download(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("parsing page: %w", err)
+	}
+	doc.Find("script, style, noscript, template").Remove()
+	if w.Ignore != "" {
+		doc.Find(w.Ignore).Remove()
+	}
+	region := doc.Find("body")
+	if w.Selector != "" {
+		region = doc.Find(w.Selector)
+	}
+	if region.Length() == 0 {
+		return nil, fmt.Errorf("scrape: no element matches %q", w.Selector)
+	}
+
+	lines := Lines(region)
+	sum := sha256.Sum256([]byte(strings.Join(lines, "\n")))
+	hash := hex.EncodeToString(sum[:16])
+
+	w.mu.Lock()
+	if w.last == nil {
+		w.last = make(map[string]snapshot)
+	}
+	prev, known := w.last[f.URL]
+	cur := prev
+	if !known || prev.hash != hash {
+		cur = snapshot{hash: hash, lines: lines, at: time.Now().UTC()}
+		w.last[f.URL] = cur
+	}
+	w.mu.Unlock()
+
+	title := text(doc.Find("title").First())
+	if title == "" {
+		title = f.URL
+	}
+	item := &gofeed.Item{
+		Title:           title + " changed",
+		Link:            f.URL,
+		GUID:            f.URL + "#" + hash,
+		Content:         strings.Join(lines, "\n"),
+		Published:       cur.at.Format(time.RFC3339),
+		PublishedParsed: &cur.at,
+	}
+	if known && prev.hash != hash {
+		item.Description = Diff(prev.lines, lines, MaxDiffLines)
+	}
+	return &gofeed.Feed{
+		Title:    title,
+		Link:     f.URL,
+		FeedType: "html",
+		Items:    []*gofeed.Item{item},
+	}, nil
+}
+
+// Lines returns the normalized text of the selection: its non-empty text
+// nodes with the whitespace collapsed, one per line.
+func Lines(sel *goquery.Selection) []string {
+	var lines []string
+	var walk func(*goquery.Selection)
+	walk = func(s *goquery.Selection) {
+		s.Contents().Each(func(_ int, c *goquery.Selection) {
+			if goquery.NodeName(c) != "#text" {
+				walk(c)
+				return
+			}
+			if line := text(c); line != "" {
+				lines = append(lines, line)
+			}
+		})
+	}
+	walk(sel)
+	return lines
+}
+
+// Diff lists the lines added to the new version with a "+ " prefix and the
+// ones removed from the old one with "- ", at most max of them.
+func Diff(old, cur []string, max int) string {
+	count := func(lines []string) map[string]int {
+		m := make(map[string]int, len(lines))
+		for _, l := range lines {
+			m[l]++
+		}
+		return m
+	}
+	before, after := count(old), count(cur)
+	var diff []string
+	for _, l := range cur {
+		if before[l] > 0 {
+			before[l]--
+			continue
+		}
+		diff = append(diff, "+ "+l)
+	}
+	for _, l := range old {
+		if after[l] > 0 {
+			after[l]--
+			continue
+		}
+		diff = append(diff, "- "+l)
+	}
+	if max > 0 && len(diff) > max {
+		diff = append(diff[:max], fmt.Sprintf("… %d more", len(diff)-max))
+	}
+	return strings.Join(diff, "\n")
+}
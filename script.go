@@ -0,0 +1,70 @@
+package feedtrigger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// maxScriptError bounds the standard error of a failed script quoted in
+// the error.
+const maxScriptError = 1024
+
+// Script is an action running the executable, e.g. a shell or Python
+// script, for every item. The script gets the item as JSON on the
+// standard input and the basics in the environment:
+//
+//	FEEDTRIGGER_FEED   the feed URL
+//	FEEDTRIGGER_TITLE  the item title
+//	FEEDTRIGGER_LINK   the item link
+//	FEEDTRIGGER_ID     the item ID
+//
+// The script is killed when the context is done. Exiting with a non-zero
+// status fails the delivery with the end of the standard error.
+//
+// Scripts aren't embedded, there is no Lua interpreter in feedtrigger: the
+// executable runs as a separate process with the privileges of feedtrigger
+// and no sandbox, so only trusted scripts should be configured. There are
+// no helpers either, a script keeping state between items has to store it
+// on its own.
+func Script(path string, args ...string) NewItemActionCtx {
+	return func(ctx context.Context, i *gofeed.Item) error {
+		input, err := json.Marshal(i)
+		if err != nil {
+			return err
+		}
+		feed := ItemFeed(i).URL
+		if f, ok := ContextFeed(ctx); ok {
+			feed = f.URL
+		}
+
+		cmd := exec.CommandContext(ctx, path, args...)
+		cmd.Env = append(os.Environ(),
+			"FEEDTRIGGER_FEED="+feed,
+			"FEEDTRIGGER_TITLE="+i.Title,
+			"FEEDTRIGGER_LINK="+i.Link,
+			"FEEDTRIGGER_ID="+ItemID(i),
+		)
+		cmd.Stdin = bytes.NewReader(input)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		cmd.Stdout = os.Stdout
+		if err := cmd.Run(); err != nil {
+			msg := strings.TrimSpace(stderr.String())
+			if len(msg) > maxScriptError {
+				msg = "..." + msg[len(msg)-maxScriptError:]
+			}
+			if msg != "" {
+				return fmt.Errorf("script %s: %w: %s", path, err, msg)
+			}
+			return fmt.Errorf("script %s: %w", path, err)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,209 @@
+package feedtrigger
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/mmcdole/gofeed"
+)
+
+const archiveTermPrefix = "archive/term/"
+
+// maxTermLength bounds the indexed words, longer ones are rather encoded
+// data than words anybody searches for.
+const maxTermLength = 64
+
+// termRef is an entry of the full-text index.
+type termRef struct {
+	Feed string `json:"feed"`
+	ID   string `json:"id"`
+}
+
+// terms splits the text into lowercased words, keeping identifiers like
+// CVE-2021-44228 or 10.0.0.1 whole.
+func terms(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_' && r != '.'
+	})
+	out := words[:0]
+	for _, w := range words {
+		if w = strings.Trim(w, "-_."); len(w) > 1 && len(w) <= maxTermLength {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+func itemTerms(i *gofeed.Item) map[string]bool {
+	set := make(map[string]bool)
+	for _, t := range terms(strings.Join([]string{i.Title, StripHTML(i.Description), StripHTML(i.Content)}, " ")) {
+		set[t] = true
+	}
+	return set
+}
+
+// indexTerms adds the item to the full-text index, ar.mu must be held.
+func (ar *Archive) indexTerms(feed string, i *gofeed.Item) error {
+	ref := termRef{Feed: feed, ID: ItemID(i)}
+	for t := range itemTerms(i) {
+		var refs []termRef
+		if _, err := ar.Store.Get(archiveTermPrefix+t, &refs); err != nil {
+			return fmt.Errorf("get search index: %w", err)
+		}
+		indexed := false
+		for _, r := range refs {
+			indexed = indexed || r == ref
+		}
+		if indexed {
+			continue
+		}
+		if err := ar.Store.Set(archiveTermPrefix+t, append(refs, ref)); err != nil {
+			return fmt.Errorf("storing search index: %w", err)
+		}
+	}
+	return nil
+}
+
+// unindexTerms removes the item from the full-text index, dropping the
+// words left without items, ar.mu must be held.
+func (ar *Archive) unindexTerms(feed string, i *gofeed.Item) error {
+	ref := termRef{Feed: feed, ID: ItemID(i)}
+	for t := range itemTerms(i) {
+		var refs []termRef
+		found, err := ar.Store.Get(archiveTermPrefix+t, &refs)
+		if err != nil {
+			return fmt.Errorf("get search index: %w", err)
+		}
+		if !found {
+			continue
+		}
+		kept := refs[:0]
+		for _, r := range refs {
+			if r != ref {
+				kept = append(kept, r)
+			}
+		}
+		switch {
+		case len(kept) == len(refs):
+			continue
+		case len(kept) == 0:
+			err = ar.Store.Delete(archiveTermPrefix + t)
+		default:
+			err = ar.Store.Set(archiveTermPrefix+t, kept)
+		}
+		if err != nil {
+			return fmt.Errorf("pruning search index: %w", err)
+		}
+	}
+	return nil
+}
+
+// Search returns the archived items containing all words of the query in
+// their title or text, the most recently archived first. With FullText the
+// index narrows down the candidates, otherwise the whole archive is
+// scanned.
+//
+// The search is a stopgap until the archive is indexed with bleve: it only
+// matches whole words, all of them, without stemming, ranking or phrase
+// queries. The index keeps one store key per word of the archived items,
+// words longer than 64 bytes aren't indexed and the items pruned by MaxAge
+// and MaxItems leave the index with them. The query syntax and the results
+// may change once bleve replaces it.
+func (ar *Archive) Search(query string) ([]ArchivedItem, error) {
+	words := terms(query)
+	if len(words) == 0 {
+		return nil, nil
+	}
+
+	var candidates []ArchivedItem
+	if ar.FullText {
+		refs, err := ar.lookup(words)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range refs {
+			item, found, err := ar.Get(r.Feed, r.ID)
+			if err != nil {
+				return nil, fmt.Errorf("get archived item: %w", err)
+			}
+			if found {
+				candidates = append(candidates, *item)
+			}
+		}
+	} else {
+		feeds, err := ar.Feeds()
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range feeds {
+			items, err := ar.Items(f, time.Time{})
+			if err != nil {
+				return nil, err
+			}
+			candidates = append(candidates, items...)
+		}
+	}
+
+	// the index may point at pruned or edited items, so every candidate
+	// is checked
+	var found []ArchivedItem
+	for _, c := range candidates {
+		set := itemTerms(c.Item)
+		all := true
+		for _, w := range words {
+			all = all && set[w]
+		}
+		if all {
+			found = append(found, c)
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		return found[i].ArchivedAt.After(found[j].ArchivedAt)
+	})
+	return found, nil
+}
+
+// Search looks the query up in the archive, see Archive.Search for the
+// limits of the stopgap search.
+func (a *FeedAction) Search(query string) ([]ArchivedItem, error) {
+	if a.Archive == nil {
+		return nil, errors.New("searching requires the archive")
+	}
+	if a.Archive.Store == nil {
+		a.Archive.Store = a.kv()
+	}
+	return a.Archive.Search(query)
+}
+
+// lookup intersects the index entries of the words.
+func (ar *Archive) lookup(words []string) ([]termRef, error) {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+	var result []termRef
+	for n, w := range words {
+		var refs []termRef
+		if _, err := ar.Store.Get(archiveTermPrefix+w, &refs); err != nil {
+			return nil, fmt.Errorf("get search index: %w", err)
+		}
+		if n == 0 {
+			result = refs
+			continue
+		}
+		in := make(map[termRef]bool, len(refs))
+		for _, r := range refs {
+			in[r] = true
+		}
+		kept := result[:0]
+		for _, r := range result {
+			if in[r] {
+				kept = append(kept, r)
+			}
+		}
+		result = kept
+	}
+	return result, nil
+}
@@ -0,0 +1,65 @@
+package feedtrigger
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger/stores"
+)
+
+// indexed reports whether the word has an entry in the full-text index.
+func indexed(t *testing.T, ar *Archive, word string) bool {
+	t.Helper()
+	var refs []termRef
+	found, err := ar.Store.Get(archiveTermPrefix+word, &refs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return found
+}
+
+func TestSearchIndexPruned(t *testing.T) {
+	ar := &Archive{Store: &stores.MemoryStore{}, MaxItems: 2, FullText: true}
+	const feed = "http://example.com/feed.xml"
+	for _, i := range []*gofeed.Item{
+		{GUID: "1", Title: "alpha shared"},
+		{GUID: "2", Title: "bravo shared"},
+		{GUID: "3", Title: "charlie shared " + strings.Repeat("x", maxTermLength+1)},
+	} {
+		if err := ar.Put(feed, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if indexed(t, ar, "alpha") {
+		t.Error("word of the pruned item indexed")
+	}
+	if indexed(t, ar, strings.Repeat("x", maxTermLength+1)) {
+		t.Error("long word indexed")
+	}
+	found, err := ar.Search("shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 2 {
+		t.Errorf("found %d items, want 2", len(found))
+	}
+
+	// an edited item leaves the index under its old words
+	if err := ar.Put(feed, &gofeed.Item{GUID: "3", Title: "delta shared"}); err != nil {
+		t.Fatal(err)
+	}
+	if indexed(t, ar, "charlie") || !indexed(t, ar, "delta") {
+		t.Error("edited item indexed under its old words")
+	}
+
+	if err := ar.Purge(feed); err != nil {
+		t.Fatal(err)
+	}
+	for _, w := range []string{"bravo", "delta", "shared"} {
+		if indexed(t, ar, w) {
+			t.Errorf("%q indexed after the purge", w)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package feedtrigger
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"sort"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+const (
+	// DefaultMaxSeen is the default number of item IDs remembered per feed.
+	DefaultMaxSeen = 1000
+	// DefaultSeenTTL is the default time an item ID is remembered after it
+	// disappeared from the feed.
+	DefaultSeenTTL = 30 * 24 * time.Hour
+)
+
+// ItemID returns a stable identifier of the item: GUID, link or a hash of
+// the title as a last resort.
+func ItemID(i *gofeed.Item) string {
+	if i.GUID != "" {
+		return i.GUID
+	}
+	if i.Link != "" {
+		return i.Link
+	}
+	sum := sha1.Sum([]byte(i.Title + "\x00" + i.Published))
+	return "sha1:" + hex.EncodeToString(sum[:])
+}
+
+// markSeen records all items of the feed as seen now and evicts IDs that
+// expired or don't fit into the feed limit.
+func (h *FeedHead) markSeen(f Feed, items []*gofeed.Item, now time.Time) {
+	if h.Seen == nil {
+		h.Seen = make(map[string]time.Time, len(items))
+	}
+	if f.OnUpdatedRecord != nil && h.Hashes == nil {
+		h.Hashes = make(map[string]string, len(items))
+	}
+	d := f.detector()
+	for _, i := range items {
+		h.Seen[d.Key(i)] = now
+		if h.Hashes != nil {
+			h.Hashes[d.Key(i)] = contentHash(i)
+		}
+	}
+	defer h.pruneHashes()
+
+	ttl := f.SeenTTL
+	if ttl <= 0 {
+		ttl = DefaultSeenTTL
+	}
+	for id, t := range h.Seen {
+		if now.Sub(t) > ttl {
+			delete(h.Seen, id)
+		}
+	}
+
+	max := f.MaxSeen
+	if max <= 0 {
+		max = DefaultMaxSeen
+	}
+	if max < len(items) {
+		max = len(items)
+	}
+	if len(h.Seen) <= max {
+		return
+	}
+
+	ids := make([]string, 0, len(h.Seen))
+	for id := range h.Seen {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return h.Seen[ids[i]].Before(h.Seen[ids[j]]) })
+	for _, id := range ids[:len(ids)-max] {
+		delete(h.Seen, id)
+	}
+}
+
+// pruneHashes forgets content hashes of the items no longer seen.
+func (h *FeedHead) pruneHashes() {
+	for id := range h.Hashes {
+		if _, ok := h.Seen[id]; !ok {
+			delete(h.Hashes, id)
+		}
+	}
+}
+
+// edited returns seen items whose content changed since they were seen.
+func (h *FeedHead) edited(f Feed, items []*gofeed.Item) []*gofeed.Item {
+	var changed []*gofeed.Item
+	d := f.detector()
+	for _, i := range items {
+		hash, ok := h.Hashes[d.Key(i)]
+		if ok && hash != contentHash(i) {
+			changed = append(changed, i)
+		}
+	}
+	return changed
+}
+
+// contentHash is a hash of the item fields an edit would change.
+func contentHash(i *gofeed.Item) string {
+	h := sha1.New()
+	for _, s := range []string{i.Title, i.Description, i.Content, i.Link, i.Updated} {
+		h.Write([]byte(s))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// unseen returns items missing from the seen set, keyed by the feed
+// ChangeDetector. Records written before the seen set existed only know the
+// top item, so the feed is scanned until it, unless the feed reorders its
+// items and nothing is new.
+func (h *FeedHead) unseen(f Feed, items []*gofeed.Item) []*gofeed.Item {
+	var fresh []*gofeed.Item
+	if len(h.Seen) == 0 && h.Title != "" && f.SortByPublished {
+		return nil
+	}
+	if len(h.Seen) == 0 {
+		for _, i := range items {
+			if h.Title == i.Title {
+				break
+			}
+			fresh = append(fresh, i)
+		}
+		return fresh
+	}
+
+	d := f.detector()
+	for _, i := range items {
+		if _, ok := h.Seen[d.Key(i)]; !ok {
+			fresh = append(fresh, i)
+		}
+	}
+	return fresh
+}
+
+// without returns items except the excluded ones.
+func without(items, excluded []*gofeed.Item) []*gofeed.Item {
+	skip := make(map[*gofeed.Item]bool, len(excluded))
+	for _, i := range excluded {
+		skip[i] = true
+	}
+	var out []*gofeed.Item
+	for _, i := range items {
+		if !skip[i] {
+			out = append(out, i)
+		}
+	}
+	return out
+}
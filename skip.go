@@ -0,0 +1,74 @@
+package feedtrigger
+
+import (
+	"sync"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// SkipReason tells why an item present in a feed wasn't triggered.
+type SkipReason string
+
+// Skip reasons.
+const (
+	SkipSeen     SkipReason = "seen"
+	SkipFiltered SkipReason = "filtered"
+)
+
+// Skip describes an item that wasn't acted on.
+type Skip struct {
+	Feed   string
+	Item   *gofeed.Item
+	Reason SkipReason
+	// Detail identifies the rule responsible, e.g. the filter number.
+	Detail string
+}
+
+// skipCounter counts skipped items per feed and reason.
+type skipCounter struct {
+	mu     sync.Mutex
+	counts map[string]map[SkipReason]int64
+}
+
+func (c *skipCounter) add(feed string, r SkipReason) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts == nil {
+		c.counts = make(map[string]map[SkipReason]int64)
+	}
+	if c.counts[feed] == nil {
+		c.counts[feed] = make(map[SkipReason]int64)
+	}
+	c.counts[feed][r]++
+}
+
+// skip records the item as not acted on and passes it to the OnSkip sink.
+func (a *FeedAction) skip(f Feed, i *gofeed.Item, r SkipReason, detail string) {
+	a.skips.add(f.URL, r)
+	if r != SkipSeen {
+		a.audit(f, i, AuditEntry{Status: AuditSkipped, Reason: r, Detail: detail})
+	}
+	if a.OnSkip != nil {
+		a.OnSkip(Skip{
+			Feed:   f.URL,
+			Item:   i,
+			Reason: r,
+			Detail: detail,
+		})
+	}
+}
+
+// Skipped returns the number of skipped items per feed URL and reason since
+// the start.
+func (a *FeedAction) Skipped() map[string]map[SkipReason]int64 {
+	a.skips.mu.Lock()
+	defer a.skips.mu.Unlock()
+	out := make(map[string]map[SkipReason]int64, len(a.skips.counts))
+	for feed, counts := range a.skips.counts {
+		out[feed] = make(map[SkipReason]int64, len(counts))
+		for r, n := range counts {
+			out[feed][r] = n
+		}
+	}
+	return out
+}
@@ -0,0 +1,209 @@
+// Package starred keeps per-user collections of flagged feed items and serves
+// them back as personal Atom feeds.
+package starred
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/philippgille/gokv"
+
+	"ilya.app/feedtrigger"
+)
+
+const keyPrefix = "starred/"
+
+// DefaultMaxItems is the default size of a user collection.
+const DefaultMaxItems = 500
+
+// Entry is a starred item.
+type Entry struct {
+	Item      *gofeed.Item `json:"item"`
+	StarredAt time.Time    `json:"starred_at"`
+}
+
+// Collection of starred items backed by a gokv store.
+type Collection struct {
+	Store gokv.Store
+	// MaxItems bounds the number of entries kept per user, the oldest ones
+	// are dropped first.
+	MaxItems int
+	sync.Mutex
+}
+
+// New returns a collection using the store s.
+func New(s gokv.Store) *Collection {
+	return &Collection{
+		Store:    s,
+		MaxItems: DefaultMaxItems,
+	}
+}
+
+// Star adds the item to the user collection. Starring an already starred item
+// moves it to the top.
+func (c *Collection) Star(user string, i *gofeed.Item) error {
+	c.Lock()
+	defer c.Unlock()
+
+	entries, err := c.entries(user)
+	if err != nil {
+		return err
+	}
+	entries = remove(entries, feedtrigger.ItemID(i))
+	entries = append([]Entry{{Item: i, StarredAt: time.Now().UTC()}}, entries...)
+	if c.MaxItems > 0 && len(entries) > c.MaxItems {
+		entries = entries[:c.MaxItems]
+	}
+
+	if err := c.Store.Set(keyPrefix+user, entries); err != nil {
+		return fmt.Errorf("storing starred items: %w", err)
+	}
+	return nil
+}
+
+// Unstar removes the item identified by id (GUID or link) from the user
+// collection.
+func (c *Collection) Unstar(user, id string) error {
+	c.Lock()
+	defer c.Unlock()
+
+	entries, err := c.entries(user)
+	if err != nil {
+		return err
+	}
+	if err := c.Store.Set(keyPrefix+user, remove(entries, id)); err != nil {
+		return fmt.Errorf("storing starred items: %w", err)
+	}
+	return nil
+}
+
+// Entries returns the user collection, most recently starred first.
+func (c *Collection) Entries(user string) ([]Entry, error) {
+	c.Lock()
+	defer c.Unlock()
+	return c.entries(user)
+}
+
+func (c *Collection) entries(user string) ([]Entry, error) {
+	var entries []Entry
+	_, err := c.Store.Get(keyPrefix+user, &entries)
+	if err != nil {
+		return nil, fmt.Errorf("get starred items: %w", err)
+	}
+	return entries, nil
+}
+
+// ServeHTTP serves the collection of the user named by the request path:
+// GET returns the Atom feed, POST stars the JSON encoded item from the body
+// and DELETE unstars the item passed in the id query parameter. Mount it with
+// http.StripPrefix.
+func (c *Collection) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	user := strings.TrimSuffix(strings.Trim(r.URL.Path, "/"), ".atom")
+	if user == "" || strings.Contains(user, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		entries, err := c.Entries(user)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+		if err := writeAtom(w, user, entries); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	case http.MethodPost:
+		var i gofeed.Item
+		if err := json.NewDecoder(r.Body).Decode(&i); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := c.Star(user, &i); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodDelete:
+		if err := c.Unstar(user, r.URL.Query().Get("id")); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Allow", "GET, POST, DELETE")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+func remove(entries []Entry, id string) []Entry {
+	out := entries[:0]
+	for _, e := range entries {
+		if feedtrigger.ItemID(e.Item) != id {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomEntry struct {
+	Title   string    `xml:"title"`
+	ID      string    `xml:"id"`
+	Link    atomLink  `xml:"link"`
+	Updated string    `xml:"updated"`
+	Author  *atomName `xml:"author,omitempty"`
+	Summary string    `xml:"summary,omitempty"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+}
+
+type atomName struct {
+	Name string `xml:"name"`
+}
+
+func writeAtom(w http.ResponseWriter, user string, entries []Entry) error {
+	feed := atomFeed{
+		Title:   fmt.Sprintf("Starred by %s", user),
+		ID:      "urn:feedtrigger:starred:" + user,
+		Updated: time.Now().UTC().Format(time.RFC3339),
+	}
+	if len(entries) > 0 {
+		feed.Updated = entries[0].StarredAt.Format(time.RFC3339)
+	}
+	for _, e := range entries {
+		entry := atomEntry{
+			Title:   e.Item.Title,
+			ID:      feedtrigger.ItemID(e.Item),
+			Link:    atomLink{Href: e.Item.Link},
+			Updated: e.StarredAt.Format(time.RFC3339),
+			Summary: e.Item.Description,
+		}
+		if e.Item.Author != nil && e.Item.Author.Name != "" {
+			entry.Author = &atomName{Name: e.Item.Author.Name}
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+
+	if _, err := w.Write([]byte(xml.Header)); err != nil {
+		return err
+	}
+	return xml.NewEncoder(w).Encode(feed)
+}
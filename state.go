@@ -0,0 +1,217 @@
+package feedtrigger
+
+import (
+	"sync"
+	"time"
+)
+
+// feedState is the runtime state of a feed.
+type feedState struct {
+	mu sync.Mutex
+	// statsMu serializes updates of the stored stats.
+	statsMu sync.Mutex
+	// runMu serializes the processing of the fetched and pushed documents.
+	runMu sync.Mutex
+	// headMu serializes the writes of the stored head, the feeds don't
+	// share any.
+	headMu sync.Mutex
+	// blocked is the number of polls answered with an interstitial page.
+	blocked int64
+	// blockedStreak is the number of consecutive blocked polls.
+	blockedStreak int
+	// since is when the feed started being polled.
+	since time.Time
+	// lastSuccess is the time of the last successful poll.
+	lastSuccess time.Time
+	lastPoll    time.Time
+	lastError   error
+	// failures is the number of consecutive failed polls.
+	failures int
+	// triggered is the number of items delivered since the start.
+	triggered int64
+	// next is the time of the next scheduled poll.
+	next time.Time
+	// paused feeds stay scheduled but aren't fetched.
+	paused bool
+	// moved is where the last fetch was permanently redirected to.
+	moved string
+	// requested is the delay before the next poll asked for by the last
+	// response.
+	requested time.Duration
+	// interval and lastItem are the learned publishing pace of an adaptive
+	// feed.
+	interval time.Duration
+	lastItem time.Time
+	// errors are the latest failed polls, the oldest first.
+	errors []PollError
+	// leasedBy is the instance that held the lease of the feed on the
+	// last poll, see Leases.
+	leasedBy string
+	// empty is the number of consecutive polls without items.
+	empty int
+	// cost is the resource usage charged since the last poll.
+	cost PollCost
+}
+
+// maxPollErrors bounds the error history kept per feed.
+const maxPollErrors = 10
+
+// PollError is a failed poll.
+type PollError struct {
+	Time  time.Time `json:"time"`
+	Error string    `json:"error"`
+}
+
+// state returns the runtime state of the feed with the url.
+func (a *FeedAction) state(url string) *feedState {
+	a.statesMu.Lock()
+	defer a.statesMu.Unlock()
+	if a.states == nil {
+		a.states = make(map[string]*feedState)
+	}
+	s, ok := a.states[url]
+	if !ok {
+		s = &feedState{}
+		a.states[url] = s
+	}
+	return s
+}
+
+// watch marks the feed as polled from now on.
+func (a *FeedAction) watch(url string) {
+	s := a.state(url)
+	s.mu.Lock()
+	s.since = a.now()
+	s.lastSuccess = time.Time{}
+	s.mu.Unlock()
+}
+
+// polled records the outcome of a poll of the feed.
+func (a *FeedAction) polled(info PollInfo) {
+	count(info)
+	s := a.state(info.Feed)
+	s.mu.Lock()
+	s.lastPoll = info.Start
+	s.lastError = info.Err
+	s.triggered += int64(info.Triggered)
+	if info.Err == nil {
+		s.lastSuccess = info.Start
+		s.failures = 0
+	} else {
+		s.failures++
+		s.errors = append(s.errors, PollError{Time: info.Start, Error: info.Err.Error()})
+		if len(s.errors) > maxPollErrors {
+			s.errors = s.errors[len(s.errors)-maxPollErrors:]
+		}
+	}
+	s.mu.Unlock()
+}
+
+// PollErrors returns the latest failed polls of the feed, the newest first.
+func (a *FeedAction) PollErrors(url string) []PollError {
+	url = NormalizeURL(url)
+	s := a.state(url)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]PollError, len(s.errors))
+	for n, e := range s.errors {
+		out[len(out)-1-n] = e
+	}
+	return out
+}
+
+// scheduledAt records the time of the next poll of the feed.
+func (a *FeedAction) scheduledAt(url string, at time.Time) {
+	s := a.state(url)
+	s.mu.Lock()
+	s.next = at
+	s.mu.Unlock()
+}
+
+// movedTo returns where the last fetch of the feed was permanently
+// redirected to.
+func (s *feedState) movedTo() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.moved
+}
+
+// paused reports whether polling of the feed is paused.
+func (a *FeedAction) paused(url string) bool {
+	s := a.state(url)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.paused
+}
+
+// FeedStatus is the runtime status of a feed.
+type FeedStatus struct {
+	URL           string        `json:"url"`
+	RefreshPeriod time.Duration `json:"refresh_period"`
+	Paused        bool          `json:"paused"`
+	LastPoll      time.Time     `json:"last_poll,omitempty"`
+	LastSuccess   time.Time     `json:"last_success,omitempty"`
+	LastError     string        `json:"last_error,omitempty"`
+	// ConsecutiveFailures is the number of failed polls since the last
+	// successful one.
+	ConsecutiveFailures int `json:"consecutive_failures"`
+	// Triggered is the number of items delivered since the start.
+	Triggered int64 `json:"triggered"`
+	// BlockedPolls is the number of polls answered with an HTML page.
+	BlockedPolls int64     `json:"blocked_polls"`
+	NextPoll     time.Time `json:"next_poll,omitempty"`
+	// MovedTo is where the feed URL permanently redirected on the last
+	// poll.
+	MovedTo  string            `json:"moved_to,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	// LeasedBy is the instance polling the feed instead of this one.
+	LeasedBy string `json:"leased_by,omitempty"`
+}
+
+// Status returns the status of the configured feeds.
+func (a *FeedAction) Status() []FeedStatus {
+	feeds := a.ListFeeds()
+	status := make([]FeedStatus, 0, len(feeds))
+	for _, f := range feeds {
+		s := a.state(f.URL)
+		s.mu.Lock()
+		fs := FeedStatus{
+			URL:                 f.URL,
+			RefreshPeriod:       f.RefreshPeriod,
+			Paused:              s.paused,
+			LastPoll:            s.lastPoll,
+			LastSuccess:         s.lastSuccess,
+			ConsecutiveFailures: s.failures,
+			Triggered:           s.triggered,
+			BlockedPolls:        s.blocked,
+			NextPoll:            s.next,
+			MovedTo:             s.moved,
+			Metadata:            f.Metadata,
+			Labels:              f.Labels,
+			LeasedBy:            s.leasedBy,
+		}
+		if s.lastError != nil {
+			fs.LastError = s.lastError.Error()
+		}
+		s.mu.Unlock()
+		status = append(status, fs)
+	}
+	return status
+}
+
+// BlockedPolls returns the number of polls per feed URL that were answered
+// with an HTML page instead of the feed.
+func (a *FeedAction) BlockedPolls() map[string]int64 {
+	a.statesMu.Lock()
+	defer a.statesMu.Unlock()
+	out := make(map[string]int64)
+	for url, s := range a.states {
+		s.mu.Lock()
+		if s.blocked > 0 {
+			out[url] = s.blocked
+		}
+		s.mu.Unlock()
+	}
+	return out
+}
@@ -0,0 +1,95 @@
+package feedtrigger
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger/stores"
+)
+
+// TestConcurrentPolls polls many feeds at once along with direct head writes
+// and state moves both ways, for the race detector to check the per-feed
+// locking.
+func TestConcurrentPolls(t *testing.T) {
+	const (
+		feeds   = 32
+		pollers = 4
+		polls   = 10
+	)
+	var seq, triggered int64
+	fetch := FetcherFunc(func(ctx context.Context, f Feed) (*gofeed.Feed, error) {
+		n := atomic.AddInt64(&seq, 1)
+		return &gofeed.Feed{Title: f.URL, Items: []*gofeed.Item{
+			{GUID: fmt.Sprintf("%s#%d", f.URL, n), Title: fmt.Sprint(n), Link: f.URL},
+		}}, nil
+	})
+	var ff []Feed
+	for n := 0; n < feeds; n++ {
+		ff = append(ff, *NewFeed(fmt.Sprintf("http://example.com/%d.xml", n), func(*gofeed.Item) error {
+			atomic.AddInt64(&triggered, 1)
+			return nil
+		}, WithFirstRun(FirstRunTriggerAll)))
+	}
+	app, err := New(WithStore(&stores.MemoryStore{}), WithFeeds(ff...), WithFetcher(fetch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.Logger = log.New(ioutil.Discard, "", 0)
+
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for _, f := range app.ListFeeds() {
+		for p := 0; p < pollers; p++ {
+			wg.Add(1)
+			go func(f Feed) {
+				defer wg.Done()
+				for n := 0; n < polls; n++ {
+					if err := app.poll(ctx, f); err != nil {
+						t.Errorf("polling %s: %v", f.URL, err)
+						return
+					}
+				}
+			}(f)
+		}
+		wg.Add(1)
+		go func(f Feed) {
+			defer wg.Done()
+			for n := 0; n < polls; n++ {
+				top := &gofeed.Item{GUID: fmt.Sprintf("%s#direct%d", f.URL, n)}
+				if err := app.storeHead(f, &FeedHead{}, top); err != nil {
+					t.Errorf("storing %s: %v", f.URL, err)
+					return
+				}
+			}
+		}(f)
+	}
+	for n := 0; n < feeds; n++ {
+		from, to := fmt.Sprintf("http://example.com/moved/%d", n), fmt.Sprintf("http://example.com/moved/%d", n+1)
+		for _, m := range [][2]string{{from, to}, {to, from}} {
+			wg.Add(1)
+			go func(from, to string) {
+				defer wg.Done()
+				if err := app.moveState(app.kv(), from, to); err != nil {
+					t.Errorf("moving %s: %v", from, err)
+				}
+			}(m[0], m[1])
+		}
+	}
+	wg.Wait()
+
+	for _, f := range app.ListFeeds() {
+		if _, found, err := app.Head(f.URL); err != nil || !found {
+			t.Errorf("head of %s: found %v, %v", f.URL, found, err)
+		}
+	}
+	if triggered == 0 {
+		t.Error("no item triggered")
+	}
+}
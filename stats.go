@@ -0,0 +1,66 @@
+package feedtrigger
+
+import (
+	"fmt"
+	"time"
+)
+
+const statsPrefix = "stats/"
+
+// FeedStats are the long-term counters of a feed kept in the store.
+type FeedStats struct {
+	Polls     int64 `json:"polls"`
+	Errors    int64 `json:"errors"`
+	Triggered int64 `json:"triggered"`
+	// LastPublished is the publish time of the newest triggered item.
+	LastPublished time.Time `json:"last_published,omitempty"`
+	LastError     string    `json:"last_error,omitempty"`
+	LastErrorAt   time.Time `json:"last_error_at,omitempty"`
+	// LastPoll is the start of the latest poll by any instance.
+	LastPoll time.Time `json:"last_poll,omitempty"`
+	// Cost is the resource usage of the polls, see TopCosts.
+	Cost  PollCost  `json:"cost"`
+	Since time.Time `json:"since"`
+}
+
+// Stats returns the stored counters of the feed.
+func (a *FeedAction) Stats(url string) (*FeedStats, bool, error) {
+	url = NormalizeURL(url)
+	var st FeedStats
+	found, err := a.feedKV(url).Get(statsPrefix+url, &st)
+	if err != nil {
+		return nil, false, fmt.Errorf("get stats: %w", err)
+	}
+	return &st, found, nil
+}
+
+// recordStats adds the poll to the stored counters of the feed.
+func (a *FeedAction) recordStats(info PollInfo) error {
+	s := a.state(info.Feed)
+	s.statsMu.Lock()
+	defer s.statsMu.Unlock()
+
+	st, found, err := a.Stats(info.Feed)
+	if err != nil {
+		return err
+	}
+	if !found {
+		st.Since = info.Start.UTC()
+	}
+	st.Polls++
+	st.LastPoll = info.Start.UTC()
+	st.Triggered += int64(info.Triggered)
+	st.Cost.add(info.Cost)
+	if info.LastPublished.After(st.LastPublished) {
+		st.LastPublished = info.LastPublished
+	}
+	if info.Err != nil {
+		st.Errors++
+		st.LastError = info.Err.Error()
+		st.LastErrorAt = info.Start.UTC()
+	}
+	if err := a.feedKV(info.Feed).Set(statsPrefix+info.Feed, st); err != nil {
+		return fmt.Errorf("storing stats: %w", err)
+	}
+	return nil
+}
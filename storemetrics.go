@@ -0,0 +1,70 @@
+package feedtrigger
+
+import (
+	"expvar"
+	"time"
+
+	"github.com/philippgille/gokv"
+)
+
+// DefaultSlowStoreThreshold is the duration of the store operations logged
+// as slow if FeedAction.SlowStoreThreshold is zero.
+const DefaultSlowStoreThreshold = 250 * time.Millisecond
+
+// storeVars are the store counters published under "store" of vars: the
+// calls, errors, slow calls and the total latency in nanoseconds of each
+// operation.
+var storeVars = new(expvar.Map).Init()
+
+func init() {
+	vars.Set("store", storeVars)
+}
+
+// measuredStore records the latency of the operations of the store.
+type measuredStore struct {
+	gokv.Store
+	slow time.Duration
+	logf func(format string, v ...interface{})
+}
+
+// Set implements gokv.Store.
+func (s measuredStore) Set(k string, v interface{}) error {
+	start := time.Now()
+	err := s.Store.Set(k, v)
+	s.observe("set", k, start, err)
+	return err
+}
+
+// Get implements gokv.Store.
+func (s measuredStore) Get(k string, v interface{}) (bool, error) {
+	start := time.Now()
+	found, err := s.Store.Get(k, v)
+	s.observe("get", k, start, err)
+	return found, err
+}
+
+// Delete implements gokv.Store.
+func (s measuredStore) Delete(k string) error {
+	start := time.Now()
+	err := s.Store.Delete(k)
+	s.observe("delete", k, start, err)
+	return err
+}
+
+func (s measuredStore) observe(op, k string, start time.Time, err error) {
+	d := time.Since(start)
+	m, ok := storeVars.Get(op).(*expvar.Map)
+	if !ok {
+		m = new(expvar.Map).Init()
+		storeVars.Set(op, m)
+	}
+	m.Add("calls", 1)
+	m.Add("latency_ns", int64(d))
+	if err != nil {
+		m.Add("errors", 1)
+	}
+	if s.slow > 0 && d >= s.slow {
+		m.Add("slow", 1)
+		s.logf("slow store %s of %s took %s", op, k, d)
+	}
+}
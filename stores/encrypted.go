@@ -0,0 +1,125 @@
+package stores
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/philippgille/gokv"
+)
+
+// Encrypted is a store encrypting values with AES-GCM before they reach the
+// underlying store. Keys are replaced with their HMAC, so feed URLs don't
+// leak either.
+type Encrypted struct {
+	Store gokv.Store
+
+	aead   cipher.AEAD
+	macKey []byte
+}
+
+// NewEncrypted returns the store encrypting with keys derived from the
+// 32 byte master key.
+func NewEncrypted(s gokv.Store, key []byte) (*Encrypted, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key should be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(derive(key, "feedtrigger encryption"))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Encrypted{
+		Store:  s,
+		aead:   aead,
+		macKey: derive(key, "feedtrigger keys"),
+	}, nil
+}
+
+// KeyFromEnv reads a 32 byte key encoded as hex or base64 from the
+// environment variable.
+func KeyFromEnv(name string) ([]byte, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return nil, fmt.Errorf("%s is not set", name)
+	}
+	if key, err := hex.DecodeString(v); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(v); err == nil && len(key) == 32 {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%s should be a 32 byte key in hex or base64", name)
+}
+
+// Set implements gokv.Store.
+func (e *Encrypted) Set(k string, v interface{}) error {
+	plain, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encoding %s: %w", k, err)
+	}
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	name := e.key(k)
+	sealed := e.aead.Seal(nonce, nonce, plain, []byte(name))
+	return e.Store.Set(name, sealed)
+}
+
+// Get implements gokv.Store.
+func (e *Encrypted) Get(k string, v interface{}) (bool, error) {
+	name := e.key(k)
+	var sealed []byte
+	found, err := e.Store.Get(name, &sealed)
+	if err != nil || !found {
+		return found, err
+	}
+
+	n := e.aead.NonceSize()
+	if len(sealed) < n {
+		return true, errors.New("encrypted value is too short")
+	}
+	plain, err := e.aead.Open(nil, sealed[:n], sealed[n:], []byte(name))
+	if err != nil {
+		return true, fmt.Errorf("decrypting %s: %w", k, err)
+	}
+	if err := json.Unmarshal(plain, v); err != nil {
+		return true, fmt.Errorf("decoding %s: %w", k, err)
+	}
+	return true, nil
+}
+
+// Delete implements gokv.Store.
+func (e *Encrypted) Delete(k string) error {
+	return e.Store.Delete(e.key(k))
+}
+
+// Close implements gokv.Store, closing the underlying store.
+func (e *Encrypted) Close() error {
+	return e.Store.Close()
+}
+
+func (e *Encrypted) key(k string) string {
+	m := hmac.New(sha256.New, e.macKey)
+	m.Write([]byte(k))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+func derive(key []byte, label string) []byte {
+	m := hmac.New(sha256.New, key)
+	m.Write([]byte(label))
+	return m.Sum(nil)
+}
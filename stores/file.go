@@ -0,0 +1,155 @@
+package stores
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/philippgille/gokv"
+)
+
+// FileStore keeps every value as a JSON file in the directory.
+type FileStore struct {
+	Dir string
+
+	mu sync.RWMutex
+}
+
+// NewFileStore returns a store in the directory, creating it if needed.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &FileStore{Dir: dir}, nil
+}
+
+func openFile(u *url.URL) (gokv.Store, error) {
+	p := path(u)
+	if p == "" {
+		return nil, errors.New("no directory")
+	}
+	return NewFileStore(p)
+}
+
+// Set implements gokv.Store.
+func (s *FileStore) Set(k string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encoding %s: %w", k, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write(k, b)
+}
+
+// write replaces the file of the key, mu must be held.
+func (s *FileStore) write(k string, b []byte) error {
+	tmp, err := ioutil.TempFile(s.Dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.file(k))
+}
+
+// Get implements gokv.Store.
+func (s *FileStore) Get(k string, v interface{}) (bool, error) {
+	s.mu.RLock()
+	b, err := ioutil.ReadFile(s.file(k))
+	s.mu.RUnlock()
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return true, fmt.Errorf("decoding %s: %w", k, err)
+	}
+	return true, nil
+}
+
+// Delete implements gokv.Store.
+func (s *FileStore) Delete(k string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := os.Remove(s.file(k))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// CompareAndSwap implements Swapper. The swap is atomic within the process
+// only, it doesn't guard against other processes sharing the directory.
+func (s *FileStore) CompareAndSwap(k string, old, v interface{}) (bool, error) {
+	var b []byte
+	if v != nil {
+		var err error
+		if b, err = json.Marshal(v); err != nil {
+			return false, fmt.Errorf("encoding %s: %w", k, err)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, err := ioutil.ReadFile(s.file(k))
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	if ok, err := matches(stored, old); !ok || err != nil {
+		return false, err
+	}
+	if v == nil {
+		if err := os.Remove(s.file(k)); err != nil && !os.IsNotExist(err) {
+			return false, err
+		}
+		return true, nil
+	}
+	return true, s.write(k, b)
+}
+
+// Keys implements Lister.
+func (s *FileStore) Keys() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	files, err := ioutil.ReadDir(s.Dir)
+	if err != nil {
+		return nil, err
+	}
+	var keys []string
+	for _, fi := range files {
+		name := fi.Name()
+		if fi.IsDir() || strings.HasPrefix(name, ".tmp-") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		k, err := url.PathUnescape(strings.TrimSuffix(name, ".json"))
+		if err != nil {
+			continue
+		}
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+// Close implements gokv.Store.
+func (s *FileStore) Close() error {
+	return nil
+}
+
+func (s *FileStore) file(k string) string {
+	return filepath.Join(s.Dir, url.PathEscape(k)+".json")
+}
@@ -0,0 +1,101 @@
+package stores
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"sync"
+
+	"github.com/philippgille/gokv"
+)
+
+// MemoryStore keeps JSON encoded values in memory, e.g. for tests and dry
+// runs.
+type MemoryStore struct {
+	mu sync.RWMutex
+	m  map[string][]byte
+}
+
+func openMemory(*url.URL) (gokv.Store, error) {
+	return &MemoryStore{}, nil
+}
+
+// Set implements gokv.Store.
+func (s *MemoryStore) Set(k string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encoding %s: %w", k, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.m == nil {
+		s.m = make(map[string][]byte)
+	}
+	s.m[k] = b
+	return nil
+}
+
+// Get implements gokv.Store.
+func (s *MemoryStore) Get(k string, v interface{}) (bool, error) {
+	s.mu.RLock()
+	b, ok := s.m[k]
+	s.mu.RUnlock()
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return true, fmt.Errorf("decoding %s: %w", k, err)
+	}
+	return true, nil
+}
+
+// Delete implements gokv.Store.
+func (s *MemoryStore) Delete(k string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.m, k)
+	return nil
+}
+
+// CompareAndSwap implements Swapper.
+func (s *MemoryStore) CompareAndSwap(k string, old, v interface{}) (bool, error) {
+	var b []byte
+	if v != nil {
+		var err error
+		if b, err = json.Marshal(v); err != nil {
+			return false, fmt.Errorf("encoding %s: %w", k, err)
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if ok, err := matches(s.m[k], old); !ok || err != nil {
+		return false, err
+	}
+	if v == nil {
+		delete(s.m, k)
+		return true, nil
+	}
+	if s.m == nil {
+		s.m = make(map[string][]byte)
+	}
+	s.m[k] = b
+	return true, nil
+}
+
+// Keys implements Lister.
+func (s *MemoryStore) Keys() ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]string, 0, len(s.m))
+	for k := range s.m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Close implements gokv.Store.
+func (s *MemoryStore) Close() error {
+	return nil
+}
@@ -0,0 +1,141 @@
+package stores
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/philippgille/gokv"
+)
+
+// keysSuffix is the key under the namespace listing its keys.
+const keysSuffix = "\x00keys"
+
+// Namespaced is a store prefixing every key with its namespace, so several
+// applications can share one backend. It keeps a list of its keys in the
+// underlying store to enumerate and clean them.
+type Namespaced struct {
+	Store     gokv.Store
+	Namespace string
+
+	mu   sync.Mutex
+	keys map[string]bool
+}
+
+// Namespace returns the store scoped to the namespace.
+func Namespace(s gokv.Store, namespace string) *Namespaced {
+	return &Namespaced{Store: s, Namespace: namespace}
+}
+
+// Set implements gokv.Store.
+func (n *Namespaced) Set(k string, v interface{}) error {
+	if err := n.track(k, true); err != nil {
+		return err
+	}
+	return n.Store.Set(n.key(k), v)
+}
+
+// Get implements gokv.Store.
+func (n *Namespaced) Get(k string, v interface{}) (bool, error) {
+	return n.Store.Get(n.key(k), v)
+}
+
+// Delete implements gokv.Store.
+func (n *Namespaced) Delete(k string) error {
+	if err := n.Store.Delete(n.key(k)); err != nil {
+		return err
+	}
+	return n.track(k, false)
+}
+
+// Close implements gokv.Store, closing the underlying store.
+func (n *Namespaced) Close() error {
+	return n.Store.Close()
+}
+
+// Keys returns the keys set in the namespace, without the prefix.
+func (n *Namespaced) Keys() ([]string, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.load(); err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(n.keys))
+	for k := range n.keys {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Clear deletes every key of the namespace.
+func (n *Namespaced) Clear() error {
+	keys, err := n.Keys()
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		if err := n.Delete(k); err != nil {
+			return fmt.Errorf("deleting %s: %w", k, err)
+		}
+	}
+	return n.Store.Delete(n.Namespace + keysSuffix)
+}
+
+// namespacedSwapper swaps the values of the namespace in the underlying
+// Swapper.
+type namespacedSwapper struct{ n *Namespaced }
+
+func (s namespacedSwapper) CompareAndSwap(k string, old, v interface{}) (bool, error) {
+	sw, _ := AsSwapper(s.n.Store)
+	ok, err := sw.CompareAndSwap(s.n.key(k), old, v)
+	if !ok || err != nil {
+		return ok, err
+	}
+	return true, s.n.track(k, v != nil)
+}
+
+func (n *Namespaced) key(k string) string {
+	return n.Namespace + "/" + k
+}
+
+// track adds or removes the key from the stored key list.
+func (n *Namespaced) track(k string, present bool) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if err := n.load(); err != nil {
+		return err
+	}
+	if n.keys[k] == present {
+		return nil
+	}
+	if present {
+		n.keys[k] = true
+	} else {
+		delete(n.keys, k)
+	}
+
+	keys := make([]string, 0, len(n.keys))
+	for k := range n.keys {
+		keys = append(keys, k)
+	}
+	if err := n.Store.Set(n.Namespace+keysSuffix, keys); err != nil {
+		return fmt.Errorf("storing keys of %s: %w", n.Namespace, err)
+	}
+	return nil
+}
+
+func (n *Namespaced) load() error {
+	if n.keys != nil {
+		return nil
+	}
+	var keys []string
+	if _, err := n.Store.Get(n.Namespace+keysSuffix, &keys); err != nil {
+		return fmt.Errorf("get keys of %s: %w", n.Namespace, err)
+	}
+	n.keys = make(map[string]bool, len(keys))
+	for _, k := range keys {
+		n.keys[k] = true
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+// Package stores opens gokv stores by DSN, e.g. "bolt:///var/lib/feeds.db"
+// or "file:///var/lib/feeds", so the backend can be chosen in a config file.
+//
+// Only the bolt, file and memory backends are built in. Redis, PostgreSQL,
+// DynamoDB and the other backends needing their own client libraries are
+// left out, so feedtrigger doesn't pull their dependencies into every
+// build. A program wanting one registers it with the gokv package of the
+// backend:
+//
+//	stores.Register("redis", func(dsn *url.URL) (gokv.Store, error) {
+//		return redis.NewClient(redis.Options{Address: dsn.Host})
+//	})
+package stores
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sync"
+
+	"github.com/philippgille/gokv"
+	"github.com/philippgille/gokv/bbolt"
+)
+
+// Lister is a store enumerating its keys, e.g. to find the state of the
+// feeds not configured anymore.
+type Lister interface {
+	Keys() ([]string, error)
+}
+
+// Swapper is a store replacing values atomically, e.g. for the instances
+// sharing it to claim the delivery of an item once.
+type Swapper interface {
+	// CompareAndSwap stores v under the key if it holds old, compared as
+	// JSON, or is missing if old is nil. A nil v deletes the key. It
+	// reports whether the key was changed.
+	CompareAndSwap(k string, old, v interface{}) (bool, error)
+}
+
+// AsSwapper returns the store as a Swapper if it, or the store under its
+// namespace, is one.
+func AsSwapper(s gokv.Store) (Swapper, bool) {
+	switch st := s.(type) {
+	case Swapper:
+		return st, true
+	case *Namespaced:
+		if _, ok := AsSwapper(st.Store); ok {
+			return namespacedSwapper{st}, true
+		}
+	}
+	return nil, false
+}
+
+// matches reports whether the stored JSON value, nil if missing, is old.
+func matches(stored []byte, old interface{}) (bool, error) {
+	if old == nil || stored == nil {
+		return old == nil && stored == nil, nil
+	}
+	b, err := json.Marshal(old)
+	if err != nil {
+		return false, err
+	}
+	var want, got bytes.Buffer
+	if err := json.Compact(&want, b); err != nil {
+		return false, err
+	}
+	if err := json.Compact(&got, stored); err != nil {
+		return false, err
+	}
+	return bytes.Equal(want.Bytes(), got.Bytes()), nil
+}
+
+// Opener creates a store from a parsed DSN.
+type Opener func(dsn *url.URL) (gokv.Store, error)
+
+var (
+	mu      sync.RWMutex
+	openers = map[string]Opener{
+		"bolt":   openBolt,
+		"bbolt":  openBolt,
+		"file":   openFile,
+		"memory": openMemory,
+	}
+)
+
+// external are the schemes of the known backends that aren't built in.
+var external = map[string]bool{
+	"redis":    true,
+	"postgres": true,
+	"dynamodb": true,
+}
+
+// Register makes the opener available for the DSN scheme, replacing the
+// existing one.
+func Register(scheme string, o Opener) {
+	mu.Lock()
+	defer mu.Unlock()
+	openers[scheme] = o
+}
+
+// Open returns the store described by the DSN. The "key_env" query
+// parameter names an environment variable with the key to encrypt the
+// store with, see NewEncrypted.
+func Open(dsn string) (gokv.Store, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("parsing store DSN: %w", err)
+	}
+
+	mu.RLock()
+	o, ok := openers[u.Scheme]
+	mu.RUnlock()
+	if !ok && external[u.Scheme] {
+		return nil, fmt.Errorf("the %s store isn't built in, register it with stores.Register", u.Scheme)
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown store scheme %q", u.Scheme)
+	}
+
+	s, err := o(u)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s store: %w", u.Scheme, err)
+	}
+
+	if env := u.Query().Get("key_env"); env != "" {
+		key, err := KeyFromEnv(env)
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		return NewEncrypted(s, key)
+	}
+	return s, nil
+}
+
+// path returns the filesystem path of the DSN, allowing both "file:///abs"
+// and "file://rel" forms.
+func path(u *url.URL) string {
+	if u.Opaque != "" {
+		return u.Opaque
+	}
+	return u.Host + u.Path
+}
+
+// openBolt opens a bbolt database, the bucket is set by the "bucket" query
+// parameter.
+func openBolt(u *url.URL) (gokv.Store, error) {
+	opts := bbolt.DefaultOptions
+	if p := path(u); p != "" {
+		opts.Path = p
+	}
+	if b := u.Query().Get("bucket"); b != "" {
+		opts.BucketName = b
+	}
+	return bbolt.NewStore(opts)
+}
@@ -0,0 +1,233 @@
+package feedtrigger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/philippgille/gokv"
+)
+
+// Tenant is an isolated group of feeds run within the application, e.g.
+// the feeds of one team. Its state is kept under its own store namespace
+// and it's polled by its own workers, so it can be started and stopped
+// independently of the other tenants.
+type Tenant struct {
+	Name  string
+	Feeds []Feed
+	// OnNewRecord is the action of the feeds without any.
+	OnNewRecord NewItemAction
+	// MaxConcurrentPolls and HostRateLimit limit the tenant like the
+	// FeedAction fields of the same name.
+	MaxConcurrentPolls int
+	HostRateLimit      float64
+	HostBurst          int
+	// Stopped tenants aren't started with the application.
+	Stopped bool
+
+	mu     sync.Mutex
+	app    *FeedAction
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// TenantStatus describes a tenant.
+type TenantStatus struct {
+	Name    string `json:"name"`
+	Running bool   `json:"running"`
+	Feeds   int    `json:"feeds"`
+}
+
+// sharedStore keeps a tenant from closing the store of the application.
+type sharedStore struct{ gokv.Store }
+
+func (sharedStore) Close() error { return nil }
+
+// tenantApp returns the application running the tenant feeds, which
+// inherits the settings of the parent.
+func (a *FeedAction) tenantApp(t *Tenant) *FeedAction {
+	feeds := make([]Feed, len(t.Feeds))
+	for n, f := range t.Feeds {
+		if f.OnNewRecord == nil && f.OnNewRecordCtx == nil && len(f.Actions) == 0 && f.Profile == "" {
+			f.OnNewRecord = t.OnNewRecord
+		}
+		feeds[n] = f
+	}
+	namespace := "tenant/" + t.Name
+	if a.Namespace != "" {
+		namespace = a.Namespace + "/" + namespace
+	}
+	var cluster *Cluster
+	if c := a.Cluster; c != nil {
+		cluster = &Cluster{Member: c.Member, Heartbeat: c.Heartbeat, VirtualNodes: c.VirtualNodes}
+	}
+	return &FeedAction{
+		Store:                sharedStore{a.Store},
+		Namespace:            namespace,
+		Feeds:                feeds,
+		Profiles:             a.Profiles,
+		Groups:               a.Groups,
+		HostRateLimit:        t.HostRateLimit,
+		HostBurst:            t.HostBurst,
+		MaxConcurrentPolls:   t.MaxConcurrentPolls,
+		MaxConcurrentActions: a.MaxConcurrentActions,
+		MaxConcurrentFetches: a.MaxConcurrentFetches,
+		QueueSize:            a.QueueSize,
+		Dispatchers:          a.Dispatchers,
+		ShutdownGracePeriod:  a.ShutdownGracePeriod,
+		Proxy:                a.Proxy,
+		Fetcher:              a.Fetcher,
+		Parser:               a.Parser,
+		Clock:                a.Clock,
+		SlowStoreThreshold:   a.SlowStoreThreshold,
+		Stagger:              a.Stagger,
+		Logger:               a.Logger,
+		Redactions:           a.Redactions,
+		DeadLetter:           a.DeadLetter,
+		Outbox:               a.Outbox,
+		ExactlyOnce:          a.ExactlyOnce,
+		FetchBranding:        a.FetchBranding,
+		HealthFactor:         a.HealthFactor,
+		DeleteGracePeriod:    a.DeleteGracePeriod,
+		ThrottleCooldown:     a.ThrottleCooldown,
+		OrphanRetention:      a.OrphanRetention,
+		AuditRetention:       a.AuditRetention,
+		Dedup:                a.Dedup,
+		Digests:              a.Digests,
+		Watchlist:            a.Watchlist,
+		OnWatchlistHit:       a.OnWatchlistHit,
+		DryRun:               a.DryRun,
+		Leases:               a.Leases,
+		Cluster:              cluster,
+		OnPoll:               a.OnPoll,
+		OnDelivered:          a.OnDelivered,
+		OnSkip:               a.OnSkip,
+	}
+}
+
+// Tenant returns the application running the tenant, e.g. to manage its
+// feeds or read its status, nil if there's no such tenant or it never
+// started.
+func (a *FeedAction) Tenant(name string) *FeedAction {
+	t := a.tenant(name)
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.app
+}
+
+func (a *FeedAction) tenant(name string) *Tenant {
+	for _, t := range a.Tenants {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+// StartTenant starts polling the feeds of the tenant.
+func (a *FeedAction) StartTenant(name string) error {
+	t := a.tenant(name)
+	if t == nil {
+		return fmt.Errorf("unknown tenant %q", name)
+	}
+	a.feedsMu.Lock()
+	parent, running := a.tenantsCtx, a.ops != nil
+	a.feedsMu.Unlock()
+	if !running {
+		return errors.New("the application isn't running")
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cancel != nil {
+		return nil
+	}
+	app := t.app
+	if app == nil {
+		app = a.tenantApp(t)
+		t.app = app
+	}
+	ctx, cancel := context.WithCancel(parent)
+	done := make(chan struct{})
+	t.cancel, t.done = cancel, done
+	go func() {
+		defer close(done)
+		err := app.Run(ctx)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			a.logf("tenant %s: %v", t.Name, err)
+		}
+		t.mu.Lock()
+		if t.done == done {
+			t.cancel, t.done = nil, nil
+		}
+		t.mu.Unlock()
+		cancel()
+	}()
+	return nil
+}
+
+// StopTenant stops polling the feeds of the tenant and waits for the
+// running polls.
+func (a *FeedAction) StopTenant(name string) error {
+	t := a.tenant(name)
+	if t == nil {
+		return fmt.Errorf("unknown tenant %q", name)
+	}
+	t.mu.Lock()
+	cancel, done := t.cancel, t.done
+	t.mu.Unlock()
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+	<-done
+	return nil
+}
+
+// TenantsStatus returns the state of the tenants.
+func (a *FeedAction) TenantsStatus() []TenantStatus {
+	var status []TenantStatus
+	for _, t := range a.Tenants {
+		t.mu.Lock()
+		st := TenantStatus{Name: t.Name, Running: t.cancel != nil, Feeds: len(t.Feeds)}
+		if t.app != nil {
+			st.Feeds = len(t.app.ListFeeds())
+		}
+		t.mu.Unlock()
+		status = append(status, st)
+	}
+	sort.Slice(status, func(i, j int) bool { return status[i].Name < status[j].Name })
+	return status
+}
+
+// startTenants starts the tenants not stopped in the configuration.
+func (a *FeedAction) startTenants() error {
+	seen := make(map[string]bool, len(a.Tenants))
+	for _, t := range a.Tenants {
+		if t.Name == "" || seen[t.Name] {
+			return fmt.Errorf("tenant names must be unique and not empty: %q", t.Name)
+		}
+		seen[t.Name] = true
+	}
+	for _, t := range a.Tenants {
+		if t.Stopped {
+			continue
+		}
+		if err := a.StartTenant(t.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// stopTenants stops all tenants.
+func (a *FeedAction) stopTenants() {
+	for _, t := range a.Tenants {
+		a.StopTenant(t.Name)
+	}
+}
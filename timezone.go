@@ -0,0 +1,83 @@
+package feedtrigger
+
+import (
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// location returns the timezone of the feed, UTC if it has none.
+func (f Feed) location() *time.Location {
+	if f.Location == nil {
+		return time.UTC
+	}
+	return f.Location
+}
+
+// normalizeTimes parses the item dates with the feed DateLayouts and
+// converts the parsed dates to UTC.
+func (f Feed) normalizeTimes(items []*gofeed.Item) {
+	for _, i := range items {
+		if t := parseDate(i.Published, f.DateLayouts, f.location()); t != nil {
+			i.PublishedParsed = t
+		}
+		if t := parseDate(i.Updated, f.DateLayouts, f.location()); t != nil {
+			i.UpdatedParsed = t
+		}
+		if i.PublishedParsed != nil {
+			t := i.PublishedParsed.UTC()
+			i.PublishedParsed = &t
+		}
+		if i.UpdatedParsed != nil {
+			t := i.UpdatedParsed.UTC()
+			i.UpdatedParsed = &t
+		}
+	}
+}
+
+// parseDate parses the date with the first matching layout, the ones
+// without a zone in the location. It returns nil if none matches.
+func parseDate(s string, layouts []string, loc *time.Location) *time.Time {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return nil
+	}
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return &t
+		}
+	}
+	return nil
+}
+
+// windows returns the delivery windows of the feed, the ones without a
+// Location in the feed timezone.
+func (f Feed) windows() []DeliveryWindow {
+	if f.Location == nil {
+		return f.DeliveryWindows
+	}
+	windows := make([]DeliveryWindow, len(f.DeliveryWindows))
+	for n, w := range f.DeliveryWindows {
+		if w.Location == nil {
+			w.Location = f.Location
+		}
+		windows[n] = w
+	}
+	return windows
+}
+
+// nextDigest returns the time of the digest after now: the next multiple
+// of the interval since the Unix epoch in the digest timezone.
+func (d *Digest) nextDigest(now time.Time) time.Time {
+	_, offset := now.In(d.location()).Zone()
+	shift := time.Duration(offset) * time.Second
+	return now.Add(shift).Truncate(d.interval()).Add(d.interval()).Add(-shift)
+}
+
+func (d *Digest) location() *time.Location {
+	if d.Location == nil {
+		return time.UTC
+	}
+	return d.Location
+}
@@ -0,0 +1,113 @@
+package feedtrigger
+
+import (
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// SkipTransformed is an item dropped by the feed Transform.
+const SkipTransformed SkipReason = "transformed"
+
+// Transform rewrites an item before the change detection, the filters and
+// the actions, e.g. to strip tracking parameters from the link. It gets a
+// copy of the item and returns the item to use, nil to drop it. A transform
+// failing is logged and the item is used as it is.
+type Transform func(*gofeed.Item) (*gofeed.Item, error)
+
+// ChainTransforms runs the transforms in order, stopping at the first one
+// dropping the item or failing.
+func ChainTransforms(transforms ...Transform) Transform {
+	return func(i *gofeed.Item) (*gofeed.Item, error) {
+		for _, t := range transforms {
+			var err error
+			if i, err = t(i); err != nil || i == nil {
+				return i, err
+			}
+		}
+		return i, nil
+	}
+}
+
+// StripTrackingParams removes the utm_ query parameters and the named ones,
+// e.g. "fbclid", from the item link.
+func StripTrackingParams(params ...string) Transform {
+	return func(i *gofeed.Item) (*gofeed.Item, error) {
+		if i.Link == "" {
+			return i, nil
+		}
+		u, err := url.Parse(i.Link)
+		if err != nil || u.RawQuery == "" {
+			return i, nil
+		}
+		q := u.Query()
+		for k := range q {
+			if strings.HasPrefix(k, "utm_") {
+				q.Del(k)
+			}
+		}
+		for _, k := range params {
+			q.Del(k)
+		}
+		u.RawQuery = q.Encode()
+		i.Link = u.String()
+		return i, nil
+	}
+}
+
+// TruncateContent cuts the description and the content of the item to max
+// characters, marking the cut with an ellipsis.
+func TruncateContent(max int) Transform {
+	cut := func(s string) string {
+		if utf8.RuneCountInString(s) <= max {
+			return s
+		}
+		return string([]rune(s)[:max]) + "…"
+	}
+	return func(i *gofeed.Item) (*gofeed.Item, error) {
+		i.Description = cut(i.Description)
+		i.Content = cut(i.Content)
+		return i, nil
+	}
+}
+
+// transform applies the feed Transform to the items of the document,
+// reporting whether any are left. The dropped items are recorded in the
+// head like the seen ones and aren't transformed nor reported again while
+// they stay in the document.
+func (a *FeedAction) transform(f Feed, feed *gofeed.Feed, head *FeedHead, now time.Time) bool {
+	if f.Transform == nil {
+		head.Dropped = nil
+		return true
+	}
+	d := f.detector()
+	dropped := make(map[string]time.Time)
+	items := make([]*gofeed.Item, 0, len(feed.Items))
+	for _, i := range feed.Items {
+		k := d.Key(i)
+		if at, ok := head.Dropped[k]; ok {
+			dropped[k] = at
+			continue
+		}
+		t, err := f.Transform(copyItem(i))
+		switch {
+		case err != nil:
+			a.logf("%s: transform: %s: %v", f.URL, ItemID(i), err)
+			items = append(items, i)
+		case t == nil:
+			a.skip(f, i, SkipTransformed, "")
+			dropped[k] = now
+		default:
+			items = append(items, t)
+		}
+	}
+	head.Dropped = nil
+	if len(dropped) > 0 {
+		head.Dropped = dropped
+	}
+	feed.Items = items
+	return len(items) > 0
+}
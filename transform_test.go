@@ -0,0 +1,75 @@
+package feedtrigger
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mmcdole/gofeed"
+
+	"ilya.app/feedtrigger/stores"
+)
+
+// TestTransformDropped polls a feed whose transform drops some items and
+// checks they are dropped once.
+func TestTransformDropped(t *testing.T) {
+	items := []*gofeed.Item{{GUID: "ad-1", Title: "ad"}, {GUID: "1", Title: "post"}}
+	fetch := FetcherFunc(func(ctx context.Context, f Feed) (*gofeed.Feed, error) {
+		return &gofeed.Feed{Items: items}, nil
+	})
+	var transformed, skipped, triggered []string
+	f := NewFeed("http://example.com/feed.xml", func(i *gofeed.Item) error {
+		triggered = append(triggered, i.GUID)
+		return nil
+	}, WithFirstRun(FirstRunTriggerAll))
+	f.Transform = func(i *gofeed.Item) (*gofeed.Item, error) {
+		transformed = append(transformed, i.GUID)
+		if strings.HasPrefix(i.GUID, "ad-") {
+			return nil, nil
+		}
+		return i, nil
+	}
+	app, err := New(WithStore(&stores.MemoryStore{}), WithFeeds(*f), WithFetcher(fetch))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app.Logger = log.New(ioutil.Discard, "", 0)
+	app.OnSkip = func(s Skip) {
+		if s.Reason == SkipTransformed {
+			skipped = append(skipped, s.Item.GUID)
+		}
+	}
+	feed := app.ListFeeds()[0]
+
+	poll := func() {
+		t.Helper()
+		if err := app.poll(context.Background(), feed); err != nil {
+			t.Fatal(err)
+		}
+	}
+	poll()
+	poll()
+	items = []*gofeed.Item{{GUID: "ad-2", Title: "ad"}, {GUID: "ad-1", Title: "ad"}}
+	poll()
+	poll()
+
+	if want := []string{"ad-1", "1", "1", "ad-2"}; !reflect.DeepEqual(transformed, want) {
+		t.Errorf("transformed %v, want %v", transformed, want)
+	}
+	if want := []string{"ad-1", "ad-2"}; !reflect.DeepEqual(skipped, want) {
+		t.Errorf("skipped %v, want %v", skipped, want)
+	}
+	if want := []string{"1"}; !reflect.DeepEqual(triggered, want) {
+		t.Errorf("triggered %v, want %v", triggered, want)
+	}
+	head, _, err := app.Head(feed.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(head.Dropped) != 2 || head.Title != "post" {
+		t.Errorf("head %q, dropped %v", head.Title, head.Dropped)
+	}
+}
@@ -0,0 +1,163 @@
+package feedtrigger
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// DefaultShorteners are the hosts of the common link shorteners.
+var DefaultShorteners = []string{
+	"t.co", "bit.ly", "bitly.com", "goo.gl", "tinyurl.com", "ow.ly", "buff.ly",
+	"is.gd", "lnkd.in", "dlvr.it", "fb.me", "trib.al", "rebrand.ly", "cutt.ly",
+	"shorturl.at", "tiny.cc", "rb.gy",
+}
+
+// DefaultMaxRedirects bounds the redirects between the shorteners followed
+// by an Unshortener without MaxRedirects.
+const DefaultMaxRedirects = 10
+
+// OriginalLinkKey is the custom item field the link changed by the
+// Unshortener is kept in.
+const OriginalLinkKey = "feedtrigger_original_link"
+
+const unshortenTimeout = 10 * time.Second
+
+// Unshortener resolves the shortened item links before the link check, the
+// deduplication and the actions, and canonicalizes the links: the scheme
+// and the host are lowercased, the fragment and the utm_ parameters are
+// dropped. An unresolved link is logged and kept as it is.
+type Unshortener struct {
+	// Hosts are the shortener hosts, DefaultShorteners if empty.
+	Hosts []string
+	// MaxRedirects is DefaultMaxRedirects if zero.
+	MaxRedirects int
+}
+
+// shortened reports whether the link is on a shortener host.
+func (u *Unshortener) shortened(link *url.URL) bool {
+	hosts := u.Hosts
+	if len(hosts) == 0 {
+		hosts = DefaultShorteners
+	}
+	host := strings.TrimPrefix(strings.ToLower(link.Hostname()), "www.")
+	for _, h := range hosts {
+		if host == h {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve follows the redirects of the shortened link until it leaves the
+// shortener hosts and returns the URL it points to. The destination itself
+// is never requested.
+func (u *Unshortener) Resolve(ctx context.Context, link string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, unshortenTimeout)
+	defer cancel()
+
+	max := u.MaxRedirects
+	if max <= 0 {
+		max = DefaultMaxRedirects
+	}
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	cur, err := url.Parse(link)
+	if err != nil {
+		return "", err
+	}
+	for n := 0; n < max && u.shortened(cur); n++ {
+		next, err := location(ctx, client, cur, http.MethodHead)
+		// some shorteners don't answer HEAD
+		if err != nil && !errors.Is(err, errNoRedirect) {
+			next, err = location(ctx, client, cur, http.MethodGet)
+		}
+		if err != nil {
+			return "", err
+		}
+		cur = next
+	}
+	if cur.String() == link {
+		return "", errNoRedirect
+	}
+	return cur.String(), nil
+}
+
+var errNoRedirect = errors.New("not redirected")
+
+// location returns where the response to the request of the URL
+// redirects.
+func location(ctx context.Context, client *http.Client, u *url.URL, method string) (*url.URL, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", UserAgent)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 300 || resp.StatusCode >= 400 {
+		if resp.StatusCode < 300 {
+			return nil, errNoRedirect
+		}
+		return nil, errors.New(resp.Status)
+	}
+	return resp.Location()
+}
+
+// canonicalLink lowercases the scheme and the host of the link and drops
+// the fragment and the utm_ parameters.
+func canonicalLink(u *url.URL) string {
+	c := *u
+	c.Scheme = strings.ToLower(c.Scheme)
+	c.Host = strings.ToLower(c.Host)
+	c.Fragment = ""
+	if c.RawQuery != "" {
+		q := c.Query()
+		for k := range q {
+			if strings.HasPrefix(k, "utm_") {
+				q.Del(k)
+			}
+		}
+		c.RawQuery = q.Encode()
+	}
+	return c.String()
+}
+
+// unshorten applies the feed Unshortener to the item, returning a copy if
+// the link changed.
+func (a *FeedAction) unshorten(ctx context.Context, f Feed, i *gofeed.Item) *gofeed.Item {
+	if f.Unshorten == nil || i.Link == "" {
+		return i
+	}
+	link, err := url.Parse(strings.TrimSpace(i.Link))
+	if err != nil {
+		return i
+	}
+	if f.Unshorten.shortened(link) {
+		final, err := f.Unshorten.Resolve(ctx, link.String())
+		if err != nil {
+			a.logf("%s: unshortening %s: %v", f.URL, i.Link, err)
+		} else if l, err := url.Parse(final); err == nil {
+			link = l
+		}
+	}
+	canonical := canonicalLink(link)
+	if canonical == i.Link {
+		return i
+	}
+	c := copyItem(i)
+	setCustom(c, OriginalLinkKey, i.Link)
+	c.Link = canonical
+	return c
+}
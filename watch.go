@@ -0,0 +1,54 @@
+package feedtrigger
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+)
+
+// watchBuffer is the number of deliveries a watcher may lag behind.
+const watchBuffer = 64
+
+// WatchItems returns the items delivered to the actions from now on. The
+// channel is closed once ctx is done. A watcher not keeping up misses
+// items instead of holding up the delivery.
+func (a *FeedAction) WatchItems(ctx context.Context) <-chan Delivery {
+	c := make(chan Delivery, watchBuffer)
+	unsubscribe := a.Subscribe(EventNewItem, func(e Event) {
+		d := Delivery{Feed: e.Feed, Title: e.Item.Title, Link: e.Item.Link, At: e.Time, Item: e.Item}
+		select {
+		case c <- d:
+		default:
+		}
+	})
+	go func() {
+		<-ctx.Done()
+		// no handler runs once unsubscribed
+		unsubscribe()
+		close(c)
+	}()
+	return c
+}
+
+// adminWatch streams the delivered items as JSON lines.
+func (a *FeedAction) adminWatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+	enc := json.NewEncoder(w)
+	for d := range a.WatchItems(r.Context()) {
+		if err := enc.Encode(d); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
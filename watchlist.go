@@ -0,0 +1,168 @@
+package feedtrigger
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+// Watchlist is a set of keywords matched against every new item of all
+// feeds. Hits are passed to FeedAction.OnWatchlistHit.
+type Watchlist struct {
+	// Path is the file the keywords are loaded from, one per line. Lines
+	// like /apt\d+/ are regular expressions, the other lines are matched
+	// case-insensitively as they are, empty lines and lines starting with #
+	// are ignored. The file is reloaded when it's modified.
+	Path string
+
+	mu       sync.Mutex
+	keywords []keyword
+	modTime  time.Time
+	hits     map[string]int64
+}
+
+type keyword struct {
+	name    string
+	pattern *regexp.Regexp
+}
+
+// NewWatchlist returns a watchlist of the keywords, in the format of the
+// watchlist file lines.
+func NewWatchlist(keywords ...string) (*Watchlist, error) {
+	w := &Watchlist{}
+	kk, err := parseKeywords(keywords)
+	if err != nil {
+		return nil, err
+	}
+	w.keywords = kk
+	return w, nil
+}
+
+// LoadWatchlist loads the watchlist file.
+func LoadWatchlist(path string) (*Watchlist, error) {
+	w := &Watchlist{Path: path}
+	if err := w.Reload(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// Reload reads the keywords from Path again.
+func (w *Watchlist) Reload() error {
+	st, err := os.Stat(w.Path)
+	if err != nil {
+		return fmt.Errorf("reading watchlist: %w", err)
+	}
+	b, err := ioutil.ReadFile(w.Path)
+	if err != nil {
+		return fmt.Errorf("reading watchlist: %w", err)
+	}
+	var lines []string
+	sc := bufio.NewScanner(bytes.NewReader(b))
+	for sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	kk, err := parseKeywords(lines)
+	if err != nil {
+		return fmt.Errorf("watchlist %s: %w", w.Path, err)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.keywords = kk
+	w.modTime = st.ModTime()
+	return nil
+}
+
+func parseKeywords(lines []string) ([]keyword, error) {
+	var kk []keyword
+	for _, l := range lines {
+		l = strings.TrimSpace(l)
+		if l == "" || strings.HasPrefix(l, "#") {
+			continue
+		}
+		expr := "(?i)" + regexp.QuoteMeta(l)
+		if len(l) > 2 && strings.HasPrefix(l, "/") && strings.HasSuffix(l, "/") {
+			expr = "(?i)" + l[1:len(l)-1]
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("keyword %q: %w", l, err)
+		}
+		kk = append(kk, keyword{name: l, pattern: re})
+	}
+	return kk, nil
+}
+
+// refresh reloads the file if it was modified since the last load. A file
+// that fails to load is logged with logf and the previous keywords are kept.
+func (w *Watchlist) refresh(logf func(string, ...interface{})) {
+	if w.Path == "" {
+		return
+	}
+	st, err := os.Stat(w.Path)
+	if err != nil {
+		logf("watchlist: %v", err)
+		return
+	}
+	w.mu.Lock()
+	changed := !st.ModTime().Equal(w.modTime)
+	w.mu.Unlock()
+	if !changed {
+		return
+	}
+	if err := w.Reload(); err != nil {
+		logf("watchlist: %v", err)
+	}
+}
+
+// Match returns the keywords found in the item title, text or link and
+// counts the hits.
+func (w *Watchlist) Match(i *gofeed.Item) []string {
+	text := strings.Join([]string{i.Title, i.Description, i.Content, i.Link}, "\n")
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var matched []string
+	for _, k := range w.keywords {
+		if k.pattern.MatchString(text) {
+			matched = append(matched, k.name)
+			if w.hits == nil {
+				w.hits = make(map[string]int64)
+			}
+			w.hits[k.name]++
+		}
+	}
+	return matched
+}
+
+// Hits returns the number of items matched per keyword since the start.
+func (w *Watchlist) Hits() map[string]int64 {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	out := make(map[string]int64, len(w.keywords))
+	for _, k := range w.keywords {
+		out[k.name] = w.hits[k.name]
+	}
+	return out
+}
+
+// watchlist matches the new item against the watchlist and reports the hits.
+func (a *FeedAction) watchlist(i *gofeed.Item) {
+	if a.Watchlist == nil || IsCanary(i) {
+		return
+	}
+	for _, k := range a.Watchlist.Match(i) {
+		if a.OnWatchlistHit != nil {
+			a.OnWatchlistHit(k, i)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package feedtrigger
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+)
+
+const heldPrefix = "held/"
+
+// heldInterval is how often the held items are checked for delivery.
+const heldInterval = time.Minute
+
+// DeliveryWindow is a daily period the feed actions may fire in, e.g.
+// weekdays from 08:00 to 20:00. The items detected outside of the delivery
+// windows of a feed are held and delivered in order once one opens.
+type DeliveryWindow struct {
+	// Days are the days the window opens on, every day if empty.
+	Days []time.Weekday
+	// Start and End are the offsets from midnight the window opens and
+	// closes at. A window ending before its start closes the next day,
+	// e.g. from 22:00 to 06:00.
+	Start, End time.Duration
+	// Location is the timezone of the window, UTC if nil.
+	Location *time.Location
+}
+
+// opening returns the period of the window opening on the day of t.
+func (w DeliveryWindow) opening(t time.Time) (start, end time.Time, ok bool) {
+	if len(w.Days) > 0 {
+		found := false
+		for _, d := range w.Days {
+			found = found || d == t.Weekday()
+		}
+		if !found {
+			return time.Time{}, time.Time{}, false
+		}
+	}
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	start, end = midnight.Add(w.Start), midnight.Add(w.End)
+	if w.End <= w.Start {
+		end = end.AddDate(0, 0, 1)
+	}
+	return start, end, true
+}
+
+func (w DeliveryWindow) location() *time.Location {
+	if w.Location == nil {
+		return time.UTC
+	}
+	return w.Location
+}
+
+// Open reports whether t is within the window.
+func (w DeliveryWindow) Open(t time.Time) bool {
+	t = t.In(w.location())
+	// the opening of the previous day may last past midnight
+	for _, day := range []time.Time{t.AddDate(0, 0, -1), t} {
+		start, end, ok := w.opening(day)
+		if ok && !t.Before(start) && t.Before(end) {
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns the time the window opens next at or after t, t itself if
+// it's open.
+func (w DeliveryWindow) Next(t time.Time) time.Time {
+	if w.Open(t) {
+		return t
+	}
+	local := t.In(w.location())
+	for n := 0; n <= 7; n++ {
+		start, _, ok := w.opening(local.AddDate(0, 0, n))
+		if ok && start.After(t) {
+			return start
+		}
+	}
+	return time.Time{}
+}
+
+// inWindow reports whether the feed may be delivered to at t.
+func (f Feed) inWindow(t time.Time) bool {
+	if len(f.DeliveryWindows) == 0 {
+		return true
+	}
+	for _, w := range f.windows() {
+		if w.Open(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseDeliveryWindow parses a window of the days, e.g. "mon-fri" or
+// "sat,sun", every day if empty, the clock times "08:00" and "20:00" and
+// the IANA timezone name, UTC if empty.
+func ParseDeliveryWindow(days, start, end, timezone string) (DeliveryWindow, error) {
+	var w DeliveryWindow
+	var err error
+	if w.Days, err = parseWeekdays(days); err != nil {
+		return w, err
+	}
+	if w.Start, err = parseClock(start); err != nil {
+		return w, err
+	}
+	if w.End, err = parseClock(end); err != nil {
+		return w, err
+	}
+	if timezone != "" {
+		if w.Location, err = time.LoadLocation(timezone); err != nil {
+			return w, fmt.Errorf("delivery window: %w", err)
+		}
+	}
+	return w, nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday,
+	"wed": time.Wednesday, "thu": time.Thursday, "fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+func parseWeekday(s string) (time.Weekday, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if len(s) >= 3 {
+		if d, ok := weekdays[s[:3]]; ok {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("delivery window: unknown day %q", s)
+}
+
+// parseWeekdays parses the comma-separated days and ranges of days.
+func parseWeekdays(s string) ([]time.Weekday, error) {
+	var days []time.Weekday
+	for _, part := range strings.Split(s, ",") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		bounds := strings.SplitN(part, "-", 2)
+		first, err := parseWeekday(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = parseWeekday(bounds[1]); err != nil {
+				return nil, err
+			}
+		}
+		for d := first; ; d = (d + 1) % 7 {
+			days = append(days, d)
+			if d == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// parseClock parses "15:04" as the offset from midnight.
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("delivery window: invalid time %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// held returns the items of the feed held until its delivery window opens.
+func (a *FeedAction) held(feed string) ([]*gofeed.Item, error) {
+	var items []*gofeed.Item
+	if _, err := a.feedKV(feed).Get(heldPrefix+feed, &items); err != nil {
+		return nil, fmt.Errorf("get held items: %w", err)
+	}
+	return items, nil
+}
+
+// hold keeps the item until the delivery window of the feed opens.
+func (a *FeedAction) hold(f Feed, i *gofeed.Item) error {
+	a.heldMu.Lock()
+	defer a.heldMu.Unlock()
+	items, err := a.held(f.URL)
+	if err != nil {
+		return err
+	}
+	if err := a.feedKV(f.URL).Set(heldPrefix+f.URL, append(items, i)); err != nil {
+		return fmt.Errorf("hold item: %w", err)
+	}
+	return nil
+}
+
+// holding reports whether items of the feed are held.
+func (a *FeedAction) holding(f Feed) (bool, error) {
+	if len(f.DeliveryWindows) == 0 {
+		return false, nil
+	}
+	a.heldMu.Lock()
+	defer a.heldMu.Unlock()
+	items, err := a.held(f.URL)
+	return len(items) > 0, err
+}
+
+// releaseHeld delivers the held items of the feeds whose delivery windows
+// are open every heldInterval until ctx is done.
+func (a *FeedAction) releaseHeld(ctx context.Context) {
+	t := a.clock().NewTicker(heldInterval)
+	defer t.Stop()
+	for {
+		for _, f := range a.ListFeeds() {
+			if len(f.DeliveryWindows) == 0 || !f.inWindow(a.now()) {
+				continue
+			}
+			if err := a.flushHeld(ctx, f); err != nil {
+				a.logf("%s: held items: %v", f.URL, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C():
+		}
+	}
+}
+
+// flushHeld delivers the held items of the feed in order. A failed item
+// goes to the delivery queue if there's one, otherwise it stays held with
+// the items after it.
+func (a *FeedAction) flushHeld(ctx context.Context, f Feed) error {
+	a.heldMu.Lock()
+	defer a.heldMu.Unlock()
+	items, err := a.held(f.URL)
+	if err != nil || len(items) == 0 {
+		return err
+	}
+	q := a.DeliveryQueue
+	n := 0
+	for ; n < len(items) && ctx.Err() == nil; n++ {
+		if q != nil && q.pending(f.URL) {
+			err = q.push(f.URL, items[n], nil, a.now().UTC())
+		} else if err = a.trigger(ctx, f, items[n]); err != nil && q != nil {
+			err = q.push(f.URL, items[n], err, a.now().UTC())
+		}
+		if err != nil {
+			break
+		}
+	}
+	if n == len(items) {
+		if derr := a.feedKV(f.URL).Delete(heldPrefix + f.URL); derr != nil {
+			return derr
+		}
+		return err
+	}
+	if serr := a.feedKV(f.URL).Set(heldPrefix+f.URL, items[n:]); serr != nil {
+		return serr
+	}
+	return err
+}